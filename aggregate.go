@@ -0,0 +1,157 @@
+package llmagent
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ChunkUnit is the boundary Aggregate cuts coalesced text at.
+type ChunkUnit int
+
+const (
+	ChunkAny       ChunkUnit = iota // no boundary; only Interval coalesces
+	ChunkWord                       // after whitespace
+	ChunkSentence                   // after ".", "!" or "?" and whitespace, or a newline
+	ChunkParagraph                  // after a blank line
+)
+
+// Aggregation coalesces the small deltas some providers stream, down to
+// single characters, into larger chunks before delivery.
+type Aggregation struct {
+	Unit ChunkUnit
+	// Interval, if set, delivers buffered text at most once per Interval,
+	// up to the last Unit boundary. Without it text is delivered as soon as
+	// a boundary is reached.
+	Interval time.Duration
+	// MaxBytes caps the text held back waiting for a boundary; past it the
+	// buffer is delivered as is. Defaults to 4 KiB.
+	MaxBytes int
+}
+
+// Aggregate coalesces the content deltas of ch as g describes. Events
+// other than plain content deltas are passed through unchanged, after
+// all buffered text has been delivered, so the terminal event still comes
+// last. Logprobs of coalesced deltas are concatenated onto the chunk that
+// delivers the rest of their delta's text or the next one.
+func Aggregate(ch <-chan CompletionResponse, g Aggregation) <-chan CompletionResponse {
+	return aggregate(context.Background(), ch, g, SystemClock)
+}
+
+func aggregate(ctx context.Context, ch <-chan CompletionResponse, g Aggregation, clock Clock) <-chan CompletionResponse {
+	if g.Unit == ChunkAny && g.Interval <= 0 {
+		return ch
+	}
+	max := g.MaxBytes
+	if max <= 0 {
+		max = 4 << 10
+	}
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		var (
+			pending  strings.Builder
+			head     CompletionResponse // metadata of the first buffered delta
+			logprobs []TokenLogprob
+			timer    Timer
+			tick     <-chan time.Time
+		)
+		// deliver sends the buffer up to its last boundary, or all of it.
+		deliver := func(all bool) bool {
+			s := pending.String()
+			i := len(s)
+			if !all && len(s) < max {
+				i = cutChunk(s, g.Unit)
+			}
+			if i <= 0 {
+				return true
+			}
+			chunk := head
+			chunk.Content, chunk.Logprobs = s[:i], logprobs
+			logprobs = nil
+			pending.Reset()
+			pending.WriteString(s[i:])
+			return emit(chunk)
+		}
+		stop := func() {
+			if timer != nil {
+				timer.Stop()
+				timer, tick = nil, nil
+			}
+		}
+		defer stop()
+		for {
+			select {
+			case resp, ok := <-ch:
+				if !ok {
+					deliver(true)
+					return
+				}
+				if !plainDelta(resp) {
+					stop()
+					if !deliver(true) || !emit(resp) {
+						return
+					}
+					continue
+				}
+				if pending.Len() == 0 {
+					head = resp
+				}
+				pending.WriteString(resp.Content)
+				logprobs = append(logprobs, resp.Logprobs...)
+				if g.Interval <= 0 {
+					if !deliver(false) {
+						return
+					}
+				} else if timer == nil {
+					timer = clock.NewTimer(g.Interval)
+					tick = timer.C()
+				}
+			case <-tick:
+				timer, tick = nil, nil
+				if !deliver(false) {
+					return
+				}
+				if pending.Len() > 0 {
+					timer = clock.NewTimer(g.Interval)
+					tick = timer.C()
+				}
+			}
+		}
+	})
+}
+
+// plainDelta reports whether resp carries only streamed text.
+func plainDelta(resp CompletionResponse) bool {
+	return resp.Content != "" && resp.Err == nil && !resp.Done && resp.FinishReason == "" &&
+		resp.Usage == nil && resp.Stats == nil && resp.Meta == nil &&
+		len(resp.Citations) == 0 && len(resp.ToolCalls) == 0 && len(resp.SuggestedQuestions) == 0
+}
+
+// cutChunk returns the index just past the last unit boundary in s, or 0.
+func cutChunk(s string, unit ChunkUnit) int {
+	switch unit {
+	case ChunkWord:
+		return strings.LastIndexFunc(s, unicode.IsSpace) + 1
+	case ChunkSentence:
+		for i := len(s); i > 0; {
+			r, n := utf8.DecodeLastRuneInString(s[:i])
+			i -= n
+			if r == '\n' {
+				return i + 1
+			}
+			if unicode.IsSpace(r) && i > 0 {
+				if p, _ := utf8.DecodeLastRuneInString(s[:i]); p == '.' || p == '!' || p == '?' {
+					return i + n
+				}
+			}
+		}
+		return 0
+	case ChunkParagraph:
+		if i := strings.LastIndex(s, "\n\n"); i >= 0 {
+			return i + 2
+		}
+		return 0
+	}
+	return len(s)
+}
@@ -0,0 +1,141 @@
+package llmagent
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCutChunk(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		unit ChunkUnit
+		want int
+	}{
+		{"hello wor", ChunkWord, 6},
+		{"hello", ChunkWord, 0},
+		{"One. Two", ChunkSentence, 5},
+		{"v1.2 is out", ChunkSentence, 0}, // a dot without a space
+		{"Done!\nNext", ChunkSentence, 6},
+		{"Why? Because. And", ChunkSentence, 14},
+		{"¿Qué? Sí", ChunkSentence, 8},
+		{"a\n\nb\n\nc", ChunkParagraph, 6},
+		{"a\nb", ChunkParagraph, 0},
+		{"anything", ChunkAny, 8},
+	} {
+		if got := cutChunk(tc.s, tc.unit); got != tc.want {
+			t.Errorf("cutChunk(%q, %d) = %d, want %d", tc.s, tc.unit, got, tc.want)
+		}
+	}
+}
+
+// deltas streams each string as a content delta, then a Done event.
+func deltas(ss ...string) <-chan CompletionResponse {
+	ch := make(chan CompletionResponse, len(ss)+1)
+	for _, s := range ss {
+		ch <- CompletionResponse{Content: s}
+	}
+	ch <- CompletionResponse{Done: true}
+	close(ch)
+	return ch
+}
+
+// contents collects the content of every event of ch, marking events
+// without content as "|".
+func contents(ch <-chan CompletionResponse) []string {
+	var out []string
+	for resp := range ch {
+		if resp.Content == "" {
+			resp.Content = "|"
+		}
+		out = append(out, resp.Content)
+	}
+	return out
+}
+
+func TestAggregate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		g    Aggregation
+		in   <-chan CompletionResponse
+		want []string
+	}{
+		{
+			name: "words",
+			g:    Aggregation{Unit: ChunkWord},
+			in:   deltas("he", "llo w", "or", "ld"),
+			want: []string{"hello ", "world", "|"},
+		},
+		{
+			name: "sentences",
+			g:    Aggregation{Unit: ChunkSentence},
+			in:   deltas("Hi", ". How", " are you?", " Fine"),
+			want: []string{"Hi. ", "How are you? ", "Fine", "|"},
+		},
+		{
+			name: "paragraphs",
+			g:    Aggregation{Unit: ChunkParagraph},
+			in:   deltas("a\n", "\nb", "\n", "\nc"),
+			want: []string{"a\n\n", "b\n\n", "c", "|"},
+		},
+		{
+			name: "MaxBytes delivers without a boundary",
+			g:    Aggregation{Unit: ChunkWord, MaxBytes: 4},
+			in:   deltas("ab", "cd", "ef"),
+			want: []string{"abcd", "ef", "|"},
+		},
+		{
+			name: "no unit or interval passes through",
+			g:    Aggregation{},
+			in:   deltas("a", "b"),
+			want: []string{"a", "b", "|"},
+		},
+		{
+			name: "other events flush the buffer first",
+			g:    Aggregation{Unit: ChunkSentence},
+			in: func() <-chan CompletionResponse {
+				ch := make(chan CompletionResponse, 4)
+				ch <- CompletionResponse{Content: "Let me"}
+				ch <- CompletionResponse{Content: " check", ToolCalls: []ToolCall{{ID: "1"}}}
+				ch <- CompletionResponse{Content: " it"}
+				ch <- CompletionResponse{Done: true}
+				close(ch)
+				return ch
+			}(),
+			want: []string{"Let me", " check", " it", "|"},
+		},
+	} {
+		if got := contents(Aggregate(tc.in, tc.g)); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: chunks %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAggregateInterval(t *testing.T) {
+	clock := NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	in := make(chan CompletionResponse)
+	out := aggregate(t.Context(), in, Aggregation{Unit: ChunkWord, Interval: time.Second}, clock)
+
+	in <- CompletionResponse{Content: "one "}
+	in <- CompletionResponse{Content: "tw"}
+	waitTimers(t, clock, 1)
+	select {
+	case resp := <-out:
+		t.Fatalf("delivered %q before the interval", resp.Content)
+	default:
+	}
+	clock.Advance(time.Second)
+	if resp := <-out; resp.Content != "one " {
+		t.Fatalf("first tick delivered %q", resp.Content)
+	}
+	in <- CompletionResponse{Content: "o three"}
+	waitTimers(t, clock, 1) // re-armed for the held-back text
+	clock.Advance(time.Second)
+	if resp := <-out; resp.Content != "two " {
+		t.Fatalf("second tick delivered %q", resp.Content)
+	}
+	close(in)
+	if got := contents(out); !slices.Equal(got, []string{"three"}) {
+		t.Fatalf("rest %q, want the held-back word", got)
+	}
+}
@@ -0,0 +1,71 @@
+package llmagent
+
+import (
+	"errors"
+	"sync"
+)
+
+// Alias maps a logical name such as "default-fast" to a concrete provider
+// and, optionally, a model.
+type Alias struct {
+	Provider string
+	Model    string // empty keeps the provider's default model
+}
+
+type aliasRegistry struct {
+	mu      sync.RWMutex
+	aliases map[string]Alias
+}
+
+// RegisterAlias points name at provider/model. Requests may then pass name
+// either as the provider name or as req.Model. Re-registering an alias
+// replaces its target, so models can be upgraded centrally.
+func (a *Agent) RegisterAlias(name, provider, model string) error {
+	if name == "" || provider == "" {
+		return errors.New("alias name and provider are required")
+	}
+	a.aliases.mu.Lock()
+	defer a.aliases.mu.Unlock()
+	if a.aliases.aliases == nil {
+		a.aliases.aliases = make(map[string]Alias)
+	}
+	a.aliases.aliases[name] = Alias{Provider: provider, Model: model}
+	return nil
+}
+
+// RemoveAlias deletes an alias.
+func (a *Agent) RemoveAlias(name string) {
+	a.aliases.mu.Lock()
+	defer a.aliases.mu.Unlock()
+	delete(a.aliases.aliases, name)
+}
+
+// Aliases returns a copy of the registered aliases.
+func (a *Agent) Aliases() map[string]Alias {
+	a.aliases.mu.RLock()
+	defer a.aliases.mu.RUnlock()
+	out := make(map[string]Alias, len(a.aliases.aliases))
+	for k, v := range a.aliases.aliases {
+		out[k] = v
+	}
+	return out
+}
+
+// resolveAlias rewrites providerName and req.Model when either refers to a
+// registered alias. An explicit req.Model wins over the alias model when the
+// alias is used as a provider name.
+func (a *Agent) resolveAlias(providerName string, req CompletionRequest) (string, CompletionRequest) {
+	a.aliases.mu.RLock()
+	defer a.aliases.mu.RUnlock()
+	if al, ok := a.aliases.aliases[providerName]; ok {
+		providerName = al.Provider
+		if req.Model == "" {
+			req.Model = al.Model
+		}
+	}
+	if al, ok := a.aliases.aliases[req.Model]; ok && (providerName == "" || providerName == al.Provider) {
+		providerName = al.Provider
+		req.Model = al.Model
+	}
+	return providerName, req
+}
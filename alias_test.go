@@ -0,0 +1,68 @@
+package llmagent
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResolveAlias(t *testing.T) {
+	a := NewAgent()
+	a.RegisterAlias("fast", "p", "p-mini")
+	a.RegisterAlias("smart", "q", "")
+
+	for _, tc := range []struct {
+		provider, model         string
+		wantProvider, wantModel string
+	}{
+		{"fast", "", "p", "p-mini"},
+		{"fast", "p-large", "p", "p-large"}, // an explicit model wins
+		{"", "fast", "p", "p-mini"},
+		{"p", "fast", "p", "p-mini"},
+		{"q", "fast", "q", "fast"}, // aliases another provider's model: left alone
+		{"smart", "", "q", ""},
+		{"other", "x", "other", "x"},
+	} {
+		provider, req := a.resolveAlias(tc.provider, CompletionRequest{Model: tc.model})
+		if provider != tc.wantProvider || req.Model != tc.wantModel {
+			t.Errorf("resolveAlias(%q, %q) = %q, %q; want %q, %q", tc.provider, tc.model, provider, req.Model, tc.wantProvider, tc.wantModel)
+		}
+	}
+}
+
+func TestAliasUpdatesAndRemoval(t *testing.T) {
+	var models []string
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		models = append(models, req.Model)
+		return answer("ok"), nil
+	})
+	a, _ := testAgent(t, p)
+	if err := a.RegisterAlias("", "p", "m"); err == nil {
+		t.Fatal("alias without a name registered")
+	}
+
+	send := func() error {
+		ch, err := a.Complete(context.Background(), "fast", CompletionRequest{Messages: []Message{User("hi")}})
+		if err == nil {
+			_, err = Collect(ch)
+		}
+		return err
+	}
+	a.RegisterAlias("fast", "p", "p-1")
+	if err := send(); err != nil {
+		t.Fatal(err)
+	}
+	a.RegisterAlias("fast", "p", "p-2") // upgraded centrally
+	if err := send(); err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 || models[0] != "p-1" || models[1] != "p-2" {
+		t.Fatalf("models sent = %q, want p-1 then p-2", models)
+	}
+	a.RemoveAlias("fast")
+	if _, ok := a.Aliases()["fast"]; ok {
+		t.Fatal("removed alias still listed")
+	}
+	if err := send(); err == nil {
+		t.Fatal("removed alias still routes")
+	}
+}
@@ -0,0 +1,230 @@
+package llmagent
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TenantUsage is the usage of one tenant (see WithUser) on one model and
+// tag set over a billing period.
+type TenantUsage struct {
+	Tenant   string
+	Provider string
+	Model    string
+	Tags     string // the request's tags, sorted and comma-separated
+	Requests int
+	Usage    Usage
+	Cost     float64 // USD from the model catalog; 0 for unpriced models
+	From, To time.Time
+}
+
+type usageKey struct{ tenant, provider, model, tags string }
+
+// UsageLedger aggregates token usage and cost per tenant, model and tag set
+// from every completed upstream request. Cache hits aren't billed. Set
+// Agent.Billing to start recording; periods are stamped by the agent's
+// Clock.
+type UsageLedger struct {
+	mu    sync.Mutex
+	clock Clock // the recording agent's clock; SystemClock until then
+	from  time.Time
+	usage map[usageKey]*TenantUsage
+}
+
+// NewUsageLedger starts an empty ledger. The first period starts with the
+// first recorded request.
+func NewUsageLedger() *UsageLedger {
+	return &UsageLedger{usage: make(map[usageKey]*TenantUsage)}
+}
+
+func (l *UsageLedger) record(tenant string, stats CompletionStats, clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = clock
+	if l.from.IsZero() {
+		l.from = clock.Now()
+	}
+	k := usageKey{tenant, stats.Provider, stats.Model, tagLabel(stats.Tags)}
+	u, ok := l.usage[k]
+	if !ok {
+		u = &TenantUsage{Tenant: tenant, Provider: stats.Provider, Model: stats.Model, Tags: k.tags}
+		l.usage[k] = u
+	}
+	u.Requests++
+	u.Usage.PromptTokens += stats.PromptTokens
+	u.Usage.CompletionTokens += stats.CompletionTokens
+	u.Usage.TotalTokens += stats.TotalTokens
+	if info, ok := LookupModel(stats.Model); ok {
+		u.Cost += info.Cost(stats.Usage)
+	}
+}
+
+// Snapshot returns the usage of the current period, sorted by tenant,
+// provider and model.
+func (l *UsageLedger) Snapshot() []TenantUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.snapshot(clockOr(l.clock).Now())
+}
+
+// Drain returns the usage of the current period and starts a new one, so
+// periodic exports never count a request twice.
+func (l *UsageLedger) Drain() []TenantUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := clockOr(l.clock).Now()
+	out := l.snapshot(now)
+	l.from = now
+	l.usage = make(map[usageKey]*TenantUsage)
+	return out
+}
+
+func (l *UsageLedger) snapshot(now time.Time) []TenantUsage {
+	out := make([]TenantUsage, 0, len(l.usage))
+	for _, u := range l.usage {
+		c := *u
+		c.From, c.To = l.from, now
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		return a.Tags < b.Tags
+	})
+	return out
+}
+
+// WriteBillingCSV writes one line per tenant, model and tag set, followed
+// by a total line per tenant (model "TOTAL").
+func WriteBillingCSV(w io.Writer, usage []TenantUsage) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"tenant", "provider", "model", "tags", "period_start", "period_end", "requests", "prompt_tokens", "completion_tokens", "total_tokens", "cost_usd"})
+	line := func(u TenantUsage) {
+		_ = cw.Write([]string{
+			u.Tenant, u.Provider, u.Model, u.Tags,
+			u.From.UTC().Format(time.RFC3339), u.To.UTC().Format(time.RFC3339),
+			strconv.Itoa(u.Requests),
+			strconv.Itoa(u.Usage.PromptTokens), strconv.Itoa(u.Usage.CompletionTokens), strconv.Itoa(u.Usage.TotalTokens),
+			strconv.FormatFloat(u.Cost, 'f', 6, 64),
+		})
+	}
+	var total TenantUsage
+	for i, u := range usage {
+		line(u)
+		if i == 0 || u.Tenant != total.Tenant {
+			total = TenantUsage{Tenant: u.Tenant, Model: "TOTAL", From: u.From, To: u.To}
+		}
+		total.Requests += u.Requests
+		total.Usage.PromptTokens += u.Usage.PromptTokens
+		total.Usage.CompletionTokens += u.Usage.CompletionTokens
+		total.Usage.TotalTokens += u.Usage.TotalTokens
+		total.Cost += u.Cost
+		if i == len(usage)-1 || usage[i+1].Tenant != u.Tenant {
+			line(total)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// StripeMeter pushes usage to a Stripe billing meter as meter events.
+type StripeMeter struct {
+	APIKey    string
+	EventName string // the meter's event_name
+	// Customer maps a tenant to its Stripe customer ID; tenants mapped to
+	// "" are skipped.
+	Customer func(tenant string) string
+	// Value picks what is metered; defaults to total tokens.
+	Value  func(u TenantUsage) int64
+	Client *http.Client // defaults to http.DefaultClient
+	// BaseURL defaults to https://api.stripe.com.
+	BaseURL string
+}
+
+// Push sends one meter event per tenant, summed over models. Each event
+// carries an identifier derived from tenant and period, so retrying a
+// failed push doesn't double-bill.
+func (m *StripeMeter) Push(ctx context.Context, usage []TenantUsage) error {
+	value := m.Value
+	if value == nil {
+		value = func(u TenantUsage) int64 { return int64(u.Usage.TotalTokens) }
+	}
+	type tenantTotal struct {
+		value int64
+		to    time.Time
+		from  time.Time
+	}
+	totals := map[string]*tenantTotal{}
+	var tenants []string
+	for _, u := range usage {
+		t, ok := totals[u.Tenant]
+		if !ok {
+			t = &tenantTotal{from: u.From, to: u.To}
+			totals[u.Tenant] = t
+			tenants = append(tenants, u.Tenant)
+		}
+		t.value += value(u)
+	}
+	for _, tenant := range tenants {
+		t := totals[tenant]
+		customer := m.Customer(tenant)
+		if customer == "" || t.value <= 0 {
+			continue
+		}
+		form := url.Values{
+			"event_name":                  {m.EventName},
+			"payload[stripe_customer_id]": {customer},
+			"payload[value]":              {strconv.FormatInt(t.value, 10)},
+			"timestamp":                   {strconv.FormatInt(t.to.Unix(), 10)},
+			"identifier":                  {fmt.Sprintf("%s-%d-%d", tenant, t.from.Unix(), t.to.Unix())},
+		}
+		if err := m.post(ctx, form); err != nil {
+			return fmt.Errorf("tenant %q: %w", tenant, err)
+		}
+	}
+	return nil
+}
+
+func (m *StripeMeter) post(ctx context.Context, form url.Values) error {
+	base := m.BaseURL
+	if base == "" {
+		base = "https://api.stripe.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/v1/billing/meter_events", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.APIKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ReadBody(resp.Body, 4<<10)
+		return &WireError{Message: fmt.Sprintf("stripe: %s: %s", resp.Status, body), StatusCode: resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Package bots bridges chat platforms such as Slack or Discord to agent
+// sessions. A platform client (Slack Socket Mode, the Discord gateway)
+// turns incoming events into Messages and implements Poster; Bot keeps one
+// session per channel or thread, streams each reply by editing the posted
+// message, handles the /model and /reset commands, and paces every
+// workspace through a RateLimiter.
+package bots
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Message is a user message as the platform delivered it.
+type Message struct {
+	Workspace string // Slack team or Discord guild
+	Channel   string
+	Thread    string // empty for a conversation spanning the channel
+	User      string
+	Text      string
+}
+
+// Poster posts and edits the bot's messages on the platform.
+type Poster interface {
+	// Post sends text to channel, in thread unless empty, and returns the
+	// new message's ID.
+	Post(ctx context.Context, channel, thread, text string) (id string, err error)
+	Edit(ctx context.Context, channel, id, text string) error
+}
+
+// Bot answers Messages through Agent, one session per conversation.
+type Bot struct {
+	Agent  *llmagent.Agent
+	Poster Poster
+	// System is the system prompt of new conversations.
+	System string
+	// EditEvery paces the edits of a streaming reply; defaults to 1s.
+	// The final text is always written.
+	EditEvery time.Duration
+	// Limiter, if set, takes one token per message from the bucket of its
+	// workspace and holds the message as long as told. A failing limiter
+	// doesn't hold messages.
+	Limiter llmagent.RateLimiter
+
+	mu       sync.Mutex
+	sessions map[conversation]*llmagent.Session
+}
+
+// conversation keys a session: a thread, or a whole channel.
+type conversation struct{ workspace, channel, thread string }
+
+// Handle answers m, or runs it as a command:
+//
+//	/model <provider> [model]  pins the conversation to provider/model
+//	/reset                     starts the conversation over
+func (b *Bot) Handle(ctx context.Context, m Message) error {
+	if err := b.wait(ctx, m.Workspace); err != nil {
+		return err
+	}
+	key := conversation{m.Workspace, m.Channel, m.Thread}
+	if cmd, ok := strings.CutPrefix(strings.TrimSpace(m.Text), "/"); ok {
+		return b.command(ctx, key, m, strings.Fields(cmd))
+	}
+	ch, err := b.session(key).Send(ctx, llmagent.User(m.Text))
+	if err != nil {
+		return err
+	}
+	return b.reply(ctx, m, ch)
+}
+
+func (b *Bot) command(ctx context.Context, key conversation, m Message, args []string) error {
+	var text string
+	switch {
+	case len(args) == 0:
+		text = "usage: /model <provider> [model], /reset"
+	case args[0] == "reset":
+		b.mu.Lock()
+		delete(b.sessions, key)
+		b.mu.Unlock()
+		text = "Conversation reset."
+	case args[0] == "model" && (len(args) == 2 || len(args) == 3):
+		model := ""
+		if len(args) == 3 {
+			model = args[2]
+		}
+		b.session(key).Migrate(args[1], model)
+		text = fmt.Sprintf("Using %s.", strings.Join(args[1:], " "))
+	default:
+		text = fmt.Sprintf("unknown command /%s", strings.Join(args, " "))
+	}
+	_, err := b.Poster.Post(ctx, m.Channel, m.Thread, text)
+	return err
+}
+
+// session returns the session of key, starting it on first use.
+func (b *Bot) session(key conversation) *llmagent.Session {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s, ok := b.sessions[key]; ok {
+		return s
+	}
+	if b.sessions == nil {
+		b.sessions = map[conversation]*llmagent.Session{}
+	}
+	var s *llmagent.Session
+	if b.System != "" {
+		s = b.Agent.NewSession(llmagent.System(b.System))
+	} else {
+		s = b.Agent.NewSession()
+	}
+	s.Template.Stream = llmagent.Bool(true)
+	b.sessions[key] = s
+	return s
+}
+
+// reply posts the first text of ch and edits the message with the text
+// that arrives after it at most once per EditEvery. ch is read to the end
+// even after the platform fails, so the turn is still recorded.
+func (b *Bot) reply(ctx context.Context, m Message, ch <-chan llmagent.CompletionResponse) error {
+	every := b.EditEvery
+	if every <= 0 {
+		every = time.Second
+	}
+	var (
+		text      strings.Builder
+		shown     int // bytes of text on the platform
+		id        string
+		failure   error
+		streamErr error
+		timer     llmagent.Timer
+		tick      <-chan time.Time
+	)
+	flush := func() {
+		if text.Len() == shown || failure != nil {
+			return
+		}
+		if id == "" {
+			id, failure = b.Poster.Post(ctx, m.Channel, m.Thread, text.String())
+		} else {
+			failure = b.Poster.Edit(ctx, m.Channel, id, text.String())
+		}
+		shown = text.Len()
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case resp, ok := <-ch:
+			if !ok {
+				flush()
+				if failure != nil {
+					return failure
+				}
+				return streamErr
+			}
+			if resp.Err != nil {
+				streamErr = resp.Err
+			}
+			if resp.Content == "" {
+				continue
+			}
+			text.WriteString(resp.Content)
+			if id == "" {
+				flush()
+			} else if timer == nil {
+				timer = b.clock().NewTimer(every)
+				tick = timer.C()
+			}
+		case <-tick:
+			timer, tick = nil, nil
+			flush()
+		}
+	}
+}
+
+// wait paces workspace through the Limiter, on the agent's clock.
+func (b *Bot) wait(ctx context.Context, workspace string) error {
+	if b.Limiter == nil {
+		return nil
+	}
+	d, err := b.Limiter.Take(ctx, workspace, 1)
+	if err != nil || d <= 0 {
+		return nil
+	}
+	t := b.clock().NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Bot) clock() llmagent.Clock {
+	if b.Agent.Clock != nil {
+		return b.Agent.Clock
+	}
+	return llmagent.SystemClock
+}
@@ -0,0 +1,207 @@
+package bots
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// fakeProvider answers with reply(req) in one delta, or, when words is
+// set, streams what the test sends on it until it is closed.
+type fakeProvider struct {
+	name  string
+	cfg   llmagent.ProviderConfig
+	reply func(req llmagent.CompletionRequest) string
+	words chan string
+}
+
+func (p *fakeProvider) Name() string                        { return p.name }
+func (p *fakeProvider) GetConfig() *llmagent.ProviderConfig { return &p.cfg }
+
+func (p *fakeProvider) Complete(ctx context.Context, req llmagent.CompletionRequest) (<-chan llmagent.CompletionResponse, error) {
+	ch := make(chan llmagent.CompletionResponse)
+	go func() {
+		defer close(ch)
+		if p.words == nil {
+			ch <- llmagent.CompletionResponse{Content: p.reply(req)}
+		} else {
+			for w := range p.words {
+				ch <- llmagent.CompletionResponse{Content: w}
+			}
+		}
+		ch <- llmagent.CompletionResponse{Done: true, FinishReason: llmagent.FinishStop}
+	}()
+	return ch, nil
+}
+
+// fakePoster records every post and edit, in order.
+type fakePoster struct {
+	mu  sync.Mutex
+	log []string // "post c/t: text" or "edit c/id: text"
+}
+
+func (p *fakePoster) Post(ctx context.Context, channel, thread, text string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = append(p.log, fmt.Sprintf("post %s/%s: %s", channel, thread, text))
+	return fmt.Sprint(len(p.log)), nil
+}
+
+func (p *fakePoster) Edit(ctx context.Context, channel, id, text string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = append(p.log, fmt.Sprintf("edit %s/%s: %s", channel, id, text))
+	return nil
+}
+
+func (p *fakePoster) seen() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.log)
+}
+
+// testBot answers with the number of user messages in the conversation
+// and the model that answered, or streams words if not nil.
+func testBot(t *testing.T, words chan string, names ...string) (*Bot, *fakePoster, *llmagent.FakeClock) {
+	t.Helper()
+	clock := llmagent.NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	a := llmagent.NewAgent()
+	a.Clock = clock
+	for _, name := range names {
+		p := &fakeProvider{name: name, words: words, cfg: llmagent.ProviderConfig{DefaultModel: name + "-default"}}
+		p.reply = func(req llmagent.CompletionRequest) string {
+			n := 0
+			for _, m := range req.Messages {
+				if m.Role == llmagent.RoleUser {
+					n++
+				}
+			}
+			model := req.Model
+			if model == "" {
+				model = p.cfg.DefaultModel
+			}
+			return fmt.Sprintf("turn %d from %s", n, model)
+		}
+		if err := a.RegisterProvidersFromUser(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.SetDefault(names[0]); err != nil {
+		t.Fatal(err)
+	}
+	poster := &fakePoster{}
+	return &Bot{Agent: a, Poster: poster}, poster, clock
+}
+
+func TestConversations(t *testing.T) {
+	b, poster, _ := testBot(t, nil, "p", "q")
+	for _, m := range []Message{
+		{Workspace: "w", Channel: "c", Thread: "t1", Text: "hi"},
+		{Workspace: "w", Channel: "c", Thread: "t1", Text: "again"},
+		{Workspace: "w", Channel: "c", Thread: "t2", Text: "hi"},
+		{Workspace: "w", Channel: "c", Text: "channel-wide"},
+		{Workspace: "w", Channel: "c", Thread: "t2", Text: "/model q q-large"},
+		{Workspace: "w", Channel: "c", Thread: "t2", Text: "and now?"},
+		{Workspace: "w", Channel: "c", Thread: "t1", Text: "/reset"},
+		{Workspace: "w", Channel: "c", Thread: "t1", Text: "fresh"},
+		{Workspace: "w", Channel: "c", Text: "/shout"},
+		{Workspace: "other", Channel: "c", Thread: "t1", Text: "same ids"},
+	} {
+		if err := b.Handle(context.Background(), m); err != nil {
+			t.Fatalf("%q: %v", m.Text, err)
+		}
+	}
+	want := []string{
+		"post c/t1: turn 1 from p-default",
+		"post c/t1: turn 2 from p-default",
+		"post c/t2: turn 1 from p-default",
+		"post c/: turn 1 from p-default",
+		"post c/t2: Using q q-large.",
+		"post c/t2: turn 2 from q-large",
+		"post c/t1: Conversation reset.",
+		"post c/t1: turn 1 from p-default",
+		"post c/: unknown command /shout",
+		"post c/t1: turn 1 from p-default",
+	}
+	if got := poster.seen(); !slices.Equal(got, want) {
+		t.Fatalf("platform saw\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStreamingEdits(t *testing.T) {
+	words := make(chan string)
+	b, poster, clock := testBot(t, words, "p")
+	done := make(chan error, 1)
+	go func() { done <- b.Handle(context.Background(), Message{Channel: "c", Text: "hi"}) }()
+
+	wait := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for len(poster.seen()) < n && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	words <- "turn "
+	wait(1) // the first text is posted at once
+	words <- "1 "
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := poster.seen(); len(got) != 1 {
+		t.Fatalf("edited before EditEvery: %q", got)
+	}
+	clock.Advance(time.Second)
+	wait(2)
+	words <- "from p"
+	close(words)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"post c/: turn ", "edit c/1: turn 1 ", "edit c/1: turn 1 from p"}
+	if got := poster.seen(); !slices.Equal(got, want) {
+		t.Fatalf("platform saw %q, want %q", got, want)
+	}
+	if n := clock.Timers(); n != 0 {
+		t.Fatalf("%d edit timers left running", n)
+	}
+}
+
+func TestWorkspaceRateLimit(t *testing.T) {
+	b, poster, clock := testBot(t, nil, "p")
+	b.Limiter = &llmagent.TokenBucket{Rate: 1.0 / 60, Clock: clock}
+	handle := func(workspace string) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- b.Handle(context.Background(), Message{Workspace: workspace, Channel: workspace, Text: "hi"})
+		}()
+		return done
+	}
+	if err := <-handle("w1"); err != nil {
+		t.Fatal(err)
+	}
+	held := handle("w1")
+	if err := <-handle("w2"); err != nil { // a workspace of its own
+		t.Fatal(err)
+	}
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-held:
+		t.Fatal("second message of w1 not held")
+	default:
+	}
+	clock.Advance(time.Minute)
+	if err := <-held; err != nil {
+		t.Fatal(err)
+	}
+	if got := poster.seen(); len(got) != 3 {
+		t.Fatalf("platform saw %q", got)
+	}
+}
@@ -0,0 +1,230 @@
+package llmagent
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// RequestBuilder assembles a CompletionRequest fluently:
+//
+//	req, err := llmagent.NewRequest().
+//		System("You are terse.").
+//		User("Capital of France?").
+//		Model("gpt-4o").Temp(0.2).Stream().
+//		Build()
+//
+// Each setter validates its argument; the first problem is reported by
+// Build and later calls are ignored.
+type RequestBuilder struct {
+	req CompletionRequest
+	err error
+}
+
+// NewRequest starts an empty request.
+func NewRequest() *RequestBuilder {
+	return &RequestBuilder{}
+}
+
+func (b *RequestBuilder) fail(format string, args ...any) *RequestBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("request builder: "+format, args...)
+	}
+	return b
+}
+
+// Message appends msg.
+func (b *RequestBuilder) Message(msg Message) *RequestBuilder {
+	if b.err != nil {
+		return b
+	}
+	if !msg.Role.Valid() {
+		return b.fail("unknown role %q", msg.Role)
+	}
+	if msg.Role == RoleSystem && len(b.req.Messages) > 0 {
+		return b.fail("system message must come first")
+	}
+	b.req.Messages = append(b.req.Messages, msg)
+	return b
+}
+
+// System appends a system message; it must be the first message.
+func (b *RequestBuilder) System(content string) *RequestBuilder { return b.Message(System(content)) }
+
+// User appends a user message.
+func (b *RequestBuilder) User(content string) *RequestBuilder { return b.Message(User(content)) }
+
+// Assistant appends an assistant message.
+func (b *RequestBuilder) Assistant(content string) *RequestBuilder {
+	return b.Message(Assistant(content))
+}
+
+// Model sets the model.
+func (b *RequestBuilder) Model(model string) *RequestBuilder {
+	if model == "" {
+		return b.fail("empty model")
+	}
+	b.req.Model = model
+	return b
+}
+
+// Temp sets the sampling temperature, in [0, 2].
+func (b *RequestBuilder) Temp(t float64) *RequestBuilder {
+	if t < 0 || t > 2 {
+		return b.fail("temperature %v out of range [0, 2]", t)
+	}
+	b.req.Temperature = Float64(t)
+	return b
+}
+
+// TopP sets nucleus sampling, in (0, 1].
+func (b *RequestBuilder) TopP(p float64) *RequestBuilder {
+	if p <= 0 || p > 1 {
+		return b.fail("top_p %v out of range (0, 1]", p)
+	}
+	b.req.TopP = Float64(p)
+	return b
+}
+
+// MaxTokens caps the completion length.
+func (b *RequestBuilder) MaxTokens(n int) *RequestBuilder {
+	if n <= 0 {
+		return b.fail("max tokens must be positive, got %d", n)
+	}
+	b.req.MaxTokens = n
+	return b
+}
+
+// Stop adds stop sequences.
+func (b *RequestBuilder) Stop(seqs ...string) *RequestBuilder {
+	for _, s := range seqs {
+		if s == "" {
+			return b.fail("empty stop sequence")
+		}
+	}
+	b.req.Stop = append(b.req.Stop, seqs...)
+	return b
+}
+
+// Seed sets the sampling seed.
+func (b *RequestBuilder) Seed(seed int) *RequestBuilder {
+	b.req.Seed = Int(seed)
+	return b
+}
+
+// Tools offers functions the model may call.
+func (b *RequestBuilder) Tools(tools ...ToolDefinition) *RequestBuilder {
+	b.req.Tools = append(b.req.Tools, tools...)
+	return b
+}
+
+// ToolChoice constrains tool use, e.g. ForceTool("extract").
+func (b *RequestBuilder) ToolChoice(tc *ToolChoice) *RequestBuilder {
+	b.req.ToolChoice = tc
+	return b
+}
+
+// ParallelToolCalls allows or forbids several tool calls in one turn.
+func (b *RequestBuilder) ParallelToolCalls(on bool) *RequestBuilder {
+	b.req.ParallelToolCalls = Bool(on)
+	return b
+}
+
+// Tags adds labels for metrics and billing.
+func (b *RequestBuilder) Tags(tags ...string) *RequestBuilder {
+	b.req.Tags = append(b.req.Tags, tags...)
+	return b
+}
+
+// SuggestQuestions asks for n follow-up question suggestions after the
+// answer.
+func (b *RequestBuilder) SuggestQuestions(n int) *RequestBuilder {
+	if n < 0 {
+		return b.fail("negative suggestion count %d", n)
+	}
+	b.req.SuggestQuestions = n
+	return b
+}
+
+// Extra sets a provider parameter passed through as-is.
+func (b *RequestBuilder) Extra(key string, value any) *RequestBuilder {
+	if key == "" {
+		return b.fail("empty extra parameter name")
+	}
+	if b.req.Extra == nil {
+		b.req.Extra = make(map[string]any)
+	}
+	b.req.Extra[key] = value
+	return b
+}
+
+// Stream requests a streamed response.
+func (b *RequestBuilder) Stream() *RequestBuilder {
+	b.req.Stream = Bool(true)
+	return b
+}
+
+// NoStream requests a single, complete response.
+func (b *RequestBuilder) NoStream() *RequestBuilder {
+	b.req.Stream = Bool(false)
+	return b
+}
+
+// Documents attaches retrieved context documents.
+func (b *RequestBuilder) Documents(docs ...Document) *RequestBuilder {
+	b.req.Documents = append(b.req.Documents, docs...)
+	return b
+}
+
+// Build returns the request. The result shares no memory with the builder,
+// so later builder calls never change a request already built.
+func (b *RequestBuilder) Build() (CompletionRequest, error) {
+	if b.err != nil {
+		return CompletionRequest{}, b.err
+	}
+	if len(b.req.Messages) == 0 {
+		return CompletionRequest{}, errors.New("request builder: no messages")
+	}
+	return b.req.clone(), nil
+}
+
+// MustBuild is like Build but panics on error.
+func (b *RequestBuilder) MustBuild() CompletionRequest {
+	req, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return req
+}
+
+// clone deep-copies the request's slices and pointers.
+func (c CompletionRequest) clone() CompletionRequest {
+	c.Messages = append([]Message(nil), c.Messages...)
+	c.Stop = append([]string(nil), c.Stop...)
+	c.Documents = append([]Document(nil), c.Documents...)
+	c.Tools = append([]ToolDefinition(nil), c.Tools...)
+	if c.Stream != nil {
+		c.Stream = Bool(*c.Stream)
+	}
+	if c.Temperature != nil {
+		c.Temperature = Float64(*c.Temperature)
+	}
+	if c.TopP != nil {
+		c.TopP = Float64(*c.TopP)
+	}
+	if c.Seed != nil {
+		c.Seed = Int(*c.Seed)
+	}
+	if c.ToolChoice != nil {
+		tc := *c.ToolChoice
+		c.ToolChoice = &tc
+	}
+	if c.ParallelToolCalls != nil {
+		c.ParallelToolCalls = Bool(*c.ParallelToolCalls)
+	}
+	c.Tags = append([]string(nil), c.Tags...)
+	if c.Extra != nil {
+		c.Extra = maps.Clone(c.Extra)
+	}
+	return c
+}
@@ -0,0 +1,235 @@
+package llmagent
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CacheKeyFunc derives the cache key for a non-streaming request served by
+// the named provider. req has already been resolved against the provider's
+// configured defaults.
+type CacheKeyFunc func(provider string, req CompletionRequest) (string, error)
+
+// CachedRequest is the normalized shape hashed by DefaultCacheKey.
+type CachedRequest struct {
+	Provider    string
+	Messages    []Message
+	Model       string
+	Temperature *float64
+	MaxTokens   int
+	TopP        *float64
+	Stop        []string
+	Seed        *int
+	Logprobs    bool
+	Tools       []ToolDefinition
+	ToolChoice  *ToolChoice
+	Parallel    *bool
+	Extra       map[string]any
+}
+
+// DefaultCacheKey hashes the provider name together with the resolved model
+// and sampling parameters, so identical prompts sent to different providers
+// or models never share an entry.
+func DefaultCacheKey(provider string, req CompletionRequest) (string, error) {
+	data, err := json.Marshal(CachedRequest{
+		Provider:    provider,
+		Messages:    req.Messages,
+		Model:       req.Model,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		TopP:        req.TopP,
+		Stop:        req.Stop,
+		Seed:        req.Seed,
+		Logprobs:    req.Logprobs,
+		Tools:       req.Tools,
+		ToolChoice:  req.ToolChoice,
+		Parallel:    req.ParallelToolCalls,
+		Extra:       req.Extra,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%x", sum), nil
+}
+
+// ResolveRequest fills unset request fields from the provider config the
+// same way providers do before sending.
+func ResolveRequest(cfg *ProviderConfig, req CompletionRequest) CompletionRequest {
+	if req.Model == "" {
+		req.Model = cfg.DefaultModel
+	}
+	if req.Temperature == nil {
+		req.Temperature = cfg.DefaultTemperature
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = cfg.DefaultMaxTokens
+		if req.MaxTokens == 0 {
+			req.MaxTokens = 200
+		}
+	}
+	if req.TopP == nil {
+		req.TopP = cfg.DefaultTopP
+	}
+	if len(req.Stop) == 0 {
+		req.Stop = nil
+	}
+	return req
+}
+
+// cacheKey resolves req against p's defaults and runs the configured key
+// builder.
+func (a *Agent) cacheKey(p Provider, req CompletionRequest) (string, error) {
+	keyFn := a.CacheKey
+	if keyFn == nil {
+		keyFn = DefaultCacheKey
+	}
+	return keyFn(p.Name(), ResolveRequest(p.GetConfig(), req))
+}
+
+// cacheNegative remembers a deterministic failure of a non-streaming request
+// for NegativeCacheTTL so identical requests fail fast.
+func (a *Agent) cacheNegative(ctx context.Context, p Provider, req CompletionRequest, err error) {
+	if a.NegativeCacheTTL <= 0 || req.StreamValue() || !IsDeterministicError(err) {
+		return
+	}
+	key, kerr := a.cacheKey(p, req)
+	if kerr != nil {
+		return
+	}
+	a.cacheSet(cacheEntry{
+		key:       key,
+		provider:  p.Name(),
+		err:       err,
+		user:      UserFromContext(ctx),
+		expiresAt: a.clock().Now().Add(a.NegativeCacheTTL),
+	}, 0)
+}
+
+// cacheEntry holds cached response and its expiration.
+type cacheEntry struct {
+	key       string
+	provider  string // provider that produced the entry
+	content   string
+	finish    FinishReason
+	err       error  // set for negative entries
+	user      string // see WithUser
+	storedAt  time.Time
+	expiresAt time.Time
+}
+
+// response converts the entry back into what the caller would have received.
+func (e cacheEntry) response() CompletionResponse {
+	resp := CompletionResponse{Content: e.content, Err: e.err, Provider: e.provider, Cached: true}
+	if e.err == nil {
+		resp.Role = RoleAssistant
+	}
+	return resp
+}
+
+// responseCache is an LRU cache of completion responses bounded by entry
+// count and total content bytes.
+type responseCache struct {
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	bytes int
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the entry for key, if still live at now, and marks it
+// recently used.
+func (c *responseCache) get(key string, now time.Time) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if !entry.expiresAt.After(now) {
+		c.removeElement(el)
+		return cacheEntry{}, false
+	}
+	c.ll.MoveToFront(el)
+	return *entry, true
+}
+
+// set stores entry and evicts least recently used entries until the cache
+// fits within maxEntries and maxBytes (zero means no limit). It returns the
+// evicted entries; an entry too large to ever fit is returned as is.
+func (c *responseCache) set(entry cacheEntry, maxEntries, maxBytes int) []cacheEntry {
+	if maxBytes > 0 && len(entry.content) > maxBytes {
+		return []cacheEntry{entry}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[entry.key]; ok {
+		c.removeElement(el)
+	}
+	c.items[entry.key] = c.ll.PushFront(&entry)
+	c.bytes += len(entry.content)
+	var evicted []cacheEntry
+	for (maxEntries > 0 && c.ll.Len() > maxEntries) || (maxBytes > 0 && c.bytes > maxBytes) {
+		evicted = append(evicted, c.removeElement(c.ll.Back()))
+	}
+	return evicted
+}
+
+// entries returns a copy of every entry, most recently used first.
+func (c *responseCache) entries() []cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]cacheEntry, 0, c.ll.Len())
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		out = append(out, *el.Value.(*cacheEntry))
+	}
+	return out
+}
+
+// purgeExpired drops every entry whose TTL has passed.
+func (c *responseCache) purgeExpired(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.ll.Back(); el != nil; {
+		prev := el.Prev()
+		if el.Value.(*cacheEntry).expiresAt.Before(now) {
+			c.removeElement(el)
+		}
+		el = prev
+	}
+}
+
+// purge drops every entry matching fn and returns how many were removed.
+func (c *responseCache) purge(fn func(*cacheEntry) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int
+	for el := c.ll.Back(); el != nil; {
+		prev := el.Prev()
+		if fn(el.Value.(*cacheEntry)) {
+			c.removeElement(el)
+			n++
+		}
+		el = prev
+	}
+	return n
+}
+
+func (c *responseCache) removeElement(el *list.Element) cacheEntry {
+	entry := c.ll.Remove(el).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.bytes -= len(entry.content)
+	return *entry
+}
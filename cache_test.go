@@ -0,0 +1,60 @@
+package llmagent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// statusError is an upstream failure with the given HTTP status.
+type statusError int
+
+func (e statusError) Error() string       { return "upstream failed" }
+func (e statusError) HTTPStatusCode() int { return int(e) }
+
+func TestCacheHitsFallbackResponse(t *testing.T) {
+	primary := newTestProvider("primary", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return nil, statusError(503)
+	})
+	fallback := newTestProvider("fallback", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return answer("ok"), nil
+	})
+	a, _ := testAgent(t, primary, fallback)
+	a.CacheTTL = time.Minute
+	a.RegisterFallbackProviders([]string{"fallback"})
+
+	for i := 0; i < 2; i++ {
+		if err := <-complete(a, "primary"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fallback.calls.Load(); got != 1 {
+		t.Fatalf("fallback called %d times, want 1 (second request cached)", got)
+	}
+}
+
+func TestNegativeCacheKeepsErrorsPerProvider(t *testing.T) {
+	primary := newTestProvider("primary", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		if n == 1 {
+			return nil, statusError(503)
+		}
+		return answer("ok"), nil
+	})
+	fallback := newTestProvider("fallback", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return nil, statusError(401)
+	})
+	a, _ := testAgent(t, primary, fallback)
+	a.NegativeCacheTTL = time.Minute
+	a.RegisterFallbackProviders([]string{"fallback"})
+
+	if err := <-complete(a, "primary"); err == nil {
+		t.Fatal("first request succeeded, want an error")
+	}
+	// The fallback's 401 must not be replayed for the primary's transient 503.
+	if err := <-complete(a, "primary"); err != nil {
+		t.Fatalf("second request: %v", err)
+	}
+	if got := primary.calls.Load(); got != 2 {
+		t.Fatalf("primary called %d times, want 2", got)
+	}
+}
@@ -0,0 +1,262 @@
+package llmagent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheRecord is a cache entry as stored by a CacheTier. Content is sealed
+// with Agent.Encryptor when one is set.
+type CacheRecord struct {
+	Key       string    `json:"key"`
+	Provider  string    `json:"provider"`
+	Content   string    `json:"content"`
+	Finish    string    `json:"finish_reason,omitempty"`
+	User      string    `json:"user,omitempty"`
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CacheTier is a slower, persistent cache level below the in-memory LRU,
+// e.g. a directory, bolt or badger database. Implementations must be safe
+// for concurrent use.
+type CacheTier interface {
+	Load(key string) (CacheRecord, bool, error)
+	Store(rec CacheRecord) error
+	// Purge deletes every record matching fn and reports how many it
+	// removed.
+	Purge(fn func(CacheRecord) bool) (int, error)
+}
+
+func (e cacheEntry) record() CacheRecord {
+	return CacheRecord{Key: e.key, Provider: e.provider, Content: e.content, Finish: string(e.finish), User: e.user, StoredAt: e.storedAt, ExpiresAt: e.expiresAt}
+}
+
+func (r CacheRecord) entry() cacheEntry {
+	return cacheEntry{key: r.Key, provider: r.Provider, content: r.Content, finish: FinishReason(r.Finish), user: r.User, storedAt: r.StoredAt, expiresAt: r.ExpiresAt}
+}
+
+// cacheGet looks key up in memory, then in the CacheTier; tier hits are
+// promoted back into memory.
+func (a *Agent) cacheGet(key string) (cacheEntry, bool) {
+	a.startPurger()
+	now := a.clock().Now()
+	if entry, ok := a.cache.get(key, now); ok || a.CacheTier == nil {
+		return entry, ok
+	}
+	rec, ok, err := a.CacheTier.Load(key)
+	if err != nil || !ok || !rec.ExpiresAt.After(now) {
+		return cacheEntry{}, false
+	}
+	entry := rec.entry()
+	a.spill(a.cache.set(entry, a.CacheMaxEntries, a.CacheMaxBytes))
+	return entry, true
+}
+
+// cacheSet stores entry in memory, writing it through to the CacheTier
+// when the prompt is expensive enough, and demotes whatever the LRU evicts.
+func (a *Agent) cacheSet(entry cacheEntry, promptTokens int) {
+	a.startPurger()
+	if entry.storedAt.IsZero() {
+		entry.storedAt = a.clock().Now()
+	}
+	if a.CacheTier != nil && entry.err == nil && a.CacheTierMinTokens > 0 && promptTokens >= a.CacheTierMinTokens {
+		_ = a.CacheTier.Store(entry.record())
+	}
+	a.spill(a.cache.set(entry, a.CacheMaxEntries, a.CacheMaxBytes))
+}
+
+// promptTokens estimates the prompt size of req.
+func promptTokens(req CompletionRequest) int {
+	var n int
+	for _, msg := range req.Messages {
+		n += EstimateTokens(msg.Content)
+	}
+	return n
+}
+
+// spill demotes evicted entries to the CacheTier. Negative and expired
+// entries are dropped.
+func (a *Agent) spill(evicted []cacheEntry) {
+	if a.CacheTier == nil {
+		return
+	}
+	now := a.clock().Now()
+	for _, e := range evicted {
+		if e.err == nil && e.expiresAt.After(now) {
+			_ = a.CacheTier.Store(e.record())
+		}
+	}
+}
+
+// FlushCache writes every live in-memory entry to the CacheTier, e.g.
+// before shutting down, so the next process starts warm.
+func (a *Agent) FlushCache() error {
+	if a.CacheTier == nil {
+		return errors.New("no cache tier configured")
+	}
+	var errs []error
+	now := a.clock().Now()
+	for _, e := range a.cache.entries() {
+		if e.err == nil && e.expiresAt.After(now) {
+			if err := a.CacheTier.Store(e.record()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// startPurger starts, once, a goroutine purging expired entries from the
+// memory cache and the CacheTier every minute of the agent's Clock. It
+// runs on the first cache access rather than in NewAgent, so the Clock
+// and the tier are read after they have been configured.
+func (a *Agent) startPurger() {
+	a.purger.Do(func() {
+		tier, clock := a.CacheTier, a.clock()
+		go func() {
+			ticker := clock.NewTicker(time.Minute)
+			defer ticker.Stop()
+			for now := range ticker.C() {
+				a.cache.purgeExpired(now)
+				if tier != nil {
+					_, _ = tier.Purge(func(r CacheRecord) bool { return r.ExpiresAt.Before(now) })
+				}
+			}
+		}()
+	})
+}
+
+// purgeTier applies fn to the CacheTier, if any.
+func (a *Agent) purgeTier(fn func(CacheRecord) bool) (int, error) {
+	if a.CacheTier == nil {
+		return 0, nil
+	}
+	return a.CacheTier.Purge(fn)
+}
+
+// DirCache is a CacheTier keeping one JSON file per entry in a directory.
+type DirCache struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewDirCache opens (creating if needed) a directory-backed cache tier.
+func NewDirCache(dir string) (*DirCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DirCache{dir: dir}, nil
+}
+
+// path hashes key so custom CacheKeyFunc output is always a safe file name.
+func (d *DirCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (d *DirCache) Load(key string) (CacheRecord, bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	data, err := os.ReadFile(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return CacheRecord{}, false, nil
+	}
+	if err != nil {
+		return CacheRecord{}, false, err
+	}
+	var rec CacheRecord
+	if err := json.Unmarshal(data, &rec); err != nil || rec.Key != key {
+		return CacheRecord{}, false, err
+	}
+	return rec, true, nil
+}
+
+func (d *DirCache) Store(rec CacheRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return writeAtomic(d.path(rec.Key), data)
+}
+
+// writeAtomic writes and renames so readers never see a partial file.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Purge walks the directory without holding the cache lock, so Load and
+// Store carry on while it runs; the lock is only taken to re-check and
+// remove each matching file.
+func (d *DirCache) Purge(fn func(CacheRecord) bool) (int, error) {
+	files, err := os.ReadDir(d.dir)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	var errs []error
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(d.dir, f.Name())
+		removed, err := d.purgeFile(path, fn)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+		if removed {
+			n++
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+// purgeFile removes the record at path if it matches fn. The record is
+// checked again under the lock, as a Store may have replaced it meanwhile.
+// Unreadable records are removed too.
+func (d *DirCache) purgeFile(path string, fn func(CacheRecord) bool) (bool, error) {
+	if match, err := matchFile(path, fn); !match || err != nil {
+		return false, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if match, err := matchFile(path, fn); !match || err != nil {
+		return false, err
+	}
+	if err := os.Remove(path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func matchFile(path string, fn func(CacheRecord) bool) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	var rec CacheRecord
+	return json.Unmarshal(data, &rec) != nil || fn(rec), nil
+}
@@ -0,0 +1,82 @@
+package llmagent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDirCachePurge(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDirCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := range 10 {
+		rec := CacheRecord{Key: fmt.Sprint("k", i), Content: "c", ExpiresAt: now.Add(time.Hour)}
+		if i%2 == 0 {
+			rec.ExpiresAt = now.Add(-time.Hour)
+		}
+		if err := d.Store(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := d.Purge(func(r CacheRecord) bool { return r.ExpiresAt.Before(now) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Fatalf("purged %d records, want 5 expired and 1 unreadable", n)
+	}
+	for i := range 10 {
+		_, ok, err := d.Load(fmt.Sprint("k", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != (i%2 == 1) {
+			t.Fatalf("k%d present = %v after purge", i, ok)
+		}
+	}
+}
+
+// TestDirCachePurgeConcurrent runs purges alongside stores and loads; run
+// with -race.
+func TestDirCachePurgeConcurrent(t *testing.T) {
+	d, err := NewDirCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAgent()
+	a.CacheTier = d // set after NewAgent, as callers do
+	a.CacheTierMinTokens = 1
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				key := fmt.Sprint(w, "-", i)
+				a.cacheSet(cacheEntry{key: key, content: "c", expiresAt: time.Now().Add(time.Hour)}, 1)
+				a.cacheGet(key)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 10 {
+			if _, err := d.Purge(func(r CacheRecord) bool { return r.Key[0] == '0' }); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+}
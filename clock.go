@@ -0,0 +1,209 @@
+package llmagent
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for retries and backoff, cache TTLs, key
+// cool-downs, hedging, SLO windows and the background loops (cache sweeps,
+// health probes, retention, key rotation, reloads). Tests swap in a
+// FakeClock to advance time deterministically instead of sleeping.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is the part of *time.Timer a Clock hands out.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker is the part of *time.Ticker a Clock hands out.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the real clock, used whenever no Clock is set.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+type systemTimer struct{ t *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.t.C }
+func (t systemTimer) Stop() bool          { return t.t.Stop() }
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
+
+// clockOr returns c, or SystemClock when c is nil.
+func clockOr(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// clock returns the agent's Clock.
+func (a *Agent) clock() Clock { return clockOr(a.Clock) }
+
+// WithClock sets the provider's clock, used for key cool-downs.
+func WithClock(c Clock) Option {
+	return func(p *ProviderConfig) {
+		p.Clock = c
+	}
+}
+
+// Now reads the provider's Clock.
+func (c *ProviderConfig) Now() time.Time {
+	return clockOr(c.Clock).Now()
+}
+
+// FakeClock is a manually advanced Clock for tests. Timers fire when
+// Advance or Set moves the clock past their deadline; tickers tick once
+// per move that passes one of their ticks, dropping ticks for a slow
+// reader like a time.Ticker.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	tickers []*fakeTicker
+}
+
+// NewFakeClock returns a clock stopped at start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.ch <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("llmagent: non-positive interval for FakeClock.NewTicker")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{clock: c, every: d, next: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing due timers in deadline
+// order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to t, firing due timers in deadline order. Moving
+// backwards fires nothing.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+	sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+	pending := c.timers[:0]
+	for _, ft := range c.timers {
+		if ft.at.After(t) {
+			pending = append(pending, ft)
+			continue
+		}
+		ft.ch <- ft.at
+	}
+	c.timers = pending
+	for _, tk := range c.tickers {
+		if tk.next.After(t) {
+			continue
+		}
+		at := tk.next
+		for !tk.next.After(t) {
+			tk.next = tk.next.Add(tk.every)
+		}
+		select {
+		case tk.ch <- at:
+		default:
+		}
+	}
+}
+
+// Timers reports how many timers are waiting, so a test can wait until the
+// code under test has armed its timer before advancing.
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// Tickers reports how many tickers are running, so a test can wait until
+// a background loop has started before advancing.
+func (c *FakeClock) Tickers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.tickers)
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	at    time.Time
+	ch    chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, ft := range c.timers {
+		if ft == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTicker struct {
+	clock *FakeClock
+	every time.Duration
+	next  time.Time
+	ch    chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTicker) Stop() {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tickers = slices.DeleteFunc(c.tickers, func(tk *fakeTicker) bool { return tk == t })
+}
@@ -0,0 +1,256 @@
+package llmagent
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// rateLimited is a 429 carrying a Retry-After header.
+type rateLimited struct{ retryAfter string }
+
+func (e rateLimited) Error() string       { return "rate limited" }
+func (e rateLimited) HTTPStatusCode() int { return http.StatusTooManyRequests }
+func (e rateLimited) HTTPHeader() http.Header {
+	return http.Header{"Retry-After": {e.retryAfter}}
+}
+
+// waitTimers waits until n timers are armed on clock.
+func waitTimers(t *testing.T, clock *FakeClock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for clock.Timers() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d timers armed, want %d", clock.Timers(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRetryAfterWaitsOnClock(t *testing.T) {
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		if n == 1 {
+			return nil, rateLimited{retryAfter: "5"}
+		}
+		return answer("ok"), nil
+	})
+	p.cfg.RetryCount = 1
+	a, clock := testAgent(t, p)
+
+	done := complete(a, "p")
+	waitTimers(t, clock, 1)
+	clock.Advance(4 * time.Second)
+	if p.calls.Load() != 1 {
+		t.Fatal("retried before Retry-After elapsed")
+	}
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if p.calls.Load() != 2 {
+		t.Fatalf("%d calls, want 2", p.calls.Load())
+	}
+}
+
+func TestHedgeOnClock(t *testing.T) {
+	slow := newTestProvider("slow", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		ch := make(chan CompletionResponse)
+		go func() {
+			<-ctx.Done()
+			close(ch)
+		}()
+		return ch, nil
+	})
+	fast := newTestProvider("fast", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return answer("fast"), nil
+	})
+	a, clock := testAgent(t, slow, fast)
+	a.HedgeAfter, a.HedgeProvider = time.Second, "fast"
+
+	done := complete(a, "slow")
+	waitTimers(t, clock, 1)
+	if fast.calls.Load() != 0 {
+		t.Fatal("hedged before HedgeAfter")
+	}
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if fast.calls.Load() != 1 {
+		t.Fatalf("hedge provider called %d times, want 1", fast.calls.Load())
+	}
+}
+
+func TestCacheTTLOnClock(t *testing.T) {
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return answer("ok"), nil
+	})
+	a, clock := testAgent(t, p)
+	a.CacheTTL = time.Minute
+
+	for _, step := range []struct {
+		advance time.Duration
+		calls   int32
+	}{
+		{0, 1},
+		{59 * time.Second, 1}, // still cached
+		{time.Second, 2},      // expired
+	} {
+		clock.Advance(step.advance)
+		if err := <-complete(a, "p"); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.calls.Load(); got != step.calls {
+			t.Fatalf("after %v: %d calls, want %d", step.advance, got, step.calls)
+		}
+	}
+}
+
+func TestBillingPeriodsOnClock(t *testing.T) {
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return answer("ok"), nil
+	})
+	a, clock := testAgent(t, p)
+	a.Billing = NewUsageLedger()
+	start := clock.Now()
+
+	clock.Advance(time.Minute)
+	if err := <-complete(a, "p"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	first := a.Billing.Drain()
+	if len(first) != 1 || !first[0].From.Equal(start.Add(time.Minute)) || !first[0].To.Equal(start.Add(time.Hour+time.Minute)) {
+		t.Fatalf("first period = %+v", first)
+	}
+
+	clock.Advance(time.Hour)
+	if err := <-complete(a, "p"); err != nil {
+		t.Fatal(err)
+	}
+	if second := a.Billing.Snapshot(); len(second) != 1 || !second[0].From.Equal(first[0].To) || !second[0].To.Equal(clock.Now()) {
+		t.Fatalf("second period = %+v", second)
+	}
+}
+
+func TestFakeClockTicker(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	tk := clock.NewTicker(time.Minute)
+	for _, step := range []struct {
+		advance time.Duration
+		tick    bool
+	}{
+		{59 * time.Second, false},
+		{time.Second, true},
+		{3 * time.Minute, true}, // one tick for the move, the others dropped
+		{30 * time.Second, false},
+		{30 * time.Second, true},
+	} {
+		clock.Advance(step.advance)
+		select {
+		case <-tk.C():
+			if !step.tick {
+				t.Fatalf("tick at %v", clock.Now())
+			}
+		default:
+			if step.tick {
+				t.Fatalf("no tick at %v", clock.Now())
+			}
+		}
+	}
+	tk.Stop()
+	if clock.Tickers() != 0 {
+		t.Fatal("stopped ticker still running")
+	}
+}
+
+func TestHealthProberOnClock(t *testing.T) {
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return answer("pong"), nil
+	})
+	a, clock := testAgent(t, p)
+	results := make(chan ProviderHealth, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.RunHealthProber(ctx, &HealthProber{Interval: time.Minute, OnResult: func(r ProviderHealth) { results <- r }})
+
+	if r := <-results; !r.Healthy || !r.CheckedAt.Equal(clock.Now()) {
+		t.Fatalf("first round = %+v", r)
+	}
+	clock.Advance(59 * time.Second)
+	select {
+	case r := <-results:
+		t.Fatalf("probed before the interval: %+v", r)
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Advance(time.Second)
+	if r := <-results; !r.CheckedAt.Equal(clock.Now()) {
+		t.Fatalf("second round = %+v", r)
+	}
+}
+
+func TestRetentionOnClock(t *testing.T) {
+	a, clock := testAgent(t, newTestProvider("p", nil))
+	a.Retention = map[string]time.Duration{CacheStoreName: time.Hour}
+	a.cacheSet(cacheEntry{key: "old", content: "c", expiresAt: clock.Now().Add(24 * time.Hour)}, 1)
+	reports := make(chan PurgeReport, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.RunRetention(ctx, 40*time.Minute, func(r PurgeReport, err error) { reports <- r })
+
+	clock.Advance(40 * time.Minute)
+	if r := <-reports; r.Deleted[CacheStoreName] != 0 {
+		t.Fatalf("first sweep = %+v, want nothing old enough", r)
+	}
+	clock.Advance(40 * time.Minute)
+	if r := <-reports; r.Deleted[CacheStoreName] != 1 || !r.At.Equal(clock.Now()) {
+		t.Fatalf("second sweep = %+v, want the entry older than an hour", r)
+	}
+}
+
+func TestKeyCoolDownOnClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	k := KeyHolder{Clock: clock, CoolDown: time.Minute}
+	k.SetAPIKeys("k1", "k2")
+	key, release := k.AcquireKey(context.Background())
+	release()
+	next, release, ok := k.Failover(context.Background(), key, rateLimited{})
+	if !ok || next != "k2" {
+		t.Fatalf("failover = %q, %v", next, ok)
+	}
+	release()
+	for range 2 {
+		if key, release := k.AcquireKey(context.Background()); key != "k2" {
+			t.Fatalf("cooling key %q used", key)
+		} else {
+			release()
+		}
+	}
+	if u := k.Usage(); !u[0].CoolUntil.Equal(time.Unix(60, 0)) {
+		t.Fatalf("cool-down ends %v", u[0].CoolUntil)
+	}
+	clock.Advance(time.Minute)
+	if u := k.Usage(); !u[0].CoolUntil.IsZero() {
+		t.Fatal("key still cooling after CoolDown")
+	}
+}
+
+func TestParseResponseMetaResolvesAgainstNow(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := http.Header{
+		"X-Ratelimit-Remaining-Requests": {"0"},
+		"X-Ratelimit-Reset-Requests":     {"1m30s"},
+		"X-Ratelimit-Reset-Tokens":       {"250ms"},
+	}
+	rl := ParseResponseMeta(h, now).RateLimit
+	if rl == nil {
+		t.Fatal("no rate limit parsed")
+	}
+	if want := now.Add(90 * time.Second); !rl.ResetRequests.Equal(want) {
+		t.Fatalf("ResetRequests = %v, want %v", rl.ResetRequests, want)
+	}
+	if want := now.Add(250 * time.Millisecond); !rl.ResetTokens.Equal(want) {
+		t.Fatalf("ResetTokens = %v, want %v", rl.ResetTokens, want)
+	}
+}
@@ -0,0 +1,98 @@
+package llmagent
+
+import (
+	"context"
+	"sync"
+)
+
+// limiterSet holds one limiter per provider with MaxConcurrency set.
+type limiterSet struct {
+	mu   sync.Mutex
+	lims map[string]*limiter
+}
+
+// limiter counts a provider's in-flight requests. Its limit follows
+// MaxConcurrency as of the latest acquire, so a config change resizes it
+// without forgetting the slots already held.
+type limiter struct {
+	max   int
+	held  int
+	queue []chan struct{} // waiters in arrival order
+}
+
+// grant hands free slots to waiters, oldest first. Called with the set's
+// mu held.
+func (lim *limiter) grant() {
+	for len(lim.queue) > 0 && lim.held < lim.max {
+		w := lim.queue[0]
+		lim.queue = lim.queue[1:]
+		lim.held++
+		close(w)
+	}
+}
+
+// acquire blocks until p has a free upstream slot or ctx is done. The
+// returned release func must be called exactly once.
+func (l *limiterSet) acquire(ctx context.Context, p Provider) (func(), error) {
+	n := p.GetConfig().MaxConcurrency
+	if n <= 0 {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	if l.lims == nil {
+		l.lims = make(map[string]*limiter)
+	}
+	lim, ok := l.lims[p.Name()]
+	if !ok {
+		lim = &limiter{}
+		l.lims[p.Name()] = lim
+	}
+	lim.max = n
+	lim.grant() // a raised limit frees slots for those already waiting
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			lim.held--
+			lim.grant()
+			l.mu.Unlock()
+		})
+	}
+	if lim.held < lim.max && len(lim.queue) == 0 {
+		lim.held++
+		l.mu.Unlock()
+		return release, nil
+	}
+	w := make(chan struct{})
+	lim.queue = append(lim.queue, w)
+	l.mu.Unlock()
+	select {
+	case <-w:
+		return release, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		for i, q := range lim.queue {
+			if q == w {
+				lim.queue = append(lim.queue[:i], lim.queue[i+1:]...)
+				l.mu.Unlock()
+				return nil, ctx.Err()
+			}
+		}
+		l.mu.Unlock()
+		release() // granted while giving up
+		return nil, ctx.Err()
+	}
+}
+
+// releaseOnClose forwards ch and calls release once it is drained or the
+// run is cancelled.
+func releaseOnClose(ctx context.Context, ch <-chan CompletionResponse, release func()) <-chan CompletionResponse {
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		defer release()
+		for resp := range ch {
+			if !emit(resp) {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// acquired reports whether acquire returns within a short wait, handing
+// back its release func when it does.
+func acquired(l *limiterSet, ctx context.Context, p Provider) (func(), bool) {
+	got := make(chan func(), 1)
+	go func() {
+		if release, err := l.acquire(ctx, p); err == nil {
+			got <- release
+		}
+	}()
+	select {
+	case release := <-got:
+		return release, true
+	case <-time.After(50 * time.Millisecond):
+		return nil, false
+	}
+}
+
+func TestLimiterQueuesInOrder(t *testing.T) {
+	var l limiterSet
+	p := newTestProvider("p", nil)
+	p.cfg.MaxConcurrency = 1
+	ctx := context.Background()
+
+	first, err := l.acquire(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan int, 2)
+	for i := 1; i <= 2; i++ {
+		go func() {
+			release, err := l.acquire(ctx, p)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			release()
+		}()
+		waitQueued(t, &l, "p", i)
+	}
+	first()
+	if a, b := <-order, <-order; a != 1 || b != 2 {
+		t.Fatalf("waiters served in order %d, %d", a, b)
+	}
+}
+
+// waitQueued waits until n acquires are queued on provider's limiter.
+func waitQueued(t *testing.T, l *limiterSet, provider string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var queued int
+		l.mu.Lock()
+		if lim, ok := l.lims[provider]; ok {
+			queued = len(lim.queue)
+		}
+		l.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d waiters queued, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiterWaitCancelled(t *testing.T) {
+	var l limiterSet
+	p := newTestProvider("p", nil)
+	p.cfg.MaxConcurrency = 1
+	release, err := l.acquire(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, p); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the context's error", err)
+	}
+	release()
+	// the abandoned wait took no slot
+	if _, ok := acquired(&l, context.Background(), p); !ok {
+		t.Fatal("slot lost to a cancelled wait")
+	}
+}
+
+func TestLimiterResizeKeepsHeldSlots(t *testing.T) {
+	var l limiterSet
+	p := newTestProvider("p", nil)
+	ctx := context.Background()
+
+	p.cfg.MaxConcurrency = 2
+	r1, _ := l.acquire(ctx, p)
+	r2, _ := l.acquire(ctx, p)
+	p.cfg.MaxConcurrency = 1
+	if _, ok := acquired(&l, ctx, p); ok {
+		t.Fatal("acquired with two slots held and a limit of 1")
+	}
+	r1()
+	l.mu.Lock()
+	held := l.lims["p"].held
+	l.mu.Unlock()
+	if held != 1 {
+		t.Fatalf("%d slots held after one release, want 1 (the queued acquire waits)", held)
+	}
+	r2() // the queued acquire gets the slot
+	l.mu.Lock()
+	held = l.lims["p"].held
+	l.mu.Unlock()
+	if held != 1 {
+		t.Fatalf("%d slots held, want the queued acquire's 1", held)
+	}
+
+	p.cfg.MaxConcurrency = 3
+	if _, ok := acquired(&l, ctx, p); !ok {
+		t.Fatal("raised limit not applied")
+	}
+}
+
+func TestMaxConcurrencyCapsInFlight(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	release := make(chan struct{})
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		if now := inFlight.Add(1); now > peak.Load() {
+			peak.Store(now)
+		}
+		<-release
+		inFlight.Add(-1)
+		return answer("ok"), nil
+	})
+	p.cfg.MaxConcurrency = 2
+	a, _ := testAgent(t, p)
+
+	var done []<-chan error
+	for range 5 {
+		done = append(done, complete(a, "p"))
+	}
+	waitQueued(t, &a.limiters, "p", 3)
+	close(release)
+	for _, d := range done {
+		if err := <-d; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := peak.Load(); got != 2 {
+		t.Fatalf("peak of %d requests in flight, want 2", got)
+	}
+}
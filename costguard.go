@@ -0,0 +1,104 @@
+package llmagent
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CostGuard caps what a session may spend. Once the session's cost
+// reaches Soft, turns move to the cheaper model Downshift names for the
+// pinned one (the provider's default before the first turn); once it
+// reaches Hard, Send refuses further turns with a *CostLimitError. Zero
+// thresholds are disabled. Cost comes from LookupModel pricing, so
+// unpriced models never trip the guard. Crossings are reported to
+// Agent.OnCostEvent.
+type CostGuard struct {
+	Soft float64 // USD
+	Hard float64 // USD
+	// Downshift maps a model to its cheaper substitute, e.g.
+	// "gpt-4o": "gpt-4o-mini". The substitute must be served by the same
+	// provider.
+	Downshift map[string]string
+}
+
+// Cost event kinds.
+const (
+	CostDownshift = "downshift"
+	CostLimit     = "limit"
+)
+
+// CostEvent reports a session crossing a CostGuard threshold: the limit
+// once, a downshift each time it changes the model.
+type CostEvent struct {
+	Session   string    `json:"session"`
+	Kind      string    `json:"kind"`
+	Spent     float64   `json:"spent"`
+	Threshold float64   `json:"threshold"`
+	From      string    `json:"from,omitempty"` // downshift only
+	To        string    `json:"to,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// CostLimitError is returned by Session.Send once the hard limit is
+// reached.
+type CostLimitError struct {
+	Session string
+	Spent   float64
+	Limit   float64
+}
+
+func (e *CostLimitError) Error() string {
+	return fmt.Sprintf("session %s: cost limit reached ($%.4f of $%.4f)", e.Session, e.Spent, e.Limit)
+}
+
+func (e *CostLimitError) HTTPStatusCode() int { return http.StatusPaymentRequired }
+
+// guardCost applies the session's CostGuard before a turn, returning the
+// model to use and the event to report once s.mu is released. Called with
+// s.mu held.
+func (s *Session) guardCost(model string) (string, *CostEvent, error) {
+	g := s.CostGuard
+	if g == nil || g.Soft <= 0 && g.Hard <= 0 {
+		return model, nil, nil
+	}
+	var spent float64
+	for _, t := range s.turns {
+		spent += t.Cost
+	}
+	now := s.agent.clock().Now()
+	if g.Hard > 0 && spent >= g.Hard {
+		var ev *CostEvent
+		if !s.costLimited {
+			s.costLimited = true
+			ev = &CostEvent{Session: s.ID, Kind: CostLimit, Spent: spent, Threshold: g.Hard, At: now}
+		}
+		return "", ev, &CostLimitError{Session: s.ID, Spent: spent, Limit: g.Hard}
+	}
+	if g.Soft > 0 && spent >= g.Soft {
+		if cheaper, ok := g.Downshift[model]; ok && cheaper != model {
+			s.model = cheaper
+			return cheaper, &CostEvent{Session: s.ID, Kind: CostDownshift, Spent: spent, Threshold: g.Soft, From: model, To: cheaper, At: now}, nil
+		}
+	}
+	return model, nil, nil
+}
+
+func (a *Agent) emitCost(ev *CostEvent) {
+	if ev != nil && a.OnCostEvent != nil {
+		a.OnCostEvent(*ev)
+	}
+}
+
+// resolveModel returns the provider a turn for provider would go to, after
+// aliases and the default provider, and the model it would run.
+func (a *Agent) resolveModel(provider string, req CompletionRequest) (string, string) {
+	name, req := a.resolveAlias(provider, req)
+	if name == "" {
+		name, req = a.resolveAlias(a.DefaultProvider, req)
+	}
+	if p, ok := a.provider(name); ok {
+		req = ResolveRequest(p.GetConfig(), req)
+	}
+	return name, req.Model
+}
@@ -0,0 +1,93 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func init() {
+	RegisterModel("guard-big", ModelInfo{InputPer1K: 1})
+	RegisterModel("guard-small", ModelInfo{InputPer1K: 0.1})
+}
+
+// guardedSession returns a session whose every turn costs 1000 prompt
+// tokens, recording the model of each request.
+func guardedSession(t *testing.T, g *CostGuard) (*Session, *[]string, *[]CostEvent) {
+	t.Helper()
+	models, events := new([]string), new([]CostEvent)
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		*models = append(*models, req.Model)
+		ch := make(chan CompletionResponse, 2)
+		ch <- CompletionResponse{Content: "ok", Usage: &Usage{PromptTokens: 1000, TotalTokens: 1000}}
+		ch <- CompletionResponse{Done: true, FinishReason: FinishStop}
+		close(ch)
+		return ch, nil
+	})
+	p.cfg.DefaultModel = "guard-big"
+	a, _ := testAgent(t, p)
+	a.CostGuard = g
+	a.OnCostEvent = func(ev CostEvent) { *events = append(*events, ev) }
+	s := a.NewSession()
+	s.Template.Stream = Bool(false)
+	return s, models, events
+}
+
+func TestCostGuard(t *testing.T) {
+	s, models, events := guardedSession(t, &CostGuard{Soft: 1, Hard: 1.15, Downshift: map[string]string{"guard-big": "guard-small"}})
+	for i, step := range []struct {
+		model   string // sent upstream
+		refused bool
+		event   string // kind reported before the turn
+	}{
+		{model: ""}, // the provider default, guard-big: $1
+		{model: "guard-small", event: CostDownshift}, // $1 spent: soft threshold
+		{model: "guard-small"},                       // stays downshifted: $1.10
+		{refused: true, event: CostLimit},            // $1.20: hard limit
+		{refused: true},                              // still refused, reported once
+	} {
+		*events = nil
+		calls := len(*models)
+		ch, err := s.Send(context.Background(), User("hi"))
+		if err == nil {
+			_, err = Collect(ch)
+		}
+		refused := step.refused
+		var lerr *CostLimitError
+		if refused != errors.As(err, &lerr) {
+			t.Fatalf("turn %d: err = %v", i+1, err)
+		}
+		if refused {
+			if len(*models) != calls {
+				t.Fatalf("turn %d: refused turn reached the provider", i+1)
+			}
+		} else if got := (*models)[calls]; got != step.model {
+			t.Fatalf("turn %d: sent model %q, want %q", i+1, got, step.model)
+		}
+		var kind string
+		if len(*events) > 0 {
+			kind = (*events)[0].Kind
+		}
+		if len(*events) > 1 || kind != step.event {
+			t.Fatalf("turn %d: events %+v, want %q", i+1, *events, step.event)
+		}
+	}
+}
+
+func TestCostGuardDownshiftsFirstTurn(t *testing.T) {
+	s, models, events := guardedSession(t, &CostGuard{Soft: 1, Downshift: map[string]string{"guard-big": "guard-small"}})
+	s.turns = []TurnStats{{Cost: 2}} // spent before, e.g. in a restored session
+	ch, err := s.Send(context.Background(), User("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Collect(ch); err != nil {
+		t.Fatal(err)
+	}
+	if len(*models) != 1 || (*models)[0] != "guard-small" {
+		t.Fatalf("sent models %q, want guard-small", *models)
+	}
+	if len(*events) != 1 || (*events)[0].From != "guard-big" || (*events)[0].To != "guard-small" {
+		t.Fatalf("events = %+v", *events)
+	}
+}
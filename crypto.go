@@ -0,0 +1,105 @@
+package llmagent
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Encryptor protects prompts and responses held by the agent's stores,
+// such as the response cache, so they are never kept in plaintext.
+type Encryptor interface {
+	Seal(plaintext []byte) ([]byte, error)
+	Open(ciphertext []byte) ([]byte, error)
+}
+
+// KeyFunc supplies a 16, 24 or 32 byte AES key, e.g. from a vault or a
+// KMS decrypt call.
+type KeyFunc func() ([]byte, error)
+
+// AESGCM is an Encryptor using AES-GCM with a random nonce prepended to
+// each ciphertext. The key is fetched from Key on first use and kept.
+type AESGCM struct {
+	Key KeyFunc
+
+	once sync.Once
+	aead cipher.AEAD
+	err  error
+}
+
+// NewAESGCM returns an AES-GCM Encryptor for a fixed key.
+func NewAESGCM(key []byte) (*AESGCM, error) {
+	e := &AESGCM{Key: func() ([]byte, error) { return key, nil }}
+	if _, err := e.cipher(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *AESGCM) cipher() (cipher.AEAD, error) {
+	e.once.Do(func() {
+		if e.Key == nil {
+			e.err = errors.New("aes-gcm: no key source")
+			return
+		}
+		key, err := e.Key()
+		if err != nil {
+			e.err = fmt.Errorf("aes-gcm: fetch key: %w", err)
+			return
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			e.err = fmt.Errorf("aes-gcm: %w", err)
+			return
+		}
+		e.aead, e.err = cipher.NewGCM(block)
+	})
+	return e.aead, e.err
+}
+
+// Seal encrypts plaintext.
+func (e *AESGCM) Seal(plaintext []byte) ([]byte, error) {
+	aead, err := e.cipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts a ciphertext produced by Seal.
+func (e *AESGCM) Open(ciphertext []byte) ([]byte, error) {
+	aead, err := e.cipher()
+	if err != nil {
+		return nil, err
+	}
+	n := aead.NonceSize()
+	if len(ciphertext) < n {
+		return nil, errors.New("aes-gcm: ciphertext too short")
+	}
+	return aead.Open(nil, ciphertext[:n], ciphertext[n:], nil)
+}
+
+// seal encrypts cached content when an Encryptor is configured.
+func (a *Agent) seal(content string) (string, error) {
+	if a.Encryptor == nil || content == "" {
+		return content, nil
+	}
+	b, err := a.Encryptor.Seal([]byte(content))
+	return string(b), err
+}
+
+// open reverses seal.
+func (a *Agent) open(content string) (string, error) {
+	if a.Encryptor == nil || content == "" {
+		return content, nil
+	}
+	b, err := a.Encryptor.Open([]byte(content))
+	return string(b), err
+}
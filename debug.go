@@ -0,0 +1,182 @@
+package llmagent
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// TokenLogprob is one generated token with its log probability.
+type TokenLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+}
+
+// Probability converts the log probability to [0, 1].
+func (t TokenLogprob) Probability() float64 { return math.Exp(t.Logprob) }
+
+// Trace records a streamed completion for debugging: every chunk with its
+// arrival time and, when the request set Logprobs, its tokens.
+type Trace struct {
+	Request CompletionRequest
+	Start   time.Time
+	Chunks  []TraceChunk
+	Stats   *CompletionStats
+	Err     error
+}
+
+// TraceChunk is one content event of a traced stream.
+type TraceChunk struct {
+	At      time.Duration // since Start
+	Content string
+	Tokens  []TokenLogprob
+}
+
+// TraceStream forwards ch unchanged while recording it into the returned
+// Trace. The trace is complete once the returned channel is closed, which
+// happens early, with ctx's error recorded, if ctx is done.
+func TraceStream(ctx context.Context, req CompletionRequest, ch <-chan CompletionResponse) (<-chan CompletionResponse, *Trace) {
+	tr := &Trace{Request: req, Start: time.Now()}
+	out := stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		for resp := range ch {
+			switch {
+			case resp.Err != nil:
+				if tr.Err == nil {
+					tr.Err = resp.Err
+				}
+			case resp.Done:
+				tr.Stats = resp.Stats
+			case resp.Content != "":
+				tr.Chunks = append(tr.Chunks, TraceChunk{At: time.Since(tr.Start), Content: resp.Content, Tokens: resp.Logprobs})
+			}
+			if !emit(resp) {
+				if tr.Err == nil {
+					tr.Err = ctx.Err()
+				}
+				return
+			}
+		}
+	})
+	return out, tr
+}
+
+// traceSpan is one rendered unit: a token when logprobs are known,
+// otherwise a whole chunk.
+type traceSpan struct {
+	Text  string
+	Prob  float64 // -1 when unknown
+	At    time.Duration
+	Chunk int
+}
+
+func (t *Trace) spans() []traceSpan {
+	var spans []traceSpan
+	for i, c := range t.Chunks {
+		if len(c.Tokens) == 0 {
+			spans = append(spans, traceSpan{Text: c.Content, Prob: -1, At: c.At, Chunk: i})
+			continue
+		}
+		for _, tok := range c.Tokens {
+			spans = append(spans, traceSpan{Text: tok.Token, Prob: tok.Probability(), At: c.At, Chunk: i})
+		}
+	}
+	return spans
+}
+
+// ANSI writes the completion with each token colored by probability
+// (green high, yellow middling, red low) and chunk boundaries marked with
+// a dim "|". Chunks without logprobs are alternately underlined.
+func (t *Trace) ANSI(w io.Writer) error {
+	var b strings.Builder
+	prev := -1
+	for _, s := range t.spans() {
+		if prev >= 0 && s.Chunk != prev {
+			b.WriteString("\x1b[2m|\x1b[0m")
+		}
+		prev = s.Chunk
+		switch {
+		case s.Prob < 0 && s.Chunk%2 == 1:
+			b.WriteString("\x1b[4m")
+		case s.Prob < 0:
+		case s.Prob >= 0.9:
+			b.WriteString("\x1b[32m")
+		case s.Prob >= 0.5:
+			b.WriteString("\x1b[33m")
+		default:
+			b.WriteString("\x1b[31m")
+		}
+		b.WriteString(s.Text)
+		b.WriteString("\x1b[0m")
+	}
+	b.WriteString("\n")
+	t.summary(&b)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (t *Trace) summary(b *strings.Builder) {
+	fmt.Fprintf(b, "%d chunks", len(t.Chunks))
+	if n := len(t.Chunks); n > 0 {
+		fmt.Fprintf(b, ", first at %s, last at %s", t.Chunks[0].At.Round(time.Millisecond), t.Chunks[n-1].At.Round(time.Millisecond))
+	}
+	if t.Stats != nil {
+		fmt.Fprintf(b, ", %d prompt + %d completion tokens via %s/%s", t.Stats.PromptTokens, t.Stats.CompletionTokens, t.Stats.Provider, t.Stats.Model)
+	}
+	if t.Err != nil {
+		fmt.Fprintf(b, ", error: %v", t.Err)
+	}
+	b.WriteString("\n")
+}
+
+// HTML writes a standalone page showing the prompt and the completion as a
+// token heatmap; hovering a token shows its probability and arrival time.
+func (t *Trace) HTML(w io.Writer) error {
+	var summary strings.Builder
+	t.summary(&summary)
+	return traceHTML.Execute(w, map[string]any{
+		"Messages": t.Request.Messages,
+		"Spans":    t.spans(),
+		"Summary":  summary.String(),
+	})
+}
+
+// heat maps a probability to a background color from red (0) to green (1).
+func heat(p float64) template.CSS {
+	if p < 0 {
+		return "transparent"
+	}
+	return template.CSS(fmt.Sprintf("hsl(%d,70%%,85%%)", int(p*120)))
+}
+
+var traceHTML = template.Must(template.New("trace").Funcs(template.FuncMap{
+	"heat": heat,
+	"ms":   func(d time.Duration) int64 { return d.Milliseconds() },
+	"pct":  func(p float64) string { return fmt.Sprintf("%.1f%%", p*100) },
+	"odd":  func(n int) bool { return n%2 == 1 },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Completion trace</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:56rem;margin:2rem auto;padding:0 1rem}
+pre{white-space:pre-wrap;background:#f6f6f6;padding:.5rem;border-radius:4px}
+.out{font-family:monospace;white-space:pre-wrap;line-height:1.8}
+.tok{border-right:1px solid #ccc;padding:1px 0}
+.alt{text-decoration:underline dotted}
+</style>
+</head>
+<body>
+<h1>Completion trace</h1>
+<h2>Prompt</h2>
+{{range .Messages}}<p><strong>{{.Role}}</strong></p><pre>{{.Content}}</pre>
+{{end}}<h2>Completion</h2>
+<div class="out">{{range .Spans}}<span class="tok{{if and (lt .Prob 0.0) (odd .Chunk)}} alt{{end}}" style="background:{{heat .Prob}}" title="{{if ge .Prob 0.0}}p={{pct .Prob}} {{end}}chunk {{.Chunk}} at {{ms .At}}ms">{{.Text}}</span>{{end}}</div>
+<p>{{.Summary}}</p>
+</body>
+</html>
+`))
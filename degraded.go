@@ -0,0 +1,86 @@
+package llmagent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"text/template"
+)
+
+// DegradedResponder produces a fallback answer when every provider and
+// fallback failed, so applications can show something useful instead of a
+// raw error. Returning false passes the error through unchanged.
+type DegradedResponder interface {
+	Respond(ctx context.Context, req CompletionRequest, err error) (string, bool)
+}
+
+// DegradedFunc adapts a function to DegradedResponder.
+type DegradedFunc func(ctx context.Context, req CompletionRequest, err error) (string, bool)
+
+func (f DegradedFunc) Respond(ctx context.Context, req CompletionRequest, err error) (string, bool) {
+	return f(ctx, req, err)
+}
+
+// StaticResponse always answers with msg.
+func StaticResponse(msg string) DegradedResponder {
+	return DegradedFunc(func(context.Context, CompletionRequest, error) (string, bool) {
+		return msg, true
+	})
+}
+
+// DegradedData is the input of TemplateResponse templates.
+type DegradedData struct {
+	Request  CompletionRequest
+	Question string // the last user message
+	Err      error
+}
+
+// TemplateResponse renders a text/template with DegradedData, e.g.
+//
+//	We couldn't answer "{{.Question}}" right now. Please try again shortly.
+func TemplateResponse(text string) (DegradedResponder, error) {
+	tmpl, err := template.New("degraded").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return DegradedFunc(func(_ context.Context, req CompletionRequest, err error) (string, bool) {
+		var b bytes.Buffer
+		data := DegradedData{Request: req, Question: lastUserMessage(req.Messages), Err: err}
+		if tmpl.Execute(&b, data) != nil {
+			return "", false
+		}
+		return b.String(), true
+	}), nil
+}
+
+// Chain tries each responder in order, e.g. a cache lookup before a
+// static message.
+func Chain(responders ...DegradedResponder) DegradedResponder {
+	return DegradedFunc(func(ctx context.Context, req CompletionRequest, err error) (string, bool) {
+		for _, r := range responders {
+			if msg, ok := r.Respond(ctx, req, err); ok {
+				return msg, true
+			}
+		}
+		return "", false
+	})
+}
+
+// degrade answers with a.Degraded when err means the providers were tried
+// and failed for reasons other than the request itself or the caller going
+// away.
+func (a *Agent) degrade(ctx context.Context, req CompletionRequest, err error) (<-chan CompletionResponse, bool) {
+	var agg *AggregateError
+	if a.Degraded == nil || ctx.Err() != nil || !errors.As(err, &agg) || IsDeterministicError(agg.Last()) {
+		return nil, false
+	}
+	msg, ok := a.Degraded.Respond(ctx, req, err)
+	if !ok {
+		return nil, false
+	}
+	out := make(chan CompletionResponse, 2)
+	out <- CompletionResponse{Content: msg, Role: RoleAssistant, Degraded: true}
+	out <- CompletionResponse{Index: 1, Done: true, Degraded: true, FinishReason: FinishError}
+	close(out)
+	return out, true
+}
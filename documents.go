@@ -0,0 +1,114 @@
+package llmagent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Document is a piece of retrieved context attached to a request, with the
+// provenance needed to cite it.
+type Document struct {
+	ID       string            `json:"id"`
+	Source   string            `json:"source,omitempty"` // URL, file path, ...
+	Title    string            `json:"title,omitempty"`
+	Content  string            `json:"content"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Citation links a completion back to a document it referenced.
+type Citation struct {
+	Index      int    `json:"index"` // the [n] marker used in the answer
+	DocumentID string `json:"document_id"`
+	Source     string `json:"source,omitempty"`
+	Title      string `json:"title,omitempty"`
+}
+
+// DocumentFormatter renders attached documents into the system message the
+// model sees. Documents must be numbered from 1 in order so citations can
+// be resolved from [n] markers.
+type DocumentFormatter func(docs []Document) string
+
+// DefaultDocumentFormatter lists the documents as numbered blocks and asks
+// the model to cite them with [n] markers.
+func DefaultDocumentFormatter(docs []Document) string {
+	var b strings.Builder
+	b.WriteString("Answer using the context documents below. Cite the documents you rely on with their number in square brackets, e.g. [1].\n")
+	for i, doc := range docs {
+		fmt.Fprintf(&b, "\n[%d]", i+1)
+		if doc.Title != "" {
+			fmt.Fprintf(&b, " %s", doc.Title)
+		}
+		if doc.Source != "" {
+			fmt.Fprintf(&b, " (%s)", doc.Source)
+		}
+		b.WriteString("\n")
+		b.WriteString(doc.Content)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// renderDocuments moves req.Documents into a system message in front of the
+// conversation, using the agent's formatter.
+func (a *Agent) renderDocuments(req CompletionRequest) CompletionRequest {
+	if len(req.Documents) == 0 {
+		return req
+	}
+	format := a.DocumentFormatter
+	if format == nil {
+		format = DefaultDocumentFormatter
+	}
+	ctxMsg := format(req.Documents)
+	msgs := make([]Message, 0, len(req.Messages)+1)
+	if len(req.Messages) > 0 && req.Messages[0].Role == RoleSystem {
+		first := req.Messages[0]
+		first.Content = first.Content + "\n\n" + ctxMsg
+		msgs = append(msgs, first)
+		msgs = append(msgs, req.Messages[1:]...)
+	} else {
+		msgs = append(msgs, Message{Role: RoleSystem, Content: ctxMsg})
+		msgs = append(msgs, req.Messages...)
+	}
+	req.Messages = msgs
+	req.Documents = nil
+	return req
+}
+
+var citationMarker = regexp.MustCompile(`\[(\d+)\]`)
+
+// citationsFor resolves the [n] markers in text against docs, in order of
+// first appearance.
+func citationsFor(text string, docs []Document) []Citation {
+	var out []Citation
+	seen := make(map[int]bool)
+	for _, m := range citationMarker.FindAllStringSubmatch(text, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 || n > len(docs) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		doc := docs[n-1]
+		out = append(out, Citation{Index: n, DocumentID: doc.ID, Source: doc.Source, Title: doc.Title})
+	}
+	return out
+}
+
+// withCitations forwards ch and attaches the citations found in the full
+// answer to its Done event.
+func withCitations(ctx context.Context, ch <-chan CompletionResponse, docs []Document) <-chan CompletionResponse {
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		var text strings.Builder
+		for resp := range ch {
+			text.WriteString(resp.Content)
+			if resp.Done {
+				resp.Citations = citationsFor(text.String(), docs)
+			}
+			if !emit(resp) {
+				return
+			}
+		}
+	})
+}
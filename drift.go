@@ -0,0 +1,302 @@
+package llmagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DriftMonitor watches provider responses for schema drift: fields the
+// provider's decoder has no place for, and fields whose JSON type no
+// longer matches. Each new finding is logged to the provider's Logger
+// and reported to OnDrift once per provider, kind and field.
+//
+// Decoders declare fields they deliberately ignore as json.RawMessage
+// fields, whose contents are not checked.
+type DriftMonitor struct {
+	// Strict rejects drifted responses with a *DriftError instead of
+	// decoding what is known.
+	Strict  bool
+	OnDrift func(DriftEvent)
+	// Clock stamps events; SystemClock when nil.
+	Clock Clock
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// DriftEvent reports the drifted fields of a provider response. Events
+// passed to OnDrift list only fields not reported before.
+type DriftEvent struct {
+	Provider string    `json:"provider"`
+	Kind     string    `json:"kind"`              // what was decoded, e.g. "completion" or "chunk"
+	Unknown  []string  `json:"unknown,omitempty"` // e.g. "choices[].message.refusal"
+	Changed  []string  `json:"changed,omitempty"` // e.g. "usage.total_tokens: got string"
+	At       time.Time `json:"at"`
+}
+
+func (e DriftEvent) String() string {
+	var parts []string
+	if len(e.Unknown) > 0 {
+		parts = append(parts, "unknown fields "+strings.Join(e.Unknown, ", "))
+	}
+	if len(e.Changed) > 0 {
+		parts = append(parts, "changed fields "+strings.Join(e.Changed, ", "))
+	}
+	return fmt.Sprintf("%s %s response drift: %s", e.Provider, e.Kind, strings.Join(parts, "; "))
+}
+
+// DriftError is returned for a drifted response under a strict
+// DriftMonitor.
+type DriftError struct {
+	DriftEvent
+}
+
+func (e *DriftError) Error() string { return "llmagent: " + e.DriftEvent.String() }
+
+func (e *DriftError) HTTPStatusCode() int { return http.StatusBadGateway }
+
+// WithDriftMonitor checks every response the provider decodes with
+// DecodeResponse against its decoder's fields. One monitor may be shared
+// by several providers.
+func WithDriftMonitor(m *DriftMonitor) Option {
+	return func(p *ProviderConfig) {
+		p.Drift = m
+	}
+}
+
+// DecodeResponse unmarshals a provider response of the given kind into v,
+// reporting drift to the configured DriftMonitor. Without one it is
+// json.Unmarshal.
+func (c *ProviderConfig) DecodeResponse(provider, kind string, data []byte, v any) error {
+	m := c.Drift
+	if m == nil {
+		return json.Unmarshal(data, v)
+	}
+	var raw any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return json.Unmarshal(data, v) // not JSON; let Unmarshal describe it
+	}
+	var d driftWalk
+	d.walk(reflect.TypeOf(v), raw, "")
+	if len(d.unknown)+len(d.changed) > 0 {
+		ev := DriftEvent{Provider: provider, Kind: kind, Unknown: d.unknown, Changed: d.changed, At: clockOr(m.Clock).Now()}
+		c.reportDrift(ev)
+		if m.Strict {
+			return &DriftError{ev}
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ReportDrift reports unknown fields a provider found itself, e.g. stream
+// event types it doesn't handle. It never fails the response.
+func (c *ProviderConfig) ReportDrift(provider, kind string, unknown ...string) {
+	if c.Drift == nil || len(unknown) == 0 {
+		return
+	}
+	c.reportDrift(DriftEvent{Provider: provider, Kind: kind, Unknown: unknown, At: clockOr(c.Drift.Clock).Now()})
+}
+
+func (c *ProviderConfig) reportDrift(ev DriftEvent) {
+	ev = c.Drift.fresh(ev)
+	if len(ev.Unknown)+len(ev.Changed) == 0 {
+		return
+	}
+	if c.Logger != nil {
+		c.Logger.Printf("%s", ev)
+	}
+	if c.Drift.OnDrift != nil {
+		c.Drift.OnDrift(ev)
+	}
+}
+
+// fresh narrows ev to the fields not reported before.
+func (m *DriftMonitor) fresh(ev DriftEvent) DriftEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seen == nil {
+		m.seen = map[string]bool{}
+	}
+	filter := func(fields []string) []string {
+		var out []string
+		for _, f := range fields {
+			key := ev.Provider + "\x00" + ev.Kind + "\x00" + f
+			if !m.seen[key] {
+				m.seen[key] = true
+				out = append(out, f)
+			}
+		}
+		return out
+	}
+	ev.Unknown, ev.Changed = filter(ev.Unknown), filter(ev.Changed)
+	return ev
+}
+
+// driftWalk compares a generically decoded JSON value with the Go type it
+// is about to be decoded into.
+type driftWalk struct {
+	unknown, changed []string
+	found            map[string]bool
+}
+
+var unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+func (d *driftWalk) walk(t reflect.Type, raw any, path string) {
+	for t.Kind() == reflect.Pointer {
+		if t.Implements(unmarshalerType) {
+			return
+		}
+		t = t.Elem()
+	}
+	if raw == nil || t.Kind() == reflect.Interface || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			d.change(path, raw)
+			return
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub := joinPath(path, k)
+			ft, ok := fields[strings.ToLower(k)]
+			if !ok {
+				d.add(&d.unknown, sub)
+			} else {
+				d.walk(ft, obj[k], sub)
+			}
+		}
+	case reflect.Map:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			d.change(path, raw)
+			return
+		}
+		for _, v := range obj {
+			d.walk(t.Elem(), v, path+".*")
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if _, ok := raw.(string); !ok {
+				d.change(path, raw) // []byte is base64
+			}
+			return
+		}
+		arr, ok := raw.([]any)
+		if !ok {
+			d.change(path, raw)
+			return
+		}
+		for _, v := range arr {
+			d.walk(t.Elem(), v, path+"[]")
+		}
+	case reflect.String:
+		if _, ok := raw.(string); !ok {
+			d.change(path, raw)
+		}
+	case reflect.Bool:
+		if _, ok := raw.(bool); !ok {
+			d.change(path, raw)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, ok := raw.(json.Number); !ok {
+			d.change(path, raw)
+		}
+	}
+}
+
+func (d *driftWalk) change(path string, raw any) {
+	kind := "number"
+	switch raw.(type) {
+	case string:
+		kind = "string"
+	case bool:
+		kind = "boolean"
+	case []any:
+		kind = "array"
+	case map[string]any:
+		kind = "object"
+	}
+	if path == "" {
+		path = "(root)"
+	}
+	d.add(&d.changed, path+": got "+kind)
+}
+
+// add records path once; array elements share a path.
+func (d *driftWalk) add(list *[]string, path string) {
+	if d.found == nil {
+		d.found = map[string]bool{}
+	}
+	if !d.found[path] {
+		d.found[path] = true
+		*list = append(*list, path)
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+var jsonFieldCache sync.Map // reflect.Type -> map[string]reflect.Type
+
+// jsonFields maps the lower-cased JSON names of struct t, including
+// promoted fields of embedded structs, to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	if f, ok := jsonFieldCache.Load(t); ok {
+		return f.(map[string]reflect.Type)
+	}
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" && tag == "-" {
+			continue
+		}
+		if f.Anonymous && !hasTag {
+			et := f.Type
+			if et.Kind() == reflect.Pointer {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				for k, v := range jsonFields(et) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+	jsonFieldCache.Store(t, fields)
+	return fields
+}
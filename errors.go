@@ -0,0 +1,106 @@
+package llmagent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StatusCode extracts the upstream HTTP status code from err, or 0 when err
+// did not originate from an HTTP response. SDK clients expose it through an
+// HTTPStatusCode method on their error types.
+func StatusCode(err error) int {
+	var se interface{ HTTPStatusCode() int }
+	if errors.As(err, &se) {
+		return se.HTTPStatusCode()
+	}
+	return 0
+}
+
+// ErrorHeader returns the upstream HTTP response headers behind err, or nil.
+// SDK clients expose them through an HTTPHeader method on their error types.
+func ErrorHeader(err error) http.Header {
+	var he interface{ HTTPHeader() http.Header }
+	if errors.As(err, &he) {
+		return he.HTTPHeader()
+	}
+	return nil
+}
+
+// IsDeterministicError reports whether err will recur for an identical
+// request (bad request, auth failure, unknown model, size guard), as opposed
+// to transient failures worth retrying.
+func IsDeterministicError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsLimitError(err) {
+		return true
+	}
+	switch StatusCode(err) {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden,
+		http.StatusNotFound, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// Attempt records one failed upstream call made while serving a request.
+type Attempt struct {
+	Provider   string        `json:"provider"`
+	Attempt    int           `json:"attempt"` // 1-based attempt number for this provider
+	Err        error         `json:"-"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// AggregateError is returned by Agent.Complete when no provider succeeded.
+// It lists every attempt across the primary and fallback providers.
+type AggregateError struct {
+	Attempts        []Attempt
+	BudgetExhausted bool // the request ran out of its RetryBudget
+}
+
+func (e *AggregateError) Error() string {
+	var b strings.Builder
+	b.WriteString("all providers failed")
+	if e.BudgetExhausted {
+		b.WriteString(" (retry budget exhausted)")
+	}
+	for i, at := range e.Attempts {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%s attempt %d", at.Provider, at.Attempt)
+		if at.StatusCode != 0 {
+			fmt.Fprintf(&b, " [HTTP %d]", at.StatusCode)
+		}
+		fmt.Fprintf(&b, " after %s: %v", at.Duration.Round(time.Millisecond), at.Err)
+	}
+	return b.String()
+}
+
+// Unwrap exposes the individual attempt errors (and ErrRetryBudgetExhausted
+// when applicable) to errors.Is and errors.As.
+func (e *AggregateError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Attempts)+1)
+	if e.BudgetExhausted {
+		errs = append(errs, ErrRetryBudgetExhausted)
+	}
+	for _, at := range e.Attempts {
+		errs = append(errs, at.Err)
+	}
+	return errs
+}
+
+// Last returns the error of the final attempt, or nil if there were none.
+func (e *AggregateError) Last() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1].Err
+}
@@ -0,0 +1,85 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAggregateErrorMessage(t *testing.T) {
+	for _, tc := range []struct {
+		err  AggregateError
+		want string
+	}{
+		{AggregateError{}, "all providers failed"},
+		{AggregateError{BudgetExhausted: true}, "all providers failed (retry budget exhausted)"},
+		{AggregateError{Attempts: []Attempt{
+			{Provider: "openai", Attempt: 1, Err: statusError(503), StatusCode: 503, Duration: 1500 * time.Microsecond},
+			{Provider: "claude", Attempt: 1, Err: errors.New("dial tcp: timeout"), Duration: time.Second},
+		}}, "all providers failed: openai attempt 1 [HTTP 503] after 2ms: upstream failed; claude attempt 1 after 1s: dial tcp: timeout"},
+	} {
+		if got := tc.err.Error(); got != tc.want {
+			t.Errorf("Error() = %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestAggregateErrorUnwrap(t *testing.T) {
+	cause := errors.New("dial tcp: timeout")
+	err := error(&AggregateError{BudgetExhausted: true, Attempts: []Attempt{
+		{Provider: "a", Attempt: 1, Err: statusError(429)},
+		{Provider: "b", Attempt: 1, Err: cause},
+	}})
+	var se statusError
+	if !errors.As(err, &se) || se != 429 {
+		t.Errorf("errors.As found %v, want the first attempt's status", se)
+	}
+	if !errors.Is(err, cause) || !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Error("errors.Is misses an attempt error or the budget")
+	}
+	if last := err.(*AggregateError).Last(); last != cause {
+		t.Errorf("Last = %v, want %v", last, cause)
+	}
+	if (&AggregateError{}).Last() != nil {
+		t.Error("Last of no attempts is not nil")
+	}
+}
+
+func TestCompleteListsEveryAttempt(t *testing.T) {
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		if n == 1 {
+			return nil, rateLimited{retryAfter: "0"}
+		}
+		return nil, statusError(503)
+	})
+	p.cfg.RetryCount = 1
+	fb := newTestProvider("fb", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return nil, statusError(401)
+	})
+	fb.cfg.RetryCount = 3 // a 401 is not retried
+	a, _ := testAgent(t, p, fb)
+	a.RegisterFallbackProviders([]string{"fb"})
+
+	_, err := a.Complete(context.Background(), "p", CompletionRequest{Messages: []Message{User("hi")}})
+	var agg *AggregateError
+	if !errors.As(err, &agg) {
+		t.Fatalf("err = %v, want an AggregateError", err)
+	}
+	want := []struct {
+		provider string
+		attempt  int
+		status   int
+	}{{"p", 1, 429}, {"p", 2, 503}, {"fb", 1, 401}}
+	if len(agg.Attempts) != len(want) {
+		t.Fatalf("attempts = %+v", agg.Attempts)
+	}
+	for i, w := range want {
+		if at := agg.Attempts[i]; at.Provider != w.provider || at.Attempt != w.attempt || at.StatusCode != w.status {
+			t.Errorf("attempt %d = %+v, want %s #%d [%d]", i, at, w.provider, w.attempt, w.status)
+		}
+	}
+	if agg.BudgetExhausted {
+		t.Error("budget reported exhausted without a budget")
+	}
+}
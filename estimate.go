@@ -0,0 +1,69 @@
+package llmagent
+
+import (
+	"context"
+	"fmt"
+)
+
+// Estimate previews a request's size and cost without calling the provider.
+type Estimate struct {
+	Provider string
+	Model    string
+
+	PromptTokens        int // estimated, see EstimateTokens
+	MaxCompletionTokens int // the request's max tokens, capped by the context window
+	ContextWindow       int // 0 when the model is unknown
+	// Fits reports whether the prompt leaves room in the context window;
+	// always true for unknown models.
+	Fits bool
+
+	// MinCost and MaxCost bound the price in USD: the prompt alone, and
+	// the prompt plus MaxCompletionTokens. Priced is false when the model
+	// has no catalog pricing, leaving both at 0.
+	MinCost float64
+	MaxCost float64
+	Priced  bool
+}
+
+// Estimate resolves providerName and req the way Complete would (aliases,
+// defaults, attached documents) and prices the result with the model
+// catalog. Nothing is sent upstream.
+func (a *Agent) Estimate(ctx context.Context, providerName string, req CompletionRequest) (Estimate, error) {
+	if err := validateMessages(req.Messages); err != nil {
+		return Estimate{}, err
+	}
+	req = a.renderDocuments(req)
+	providerName, req = a.resolveAlias(providerName, req)
+	name := providerName
+	if name == "" {
+		name, req = a.resolveAlias(a.DefaultProvider, req)
+	}
+	p, ok := a.provider(name)
+	if !ok {
+		return Estimate{}, fmt.Errorf("provider %q not registered", name)
+	}
+	req = ResolveRequest(p.GetConfig(), req)
+	est := Estimate{
+		Provider:            p.Name(),
+		Model:               req.Model,
+		PromptTokens:        promptTokens(req),
+		MaxCompletionTokens: req.MaxTokens,
+		Fits:                true,
+	}
+	info, ok := LookupModel(req.Model)
+	if !ok {
+		return est, nil
+	}
+	if info.ContextWindow > 0 {
+		est.ContextWindow = info.ContextWindow
+		room := info.ContextWindow - est.PromptTokens
+		est.Fits = room > 0
+		est.MaxCompletionTokens = max(min(est.MaxCompletionTokens, room), 0)
+	}
+	if info.InputPer1K > 0 || info.OutputPer1K > 0 {
+		est.Priced = true
+		est.MinCost = info.Cost(Usage{PromptTokens: est.PromptTokens})
+		est.MaxCost = info.Cost(Usage{PromptTokens: est.PromptTokens, CompletionTokens: est.MaxCompletionTokens})
+	}
+	return est, nil
+}
@@ -1,3 +1,9 @@
+//go:build !js && !wasip1
+
+// The example reads keys from a secretr vault, which needs OS clipboard and
+// terminal support; the llmagent packages themselves build for js/wasm and
+// wasip1.
+
 // File: main.go
 package main
 
@@ -19,9 +25,11 @@ func main() {
 	claudeProvider := providers.NewClaude(secretr.MustGet("ANTHROPIC_API_KEY"))
 
 	agent := llmagent.NewAgent()
-	agent.RegisterProvidersFromUser(openaiProvider)
-	agent.RegisterProvidersFromUser(deepseekProvider)
-	agent.RegisterProvidersFromUser(claudeProvider)
+	for _, p := range []llmagent.Provider{openaiProvider, deepseekProvider, claudeProvider} {
+		if err := agent.RegisterProvidersFromUser(p); err != nil {
+			panic(err)
+		}
+	}
 
 	if err := agent.SetDefault("claude"); err != nil {
 		panic(err)
@@ -31,8 +39,8 @@ func main() {
 	req := llmagent.CompletionRequest{
 		Stream: &streamReq,
 		Messages: []llmagent.Message{
-			{Role: "system", Content: "You are a helpful assistant."},
-			{Role: "user", Content: "What's the capital of France?"},
+			llmagent.System("You are a helpful assistant."),
+			llmagent.User("What's the capital of France?"),
 		},
 	}
 	stream, err := agent.Complete(ctx, "", req)
@@ -0,0 +1,175 @@
+package llmagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// ExportFormat selects the output of Session.Export.
+type ExportFormat string
+
+const (
+	ExportMarkdown ExportFormat = "markdown"
+	ExportHTML     ExportFormat = "html"
+	ExportJSON     ExportFormat = "json"
+)
+
+// ExportedMessage is one message of an exported conversation.
+type ExportedMessage struct {
+	Role       Role       `json:"role"`
+	Name       string     `json:"name,omitempty"` // tool name for tool messages
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // calls made by an assistant turn
+	ToolCallID string     `json:"tool_call_id,omitempty"` // call a tool message answers
+	Citations  []Citation `json:"citations,omitempty"`
+}
+
+// ExportedConversation is the canonical JSON form of a session.
+type ExportedConversation struct {
+	Version  int               `json:"version"`
+	ID       string            `json:"id"`
+	Provider string            `json:"provider,omitempty"`
+	Model    string            `json:"model,omitempty"`
+	Messages []ExportedMessage `json:"messages"`
+	Usage    Usage             `json:"usage"`
+	Cost     float64           `json:"cost,omitempty"`
+}
+
+// Snapshot returns the conversation in its export form.
+func (s *Session) Snapshot() ExportedConversation {
+	stats := s.Stats()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := ExportedConversation{
+		Version:  WireVersion,
+		ID:       s.ID,
+		Provider: s.provider,
+		Model:    s.model,
+		Messages: make([]ExportedMessage, len(s.messages)),
+		Usage:    stats.Usage,
+		Cost:     stats.Cost,
+	}
+	for i, msg := range s.messages {
+		c.Messages[i] = ExportedMessage{
+			Role:       msg.Role,
+			Name:       msg.Name,
+			Content:    msg.Content,
+			ToolCalls:  append([]ToolCall(nil), msg.ToolCalls...),
+			ToolCallID: msg.ToolCallID,
+			Citations:  s.citations[i],
+		}
+	}
+	return c
+}
+
+// Export writes the conversation to w in format.
+func (s *Session) Export(w io.Writer, format ExportFormat) error {
+	c := s.Snapshot()
+	switch format {
+	case ExportJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	case ExportMarkdown:
+		_, err := io.WriteString(w, c.Markdown())
+		return err
+	case ExportHTML:
+		return exportHTML.Execute(w, c)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// Markdown renders the conversation as a Markdown transcript.
+func (c ExportedConversation) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Conversation %s\n\n", c.ID)
+	if c.Model != "" {
+		fmt.Fprintf(&b, "_%s · %s_\n\n", c.Provider, c.Model)
+	}
+	for _, msg := range c.Messages {
+		fmt.Fprintf(&b, "## %s\n\n", messageHeading(msg))
+		switch {
+		case msg.Role == RoleTool:
+			fmt.Fprintf(&b, "```\n%s\n```\n\n", strings.TrimRight(msg.Content, "\n"))
+		case strings.TrimSpace(msg.Content) != "":
+			fmt.Fprintf(&b, "%s\n\n", strings.TrimSpace(msg.Content))
+		}
+		for _, tc := range msg.ToolCalls {
+			fmt.Fprintf(&b, "Tool call `%s` (%s):\n\n```json\n%s\n```\n\n", tc.Name, tc.ID, toolCallArgs(tc))
+		}
+		for _, cit := range msg.Citations {
+			fmt.Fprintf(&b, "[%d]: %s\n", cit.Index, citationLabel(cit))
+		}
+		if len(msg.Citations) > 0 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func messageHeading(msg ExportedMessage) string {
+	role := string(msg.Role)
+	if role != "" {
+		role = strings.ToUpper(role[:1]) + role[1:]
+	}
+	switch {
+	case msg.Name != "" && msg.ToolCallID != "":
+		return role + " (" + msg.Name + " · " + msg.ToolCallID + ")"
+	case msg.Name != "":
+		return role + " (" + msg.Name + ")"
+	}
+	return role
+}
+
+// toolCallArgs is the call's arguments as written by the model, "{}" when
+// there are none.
+func toolCallArgs(tc ToolCall) string {
+	if len(tc.Arguments) == 0 {
+		return "{}"
+	}
+	return string(tc.Arguments)
+}
+
+func citationLabel(c Citation) string {
+	switch {
+	case c.Title != "" && c.Source != "":
+		return c.Title + " — " + c.Source
+	case c.Title != "":
+		return c.Title
+	case c.Source != "":
+		return c.Source
+	}
+	return c.DocumentID
+}
+
+var exportHTML = template.Must(template.New("export").Funcs(template.FuncMap{
+	"heading":  messageHeading,
+	"citation": citationLabel,
+	"args":     toolCallArgs,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Conversation {{.ID}}</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:48rem;margin:2rem auto;padding:0 1rem;color:#222}
+.msg{border-radius:8px;padding:.75rem 1rem;margin:1rem 0;white-space:pre-wrap}
+.system{background:#f4f4f4;color:#555}.user{background:#e8f0fe}.assistant{background:#fff;border:1px solid #ddd}
+.tool{background:#fdf6e3;font-family:monospace}
+.role{font-weight:600;margin-bottom:.25rem;white-space:normal}
+.call{font-family:monospace;font-size:.9em;background:#f4f4f4;border-radius:4px;padding:.25rem .5rem;margin-top:.5rem}
+ol.citations{font-size:.85em;color:#555;white-space:normal}
+</style>
+</head>
+<body>
+<h1>Conversation {{.ID}}</h1>
+{{if .Model}}<p><em>{{.Provider}} · {{.Model}}</em></p>{{end}}
+{{range .Messages}}<div class="msg {{.Role}}"><div class="role">{{heading .}}</div>{{.Content}}{{range .ToolCalls}}
+<div class="call">{{.Name}}({{args .}}) <small>{{.ID}}</small></div>{{end}}{{if .Citations}}
+<ol class="citations">{{range .Citations}}<li value="{{.Index}}">{{citation .}}</li>{{end}}</ol>{{end}}</div>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,40 @@
+package llmagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func toolSession(t *testing.T) *Session {
+	t.Helper()
+	call := ToolCall{ID: "call_1", Name: "weather", Arguments: json.RawMessage(`{"city":"Oslo"}`)}
+	return NewAgent().NewSession(
+		User("weather in Oslo?"),
+		ToolCallsMessage("", []ToolCall{call}),
+		ToolReply(call, "12C, sunny"),
+	)
+}
+
+func TestExportIncludesToolCalls(t *testing.T) {
+	s := toolSession(t)
+	for _, tc := range []struct {
+		format ExportFormat
+		want   []string
+	}{
+		{ExportJSON, []string{`"tool_calls": [`, `"id": "call_1"`, `"tool_call_id": "call_1"`}},
+		{ExportMarkdown, []string{"Tool call `weather` (call_1)", `{"city":"Oslo"}`, "## Tool (weather · call_1)"}},
+		{ExportHTML, []string{`<div class="call">weather({&#34;city&#34;:&#34;Oslo&#34;}) <small>call_1</small></div>`, "Tool (weather · call_1)"}},
+	} {
+		var buf bytes.Buffer
+		if err := s.Export(&buf, tc.format); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s export lacks %q:\n%s", tc.format, want, buf.String())
+			}
+		}
+	}
+}
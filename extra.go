@@ -0,0 +1,46 @@
+package llmagent
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// ParamError reports a request parameter the provider won't accept. It
+// counts as a 400 so it is neither retried nor cached as a success.
+type ParamError struct {
+	Provider string
+	Param    string
+	Reason   string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("provider %q: parameter %q %s", e.Provider, e.Param, e.Reason)
+}
+
+// HTTPStatusCode makes StatusCode and IsDeterministicError treat the error
+// like the upstream 400 it prevents.
+func (e *ParamError) HTTPStatusCode() int { return http.StatusBadRequest }
+
+// CheckExtra rejects Extra keys outside the provider's AllowedExtra list.
+func (cfg *ProviderConfig) CheckExtra(provider string, req CompletionRequest) error {
+	if cfg.AllowedExtra == nil {
+		return nil
+	}
+	for key := range req.Extra {
+		if !slices.Contains(cfg.AllowedExtra, key) {
+			return &ParamError{Provider: provider, Param: key, Reason: "is not in the allowed extra parameters"}
+		}
+	}
+	return nil
+}
+
+// MergeExtra copies extra into payload, skipping keys the payload already
+// sets so pass-through parameters can't clobber modelled ones.
+func MergeExtra(payload, extra map[string]any) {
+	for k, v := range extra {
+		if _, ok := payload[k]; !ok {
+			payload[k] = v
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package llmagent
+
+import "strings"
+
+// finishReasons maps each provider's finish and stop signals to a
+// FinishReason. Providers without an entry, e.g. OpenAI-compatible servers
+// registered under another name, fall back to commonFinishReasons.
+var finishReasons = map[string]map[string]FinishReason{
+	"openai": {
+		"stop":           FinishStop,
+		"length":         FinishLength,
+		"tool_calls":     FinishToolCalls,
+		"function_call":  FinishToolCalls, // the deprecated functions API
+		"content_filter": FinishContentFilter,
+	},
+	"deepseek": {
+		"stop":                         FinishStop,
+		"length":                       FinishLength,
+		"tool_calls":                   FinishToolCalls,
+		"content_filter":               FinishContentFilter,
+		"insufficient_system_resource": FinishError,
+	},
+	"claude": {
+		"end_turn":                      FinishStop,
+		"stop_sequence":                 FinishStop,
+		"pause_turn":                    FinishPaused,
+		"max_tokens":                    FinishLength,
+		"model_context_window_exceeded": FinishLength,
+		"tool_use":                      FinishToolCalls,
+		"refusal":                       FinishContentFilter,
+	},
+}
+
+// commonFinishReasons covers the spellings seen across APIs.
+var commonFinishReasons = map[string]FinishReason{
+	"stop":             FinishStop,
+	"end_turn":         FinishStop,
+	"stop_sequence":    FinishStop,
+	"eos":              FinishStop,
+	"length":           FinishLength,
+	"max_tokens":       FinishLength,
+	"tool_calls":       FinishToolCalls,
+	"tool_use":         FinishToolCalls,
+	"function_call":    FinishToolCalls,
+	"content_filter":   FinishContentFilter,
+	"content_filtered": FinishContentFilter,
+	"safety":           FinishContentFilter,
+	"refusal":          FinishContentFilter,
+	"error":            FinishError,
+}
+
+// ParseFinishReason normalizes the finish or stop signal raw reported by
+// provider, e.g. Anthropic's "end_turn" or "max_tokens", to a
+// FinishReason. Matching ignores case. A signal neither the provider's
+// table nor the common spellings know is passed through lowercased, so
+// callers still see it; empty stays empty.
+func ParseFinishReason(provider, raw string) FinishReason {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if raw == "" {
+		return ""
+	}
+	if r, ok := finishReasons[provider][raw]; ok {
+		return r
+	}
+	if r, ok := commonFinishReasons[raw]; ok {
+		return r
+	}
+	return FinishReason(raw)
+}
+
+// Known reports whether r is one of the FinishReason constants.
+func (r FinishReason) Known() bool {
+	switch r {
+	case FinishStop, FinishLength, FinishToolCalls, FinishContentFilter, FinishError, FinishPaused:
+		return true
+	}
+	return false
+}
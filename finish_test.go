@@ -0,0 +1,92 @@
+package llmagent
+
+import "testing"
+
+func TestParseFinishReason(t *testing.T) {
+	tests := []struct {
+		provider, raw string
+		want          FinishReason
+	}{
+		{"openai", "stop", FinishStop},
+		{"openai", "length", FinishLength},
+		{"openai", "tool_calls", FinishToolCalls},
+		{"openai", "function_call", FinishToolCalls},
+		{"openai", "content_filter", FinishContentFilter},
+
+		{"deepseek", "stop", FinishStop},
+		{"deepseek", "length", FinishLength},
+		{"deepseek", "tool_calls", FinishToolCalls},
+		{"deepseek", "content_filter", FinishContentFilter},
+		{"deepseek", "insufficient_system_resource", FinishError},
+
+		{"claude", "end_turn", FinishStop},
+		{"claude", "stop_sequence", FinishStop},
+		{"claude", "pause_turn", FinishPaused},
+		{"claude", "max_tokens", FinishLength},
+		{"claude", "model_context_window_exceeded", FinishLength},
+		{"claude", "tool_use", FinishToolCalls},
+		{"claude", "refusal", FinishContentFilter},
+
+		// common spellings, for providers without a table
+		{"ollama", "stop", FinishStop},
+		{"ollama", "end_turn", FinishStop},
+		{"ollama", "stop_sequence", FinishStop},
+		{"ollama", "eos", FinishStop},
+		{"ollama", "length", FinishLength},
+		{"ollama", "max_tokens", FinishLength},
+		{"ollama", "tool_calls", FinishToolCalls},
+		{"ollama", "tool_use", FinishToolCalls},
+		{"ollama", "function_call", FinishToolCalls},
+		{"ollama", "content_filter", FinishContentFilter},
+		{"ollama", "content_filtered", FinishContentFilter},
+		{"ollama", "safety", FinishContentFilter},
+		{"ollama", "refusal", FinishContentFilter},
+		{"ollama", "error", FinishError},
+
+		// a provider's table falls back to the common spellings
+		{"openai", "end_turn", FinishStop},
+		// case and whitespace don't matter
+		{"gemini", " SAFETY ", FinishContentFilter},
+		{"claude", "End_Turn", FinishStop},
+		// unknown signals pass through lowercased, empty stays empty
+		{"openai", "Mystery", "mystery"},
+		{"claude", "", ""},
+		{"", "  ", ""},
+	}
+	for _, tt := range tests {
+		if got := ParseFinishReason(tt.provider, tt.raw); got != tt.want {
+			t.Errorf("ParseFinishReason(%q, %q) = %q, want %q", tt.provider, tt.raw, got, tt.want)
+		}
+	}
+
+	// every table entry is covered above
+	covered := map[[2]string]bool{}
+	for _, tt := range tests {
+		covered[[2]string{tt.provider, tt.raw}] = true
+	}
+	for provider, table := range finishReasons {
+		for raw := range table {
+			if !covered[[2]string{provider, raw}] {
+				t.Errorf("no test for %s %q", provider, raw)
+			}
+		}
+	}
+	for raw := range commonFinishReasons {
+		if !covered[[2]string{"ollama", raw}] {
+			t.Errorf("no test for common %q", raw)
+		}
+	}
+}
+
+func TestFinishReasonKnown(t *testing.T) {
+	for _, r := range []FinishReason{FinishStop, FinishLength, FinishToolCalls, FinishContentFilter, FinishError, FinishPaused} {
+		if !r.Known() {
+			t.Errorf("%q not known", r)
+		}
+	}
+	for _, r := range []FinishReason{"", "end_turn", "mystery"} {
+		if r.Known() {
+			t.Errorf("%q known", r)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package llmagent
+
+import (
+	"context"
+	"strings"
+)
+
+// withSuggestions forwards ch and, once an answer completes cleanly, sends
+// a suggestions event with n follow-ups before the Done event. Failing to
+// suggest doesn't fail the answer.
+func (a *Agent) withSuggestions(ctx context.Context, msgs []Message, n int, ch <-chan CompletionResponse) <-chan CompletionResponse {
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		var answer strings.Builder
+		var failed, tools bool
+		for resp := range ch {
+			if resp.Err != nil {
+				failed = true
+			}
+			if len(resp.ToolCalls) > 0 {
+				tools = true
+			}
+			if resp.Done && !failed && !tools && answer.Len() > 0 && ctx.Err() == nil {
+				convo := append(append([]Message(nil), msgs...), Assistant(answer.String()))
+				if qs, err := a.suggestQuestions(ctx, a.SuggestProvider, a.SuggestModel, convo, n); err == nil && len(qs) > 0 && !emit(CompletionResponse{Provider: resp.Provider, SuggestedQuestions: qs}) {
+					return
+				}
+			}
+			answer.WriteString(resp.Content)
+			if !emit(resp) {
+				return
+			}
+		}
+	})
+}
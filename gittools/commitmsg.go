@@ -0,0 +1,134 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// MessageOptions configures CommitMessage.
+type MessageOptions struct {
+	Provider string // empty uses the agent's default
+	Model    string
+	// Style is appended to the instructions, e.g. "Use Conventional
+	// Commits." or the project's own rules.
+	Style string
+	// MaxDiffBytes is the largest staged diff sent in one piece; bigger
+	// diffs are summarized file by file first. Defaults to 24 KiB.
+	MaxDiffBytes int
+}
+
+const messagePrompt = `Write a git commit message for the staged changes below.
+The subject line is imperative, at most 72 characters, without a trailing
+period. Add a body after a blank line only if the change needs explaining;
+wrap it at 72 columns and say what changed and why, not how.
+Reply with the commit message only.%s
+
+%s`
+
+const summaryPrompt = `Summarize this diff of %s in one to three short sentences: what changed
+and, if apparent, why. Reply with the summary only.
+
+%s`
+
+// CommitMessage drafts a commit message for the staged changes. Large
+// diffs go through a two-step chain: each file's diff is summarized, then
+// the message is written from the summaries.
+func (r *Repo) CommitMessage(ctx context.Context, a *llmagent.Agent, opts MessageOptions) (string, error) {
+	diff, err := r.Exec(ctx, "diff", "--cached", "--no-color", "--no-ext-diff", "--stat", "--patch")
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return "", errors.New("nothing staged")
+	}
+	max := opts.MaxDiffBytes
+	if max <= 0 {
+		max = 24 << 10
+	}
+	input := diff
+	if len(diff) > max {
+		if input, err = r.summarize(ctx, a, opts, diff, max); err != nil {
+			return "", err
+		}
+	}
+	style := ""
+	if opts.Style != "" {
+		style = "\n" + opts.Style
+	}
+	msg, err := ask(ctx, a, opts, fmt.Sprintf(messagePrompt, style, input))
+	if err != nil {
+		return "", err
+	}
+	return cleanMessage(msg), nil
+}
+
+// summarize replaces each file's diff with a model-written summary.
+func (r *Repo) summarize(ctx context.Context, a *llmagent.Agent, opts MessageOptions, diff string, max int) (string, error) {
+	var b strings.Builder
+	b.WriteString("Per-file summaries of the staged diff:\n")
+	for _, file := range splitDiff(diff) {
+		body := file.body
+		if len(body) > max {
+			body = body[:max] + "\n[diff truncated]"
+		}
+		sum, err := ask(ctx, a, opts, fmt.Sprintf(summaryPrompt, file.path, body))
+		if err != nil {
+			return "", fmt.Errorf("summarize %s: %w", file.path, err)
+		}
+		fmt.Fprintf(&b, "- %s: %s\n", file.path, strings.TrimSpace(sum))
+	}
+	return b.String(), nil
+}
+
+type fileDiff struct {
+	path, body string
+}
+
+// splitDiff splits a patch at its "diff --git" headers; the --stat
+// preamble is dropped.
+func splitDiff(diff string) []fileDiff {
+	var out []fileDiff
+	for _, part := range strings.Split(diff, "\ndiff --git ")[1:] {
+		header, _, _ := strings.Cut(part, "\n")
+		path := header
+		if i := strings.LastIndex(header, " b/"); i >= 0 {
+			path = header[i+3:]
+		}
+		out = append(out, fileDiff{path: path, body: "diff --git " + part})
+	}
+	return out
+}
+
+func ask(ctx context.Context, a *llmagent.Agent, opts MessageOptions, prompt string) (string, error) {
+	ch, err := a.Complete(ctx, opts.Provider, llmagent.CompletionRequest{
+		Model:       opts.Model,
+		Stream:      llmagent.Bool(false),
+		Temperature: llmagent.Float64(0.2),
+		Messages:    []llmagent.Message{llmagent.User(prompt)},
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := llmagent.Collect(ch)
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
+
+// cleanMessage strips code fences and quotes models like to add.
+func cleanMessage(msg string) string {
+	msg = strings.TrimSpace(msg)
+	if strings.HasPrefix(msg, "```") {
+		msg = strings.TrimPrefix(msg, "```")
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			msg = msg[i+1:]
+		}
+		msg = strings.TrimSuffix(strings.TrimSpace(msg), "```")
+	}
+	return strings.Trim(strings.TrimSpace(msg), `"`)
+}
@@ -0,0 +1,362 @@
+// Package gittools exposes a git repository to an agent as tools: status,
+// diff, log, commit and branch. Git runs as a subprocess without a shell,
+// in an environment built from scratch, with hooks, pagers, prompts,
+// system config, filter drivers, textconv and external diff commands
+// disabled, arguments checked against option injection, and every tool
+// command reported to Repo.OnRun for auditing.
+package gittools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Repo is a working tree the tools operate on.
+type Repo struct {
+	Dir       string
+	Git       string        // git binary; defaults to "git" on PATH
+	Timeout   time.Duration // per command; defaults to 30s
+	MaxOutput int           // bytes of output returned; defaults to 64 KiB
+	ReadOnly  bool          // leave out git_commit and branch creation
+	// Author, if set, is used for commits instead of the repository's
+	// configured identity, e.g. "Agent <agent@example.com>".
+	Author string
+	// OnRun receives a record of every git invocation.
+	OnRun func(Run)
+}
+
+// Run is the audit record of one git invocation.
+type Run struct {
+	At       time.Time     `json:"at"`
+	Dir      string        `json:"dir"`
+	Args     []string      `json:"args"`
+	Duration time.Duration `json:"duration"`
+	ExitCode int           `json:"exit_code"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// GitError is a git command that exited non-zero.
+type GitError struct {
+	Args   []string
+	Code   int
+	Stderr string
+}
+
+func (e *GitError) Error() string {
+	return fmt.Sprintf("git %s: exit %d: %s", strings.Join(e.Args, " "), e.Code, strings.TrimSpace(e.Stderr))
+}
+
+// sandbox flags go before every subcommand
+var sandbox = []string{
+	"-c", "core.hooksPath=/dev/null",
+	"-c", "core.pager=cat",
+	"-c", "core.fsmonitor=false",
+	"-c", "credential.helper=",
+	"-c", "diff.external=",
+	"-c", "log.showSignature=false",
+	"-c", "protocol.allow=never",
+	"--no-optional-locks",
+}
+
+// env is the whole environment git runs with. Nothing is inherited but
+// PATH and HOME (for the user's identity), so GIT_DIR, GIT_CONFIG_* and
+// the like can't redirect it.
+func env() []string {
+	e := []string{
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ASKPASS=",
+		"SSH_ASKPASS=",
+		"GIT_EDITOR=true",
+		"GIT_NO_LAZY_FETCH=1",
+		"LC_ALL=C",
+	}
+	for _, k := range []string{"PATH", "HOME"} {
+		if v, ok := os.LookupEnv(k); ok {
+			e = append(e, k+"="+v)
+		}
+	}
+	return e
+}
+
+// filterOverrides blanks every filter driver configured for the
+// repository, so clean, smudge and process commands never run. Git has no
+// switch for that, and -c cannot match filter.* by pattern.
+func (r *Repo) filterOverrides(ctx context.Context, bin string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, bin, "config", "--null", "--name-only", "--get-regexp", `^filter\.`)
+	cmd.Dir, cmd.Env = r.Dir, env()
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		return nil, nil // no filters
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list filter drivers: %w", err)
+	}
+	seen := map[string]bool{}
+	var args []string
+	for _, key := range strings.Split(string(out), "\x00") {
+		i, j := strings.IndexByte(key, '.'), strings.LastIndexByte(key, '.')
+		if i < 0 || j <= i || seen[key[i+1:j]] {
+			continue
+		}
+		name := key[i+1 : j]
+		seen[name] = true
+		for _, field := range []string{"clean", "smudge", "process"} {
+			args = append(args, "-c", "filter."+name+"."+field+"=")
+		}
+		args = append(args, "-c", "filter."+name+".required=false")
+	}
+	return args, nil
+}
+
+// Exec runs git with args in the repository and returns stdout, cut to
+// MaxOutput.
+func (r *Repo) Exec(ctx context.Context, args ...string) (string, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	bin := r.Git
+	if bin == "" {
+		bin = "git"
+	}
+	filters, err := r.filterOverrides(ctx, bin)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, bin, slices.Concat(sandbox, filters, args)...)
+	cmd.Dir = r.Dir
+	cmd.Env = env()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	run := Run{At: start, Dir: r.Dir, Args: args, Duration: time.Since(start)}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		run.ExitCode = exit.ExitCode()
+		err = &GitError{Args: args, Code: run.ExitCode, Stderr: stderr.String()}
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if r.OnRun != nil {
+		r.OnRun(run)
+	}
+	if err != nil {
+		return "", err
+	}
+	return r.cut(stdout.String()), nil
+}
+
+func (r *Repo) cut(s string) string {
+	max := r.MaxOutput
+	if max <= 0 {
+		max = 64 << 10
+	}
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + fmt.Sprintf("\n[output truncated: %d of %d bytes]", max, len(s))
+}
+
+// checkArg rejects values that git would read as options.
+func checkArg(kind, v string) error {
+	if strings.HasPrefix(v, "-") {
+		return fmt.Errorf("%s %q must not start with '-'", kind, v)
+	}
+	if strings.ContainsAny(v, "\x00\n") {
+		return fmt.Errorf("%s %q contains control characters", kind, v)
+	}
+	return nil
+}
+
+// Status returns the short status with the branch line.
+func (r *Repo) Status(ctx context.Context) (string, error) {
+	out, err := r.Exec(ctx, "status", "--short", "--branch", "--ignore-submodules=all")
+	if err == nil && strings.Count(out, "\n") <= 1 {
+		out += "(working tree clean)\n"
+	}
+	return out, err
+}
+
+// Diff returns the working tree diff, the staged diff, or the diff against
+// ref, limited to paths.
+func (r *Repo) Diff(ctx context.Context, staged bool, ref string, paths ...string) (string, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--no-textconv", "--ignore-submodules=all"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	if ref != "" {
+		if err := checkArg("ref", ref); err != nil {
+			return "", err
+		}
+		args = append(args, ref)
+	}
+	for _, p := range paths {
+		if err := checkArg("path", p); err != nil {
+			return "", err
+		}
+	}
+	args = append(append(args, "--"), paths...)
+	return r.Exec(ctx, args...)
+}
+
+// Log returns the last n commits, one per line.
+func (r *Repo) Log(ctx context.Context, n int) (string, error) {
+	if n <= 0 || n > 200 {
+		n = 20
+	}
+	return r.Exec(ctx, "log", "--no-color", fmt.Sprintf("-n%d", n), "--format=%h %ad %an: %s", "--date=short")
+}
+
+// Commit stages paths (all tracked changes when all is set) and commits
+// with message. It returns the new commit's short hash and subject.
+func (r *Repo) Commit(ctx context.Context, message string, all bool, paths ...string) (string, error) {
+	if r.ReadOnly {
+		return "", errors.New("repository is read-only")
+	}
+	if strings.TrimSpace(message) == "" {
+		return "", errors.New("empty commit message")
+	}
+	for _, p := range paths {
+		if err := checkArg("path", p); err != nil {
+			return "", err
+		}
+	}
+	if len(paths) > 0 {
+		if _, err := r.Exec(ctx, append([]string{"add", "--"}, paths...)...); err != nil {
+			return "", err
+		}
+	}
+	args := []string{"commit", "--no-verify", "--no-gpg-sign", "-m", message}
+	if all {
+		args = append(args, "--all")
+	}
+	if r.Author != "" {
+		args = append(args, "--author="+r.Author)
+	}
+	if _, err := r.Exec(ctx, args...); err != nil {
+		return "", err
+	}
+	return r.Exec(ctx, "log", "-n1", "--format=%h %s")
+}
+
+// Branches lists local branches, the current one marked with "*".
+func (r *Repo) Branches(ctx context.Context) (string, error) {
+	return r.Exec(ctx, "branch", "--no-color", "--list")
+}
+
+// CreateBranch creates name from the given start point (HEAD if empty) and
+// optionally switches to it.
+func (r *Repo) CreateBranch(ctx context.Context, name, from string, checkout bool) (string, error) {
+	if r.ReadOnly {
+		return "", errors.New("repository is read-only")
+	}
+	if err := checkArg("branch", name); err != nil {
+		return "", err
+	}
+	if _, err := r.Exec(ctx, "check-ref-format", "--branch", name); err != nil {
+		return "", fmt.Errorf("invalid branch name %q", name)
+	}
+	args := []string{"branch", name}
+	if checkout {
+		args = []string{"switch", "-c", name}
+	}
+	if from != "" {
+		if err := checkArg("ref", from); err != nil {
+			return "", err
+		}
+		args = append(args, from)
+	}
+	if _, err := r.Exec(ctx, args...); err != nil {
+		return "", err
+	}
+	if checkout {
+		return "switched to new branch " + name, nil
+	}
+	return "created branch " + name, nil
+}
+
+// Tools returns the repository's tools. Pass them through an
+// llmagent.ToolGuard to require approval for git_commit and git_branch.
+func (r *Repo) Tools() []llmagent.ToolFunc {
+	tools := []llmagent.ToolFunc{
+		tool("git_status", "Show the current branch and changed files.",
+			`{"type":"object","properties":{}}`,
+			func(ctx context.Context, _ struct{}) (string, error) { return r.Status(ctx) }),
+		tool("git_diff", "Show changes: unstaged by default, staged with staged=true, or against a ref.",
+			`{"type":"object","properties":{"staged":{"type":"boolean","default":false},"ref":{"type":"string","description":"commit or branch to diff against"},"paths":{"type":"array","items":{"type":"string"}}}}`,
+			func(ctx context.Context, in struct {
+				Staged bool     `json:"staged"`
+				Ref    string   `json:"ref"`
+				Paths  []string `json:"paths"`
+			}) (string, error) {
+				return r.Diff(ctx, in.Staged, in.Ref, in.Paths...)
+			}),
+		tool("git_log", "List recent commits.",
+			`{"type":"object","properties":{"n":{"type":"integer","minimum":1,"maximum":200,"default":20}}}`,
+			func(ctx context.Context, in struct {
+				N int `json:"n"`
+			}) (string, error) {
+				return r.Log(ctx, in.N)
+			}),
+	}
+	if r.ReadOnly {
+		return append(tools, tool("git_branch", "List local branches.",
+			`{"type":"object","properties":{}}`,
+			func(ctx context.Context, _ struct{}) (string, error) { return r.Branches(ctx) }))
+	}
+	return append(tools,
+		tool("git_commit", "Stage the given paths (or all tracked changes with all=true) and commit.",
+			`{"type":"object","properties":{"message":{"type":"string","minLength":1},"paths":{"type":"array","items":{"type":"string"}},"all":{"type":"boolean","default":false}},"required":["message"]}`,
+			func(ctx context.Context, in struct {
+				Message string   `json:"message"`
+				Paths   []string `json:"paths"`
+				All     bool     `json:"all"`
+			}) (string, error) {
+				return r.Commit(ctx, in.Message, in.All, in.Paths...)
+			}),
+		tool("git_branch", "List local branches, or create one when name is given.",
+			`{"type":"object","properties":{"name":{"type":"string"},"from":{"type":"string","description":"start point, HEAD by default"},"checkout":{"type":"boolean","default":false}}}`,
+			func(ctx context.Context, in struct {
+				Name     string `json:"name"`
+				From     string `json:"from"`
+				Checkout bool   `json:"checkout"`
+			}) (string, error) {
+				if in.Name == "" {
+					return r.Branches(ctx)
+				}
+				return r.CreateBranch(ctx, in.Name, in.From, in.Checkout)
+			}),
+	)
+}
+
+func tool[T any](name, description, schema string, run func(context.Context, T) (string, error)) llmagent.ToolFunc {
+	return llmagent.ToolFunc{
+		ToolDefinition: llmagent.ToolDefinition{Name: name, Description: description, Parameters: json.RawMessage(schema)},
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var in T
+			if len(args) > 0 {
+				if err := json.Unmarshal(args, &in); err != nil {
+					return "", err
+				}
+			}
+			return run(ctx, in)
+		},
+	}
+}
@@ -0,0 +1,122 @@
+package gittools
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// hostileRepo returns a repository whose config and attributes try to run
+// commands through hooks, filter drivers, textconv and external diff; each
+// command creates a file in the returned marker directory.
+func hostileRepo(t *testing.T) (dir, markers string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir, markers = t.TempDir(), t.TempDir()
+	touch := func(name string) string { return "touch " + filepath.Join(markers, name) }
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	write := func(name, content string, mode os.FileMode) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	git("config", "user.name", "Test")
+	git("config", "user.email", "test@example.com")
+	write("a.txt", "one\n", 0o644)
+	git("add", "a.txt")
+	git("commit", "-q", "-m", "init")
+
+	for k, v := range map[string]string{
+		"filter.evil.clean":           touch("clean") + "; cat",
+		"filter.evil.smudge":          touch("smudge") + "; cat",
+		"filter.evil.process":         touch("process"),
+		"filter.evil.required":        "true",
+		"filter.my.dotted.evil.clean": touch("dotted") + "; cat",
+		"diff.evil.textconv":          touch("textconv") + "; cat",
+		"diff.evil.command":           touch("diffcmd"),
+		"diff.external":               touch("external"),
+		"core.fsmonitor":              touch("fsmonitor"),
+		"core.pager":                  touch("pager"),
+	} {
+		git("config", k, v)
+	}
+	write(".gitattributes", "*.txt filter=evil diff=evil\n*.md filter=my.dotted.evil\n", 0o644)
+	write("b.md", "md\n", 0o644)
+	write("a.txt", "two\n", 0o644)
+	hooks := filepath.Join(dir, ".git", "hooks")
+	for _, hook := range []string{"pre-commit", "commit-msg", "post-commit", "post-checkout"} {
+		if err := os.WriteFile(filepath.Join(hooks, hook), []byte("#!/bin/sh\n"+touch(hook)+"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, markers
+}
+
+func TestSandbox(t *testing.T) {
+	dir, markers := hostileRepo(t)
+	// a parent environment pointing git elsewhere is ignored
+	t.Setenv("GIT_DIR", filepath.Join(t.TempDir(), "elsewhere"))
+	t.Setenv("GIT_EXTERNAL_DIFF", "touch "+filepath.Join(markers, "env"))
+
+	var runs int
+	r := &Repo{Dir: dir, OnRun: func(Run) { runs++ }}
+	ctx := context.Background()
+	if _, err := r.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := r.Diff(ctx, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "-one") || !strings.Contains(diff, "+two") {
+		t.Fatalf("diff = %q", diff)
+	}
+	if _, err := r.Commit(ctx, "change", true, "a.txt", "b.md", ".gitattributes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CreateBranch(ctx, "topic", "", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Log(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if runs == 0 {
+		t.Fatal("no runs reported")
+	}
+
+	ran, err := os.ReadDir(markers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range ran {
+		t.Errorf("git ran the %s command", m.Name())
+	}
+}
+
+func TestCheckArg(t *testing.T) {
+	for _, v := range []string{"--output=/etc/passwd", "-p", "a\nb", "a\x00b"} {
+		if checkArg("ref", v) == nil {
+			t.Errorf("checkArg accepted %q", v)
+		}
+	}
+	for _, v := range []string{"main", "HEAD~1", "src/a-b.go"} {
+		if err := checkArg("ref", v); err != nil {
+			t.Errorf("checkArg rejected %q: %v", v, err)
+		}
+	}
+}
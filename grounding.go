@@ -0,0 +1,261 @@
+package llmagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GroundingOptions configures VerifyGrounding and CompleteGrounded.
+type GroundingOptions struct {
+	// Provider and Model run the verification; empty uses the agent
+	// default. Set Lexical to skip the model and compare words instead.
+	Provider string
+	Model    string
+	// Lexical marks a claim supported when at least MinOverlap (default
+	// 0.5) of its content words appear in a single document. Cheap, but
+	// blind to paraphrase.
+	Lexical    bool
+	MinOverlap float64
+	// Regenerate is how many corrective re-generations CompleteGrounded
+	// may run when claims are unsupported.
+	Regenerate int
+}
+
+// ClaimCheck is the verdict on one sentence of an answer.
+type ClaimCheck struct {
+	Claim     string `json:"claim"`
+	Supported bool   `json:"supported"`
+	Documents []int  `json:"documents,omitempty"` // 1-based, as in [n] markers
+	Reason    string `json:"reason,omitempty"`
+}
+
+// GroundingReport lists every claim of an answer and whether the sources
+// back it.
+type GroundingReport struct {
+	Claims      []ClaimCheck `json:"claims"`
+	Unsupported int          `json:"unsupported"`
+}
+
+// Grounded reports whether every claim is supported.
+func (r GroundingReport) Grounded() bool { return r.Unsupported == 0 }
+
+// Annotate returns answer with each unsupported claim followed by
+// "[unsupported]".
+func (r GroundingReport) Annotate(answer string) string {
+	for _, c := range r.Claims {
+		if !c.Supported {
+			answer = strings.Replace(answer, c.Claim, c.Claim+" [unsupported]", 1)
+		}
+	}
+	return answer
+}
+
+const groundingPrompt = `You verify that an answer is supported by its source documents.
+
+Documents:
+%s
+Claims from the answer, one per line, numbered:
+%s
+For each claim decide whether the documents entail it. Claims that only
+restate the question, hedge, or carry no factual content count as supported.
+Reply with JSON only, in this form:
+{"claims":[{"n":<claim number>,"supported":true|false,"documents":[<document numbers>],"reason":"<short reason when unsupported>"}]}`
+
+// VerifyGrounding checks every sentence of answer against docs.
+func (a *Agent) VerifyGrounding(ctx context.Context, answer string, docs []Document, opts GroundingOptions) (GroundingReport, error) {
+	claims := splitClaims(answer)
+	if len(claims) == 0 {
+		return GroundingReport{}, nil
+	}
+	var checks []ClaimCheck
+	if opts.Lexical {
+		checks = lexicalChecks(claims, docs, opts.MinOverlap)
+	} else {
+		var err error
+		if checks, err = a.modelChecks(ctx, claims, docs, opts); err != nil {
+			return GroundingReport{}, err
+		}
+	}
+	report := GroundingReport{Claims: checks}
+	for _, c := range checks {
+		if !c.Supported {
+			report.Unsupported++
+		}
+	}
+	return report, nil
+}
+
+func (a *Agent) modelChecks(ctx context.Context, claims []string, docs []Document, opts GroundingOptions) ([]ClaimCheck, error) {
+	var docText, claimText strings.Builder
+	for i, d := range docs {
+		fmt.Fprintf(&docText, "[%d] %s\n", i+1, d.Content)
+	}
+	for i, c := range claims {
+		fmt.Fprintf(&claimText, "%d. %s\n", i+1, c)
+	}
+	// like Judge, verification bypasses policy and shadowing
+	ch, err := a.complete(ctx, opts.Provider, CompletionRequest{
+		Model:       opts.Model,
+		Stream:      new(bool),
+		Temperature: Float64(0),
+		MaxTokens:   100 + 60*len(claims),
+		Messages:    []Message{User(fmt.Sprintf(groundingPrompt, docText.String(), claimText.String()))},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := Collect(ch)
+	if err != nil {
+		return nil, err
+	}
+	reply := resp.Content
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("verifier reply has no JSON object: %q", reply)
+	}
+	var parsed struct {
+		Claims []struct {
+			N         int    `json:"n"`
+			Supported bool   `json:"supported"`
+			Documents []int  `json:"documents"`
+			Reason    string `json:"reason"`
+		} `json:"claims"`
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &parsed); err != nil {
+		return nil, fmt.Errorf("parse verifier reply: %w", err)
+	}
+	checks := make([]ClaimCheck, len(claims))
+	for i, c := range claims {
+		// claims the verifier skipped count as unsupported
+		checks[i] = ClaimCheck{Claim: c, Reason: "not assessed"}
+	}
+	for _, v := range parsed.Claims {
+		if v.N < 1 || v.N > len(claims) {
+			continue
+		}
+		checks[v.N-1] = ClaimCheck{Claim: claims[v.N-1], Supported: v.Supported, Documents: v.Documents, Reason: v.Reason}
+	}
+	return checks, nil
+}
+
+func lexicalChecks(claims []string, docs []Document, minOverlap float64) []ClaimCheck {
+	if minOverlap <= 0 {
+		minOverlap = 0.5
+	}
+	docWords := make([]map[string]bool, len(docs))
+	for i, d := range docs {
+		docWords[i] = wordSet(d.Content)
+	}
+	checks := make([]ClaimCheck, len(claims))
+	for i, claim := range claims {
+		words := wordSet(citationMarker.ReplaceAllString(claim, ""))
+		check := ClaimCheck{Claim: claim, Supported: len(words) == 0}
+		for j, dw := range docWords {
+			var hit int
+			for w := range words {
+				if dw[w] {
+					hit++
+				}
+			}
+			if len(words) > 0 && float64(hit)/float64(len(words)) >= minOverlap {
+				check.Supported = true
+				check.Documents = append(check.Documents, j+1)
+			}
+		}
+		if !check.Supported {
+			check.Reason = "no document shares enough of its words"
+		}
+		checks[i] = check
+	}
+	return checks
+}
+
+// wordSet returns the lower-cased words of s longer than three letters,
+// a rough cut of stop words.
+func wordSet(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 0x7f)
+	}) {
+		if len([]rune(w)) > 3 {
+			set[w] = true
+		}
+	}
+	return set
+}
+
+// splitClaims breaks an answer into sentences.
+func splitClaims(answer string) []string {
+	var claims []string
+	var b strings.Builder
+	flush := func() {
+		if c := strings.TrimSpace(b.String()); c != "" {
+			claims = append(claims, c)
+		}
+		b.Reset()
+	}
+	runes := []rune(answer)
+	for i, r := range runes {
+		b.WriteRune(r)
+		switch {
+		case r == '\n':
+			flush()
+		case (r == '.' || r == '!' || r == '?') && (i+1 == len(runes) || runes[i+1] == ' ' || runes[i+1] == '\n'):
+			// keep trailing citation markers such as "... [2]." together
+			flush()
+		}
+	}
+	flush()
+	return claims
+}
+
+// GroundedAnswer is the result of CompleteGrounded.
+type GroundedAnswer struct {
+	CompletionResponse
+	Report   GroundingReport
+	Attempts int // 1 plus the corrective re-generations run
+}
+
+// CompleteGrounded runs a non-streaming completion with req.Documents,
+// verifies the answer and, while claims are unsupported and
+// opts.Regenerate allows, asks the model to revise it without them. The
+// last answer is returned with its report either way.
+func (a *Agent) CompleteGrounded(ctx context.Context, providerName string, req CompletionRequest, opts GroundingOptions) (GroundedAnswer, error) {
+	if len(req.Documents) == 0 {
+		return GroundedAnswer{}, fmt.Errorf("grounding needs documents")
+	}
+	req = req.clone()
+	req.Stream = new(bool)
+	docs := req.Documents
+	var out GroundedAnswer
+	for {
+		out.Attempts++
+		ch, err := a.Complete(ctx, providerName, req)
+		if err != nil {
+			return out, err
+		}
+		resp, err := Collect(ch)
+		if err != nil {
+			return out, err
+		}
+		report, err := a.VerifyGrounding(ctx, resp.Content, docs, opts)
+		if err != nil {
+			return out, err
+		}
+		out.CompletionResponse, out.Report = resp, report
+		if report.Grounded() || out.Attempts > opts.Regenerate {
+			return out, nil
+		}
+		var fix strings.Builder
+		fix.WriteString("These statements in your answer are not supported by the documents:\n")
+		for _, c := range report.Claims {
+			if !c.Supported {
+				fmt.Fprintf(&fix, "- %s\n", c.Claim)
+			}
+		}
+		fix.WriteString("Rewrite the answer using only information from the documents, citing them. Say so if the documents don't answer the question.")
+		req.Messages = append(req.Messages, Assistant(resp.Content), User(fix.String()))
+	}
+}
@@ -0,0 +1,375 @@
+package llmagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HandlerOptions configures the net/http handlers, CompletionHandler and
+// ChatHandler. There is no EmbeddingHandler: Provider has no embeddings
+// call to serve it with.
+type HandlerOptions struct {
+	// Provider serves the requests; empty uses the agent's default.
+	Provider string
+	// AllowProviderParam lets clients pick a provider (or alias) with the
+	// ?provider= query parameter.
+	AllowProviderParam bool
+	// Auth authenticates a request and returns the user it acts for, which
+	// scopes chat sessions and is attached with WithUser. Returning an
+	// error answers 401. Nil allows everyone anonymously; chat sessions
+	// are then scoped to the client's IP address, so clients behind one
+	// proxy share a session space.
+	Auth func(r *http.Request) (string, error)
+	// MaxBodyBytes caps request bodies; defaults to 1 MiB.
+	MaxBodyBytes int64
+	// SessionIdle is how long a ChatHandler session lives without a
+	// message; defaults to 30 minutes.
+	SessionIdle time.Duration
+	// MaxSessionsPerUser caps each user's (or, without Auth, each client
+	// address's) ChatHandler sessions; defaults to 32.
+	MaxSessionsPerUser int
+}
+
+func (o HandlerOptions) sessionIdle() time.Duration {
+	if o.SessionIdle <= 0 {
+		return 30 * time.Minute
+	}
+	return o.SessionIdle
+}
+
+func (o HandlerOptions) maxSessions() int {
+	if o.MaxSessionsPerUser <= 0 {
+		return 32
+	}
+	return o.MaxSessionsPerUser
+}
+
+// BearerTokens authenticates "Authorization: Bearer <token>" headers
+// against a token -> user map.
+func BearerTokens(tokens map[string]string) func(r *http.Request) (string, error) {
+	return func(r *http.Request) (string, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return "", errors.New("missing bearer token")
+		}
+		user, ok := tokens[token]
+		if !ok {
+			return "", errors.New("invalid bearer token")
+		}
+		return user, nil
+	}
+}
+
+// CompletionHandler serves POST requests carrying a wire CompletionRequest.
+// Streaming requests are answered with server-sent events, one wire event
+// per message and the event type as the SSE event name; others with a
+// single JSON wire event of type done holding the whole answer.
+//
+//	http.Handle("/api/complete", agent.CompletionHandler(llmagent.HandlerOptions{}))
+func (a *Agent) CompletionHandler(opts HandlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, provider, ok := opts.begin(w, r)
+		if !ok {
+			return
+		}
+		var req CompletionRequest
+		if !decodeBody(w, r, opts, &req) {
+			return
+		}
+		ch, err := a.Complete(ctx, provider, req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeCompletion(w, req.StreamValue(), ch)
+	})
+}
+
+// ChatRequest is the body accepted by ChatHandler.
+type ChatRequest struct {
+	SessionID string  `json:"session_id,omitempty"` // empty starts a new session
+	Message   Message `json:"message"`
+	// System seeds a new session; ignored when continuing one.
+	System string `json:"system,omitempty"`
+	// Stream answers this message with server-sent events.
+	Stream bool `json:"stream,omitempty"`
+}
+
+// ChatHandler serves multi-turn conversations: each POST adds a message to
+// a Session kept in memory and answers like CompletionHandler, streaming
+// when the ChatRequest asks for it. The session
+// ID comes back in the X-Session-ID header; DELETE ?session_id= ends a
+// session. Sessions belong to the user returned by Auth and end after
+// SessionIdle without a message. A user holds at most MaxSessionsPerUser
+// sessions; starting another evicts their least recently used one. A
+// message sent while the session is still answering the previous one is
+// rejected with 409.
+func (a *Agent) ChatHandler(opts HandlerOptions) http.Handler {
+	return &chatHandler{
+		agent:    a,
+		opts:     opts,
+		sessions: make(map[string]*chatSession),
+		users:    make(map[string]map[string]*chatSession),
+	}
+}
+
+type chatSession struct {
+	user     string // session space, see owner
+	session  *Session
+	lastUsed time.Time
+	busy     bool // answering a message
+}
+
+type chatHandler struct {
+	agent    *Agent
+	opts     HandlerOptions
+	mu       sync.Mutex
+	sessions map[string]*chatSession
+	users    map[string]map[string]*chatSession // sessions by owner, then ID
+	swept    time.Time
+}
+
+func (h *chatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		user, ok := h.opts.authenticate(w, r)
+		if !ok {
+			return
+		}
+		user = h.opts.owner(r, user)
+		id := r.URL.Query().Get("session_id")
+		h.mu.Lock()
+		cs, found := h.sessions[id]
+		if found && cs.user == user {
+			h.remove(cs)
+		}
+		h.mu.Unlock()
+		if !found || cs.user != user {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	ctx, provider, ok := h.opts.begin(w, r)
+	if !ok {
+		return
+	}
+	var req ChatRequest
+	if !decodeBody(w, r, h.opts, &req) {
+		return
+	}
+	cs, err := h.checkout(req, provider, h.opts.owner(r, UserFromContext(ctx)))
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return
+	}
+	defer h.checkin(cs)
+
+	ch, err := cs.session.send(ctx, req.Message, Bool(req.Stream))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("X-Session-ID", cs.session.ID)
+	writeCompletion(w, req.Stream, ch)
+}
+
+// checkout finds or starts the session for req and marks it busy until
+// checkin.
+func (h *chatHandler) checkout(req ChatRequest, provider, user string) (*chatSession, error) {
+	now := h.agent.clock().Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sweep(now)
+	if req.SessionID != "" {
+		cs, found := h.sessions[req.SessionID]
+		if !found || cs.user != user || h.expired(cs, now) {
+			return nil, &WireError{Message: "session not found", StatusCode: http.StatusNotFound}
+		}
+		if cs.busy {
+			return nil, &WireError{Message: "session is answering another message", StatusCode: http.StatusConflict}
+		}
+		cs.busy, cs.lastUsed = true, now
+		return cs, nil
+	}
+	if own := h.users[user]; len(own) >= h.opts.maxSessions() {
+		var lru *chatSession
+		for _, cs := range own {
+			if !cs.busy && (lru == nil || cs.lastUsed.Before(lru.lastUsed)) {
+				lru = cs
+			}
+		}
+		if lru == nil {
+			return nil, &WireError{Message: "too many sessions", StatusCode: http.StatusTooManyRequests}
+		}
+		h.remove(lru)
+	}
+	var seed []Message
+	if req.System != "" {
+		seed = append(seed, System(req.System))
+	}
+	cs := &chatSession{user: user, session: h.agent.NewSession(seed...), lastUsed: now, busy: true}
+	if provider != "" {
+		cs.session.Migrate(provider, "")
+	}
+	h.sessions[cs.session.ID] = cs
+	if h.users[user] == nil {
+		h.users[user] = make(map[string]*chatSession)
+	}
+	h.users[user][cs.session.ID] = cs
+	return cs, nil
+}
+
+// checkin ends the message checkout started.
+func (h *chatHandler) checkin(cs *chatSession) {
+	now := h.agent.clock().Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cs.busy, cs.lastUsed = false, now
+}
+
+// expired must be called with h.mu held; expired sessions are removed.
+func (h *chatHandler) expired(cs *chatSession, now time.Time) bool {
+	if cs.busy || now.Sub(cs.lastUsed) < h.opts.sessionIdle() {
+		return false
+	}
+	h.remove(cs)
+	return true
+}
+
+// sweep removes expired sessions, at most every quarter of SessionIdle. It
+// must be called with h.mu held.
+func (h *chatHandler) sweep(now time.Time) {
+	if now.Sub(h.swept) < h.opts.sessionIdle()/4 {
+		return
+	}
+	h.swept = now
+	for _, cs := range h.sessions {
+		h.expired(cs, now)
+	}
+}
+
+// remove must be called with h.mu held.
+func (h *chatHandler) remove(cs *chatSession) {
+	id := cs.session.ID
+	delete(h.sessions, id)
+	delete(h.users[cs.user], id)
+	if len(h.users[cs.user]) == 0 {
+		delete(h.users, cs.user)
+	}
+}
+
+// owner is the session space of a request's client: the authenticated
+// user, or without Auth the client's IP address, so anonymous clients
+// cannot reach or evict each other's sessions.
+func (o HandlerOptions) owner(r *http.Request, user string) string {
+	if o.Auth != nil {
+		return "user:" + user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// authenticate runs Auth, answering 401 on failure.
+func (o HandlerOptions) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if o.Auth == nil {
+		return "", true
+	}
+	user, err := o.Auth(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return "", false
+	}
+	return user, true
+}
+
+// begin checks the method and credentials and picks the provider.
+func (o HandlerOptions) begin(w http.ResponseWriter, r *http.Request) (context.Context, string, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, "", false
+	}
+	user, ok := o.authenticate(w, r)
+	if !ok {
+		return nil, "", false
+	}
+	provider := o.Provider
+	if p := r.URL.Query().Get("provider"); p != "" && o.AllowProviderParam {
+		provider = p
+	}
+	ctx := r.Context()
+	if user != "" {
+		ctx = WithUser(ctx, user)
+	}
+	return ctx, provider, true
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, opts HandlerOptions, v any) bool {
+	limit := opts.MaxBodyBytes
+	if limit <= 0 {
+		limit = 1 << 20
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(v); err != nil {
+		writeError(w, &WireError{Message: "invalid request body: " + err.Error(), StatusCode: http.StatusBadRequest})
+		return false
+	}
+	return true
+}
+
+// writeError answers with the error's status code (502 for upstream
+// failures without one) and a wire error event.
+func writeError(w http.ResponseWriter, err error) {
+	code := StatusCode(err)
+	if code < 400 || code > 599 {
+		code = http.StatusBadGateway
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(CompletionResponse{Err: err})
+}
+
+// writeCompletion streams ch as server-sent events or collects it into one
+// JSON event.
+func writeCompletion(w http.ResponseWriter, stream bool, ch <-chan CompletionResponse) {
+	if !stream {
+		resp, err := Collect(ch)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	for resp := range ch {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", resp.EventType(), data); err != nil {
+			// client went away; drain so upstream goroutines finish
+			for range ch {
+			}
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
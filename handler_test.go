@@ -0,0 +1,151 @@
+package llmagent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echo answers every request with "ok".
+func echo(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+	return answer("ok"), nil
+}
+
+// chat posts a message to h, continuing session id unless it is empty, and
+// returns the status and session ID.
+func chat(h http.Handler, id string) (int, string) {
+	body := `{"session_id":"` + id + `","message":{"role":"user","content":"hi"}}`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(body)))
+	return rec.Code, rec.Header().Get("X-Session-ID")
+}
+
+func TestChatHandlerSessionLimits(t *testing.T) {
+	a, clock := testAgent(t, newTestProvider("echo", echo))
+	h := a.ChatHandler(HandlerOptions{SessionIdle: 10 * time.Minute, MaxSessionsPerUser: 2})
+
+	var ids []string
+	for range 3 {
+		code, id := chat(h, "")
+		if code != http.StatusOK {
+			t.Fatalf("new session: status %d", code)
+		}
+		ids = append(ids, id)
+		clock.Advance(time.Minute)
+	}
+	if code, _ := chat(h, ids[0]); code != http.StatusNotFound {
+		t.Fatalf("least recently used session: status %d, want 404", code)
+	}
+	if code, _ := chat(h, ids[1]); code != http.StatusOK {
+		t.Fatalf("second session: status %d", code)
+	}
+
+	clock.Advance(9 * time.Minute) // ids[2] idle for 10 minutes, ids[1] for 9
+	if code, _ := chat(h, ids[2]); code != http.StatusNotFound {
+		t.Fatalf("idle session: status %d, want 404", code)
+	}
+	if code, _ := chat(h, ids[1]); code != http.StatusOK {
+		t.Fatalf("recently used session: status %d", code)
+	}
+
+	clock.Advance(time.Hour) // the sweep drops sessions nobody asks for
+	chat(h, "")
+	if n := len(h.(*chatHandler).sessions); n != 1 {
+		t.Fatalf("%d sessions after the sweep, want 1", n)
+	}
+}
+
+func TestChatHandlerRejectsOverlap(t *testing.T) {
+	var entered, release chan struct{}
+	p := newTestProvider("echo", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		if entered != nil {
+			entered <- struct{}{}
+			<-release
+		}
+		return answer("ok"), nil
+	})
+	a, _ := testAgent(t, p)
+	h := a.ChatHandler(HandlerOptions{})
+	_, id := chat(h, "")
+
+	entered, release = make(chan struct{}), make(chan struct{})
+	done := make(chan int)
+	go func() {
+		code, _ := chat(h, id)
+		done <- code
+	}()
+	<-entered
+	if code, _ := chat(h, id); code != http.StatusConflict {
+		t.Fatalf("overlapping message: status %d, want 409", code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("first message: status %d", code)
+	}
+
+	entered = nil
+	if code, _ := chat(h, id); code != http.StatusOK {
+		t.Fatalf("message after the answer: status %d", code)
+	}
+}
+
+func TestChatHandlerStreamsSSE(t *testing.T) {
+	var streamed []bool
+	a, _ := testAgent(t, newTestProvider("echo", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		streamed = append(streamed, req.StreamValue())
+		return echo(ctx, req, n)
+	}))
+	h := a.ChatHandler(HandlerOptions{})
+	body := `{"stream":true,"message":{"role":"user","content":"hi"}}`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	if out := rec.Body.String(); !strings.Contains(out, "event: done\ndata: ") || !strings.Contains(out, `"ok"`) {
+		t.Fatalf("body is not an SSE answer:\n%s", out)
+	}
+
+	// Without stream the same session answers with one JSON event.
+	id := rec.Header().Get("X-Session-ID")
+	if code, _ := chat(h, id); code != http.StatusOK {
+		t.Fatalf("non-streamed message: status %d", code)
+	}
+	if !slices.Equal(streamed, []bool{true, false}) {
+		t.Fatalf("provider saw stream %v, want true then false", streamed)
+	}
+	// The flag applies per message; the session's template is untouched.
+	if cs := h.(*chatHandler).sessions[id]; cs.session.Template.Stream != nil {
+		t.Fatalf("session template stream set to %v", *cs.session.Template.Stream)
+	}
+}
+
+func TestChatHandlerIsolatesAnonymousClients(t *testing.T) {
+	a, _ := testAgent(t, newTestProvider("echo", echo))
+	h := a.ChatHandler(HandlerOptions{MaxSessionsPerUser: 1})
+	post := func(addr, id string) (int, string) {
+		body := `{"session_id":"` + id + `","message":{"role":"user","content":"hi"}}`
+		req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(body))
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code, rec.Header().Get("X-Session-ID")
+	}
+	_, mine := post("192.0.2.1:1000", "")
+	if code, _ := post("192.0.2.2:1000", ""); code != http.StatusOK {
+		t.Fatalf("other client's session: status %d", code)
+	}
+	if code, _ := post("192.0.2.1:2000", mine); code != http.StatusOK {
+		t.Fatalf("own session after another client started one: status %d", code)
+	}
+	if code, _ := post("192.0.2.2:1000", mine); code != http.StatusNotFound {
+		t.Fatalf("another client's session: status %d, want 404", code)
+	}
+}
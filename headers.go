@@ -0,0 +1,131 @@
+package llmagent
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit is the provider's view of the remaining quota, as reported in
+// response headers. Negative counts mean the header was absent.
+type RateLimit struct {
+	RemainingRequests int       `json:"remaining_requests"`
+	RemainingTokens   int       `json:"remaining_tokens"`
+	LimitRequests     int       `json:"limit_requests"`
+	LimitTokens       int       `json:"limit_tokens"`
+	ResetRequests     time.Time `json:"reset_requests,omitzero"`
+	ResetTokens       time.Time `json:"reset_tokens,omitzero"`
+}
+
+// ResponseMeta carries what a provider reported in its response headers.
+// Providers send it in a leading event; the agent folds it into the
+// completion's stats and the provider metrics.
+type ResponseMeta struct {
+	RequestID string
+	RateLimit *RateLimit
+	Header    http.Header
+}
+
+// ResponseHeader returns the HTTP headers behind a body returned by the sdk
+// clients, or nil.
+func ResponseHeader(body io.ReadCloser) http.Header {
+	if h, ok := body.(interface{ Header() http.Header }); ok {
+		return h.Header()
+	}
+	return nil
+}
+
+// ParseResponseMeta extracts request IDs and rate limit headers in the
+// OpenAI (x-ratelimit-*) and Anthropic (anthropic-ratelimit-*) styles.
+// Relative reset durations are resolved against now, which providers take
+// from ProviderConfig.Now.
+func ParseResponseMeta(h http.Header, now time.Time) *ResponseMeta {
+	if h == nil {
+		return nil
+	}
+	meta := &ResponseMeta{Header: h}
+	for _, name := range []string{"X-Request-Id", "Request-Id"} {
+		if v := h.Get(name); v != "" {
+			meta.RequestID = v
+			break
+		}
+	}
+	rl := RateLimit{
+		RemainingRequests: headerInt(h, "X-Ratelimit-Remaining-Requests", "Anthropic-Ratelimit-Requests-Remaining"),
+		RemainingTokens:   headerInt(h, "X-Ratelimit-Remaining-Tokens", "Anthropic-Ratelimit-Tokens-Remaining"),
+		LimitRequests:     headerInt(h, "X-Ratelimit-Limit-Requests", "Anthropic-Ratelimit-Requests-Limit"),
+		LimitTokens:       headerInt(h, "X-Ratelimit-Limit-Tokens", "Anthropic-Ratelimit-Tokens-Limit"),
+		ResetRequests:     headerReset(h, now, "X-Ratelimit-Reset-Requests", "Anthropic-Ratelimit-Requests-Reset"),
+		ResetTokens:       headerReset(h, now, "X-Ratelimit-Reset-Tokens", "Anthropic-Ratelimit-Tokens-Reset"),
+	}
+	if rl.RemainingRequests >= 0 || rl.RemainingTokens >= 0 || rl.LimitRequests >= 0 || rl.LimitTokens >= 0 {
+		meta.RateLimit = &rl
+	}
+	return meta
+}
+
+func headerInt(h http.Header, names ...string) int {
+	for _, name := range names {
+		if v, err := strconv.Atoi(strings.TrimSpace(h.Get(name))); err == nil {
+			return v
+		}
+	}
+	return -1
+}
+
+// headerReset accepts RFC 3339 timestamps (Anthropic) and Go-style
+// durations such as "6m0s" or "20ms" (OpenAI).
+func headerReset(h http.Header, now time.Time, names ...string) time.Time {
+	for _, name := range names {
+		v := strings.TrimSpace(h.Get(name))
+		if v == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			return now.Add(d)
+		}
+	}
+	return time.Time{}
+}
+
+// RetryAfter reports how long a rate-limited (429) or overloaded (503)
+// response asks the client to wait: Retry-After-Ms, then Retry-After as
+// seconds or an HTTP date, then the reset time of whichever rate limit
+// bucket is exhausted. ok is false when the headers say nothing.
+func RetryAfter(h http.Header, now time.Time) (d time.Duration, ok bool) {
+	if h == nil {
+		return 0, false
+	}
+	if ms, err := strconv.ParseFloat(strings.TrimSpace(h.Get("Retry-After-Ms")), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	if v := strings.TrimSpace(h.Get("Retry-After")); v != "" {
+		if s, err := strconv.ParseFloat(v, 64); err == nil && s >= 0 {
+			return time.Duration(s * float64(time.Second)), true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(t.Sub(now), 0), true
+		}
+	}
+	rl := ParseResponseMeta(h, now).RateLimit
+	if rl == nil {
+		return 0, false
+	}
+	for _, b := range []struct {
+		remaining int
+		reset     time.Time
+	}{
+		{rl.RemainingRequests, rl.ResetRequests},
+		{rl.RemainingTokens, rl.ResetTokens},
+	} {
+		if b.remaining == 0 && !b.reset.IsZero() {
+			d, ok = max(d, b.reset.Sub(now)), true
+		}
+	}
+	return d, ok
+}
@@ -0,0 +1,151 @@
+package llmagent
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+)
+
+// ProviderHealth is the outcome of one active health probe.
+type ProviderHealth struct {
+	Provider  string        `json:"provider"`
+	Healthy   bool          `json:"healthy"`
+	Error     string        `json:"error,omitempty"`
+	Latency   time.Duration `json:"latency"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// Leader elects one instance of a cluster, e.g. through a Redis lease.
+type Leader interface {
+	// Acquire takes or renews leadership for ttl and reports whether this
+	// instance holds it.
+	Acquire(ctx context.Context, ttl time.Duration) (bool, error)
+}
+
+// HealthStore shares probe results between the instances of a cluster.
+type HealthStore interface {
+	Publish(ctx context.Context, results map[string]ProviderHealth) error
+	Load(ctx context.Context) (map[string]ProviderHealth, error)
+}
+
+// HealthProber periodically sends a one-token completion to each provider.
+// In a cluster, give every instance the same Leader and Store: only the
+// leader probes and publishes, the others read its results, so providers
+// see one probe per interval however many instances run.
+type HealthProber struct {
+	Interval  time.Duration // defaults to 30s
+	Timeout   time.Duration // per probe; defaults to 10s
+	Providers []string      // defaults to every registered provider
+	Leader    Leader        // nil: this instance always probes
+	Store     HealthStore   // nil: results stay local
+	// OnResult receives every result this instance probes or loads.
+	OnResult func(ProviderHealth)
+
+	mu      sync.Mutex
+	results map[string]ProviderHealth
+}
+
+// Health returns the latest result per provider.
+func (h *HealthProber) Health() map[string]ProviderHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return maps.Clone(h.results)
+}
+
+// RunHealthProber runs h until ctx is done, starting with a round at once.
+// Rounds follow the agent's Clock.
+func (a *Agent) RunHealthProber(ctx context.Context, h *HealthProber) {
+	interval := h.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	t := a.clock().NewTicker(interval)
+	defer t.Stop()
+	for {
+		a.healthRound(ctx, h, interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+		}
+	}
+}
+
+// healthRound probes as leader, or loads the leader's results.
+func (a *Agent) healthRound(ctx context.Context, h *HealthProber, interval time.Duration) {
+	leader := h.Leader == nil
+	if !leader {
+		// the lease outlives a missed round so leadership doesn't flap
+		ok, err := h.Leader.Acquire(ctx, 2*interval+interval/2)
+		leader = ok && err == nil
+	}
+	if !leader {
+		if h.Store == nil {
+			return
+		}
+		results, err := h.Store.Load(ctx)
+		if err == nil {
+			h.record(results)
+		}
+		return
+	}
+	results := a.probeAll(ctx, h)
+	h.record(results)
+	if h.Store != nil {
+		_ = h.Store.Publish(ctx, results)
+	}
+}
+
+func (a *Agent) probeAll(ctx context.Context, h *HealthProber) map[string]ProviderHealth {
+	names := h.Providers
+	if len(names) == 0 {
+		names = a.ListProviders()
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]ProviderHealth, len(names))
+	)
+	for _, name := range names {
+		p, ok := a.provider(name)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := a.clock().Now()
+			err := probe(pctx, p)
+			r := ProviderHealth{Provider: name, Healthy: err == nil, Latency: a.clock().Now().Sub(start), CheckedAt: start}
+			if err != nil {
+				r.Error = err.Error()
+			}
+			mu.Lock()
+			results[name] = r
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (h *HealthProber) record(results map[string]ProviderHealth) {
+	h.mu.Lock()
+	if h.results == nil {
+		h.results = map[string]ProviderHealth{}
+	}
+	maps.Copy(h.results, results)
+	h.mu.Unlock()
+	if h.OnResult != nil {
+		for _, r := range results {
+			h.OnResult(r)
+		}
+	}
+}
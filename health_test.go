@@ -0,0 +1,92 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeLeader grants leadership when ok, recording the lease it was asked
+// for.
+type fakeLeader struct {
+	ok  bool
+	err error
+	ttl time.Duration
+}
+
+func (l *fakeLeader) Acquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	l.ttl = ttl
+	return l.ok, l.err
+}
+
+// memHealthStore keeps the published results in memory.
+type memHealthStore struct {
+	results   map[string]ProviderHealth
+	published int
+}
+
+func (s *memHealthStore) Publish(ctx context.Context, results map[string]ProviderHealth) error {
+	s.results = results
+	s.published++
+	return nil
+}
+
+func (s *memHealthStore) Load(ctx context.Context) (map[string]ProviderHealth, error) {
+	return s.results, nil
+}
+
+func TestHealthRound(t *testing.T) {
+	shared := map[string]ProviderHealth{"up": {Provider: "up", Error: "from the leader"}}
+	for _, tc := range []struct {
+		name      string
+		leader    *fakeLeader // nil: always probes
+		noStore   bool
+		probed    bool
+		published bool
+		want      map[string]bool // Healthy per provider, as recorded
+	}{
+		{name: "no leader probes", probed: true, published: true, want: map[string]bool{"up": true, "down": false}},
+		{name: "leader probes and publishes", leader: &fakeLeader{ok: true}, probed: true, published: true, want: map[string]bool{"up": true, "down": false}},
+		{name: "follower loads", leader: &fakeLeader{}, want: map[string]bool{"up": false}},
+		{name: "election error loads", leader: &fakeLeader{ok: true, err: errors.New("redis down")}, want: map[string]bool{"up": false}},
+		{name: "follower without a store", leader: &fakeLeader{}, noStore: true, want: map[string]bool{}},
+		{name: "leader without a store", leader: &fakeLeader{ok: true}, noStore: true, probed: true, want: map[string]bool{"up": true, "down": false}},
+	} {
+		up := newTestProvider("up", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+			return answer("pong"), nil
+		})
+		down := newTestProvider("down", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+			return nil, statusError(503)
+		})
+		a, _ := testAgent(t, up, down)
+		store := &memHealthStore{results: shared}
+		h := &HealthProber{}
+		if tc.leader != nil {
+			h.Leader = tc.leader
+		}
+		if !tc.noStore {
+			h.Store = store
+		}
+
+		a.healthRound(context.Background(), h, time.Minute)
+		if probed := up.calls.Load() > 0; probed != tc.probed {
+			t.Errorf("%s: probed = %v, want %v", tc.name, probed, tc.probed)
+		}
+		if published := store.published > 0; published != tc.published {
+			t.Errorf("%s: published = %v, want %v", tc.name, published, tc.published)
+		}
+		got := h.Health()
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: recorded %+v, want %v", tc.name, got, tc.want)
+		}
+		for name, healthy := range tc.want {
+			if r, ok := got[name]; !ok || r.Healthy != healthy {
+				t.Errorf("%s: %s = %+v, want healthy %v", tc.name, name, r, healthy)
+			}
+		}
+		if tc.leader != nil && tc.leader.ttl != 150*time.Second {
+			t.Errorf("%s: lease %v, want 2.5 intervals", tc.name, tc.leader.ttl)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package llmagent
+
+import (
+	"context"
+)
+
+// hedgeTarget returns the provider to hedge p with, if hedging is enabled
+// and the hedge provider satisfies ctx's region constraint.
+func (a *Agent) hedgeTarget(ctx context.Context, p Provider) (Provider, bool) {
+	if a.HedgeAfter <= 0 || a.HedgeProvider == "" || a.HedgeProvider == p.Name() {
+		return nil, false
+	}
+	hp, ok := a.provider(a.HedgeProvider)
+	if !ok || !inRegion(ctx, hp) {
+		return nil, false
+	}
+	return hp, true
+}
+
+type hedgeResult struct {
+	ch     <-chan CompletionResponse
+	p      Provider
+	err    error
+	cancel context.CancelFunc
+}
+
+// hedge starts req on primary and, if no first token arrived within
+// HedgeAfter (or primary failed outright), also on secondary. Response
+// headers alone don't count: tryProvider only returns once an attempt has
+// produced an event past them. The first
+// attempt to produce a response wins; the other is cancelled.
+func (a *Agent) hedge(ctx context.Context, primary, secondary Provider, req CompletionRequest, run *requestRun) (<-chan CompletionResponse, Provider, error) {
+	results := make(chan hedgeResult, 2)
+	launch := func(p Provider) context.CancelFunc {
+		cctx, cancel := context.WithCancel(ctx)
+		spawn(ctx, func() {
+			ch, err := a.tryProvider(cctx, p, requestFor(ctx, p, req), run)
+			results <- hedgeResult{ch: ch, p: p, err: err, cancel: cancel}
+		})
+		return cancel
+	}
+
+	cancels := map[string]context.CancelFunc{primary.Name(): launch(primary)}
+	timer := a.clock().NewTimer(a.HedgeAfter)
+	defer timer.Stop()
+	pending, hedged := 1, false
+	startSecondary := func() {
+		if !hedged {
+			hedged = true
+			cancels[secondary.Name()] = launch(secondary)
+			pending++
+		}
+	}
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C():
+			startSecondary()
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				r.cancel()
+				lastErr = r.err
+				if ctx.Err() == nil {
+					startSecondary()
+				}
+				continue
+			}
+			// r won: cancel and drain whichever attempt is still running.
+			for name, cancel := range cancels {
+				if name != r.p.Name() {
+					cancel()
+				}
+			}
+			n := pending
+			spawn(ctx, func() {
+				for ; n > 0; n-- {
+					loser := <-results
+					if loser.err == nil {
+						for range loser.ch {
+						}
+					}
+					loser.cancel()
+				}
+			})
+			return cancelOnClose(ctx, r.ch, r.cancel), r.p, nil
+		}
+	}
+	return nil, nil, lastErr
+}
+
+// cancelOnClose forwards ch and cancels the attempt's context once the
+// stream has been fully consumed.
+func cancelOnClose(ctx context.Context, ch <-chan CompletionResponse, cancel context.CancelFunc) <-chan CompletionResponse {
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		defer cancel()
+		for resp := range ch {
+			if !emit(resp) {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHedge(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		primary       string // "answer", "fail" or "slow" (waits for cancellation)
+		secondaryFail bool
+		advance       bool // move the clock past HedgeAfter
+		want          string
+		hedged        bool
+	}{
+		{name: "primary answers in time", primary: "answer", want: "primary"},
+		{name: "primary fails before HedgeAfter", primary: "fail", want: "secondary", hedged: true},
+		{name: "slow primary loses", primary: "slow", advance: true, want: "secondary", hedged: true},
+		{name: "both fail", primary: "fail", secondaryFail: true, hedged: true},
+	} {
+		cancelled := make(chan struct{})
+		primary := newTestProvider("primary", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+			switch tc.primary {
+			case "answer":
+				return answer("primary"), nil
+			case "fail":
+				return nil, statusError(503)
+			}
+			ch := make(chan CompletionResponse)
+			go func() {
+				<-ctx.Done()
+				close(cancelled)
+				close(ch)
+			}()
+			return ch, nil
+		})
+		secondary := newTestProvider("secondary", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+			if tc.secondaryFail {
+				return nil, statusError(503)
+			}
+			return answer("secondary"), nil
+		})
+		a, clock := testAgent(t, primary, secondary)
+		a.HedgeAfter, a.HedgeProvider = time.Second, "secondary"
+
+		got := make(chan string, 1)
+		errc := make(chan error, 1)
+		go func() {
+			resp, err := completeText(a, "primary")
+			got <- resp
+			errc <- err
+		}()
+		if tc.advance {
+			waitTimers(t, clock, 1)
+			clock.Advance(time.Second)
+		}
+		content, err := <-got, <-errc
+		switch {
+		case tc.want == "" && err == nil:
+			t.Errorf("%s: answered %q, want an error", tc.name, content)
+		case tc.want != "" && (err != nil || content != tc.want):
+			t.Errorf("%s: answer = %q, %v; want %q", tc.name, content, err, tc.want)
+		}
+		if hedged := secondary.calls.Load() > 0; hedged != tc.hedged {
+			t.Errorf("%s: hedged = %v, want %v", tc.name, hedged, tc.hedged)
+		}
+		if tc.primary == "slow" {
+			select {
+			case <-cancelled:
+			case <-time.After(5 * time.Second):
+				t.Errorf("%s: losing attempt not cancelled", tc.name)
+			}
+		}
+	}
+}
+
+// completeText sends one request to provider and returns its content.
+func completeText(a *Agent, provider string) (string, error) {
+	ch, err := a.Complete(context.Background(), provider, CompletionRequest{Stream: new(bool), Messages: []Message{User("hi")}})
+	if err != nil {
+		return "", err
+	}
+	resp, err := Collect(ch)
+	return resp.Content, err
+}
+
+func TestHedgeDrainsLosingStream(t *testing.T) {
+	release, drained := make(chan struct{}), make(chan struct{})
+	primary := newTestProvider("primary", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		ch := make(chan CompletionResponse)
+		go func() {
+			// answers late, and ignores ctx like a careless provider
+			defer close(drained)
+			defer close(ch)
+			<-release
+			for _, s := range []string{"late", " answer", ""} {
+				ch <- CompletionResponse{Content: s, Done: s == ""}
+			}
+		}()
+		return ch, nil
+	})
+	secondary := newTestProvider("secondary", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return answer("secondary"), nil
+	})
+	a, clock := testAgent(t, primary, secondary)
+	a.HedgeAfter, a.HedgeProvider = time.Second, "secondary"
+
+	errc := make(chan error, 1)
+	go func() {
+		content, err := completeText(a, "primary")
+		if err == nil && content != "secondary" {
+			err = errors.New("answered by " + content)
+		}
+		errc <- err
+	}()
+	waitTimers(t, clock, 1)
+	clock.Advance(time.Second)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("losing stream left blocked")
+	}
+}
@@ -0,0 +1,46 @@
+package llmagent
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// DefaultMaxBodyBytes caps non-streaming response bodies when a provider has
+// no explicit MaxResponseBytes configured.
+const DefaultMaxBodyBytes = 16 << 20
+
+// ReadBody reads r fully but never more than max bytes (DefaultMaxBodyBytes
+// when max <= 0). A body larger than the cap yields a *LimitError.
+func ReadBody(r io.Reader, max int) ([]byte, error) {
+	if max <= 0 {
+		max = DefaultMaxBodyBytes
+	}
+	b, err := io.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > max {
+		return nil, &LimitError{Limit: "response_bytes", Max: max, Actual: len(b)}
+	}
+	return b, nil
+}
+
+var readerPool = sync.Pool{
+	New: func() any { return bufio.NewReaderSize(nil, 32<<10) },
+}
+
+// AcquireReader returns a pooled *bufio.Reader reading from r; hand it
+// back with ReleaseReader when done. Event streams are better read with
+// NewSSEReader, which parses whole frames.
+func AcquireReader(r io.Reader) *bufio.Reader {
+	br := readerPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
+
+// ReleaseReader returns br to the pool.
+func ReleaseReader(br *bufio.Reader) {
+	br.Reset(nil)
+	readerPool.Put(br)
+}
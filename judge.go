@@ -0,0 +1,148 @@
+package llmagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Rubric tells the judge how to compare two answers. Template, if set,
+// replaces DefaultJudgeTemplate; it is executed with the JudgeInput and
+// must ask for the JSON reply described there.
+type Rubric struct {
+	Name     string
+	Task     string   // the prompt both candidates answered
+	Criteria []string // e.g. "accuracy", "helpfulness"; defaults to overall quality
+	Template string
+
+	Provider string // judge provider or alias; empty uses the agent default
+	Model    string
+}
+
+// JudgeInput is the data passed to a rubric template.
+type JudgeInput struct {
+	Task     string
+	Criteria []string
+	A, B     string
+}
+
+// DefaultJudgeTemplate is the prompt used by rubrics without a Template.
+const DefaultJudgeTemplate = `You are an impartial judge comparing two answers to the same task.
+{{if .Task}}
+Task:
+{{.Task}}
+{{end}}
+Answer A:
+{{.A}}
+
+Answer B:
+{{.B}}
+
+Score each answer from 1 to 10 on each criterion: {{join .Criteria ", "}}.
+Do not let answer order or length sway you.
+Reply with JSON only, in this form:
+{"scores":{"<criterion>":{"a":<score>,"b":<score>}},"preferred":"a"|"b"|"tie","reasoning":"<one or two sentences>"}`
+
+// Preference is the judge's verdict.
+type Preference string
+
+const (
+	PreferA   Preference = "a"
+	PreferB   Preference = "b"
+	PreferTie Preference = "tie"
+)
+
+// CriterionScore holds both candidates' scores for one criterion.
+type CriterionScore struct {
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+}
+
+// Judgement is the structured result of Judge.
+type Judgement struct {
+	Rubric    string                    `json:"rubric,omitempty"`
+	Scores    map[string]CriterionScore `json:"scores"`
+	Preferred Preference                `json:"preferred"`
+	Reasoning string                    `json:"reasoning"`
+	ScoreA    float64                   `json:"score_a"` // mean over criteria
+	ScoreB    float64                   `json:"score_b"`
+}
+
+var judgeFuncs = template.FuncMap{"join": strings.Join}
+
+// Judge asks a model to score candidateA and candidateB against rubric.
+func (a *Agent) Judge(ctx context.Context, rubric Rubric, candidateA, candidateB string) (Judgement, error) {
+	text := rubric.Template
+	if text == "" {
+		text = DefaultJudgeTemplate
+	}
+	tmpl, err := template.New("judge").Funcs(judgeFuncs).Parse(text)
+	if err != nil {
+		return Judgement{}, fmt.Errorf("rubric %q: %w", rubric.Name, err)
+	}
+	criteria := rubric.Criteria
+	if len(criteria) == 0 {
+		criteria = []string{"overall"}
+	}
+	var prompt bytes.Buffer
+	if err := tmpl.Execute(&prompt, JudgeInput{Task: rubric.Task, Criteria: criteria, A: candidateA, B: candidateB}); err != nil {
+		return Judgement{}, fmt.Errorf("rubric %q: %w", rubric.Name, err)
+	}
+
+	// Judge calls bypass policy and shadowing, which may themselves judge.
+	ch, err := a.complete(ctx, rubric.Provider, CompletionRequest{
+		Model:       rubric.Model,
+		Stream:      new(bool),
+		Temperature: Float64(0),
+		MaxTokens:   400,
+		Messages:    []Message{{Role: RoleUser, Content: prompt.String()}},
+	})
+	if err != nil {
+		return Judgement{}, err
+	}
+	resp, err := Collect(ch)
+	if err != nil {
+		return Judgement{}, err
+	}
+	return parseJudgement(rubric.Name, resp.Content)
+}
+
+// parseJudgement extracts the JSON object from the judge's reply, which
+// may be wrapped in prose or a code fence.
+func parseJudgement(rubric, reply string) (Judgement, error) {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return Judgement{}, fmt.Errorf("judge reply has no JSON object: %q", reply)
+	}
+	var j Judgement
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &j); err != nil {
+		return Judgement{}, fmt.Errorf("parse judge reply: %w", err)
+	}
+	j.Rubric = rubric
+	j.Preferred = Preference(strings.ToLower(string(j.Preferred)))
+	for _, s := range j.Scores {
+		j.ScoreA += s.A
+		j.ScoreB += s.B
+	}
+	if n := float64(len(j.Scores)); n > 0 {
+		j.ScoreA /= n
+		j.ScoreB /= n
+	}
+	switch j.Preferred {
+	case PreferA, PreferB, PreferTie:
+	default:
+		// fall back to the scores when the verdict is missing or garbled
+		switch {
+		case j.ScoreA > j.ScoreB:
+			j.Preferred = PreferA
+		case j.ScoreB > j.ScoreA:
+			j.Preferred = PreferB
+		default:
+			j.Preferred = PreferTie
+		}
+	}
+	return j, nil
+}
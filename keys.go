@@ -0,0 +1,390 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// KeyHolder stores a provider's API keys and tracks how many requests are
+// in flight on each key, so a rotated-out key can be drained. Providers
+// embed it to become rotatable.
+//
+// A holder may own a pool of keys (SetAPIKeys). Requests then spread over
+// the pool round-robin, and a key that hits a rate limit or quota error is
+// cooled down while the request moves on to the next key (see Failover).
+type KeyHolder struct {
+	mu       sync.Mutex
+	keys     []*pooledKey
+	next     int
+	serial   int // installation order of pooled keys
+	inflight map[string]int
+	drained  chan struct{} // closed and replaced whenever a count drops to zero
+
+	// CoolDown is how long a rate-limited key is skipped; defaults to a
+	// minute.
+	CoolDown time.Duration
+	// Clock times cool-downs; providers set it from ProviderConfig.Clock.
+	Clock Clock
+}
+
+type pooledKey struct {
+	key         string
+	serial      int
+	requests    int
+	rateLimited int
+	coolUntil   time.Time
+}
+
+// KeyUsage reports per-key counters of a pool. Keys are masked.
+type KeyUsage struct {
+	Key         string
+	Requests    int
+	RateLimited int
+	CoolUntil   time.Time // zero unless cooling down
+}
+
+// APIKey returns the key new requests would use next.
+func (k *KeyHolder) APIKey() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if pk := k.pick(false); pk != nil {
+		return pk.key
+	}
+	return ""
+}
+
+// APIKeys returns the pooled keys in pool order.
+func (k *KeyHolder) APIKeys() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := make([]string, len(k.keys))
+	for i, pk := range k.keys {
+		keys[i] = pk.key
+	}
+	return keys
+}
+
+// SetAPIKey replaces the pool with a single key for new requests; in-flight
+// requests keep the key they started with.
+func (k *KeyHolder) SetAPIKey(key string) {
+	k.SetAPIKeys(key)
+}
+
+// SetAPIKeys replaces the pool. Usage counters of keys kept in the pool
+// are preserved.
+func (k *KeyHolder) SetAPIKeys(keys ...string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	old := make(map[string]*pooledKey, len(k.keys))
+	for _, pk := range k.keys {
+		old[pk.key] = pk
+	}
+	k.keys = k.keys[:0:0]
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if pk, ok := old[key]; ok {
+			k.keys = append(k.keys, pk)
+		} else {
+			k.keys = append(k.keys, k.newKey(key))
+		}
+	}
+	k.next = 0
+}
+
+// RotateAPIKey puts key into the pool, keeping the other keys and their
+// counters. While the pool holds fewer than size keys, key is added;
+// otherwise it replaces the longest-serving key, which is returned so the
+// caller can drain it. A key already in the pool is left alone.
+func (k *KeyHolder) RotateAPIKey(key string, size int) (old string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if key == "" {
+		return ""
+	}
+	oldest := -1
+	for i, pk := range k.keys {
+		if pk.key == key {
+			return ""
+		}
+		if oldest < 0 || pk.serial < k.keys[oldest].serial {
+			oldest = i
+		}
+	}
+	if oldest < 0 || len(k.keys) < size {
+		k.keys = append(k.keys, k.newKey(key))
+		return ""
+	}
+	old = k.keys[oldest].key
+	k.keys[oldest] = k.newKey(key)
+	return old
+}
+
+// newKey must be called with k.mu held.
+func (k *KeyHolder) newKey(key string) *pooledKey {
+	k.serial++
+	return &pooledKey{key: key, serial: k.serial}
+}
+
+// Usage returns per-key counters in pool order.
+func (k *KeyHolder) Usage() []KeyUsage {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := clockOr(k.Clock).Now()
+	out := make([]KeyUsage, len(k.keys))
+	for i, pk := range k.keys {
+		out[i] = KeyUsage{Key: maskKey(pk.key), Requests: pk.requests, RateLimited: pk.rateLimited}
+		if pk.coolUntil.After(now) {
+			out[i].CoolUntil = pk.coolUntil
+		}
+	}
+	return out
+}
+
+// pick returns the next key round-robin, skipping cooling keys unless all
+// of them are cooling, in which case the one recovering first is used.
+func (k *KeyHolder) pick(advance bool) *pooledKey {
+	if len(k.keys) == 0 {
+		return nil
+	}
+	now := clockOr(k.Clock).Now()
+	var soonest *pooledKey
+	for i := range k.keys {
+		idx := (k.next + i) % len(k.keys)
+		pk := k.keys[idx]
+		if !pk.coolUntil.After(now) {
+			if advance {
+				k.next = idx + 1
+			}
+			return pk
+		}
+		if soonest == nil || pk.coolUntil.Before(soonest.coolUntil) {
+			soonest = pk
+		}
+	}
+	return soonest
+}
+
+type apiKeyKey struct{}
+
+// WithAPIKey makes requests made with the returned context use key instead
+// of the provider's pool, without failing over to pooled keys.
+// RotationManager uses it to probe a key before installing it.
+func WithAPIKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, key)
+}
+
+// AcquireKey returns a key for a request made with ctx and marks a request
+// in flight on it. release must be called when the request finishes.
+func (k *KeyHolder) AcquireKey(ctx context.Context) (key string, release func()) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if key, ok := ctx.Value(apiKeyKey{}).(string); ok {
+		return k.acquire(key)
+	}
+	if pk := k.pick(true); pk != nil {
+		key = pk.key
+		pk.requests++
+	}
+	return k.acquire(key)
+}
+
+// acquire must be called with k.mu held.
+func (k *KeyHolder) acquire(key string) (string, func()) {
+	if k.inflight == nil {
+		k.inflight = make(map[string]int)
+	}
+	k.inflight[key]++
+	var once sync.Once
+	return key, func() {
+		once.Do(func() {
+			k.mu.Lock()
+			defer k.mu.Unlock()
+			k.inflight[key]--
+			if k.inflight[key] <= 0 {
+				delete(k.inflight, key)
+				if k.drained != nil {
+					close(k.drained)
+					k.drained = nil
+				}
+			}
+		})
+	}
+}
+
+// Failover handles err from a request made with ctx and key. Rate limit
+// and quota errors (HTTP 429 and 402) cool the key down; if another key is
+// available it is acquired and returned for an immediate retry. The caller
+// still releases the original key. Keys set by WithAPIKey never fail over.
+func (k *KeyHolder) Failover(ctx context.Context, key string, err error) (next string, release func(), ok bool) {
+	code := StatusCode(err)
+	if code != http.StatusTooManyRequests && code != http.StatusPaymentRequired {
+		return "", nil, false
+	}
+	if _, pinned := ctx.Value(apiKeyKey{}).(string); pinned {
+		return "", nil, false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	coolDown := k.CoolDown
+	if coolDown <= 0 {
+		coolDown = time.Minute
+	}
+	for _, pk := range k.keys {
+		if pk.key == key {
+			pk.rateLimited++
+			pk.coolUntil = clockOr(k.Clock).Now().Add(coolDown)
+		}
+	}
+	pk := k.pick(true)
+	if pk == nil || pk.key == key || pk.coolUntil.After(clockOr(k.Clock).Now()) {
+		return "", nil, false
+	}
+	pk.requests++
+	next, release = k.acquire(pk.key)
+	return next, release, true
+}
+
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "…" + key[len(key)-4:]
+}
+
+// Drain waits until no request is in flight on key, or ctx is done.
+func (k *KeyHolder) Drain(ctx context.Context, key string) error {
+	for {
+		k.mu.Lock()
+		if k.inflight[key] == 0 {
+			k.mu.Unlock()
+			return nil
+		}
+		if k.drained == nil {
+			k.drained = make(chan struct{})
+		}
+		wait := k.drained
+		k.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// KeyRotator is implemented by providers whose API keys can be rotated at
+// runtime (every provider embedding KeyHolder).
+type KeyRotator interface {
+	APIKeys() []string
+	SetAPIKeys(keys ...string)
+	RotateAPIKey(key string, size int) (old string)
+	Drain(ctx context.Context, key string) error
+}
+
+// KeySource fetches the current API key for a provider, e.g. from a secret
+// store such as secretr.
+type KeySource func(ctx context.Context, provider string) (string, error)
+
+// RotationManager rotates provider API keys from a KeySource, one pool
+// member at a time, optionally verifying each new key with a probe
+// completion before it goes live.
+type RotationManager struct {
+	Agent  *Agent
+	Source KeySource
+	// Probe sends a one-token completion with the new key before it joins
+	// the pool; a failing key is never installed.
+	Probe bool
+	// PoolSize is how many keys a pool grows to before a new key replaces
+	// the longest-serving one (0 or 1 = replace).
+	PoolSize int
+	// DrainTimeout bounds how long Rotate waits for requests on the old key
+	// to finish (0 = don't wait). If they don't, the rotation is rolled
+	// back and the old key stays in use.
+	DrainTimeout time.Duration
+	// OnRotate, if set, is called after every scheduled rotation attempt.
+	OnRotate func(provider string, err error)
+}
+
+// Rotate fetches a fresh key for the named provider and installs it in the
+// provider's pool, keeping the other keys. When it replaces a key, it
+// returns once in-flight requests on that key have drained (bounded by
+// DrainTimeout), so the caller can safely revoke it. If they don't drain
+// in time, the pool is restored and the error says so: the old key must
+// not be revoked yet.
+func (m *RotationManager) Rotate(ctx context.Context, provider string) error {
+	p, ok := m.Agent.provider(provider)
+	if !ok {
+		return fmt.Errorf("provider %q not registered", provider)
+	}
+	kr, ok := p.(KeyRotator)
+	if !ok {
+		return fmt.Errorf("provider %q does not support key rotation", provider)
+	}
+	newKey, err := m.Source(ctx, provider)
+	if err != nil {
+		return fmt.Errorf("fetch key for %q: %w", provider, err)
+	}
+	if newKey == "" {
+		return errors.New("key source returned an empty key")
+	}
+	if slices.Contains(kr.APIKeys(), newKey) {
+		return nil
+	}
+	if m.Probe {
+		if err := probe(WithAPIKey(ctx, newKey), p); err != nil {
+			return fmt.Errorf("new key for %q failed probe: %w", provider, err)
+		}
+	}
+	before := kr.APIKeys()
+	oldKey := kr.RotateAPIKey(newKey, m.PoolSize)
+	if oldKey != "" && m.DrainTimeout > 0 {
+		dctx, cancel := context.WithTimeout(ctx, m.DrainTimeout)
+		defer cancel()
+		if err := kr.Drain(dctx, oldKey); err != nil {
+			kr.SetAPIKeys(before...)
+			return fmt.Errorf("drain old key for %q, rotation rolled back: %w", provider, err)
+		}
+	}
+	return nil
+}
+
+// Schedule rotates the provider's key every interval of the agent's Clock
+// until ctx is done.
+func (m *RotationManager) Schedule(ctx context.Context, provider string, interval time.Duration) {
+	ticker := m.Agent.clock().NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+			err := m.Rotate(ctx, provider)
+			if m.OnRotate != nil {
+				m.OnRotate(provider, err)
+			}
+		}
+	}()
+}
+
+// probe sends a minimal completion straight to p, bypassing the cache.
+func probe(ctx context.Context, p Provider) error {
+	ch, err := p.Complete(ctx, CompletionRequest{
+		Stream:    new(bool),
+		MaxTokens: 1,
+		Messages:  []Message{{Role: RoleUser, Content: "ping"}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = Collect(ch)
+	return err
+}
@@ -0,0 +1,174 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// keyed returns a provider answering with the key each request acquired,
+// failing for keys listed in bad. used records the keys in order.
+func keyed(bad map[string]bool) (p *testProvider, used *[]string) {
+	used = new([]string)
+	p = newTestProvider("keyed", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		key, release := p.AcquireKey(ctx)
+		defer release()
+		*used = append(*used, key)
+		ch := make(chan CompletionResponse, 1)
+		if bad[key] {
+			ch <- CompletionResponse{Err: &WireError{Message: "invalid key", StatusCode: http.StatusUnauthorized}, Done: true}
+		} else {
+			ch <- CompletionResponse{Content: key, Done: true, FinishReason: FinishStop}
+		}
+		close(ch)
+		return ch, nil
+	})
+	return p, used
+}
+
+func TestRotateKeepsPool(t *testing.T) {
+	p, used := keyed(map[string]bool{"bad": true})
+	p.SetAPIKeys("k1", "k2", "k3")
+	a, _ := testAgent(t, p)
+	next := []string{"k4", "k5", "bad", "k3"}
+	m := &RotationManager{Agent: a, Probe: true, Source: func(context.Context, string) (string, error) {
+		key := next[0]
+		next = next[1:]
+		return key, nil
+	}}
+	ctx := context.Background()
+
+	steps := []struct {
+		pool []string
+		err  bool
+	}{
+		{pool: []string{"k4", "k2", "k3"}},            // replaces the longest-serving key
+		{pool: []string{"k4", "k5", "k3"}},            // then the next one
+		{pool: []string{"k4", "k5", "k3"}, err: true}, // a failing probe installs nothing
+		{pool: []string{"k4", "k5", "k3"}},            // a key already pooled is a no-op
+	}
+	for i, step := range steps {
+		err := m.Rotate(ctx, "keyed")
+		if (err != nil) != step.err {
+			t.Fatalf("rotation %d: err = %v", i, err)
+		}
+		if got := p.APIKeys(); !slices.Equal(got, step.pool) {
+			t.Fatalf("rotation %d: pool = %q, want %q", i, got, step.pool)
+		}
+	}
+	// probes ran on the new keys only, never on pooled ones
+	if want := []string{"k4", "k5", "bad"}; !slices.Equal(*used, want) {
+		t.Fatalf("probed keys = %q, want %q", *used, want)
+	}
+	for _, u := range p.Usage() {
+		if u.Requests != 0 {
+			t.Fatalf("probe counted against pooled key %s", u.Key)
+		}
+	}
+}
+
+func TestRotateGrowsPool(t *testing.T) {
+	p, _ := keyed(nil)
+	a, _ := testAgent(t, p)
+	keys := []string{"k1", "k2", "k3"}
+	m := &RotationManager{Agent: a, PoolSize: 2, Source: func(context.Context, string) (string, error) {
+		key := keys[0]
+		keys = keys[1:]
+		return key, nil
+	}}
+	for range 3 {
+		if err := m.Rotate(context.Background(), "keyed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := p.APIKeys(), []string{"k3", "k2"}; !slices.Equal(got, want) {
+		t.Fatalf("pool = %q, want %q", got, want)
+	}
+}
+
+func TestPinnedKeyDoesNotFailOver(t *testing.T) {
+	var k KeyHolder
+	k.SetAPIKeys("k1", "k2")
+	ctx := WithAPIKey(context.Background(), "probe")
+	key, release := k.AcquireKey(ctx)
+	defer release()
+	if key != "probe" {
+		t.Fatalf("key = %q, want the pinned key", key)
+	}
+	limited := &WireError{Message: "slow down", StatusCode: http.StatusTooManyRequests}
+	if _, _, ok := k.Failover(ctx, key, limited); ok {
+		t.Fatal("pinned key failed over to the pool")
+	}
+	key, release2 := k.AcquireKey(context.Background())
+	defer release2()
+	if _, _, ok := k.Failover(context.Background(), key, limited); !ok {
+		t.Fatal("pooled key did not fail over")
+	}
+	if !errors.Is(k.Drain(canceled(), "probe"), context.Canceled) {
+		t.Fatal("drain returned while the pinned key was in flight")
+	}
+}
+
+func canceled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestRotateRollsBackUndrainedKey(t *testing.T) {
+	p, _ := keyed(nil)
+	p.SetAPIKeys("k1")
+	a, _ := testAgent(t, p)
+	m := &RotationManager{Agent: a, DrainTimeout: 10 * time.Millisecond, Source: func(context.Context, string) (string, error) {
+		return "k2", nil
+	}}
+
+	_, release := p.AcquireKey(context.Background()) // a request still on k1
+	err := m.Rotate(context.Background(), "keyed")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the drain timeout", err)
+	}
+	if got := p.APIKeys(); !slices.Equal(got, []string{"k1"}) {
+		t.Fatalf("pool after the failed drain = %q, want k1 restored", got)
+	}
+	release()
+	if err := m.Rotate(context.Background(), "keyed"); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.APIKeys(); !slices.Equal(got, []string{"k2"}) {
+		t.Fatalf("pool = %q, want k2", got)
+	}
+}
+
+func TestScheduledRotationOnClock(t *testing.T) {
+	p, _ := keyed(nil)
+	p.SetAPIKeys("k0")
+	a, clock := testAgent(t, p)
+	n := 0
+	rotated := make(chan error, 1)
+	m := &RotationManager{
+		Agent: a,
+		Source: func(context.Context, string) (string, error) {
+			n++
+			return fmt.Sprint("k", n), nil
+		},
+		OnRotate: func(provider string, err error) { rotated <- err },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Schedule(ctx, "keyed", time.Hour)
+
+	for i := 1; i <= 2; i++ {
+		clock.Advance(time.Hour)
+		if err := <-rotated; err != nil {
+			t.Fatal(err)
+		}
+		if got, want := p.APIKeys(), []string{fmt.Sprint("k", i)}; !slices.Equal(got, want) {
+			t.Fatalf("after %d hours pool = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package llmagent
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LimitError is returned when a request or response exceeds one of the
+// payload size guards configured on a provider.
+type LimitError struct {
+	Limit  string // which limit was hit, e.g. "prompt_bytes"
+	Max    int    // configured maximum
+	Actual int    // observed size (may be a lower bound while streaming)
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("llmagent: %s limit exceeded (%d > %d)", e.Limit, e.Actual, e.Max)
+}
+
+// IsLimitError reports whether err is (or wraps) a *LimitError.
+func IsLimitError(err error) bool {
+	var le *LimitError
+	return errors.As(err, &le)
+}
+
+// EstimateTokens gives a rough token count for s using the common
+// four-characters-per-token heuristic.
+func EstimateTokens(s string) int {
+	if s == "" {
+		return 0
+	}
+	return (len(s) + 3) / 4
+}
+
+// CheckRequestSize validates the prompt of req against MaxPromptBytes and
+// MaxPromptTokens before it is sent upstream.
+func (c *ProviderConfig) CheckRequestSize(req CompletionRequest) error {
+	if c.MaxPromptBytes <= 0 && c.MaxPromptTokens <= 0 {
+		return nil
+	}
+	var size, tokens int
+	for _, msg := range req.Messages {
+		size += len(msg.Content)
+		tokens += EstimateTokens(msg.Content)
+	}
+	if c.MaxPromptBytes > 0 && size > c.MaxPromptBytes {
+		return &LimitError{Limit: "prompt_bytes", Max: c.MaxPromptBytes, Actual: size}
+	}
+	if c.MaxPromptTokens > 0 && tokens > c.MaxPromptTokens {
+		return &LimitError{Limit: "prompt_tokens", Max: c.MaxPromptTokens, Actual: tokens}
+	}
+	return nil
+}
+
+// CheckResponseSize returns a *LimitError once received bytes exceed
+// MaxResponseBytes. Providers call it as content accumulates.
+func (c *ProviderConfig) CheckResponseSize(received int) error {
+	if c.MaxResponseBytes > 0 && received > c.MaxResponseBytes {
+		return &LimitError{Limit: "response_bytes", Max: c.MaxResponseBytes, Actual: received}
+	}
+	return nil
+}
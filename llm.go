@@ -3,11 +3,12 @@ package llmagent
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,19 +18,54 @@ type ProviderMetrics struct {
 	SuccessCount int
 	FailureCount int
 	TotalLatency time.Duration
+	RateLimited  int // failures with HTTP 429 or 503
+
+	// Aggregated from the Done event of each completion.
+	Completions           int
+	StreamErrors          int
+	PromptTokens          int
+	CompletionTokens      int
+	TotalDuration         time.Duration
+	TotalTimeToFirstToken time.Duration
+
+	// From the most recent response headers, including those of
+	// rate-limited failures.
+	RateLimit     *RateLimit
+	LastRequestID string
 }
 
 type ProviderConfig struct {
 	BaseURL            string
 	Timeout            time.Duration
-	DefaultModel       string      // default model if request.Model is empty
-	DefaultStream      *bool       // default stream value if request.Stream is nil
-	DefaultTemperature float64     // default temperature (e.g. 0.7)
-	DefaultMaxTokens   int         // default max tokens (e.g. 100)
-	DefaultTopP        float64     // default top_p (e.g. 1.0)
-	SupportedModels    []string    // list of supported models
-	Logger             *log.Logger // optional logger for debugging
-	RetryCount         int         // number of retry attempts for a failing request
+	DefaultModel       string                // default model if request.Model is empty
+	DefaultStream      *bool                 // default stream value if request.Stream is nil
+	DefaultTemperature *float64              // default temperature (e.g. 0.7) if request.Temperature is nil
+	DefaultMaxTokens   int                   // default max tokens (e.g. 100)
+	DefaultTopP        *float64              // default top_p (e.g. 1.0) if request.TopP is nil
+	SupportedModels    []string              // list of supported models
+	Logger             *log.Logger           // optional logger for debugging
+	RetryCount         int                   // number of retry attempts for a failing request
+	MaxRetryDelay      time.Duration         // longest Retry-After honored before failing over instead (0 = DefaultMaxRetryDelay)
+	MaxPromptBytes     int                   // reject prompts larger than this many bytes (0 = unlimited)
+	MaxPromptTokens    int                   // reject prompts estimated above this many tokens (0 = unlimited)
+	MaxResponseBytes   int                   // abort responses larger than this many bytes (0 = DefaultMaxBodyBytes for non-streaming, unlimited for streams)
+	MaxConcurrency     int                   // max simultaneous upstream requests through the agent (0 = unlimited)
+	GzipRequestsAbove  int                   // gzip request bodies larger than this many bytes (0 = never)
+	AllowedExtra       []string              // CompletionRequest.Extra keys passed to this provider (nil = any)
+	Region             string                // data residency region of the endpoint, e.g. "eu" or "us"; see RequireRegion
+	ParamRules         []ParamRule           // clamp/strip parameters per model; see ApplyParamRules
+	OnParamAdjust      func(ParamAdjustment) // called for every parameter a rule changes
+	Clock              Clock                 // time source for key cool-downs; SystemClock when nil
+	Options            ProviderOptions       // provider-specific settings, e.g. AnthropicOptions
+	Drift              *DriftMonitor         // reports response schema drift; see DecodeResponse
+	RateLimiter        RateLimiter           // paces requests, e.g. to an org-level limit shared by instances
+
+	// Egress settings used by HTTPClient.
+	Proxy     string            // http://, https:// or socks5:// proxy URL
+	Dialer    *net.Dialer       // custom dialer (timeouts, resolver, ...)
+	LocalAddr string            // source IP to bind, selecting the network interface
+	Network   string            // "tcp4" or "tcp6" to force an address family
+	Transport http.RoundTripper // replaces all of the above when set
 }
 
 type Option func(*ProviderConfig)
@@ -60,7 +96,7 @@ func WithDefaultStream(stream bool) Option {
 
 func WithDefaultTemperature(temp float64) Option {
 	return func(p *ProviderConfig) {
-		p.DefaultTemperature = temp
+		p.DefaultTemperature = &temp
 	}
 }
 
@@ -72,7 +108,7 @@ func WithDefaultMaxTokens(max int) Option {
 
 func WithDefaultTopP(topP float64) Option {
 	return func(p *ProviderConfig) {
-		p.DefaultTopP = topP
+		p.DefaultTopP = &topP
 	}
 }
 
@@ -88,22 +124,165 @@ func WithRetryCount(count int) Option {
 	}
 }
 
+// WithMaxRetryDelay caps how long the agent waits on a 429 or 503 that
+// carries Retry-After before retrying the provider; a longer delay moves on
+// to the next provider instead.
+func WithMaxRetryDelay(d time.Duration) Option {
+	return func(p *ProviderConfig) {
+		p.MaxRetryDelay = d
+	}
+}
+
+func WithMaxPromptBytes(n int) Option {
+	return func(p *ProviderConfig) {
+		p.MaxPromptBytes = n
+	}
+}
+
+func WithMaxPromptTokens(n int) Option {
+	return func(p *ProviderConfig) {
+		p.MaxPromptTokens = n
+	}
+}
+
+func WithMaxResponseBytes(n int) Option {
+	return func(p *ProviderConfig) {
+		p.MaxResponseBytes = n
+	}
+}
+
+// WithMaxConcurrency caps simultaneous in-flight requests to the provider;
+// excess requests wait, in arrival order, for a free slot or their context
+// to end. Lowering the cap at runtime lets in-flight requests finish
+// before new ones start.
+func WithMaxConcurrency(n int) Option {
+	return func(p *ProviderConfig) {
+		p.MaxConcurrency = n
+	}
+}
+
+// WithGzipRequests compresses request bodies above threshold bytes. Only
+// use it with APIs that accept Content-Encoding: gzip uploads; responses are
+// always negotiated with Accept-Encoding: gzip.
+func WithGzipRequests(threshold int) Option {
+	return func(p *ProviderConfig) {
+		p.GzipRequestsAbove = threshold
+	}
+}
+
+// WithRegion records the data residency region of the provider's endpoint.
+func WithRegion(region string) Option {
+	return func(p *ProviderConfig) {
+		p.Region = region
+	}
+}
+
+// WithAllowedExtra restricts which CompletionRequest.Extra parameters are
+// sent to the provider; requests carrying other keys are rejected.
+func WithAllowedExtra(keys ...string) Option {
+	return func(p *ProviderConfig) {
+		p.AllowedExtra = keys
+	}
+}
+
+// WithProxy routes the provider's traffic through an HTTP(S) or SOCKS5 proxy.
+func WithProxy(proxyURL string) Option {
+	return func(p *ProviderConfig) {
+		p.Proxy = proxyURL
+	}
+}
+
+func WithDialer(d *net.Dialer) Option {
+	return func(p *ProviderConfig) {
+		p.Dialer = d
+	}
+}
+
+// WithLocalAddr binds outgoing connections to the given source IP.
+func WithLocalAddr(ip string) Option {
+	return func(p *ProviderConfig) {
+		p.LocalAddr = ip
+	}
+}
+
+// WithNetwork forces "tcp4" or "tcp6" connections.
+func WithNetwork(network string) Option {
+	return func(p *ProviderConfig) {
+		p.Network = network
+	}
+}
+
+func WithTransport(rt http.RoundTripper) Option {
+	return func(p *ProviderConfig) {
+		p.Transport = rt
+	}
+}
+
 // Message represents a single turn in the conversation.
 type Message struct {
-	Role    string `json:"role"`           // "user" or "assistant"
+	Role    Role   `json:"role"`           // see RoleUser, RoleAssistant, ...
 	Content string `json:"content"`        // The message content
 	Name    string `json:"name,omitempty"` // Optional name field for Claude API
+
+	// ToolCalls are the calls an assistant turn made; ToolCallID links a
+	// tool message to the call it answers. See ToolCallsMessage and
+	// ToolReply.
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
 }
 
 // CompletionRequest holds settings for a completion call.
 type CompletionRequest struct {
-	Messages    []Message `json:"messages"`
-	Model       string    `json:"model,omitempty"`       // if empty, use ProviderConfig.DefaultModel
-	Stream      *bool     `json:"stream,omitempty"`      // if nil, use ProviderConfig.DefaultStream
-	Temperature float64   `json:"temperature,omitempty"` // if zero, use ProviderConfig.DefaultTemperature
-	MaxTokens   int       `json:"max_tokens,omitempty"`  // if zero, use ProviderConfig.DefaultMaxTokens
-	TopP        float64   `json:"top_p,omitempty"`       // if zero, use ProviderConfig.DefaultTopP
-	Stop        []string  `json:"stop,omitempty"`        // new optional stop sequence(s)
+	Messages    []Message  `json:"messages"`
+	Model       string     `json:"model,omitempty"`       // if empty, use ProviderConfig.DefaultModel
+	Stream      *bool      `json:"stream,omitempty"`      // if nil, use ProviderConfig.DefaultStream
+	Temperature *float64   `json:"temperature,omitempty"` // if nil, use ProviderConfig.DefaultTemperature; 0 means greedy
+	MaxTokens   int        `json:"max_tokens,omitempty"`  // if zero, use ProviderConfig.DefaultMaxTokens
+	TopP        *float64   `json:"top_p,omitempty"`       // if nil, use ProviderConfig.DefaultTopP
+	Stop        []string   `json:"stop,omitempty"`        // new optional stop sequence(s)
+	Documents   []Document `json:"documents,omitempty"`   // retrieved context, rendered via Agent.DocumentFormatter
+	Seed        *int       `json:"seed,omitempty"`        // deterministic sampling, where supported
+	Logprobs    bool       `json:"logprobs,omitempty"`    // request per-token log probabilities, where supported
+
+	// Tools are the functions the model may call; calls come back as
+	// CompletionResponse.ToolCalls.
+	Tools []ToolDefinition `json:"tools,omitempty"`
+	// ToolChoice forces or forbids tool calls; nil leaves it to the model.
+	// ParallelToolCalls, when set to false, limits the model to one tool
+	// call per turn.
+	ToolChoice        *ToolChoice `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool       `json:"parallel_tool_calls,omitempty"`
+
+	// Tags label the request for metrics, audit hooks (TagsFromContext)
+	// and billing, e.g. "feature:summarize"; see Agent.Taxonomy. They
+	// don't affect the answer or the cache key.
+	Tags []string `json:"tags,omitempty"`
+
+	// SuggestQuestions, when positive, follows the answer with up to that
+	// many likely follow-up questions in a suggestions event, written by
+	// Agent.SuggestProvider/SuggestModel. Like Tags it isn't part of the
+	// cache key.
+	SuggestQuestions int `json:"suggest_questions,omitempty"`
+
+	// Extra is merged into the provider payload as-is, for parameters this
+	// package doesn't model yet. It never overrides fields set above.
+	Extra map[string]any `json:"extra,omitempty"`
+}
+
+// Float64 returns a pointer to v, for setting optional request fields such
+// as Temperature and TopP.
+func Float64(v float64) *float64 {
+	return &v
+}
+
+// Int returns a pointer to v, for setting Seed.
+func Int(v int) *int {
+	return &v
+}
+
+// Bool returns a pointer to v, for setting Stream.
+func Bool(v bool) *bool {
+	return &v
 }
 
 func (c CompletionRequest) StreamValue() bool {
@@ -118,8 +297,38 @@ func (c CompletionRequest) StreamValue() bool {
 
 // CompletionResponse is streamed back to the caller.
 type CompletionResponse struct {
-	Content string `json:"content"` // the completion text
-	Err     error  `json:"error"`   // any error that occurred
+	Content  string `json:"content"`            // the completion text
+	Err      error  `json:"error"`              // any error that occurred
+	Provider string `json:"provider,omitempty"` // provider that produced the response
+	Cached   bool   `json:"cached,omitempty"`   // served from the agent cache
+	Usage    *Usage `json:"usage,omitempty"`    // token usage, when reported by the provider
+	// Role is the author of Content or ToolCalls, normally assistant.
+	Role Role `json:"role,omitempty"`
+	// Index is the event's position in the stream returned by Complete,
+	// counting from 0.
+	Index int `json:"index"`
+
+	// Done marks the terminal event of a completion; Stats is set on it.
+	// FinishReason tells a normal stop from a length cutoff, a content
+	// filter, tool calls or an error.
+	Done         bool             `json:"done,omitempty"`
+	FinishReason FinishReason     `json:"finish_reason,omitempty"`
+	Stats        *CompletionStats `json:"stats,omitempty"`
+	Citations    []Citation       `json:"citations,omitempty"` // documents referenced by the answer
+	Logprobs     []TokenLogprob   `json:"logprobs,omitempty"`  // tokens of Content, when requested
+	ToolCalls    []ToolCall       `json:"tool_calls,omitempty"`
+
+	// SuggestedQuestions is set on the suggestions event, sent just before
+	// Done when the request asked for SuggestQuestions.
+	SuggestedQuestions []string `json:"suggested_questions,omitempty"`
+
+	// Meta is set only on a provider's leading header event, which the
+	// agent consumes; callers see it via Stats.RequestID and Stats.RateLimit.
+	Meta *ResponseMeta `json:"-"`
+
+	// Degraded marks a fallback answer from Agent.Degraded, produced
+	// because every provider failed.
+	Degraded bool `json:"degraded,omitempty"`
 }
 
 // Provider now assumes provider configuration is internal.
@@ -136,22 +345,131 @@ type Agent struct {
 	userProviders     map[string]Provider
 	systemProviders   map[string]Provider
 
-	// updated: cache now stores cacheEntry with expiration.
-	cache     map[string]cacheEntry
-	cacheLock sync.RWMutex
+	// updated: cache is an LRU bounded by CacheMaxEntries/CacheMaxBytes.
+	cache *responseCache
 
 	// new: CacheTTL defines the lifetime of a cached entry.
 	CacheTTL time.Duration
+	// RetryBudget bounds attempts across primary and fallback providers for
+	// each request; override per request with WithRetryBudget.
+	RetryBudget RetryBudget
+
+	// CacheKey builds cache keys; defaults to DefaultCacheKey when nil.
+	CacheKey CacheKeyFunc
+	// NegativeCacheTTL, when positive, caches deterministic errors (see
+	// IsDeterministicError) for this long so repeated bad requests don't
+	// hammer providers.
+	NegativeCacheTTL time.Duration
+	// CacheMaxEntries and CacheMaxBytes bound the cache size (0 = unlimited).
+	CacheMaxEntries int
+	CacheMaxBytes   int
+	// CacheTier is an optional persistent level below the in-memory cache:
+	// entries evicted from memory spill to it and are promoted back on a
+	// hit. Responses to prompts of at least CacheTierMinTokens (estimated)
+	// are written through at once, so expensive long-context completions
+	// survive restarts.
+	CacheTier          CacheTier
+	CacheTierMinTokens int
+	purger             sync.Once
 
 	// new: metrics tracking per provider
 	metrics     map[string]*ProviderMetrics
 	metricsLock sync.Mutex
-}
-
-// new: cacheEntry holds cached response and its expiration.
-type cacheEntry struct {
-	content   string
-	expiresAt time.Time
+	// SharedMetrics, if set, also receives every metric update, so
+	// ClusterMetrics can report the totals of all instances.
+	SharedMetrics MetricsStore
+	metricsPush   metricsPusher
+
+	aliases  aliasRegistry
+	limiters limiterSet
+
+	// Personas holds named system prompts used by CompleteAs.
+	Personas *PersonaRegistry
+
+	// DocumentFormatter renders CompletionRequest.Documents into the prompt;
+	// defaults to DefaultDocumentFormatter when nil.
+	DocumentFormatter DocumentFormatter
+
+	// Policy, if set, screens prompts before they are sent and answers
+	// before they reach the caller.
+	Policy *PolicyEngine
+
+	// HedgeAfter, together with HedgeProvider, enables hedged requests: if
+	// the chosen provider has not produced a first token within HedgeAfter,
+	// the request is also sent to HedgeProvider and the first to respond
+	// wins.
+	HedgeAfter    time.Duration
+	HedgeProvider string
+
+	// SLOs holds per-provider objectives; OnSLOEvent is called whenever one
+	// is breached or recovers (see SLOWebhook).
+	SLOs       map[string]SLO
+	OnSLOEvent func(SLOEvent)
+	slo        sloMonitor
+
+	// Shadow, if set, mirrors a sample of requests to a candidate provider
+	// for offline comparison.
+	Shadow *Shadow
+
+	// Encryptor, if set, encrypts response content held in the cache.
+	Encryptor Encryptor
+
+	// DataStores are the external stores holding user data, covered by
+	// PurgeUserData and ApplyRetention alongside the cache. Retention maps
+	// a store name (or CacheStoreName) to how long its data is kept.
+	DataStores []DataStore
+	Retention  map[string]time.Duration
+
+	// Degraded, if set, answers requests that every provider failed.
+	Degraded DegradedResponder
+
+	// Sanitize, if set, cleans every message before it is sent and rejects
+	// binary garbage.
+	Sanitize *SanitizeOptions
+
+	// Transformers rewrite every answer as it streams, e.g. MaskWords or
+	// StripEmoji; see Transform.
+	Transformers []func() StreamTransformer
+	// Aggregation, if set, coalesces tiny deltas into larger chunks before
+	// delivery; see Aggregate.
+	Aggregation *Aggregation
+
+	// Clock is the time source for retries, cache TTLs, hedging and SLO
+	// windows; SystemClock when nil. See FakeClock.
+	Clock Clock
+
+	// Billing, if set, aggregates usage and cost per tenant (see WithUser)
+	// for export with WriteBillingCSV or StripeMeter.
+	Billing *UsageLedger
+
+	// Requests, if set, keeps per-attempt samples for SLAReport.
+	Requests *RequestLog
+	// Taxonomy, if set, validates CompletionRequest.Tags.
+	Taxonomy *TagTaxonomy
+
+	// CostGuard is the default spend cap of new sessions; OnCostEvent is
+	// called whenever a session is downshifted or reaches its limit.
+	CostGuard   *CostGuard
+	OnCostEvent func(CostEvent)
+
+	// Prefetcher, if set, prefetches likely follow-ups after each
+	// non-streaming session turn.
+	Prefetcher *Prefetcher
+
+	// ToolGuard, if set, applies its policies to the tool calls RunTools
+	// executes. ToolResultLimit caps their results, and MaxToolIterations
+	// (default 8) the model turns of one run.
+	ToolGuard         *ToolGuard
+	ToolResultLimit   ToolResultLimit
+	MaxToolIterations int
+
+	// SuggestProvider and SuggestModel write the questions requested with
+	// CompletionRequest.SuggestQuestions; a small, cheap model is enough.
+	// Empty values use the agent and provider defaults.
+	SuggestProvider string
+	SuggestModel    string
+
+	plugins map[string]Plugin // installed via Use
 }
 
 // NewAgent creates an empty Agent.
@@ -159,62 +477,36 @@ func NewAgent() *Agent {
 	agent := &Agent{
 		userProviders:   make(map[string]Provider),
 		systemProviders: make(map[string]Provider),
-		cache:           make(map[string]cacheEntry),
+		cache:           newResponseCache(),
+		Personas:        NewPersonaRegistry(),
 		metrics:         make(map[string]*ProviderMetrics),
 		CacheTTL:        5 * time.Minute, // default TTL
+		CacheMaxEntries: 1000,
+		CacheMaxBytes:   32 << 20,
 	}
-	// new: background goroutine to purge expired cache entries.
-	go func() {
-		ticker := time.NewTicker(1 * time.Minute)
-		defer ticker.Stop()
-		for range ticker.C {
-			now := time.Now()
-			agent.cacheLock.Lock()
-			for k, entry := range agent.cache {
-				if entry.expiresAt.Before(now) {
-					delete(agent.cache, k)
-				}
-			}
-			agent.cacheLock.Unlock()
-		}
-	}()
+	// Expired cache entries are purged in the background once the cache
+	// is first used (see startPurger).
 	return agent
 }
 
-type CachedRequest struct {
-	Messages    []Message
-	Model       string
-	Temperature float64
-	MaxTokens   int
-	TopP        float64
-	Stop        []string
-}
-
-// new helper: getCacheKey computes a hash key from a non-streaming request.
-func getCacheKey(req CompletionRequest) (string, error) {
-	data, err := json.Marshal(CachedRequest{
-		Messages:    req.Messages,
-		Model:       req.Model,
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stop:        req.Stop,
-	})
-	if err != nil {
-		return "", err
-	}
-	sum := sha256.Sum256(data)
-	return fmt.Sprintf("%x", sum), nil
-}
-
 // RegisterProvidersFromUser registers a provider constructed by the user.
-func (a *Agent) RegisterProvidersFromUser(p Provider) {
+// The provider's config is validated first; an invalid provider is not
+// registered.
+func (a *Agent) RegisterProvidersFromUser(p Provider) error {
+	if err := p.GetConfig().Validate(); err != nil {
+		return fmt.Errorf("provider %q: %w", p.Name(), err)
+	}
 	a.userProviders[p.Name()] = p
+	return nil
 }
 
 // RegisterProvidersFromSystem registers a system default provider.
-func (a *Agent) RegisterProvidersFromSystem(p Provider) {
+func (a *Agent) RegisterProvidersFromSystem(p Provider) error {
+	if err := p.GetConfig().Validate(); err != nil {
+		return fmt.Errorf("provider %q: %w", p.Name(), err)
+	}
 	a.systemProviders[p.Name()] = p
+	return nil
 }
 
 // SetDefault selects which provider to use if none is specified per-call.
@@ -242,45 +534,134 @@ func (a *Agent) ListProviders() []string {
 	return list
 }
 
+// provider looks up a registered provider, preferring user providers.
+func (a *Agent) provider(name string) (Provider, bool) {
+	if p, ok := a.userProviders[name]; ok {
+		return p, true
+	}
+	p, ok := a.systemProviders[name]
+	return p, ok
+}
+
 // RegisterFallbackProviders sets the fallback provider names (in order).
 func (a *Agent) RegisterFallbackProviders(names []string) {
 	a.FallbackProviders = names
 }
 
 // Complete does a completion using either the named provider or the default.
+// providerName and req.Model may also name an alias (see RegisterAlias).
 // If the request is non-streaming, it checks an internal cache.
 func (a *Agent) Complete(ctx context.Context, providerName string, req CompletionRequest) (<-chan CompletionResponse, error) {
-	// If non-streaming, try cache first.
-	if !req.StreamValue() {
-		key, err := getCacheKey(req)
-		if err == nil {
-			a.cacheLock.RLock()
-			if entry, ok := a.cache[key]; ok {
-				// Check if the cached entry is still valid.
-				if entry.expiresAt.After(time.Now()) {
-					a.cacheLock.RUnlock()
-					out := make(chan CompletionResponse, 1)
-					out <- CompletionResponse{Content: entry.content}
-					close(out)
-					return out, nil
-				}
-			}
-			a.cacheLock.RUnlock()
+	if err := validateMessages(req.Messages); err != nil {
+		return nil, err
+	}
+	if err := a.Taxonomy.Validate(req.Tags); err != nil {
+		return nil, err
+	}
+	ctx = withTags(ctx, req.Tags)
+	if a.Sanitize != nil {
+		var err error
+		if req, err = sanitize(req, *a.Sanitize); err != nil {
+			return nil, err
 		}
 	}
+	if a.Policy != nil {
+		var err error
+		if req, err = a.Policy.checkInput(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	docs, msgs := req.Documents, req.Messages
+	req = a.renderDocuments(req)
+	ch, err := a.complete(ctx, providerName, req)
+	if err != nil {
+		if degraded, ok := a.degrade(ctx, req, err); ok {
+			return degraded, nil
+		}
+		return nil, err
+	}
+	ch = a.shadow(ctx, req, ch)
+	if a.Policy != nil {
+		ch = a.Policy.checkOutput(ctx, ch)
+	}
+	ch = transform(ctx, ch, a.Transformers...)
+	if len(docs) > 0 {
+		ch = withCitations(ctx, ch, docs)
+	}
+	if req.SuggestQuestions > 0 {
+		ch = a.withSuggestions(ctx, msgs, req.SuggestQuestions, ch)
+	}
+	if a.Aggregation != nil {
+		ch = aggregate(ctx, ch, *a.Aggregation, a.clock())
+	}
+	return indexed(ctx, ch), nil
+}
+
+// indexed numbers the events of ch in the order the caller receives them.
+func indexed(ctx context.Context, ch <-chan CompletionResponse) <-chan CompletionResponse {
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		i := 0
+		for resp := range ch {
+			resp.Index = i
+			if !emit(resp) {
+				return
+			}
+			i++
+		}
+	})
+}
+
+// complete resolves the provider, consults the cache and runs the request
+// through retries and fallbacks.
+func (a *Agent) complete(ctx context.Context, providerName string, req CompletionRequest) (<-chan CompletionResponse, error) {
+	providerName, req = a.resolveAlias(providerName, req)
 	name := providerName
 	if name == "" {
-		name = a.DefaultProvider
+		// the default provider may itself be an alias
+		name, req = a.resolveAlias(a.DefaultProvider, req)
 	}
-	var p Provider
-	var ok bool
-	if p, ok = a.userProviders[name]; !ok {
-		if p, ok = a.systemProviders[name]; !ok {
-			return nil, fmt.Errorf("provider %q not registered", name)
+	p, ok := a.provider(name)
+	if !ok {
+		return nil, fmt.Errorf("provider %q not registered", name)
+	}
+	// Region constraints filter the route before anything is looked up or
+	// sent.
+	routed, fallbacks, err := a.residency(ctx, name, a.FallbackProviders)
+	if err != nil {
+		return nil, err
+	}
+	if routed != name {
+		name = routed
+		p, _ = a.provider(name)
+	}
+	// If non-streaming, try cache first. Keys are derived from the request
+	// as the caller sent it, before any defaults are filled in below, so a
+	// response served by a fallback is stored where this lookup finds it.
+	keyReq := req
+	var key string
+	if !req.StreamValue() {
+		var kerr error
+		if key, kerr = a.cacheKey(p, req); kerr != nil {
+			key = ""
+		} else if entry, ok := a.cacheGet(key); ok {
+			if entry.err != nil {
+				return nil, entry.err
+			}
+			// an entry that no longer decrypts (e.g. after a key
+			// change) is treated as a miss
+			var oerr error
+			if entry.content, oerr = a.open(entry.content); oerr == nil {
+				return cachedResponse(entry, ResolveRequest(p.GetConfig(), req).Model), nil
+			}
 		}
 	}
+	// Providers demoted for breaching an SLO go behind healthy fallbacks.
+	if routed, rest := a.route(name, fallbacks); routed != name {
+		name, fallbacks = routed, rest
+		p, _ = a.provider(name)
+	}
 	cfg := p.GetConfig()
-	if cfg.DefaultModel == "" && req.Model == "" {
+	if cfg.DefaultModel == "" && requestFor(ctx, p, req).Model == "" {
 		return nil, errors.New("no model specified")
 	}
 	if cfg.DefaultMaxTokens == 0 {
@@ -289,105 +670,104 @@ func (a *Agent) Complete(ctx context.Context, providerName string, req Completio
 		}
 	}
 
+	run := &requestRun{budget: newBudgetTracker(ctx, a.RetryBudget, a.Clock), agg: &AggregateError{}}
 	tryProvider := func(current Provider) (<-chan CompletionResponse, error) {
-		// Ensure metrics for current provider exists.
-		a.metricsLock.Lock()
-		if _, ok := a.metrics[current.Name()]; !ok {
-			a.metrics[current.Name()] = &ProviderMetrics{}
-		}
-		a.metricsLock.Unlock()
-
-		attempts := 1
-		if current.GetConfig().RetryCount > 0 {
-			attempts = current.GetConfig().RetryCount + 1
-		}
-		var respChan <-chan CompletionResponse
-		var err error
-		for i := 0; i < attempts; i++ {
-			start := time.Now()
-			respChan, err = current.Complete(ctx, req)
-			latency := time.Since(start)
-
-			a.metricsLock.Lock()
-			m := a.metrics[current.Name()]
-			m.TotalLatency += latency
-			if err == nil {
-				m.SuccessCount++
-				a.metricsLock.Unlock()
-				if current.GetConfig().Logger != nil {
-					current.GetConfig().Logger.Printf("Provider %q succeeded on attempt %d", current.Name(), i+1)
-				}
-				return respChan, nil
-			}
-			m.FailureCount++
-			a.metricsLock.Unlock()
+		return a.tryProvider(ctx, current, requestFor(ctx, current, req), run)
+	}
 
-			if current.GetConfig().Logger != nil {
-				current.GetConfig().Logger.Printf("Provider %q attempt %d failed: %v", current.Name(), i+1, err)
-			}
-			time.Sleep(100 * time.Millisecond)
+	served := p
+	var respChan <-chan CompletionResponse
+	if hp, ok := a.hedgeTarget(ctx, p); ok {
+		var winner Provider
+		if respChan, winner, err = a.hedge(ctx, p, hp, req, run); err == nil {
+			served = winner
 		}
-		return nil, err
+	} else if respChan, err = tryProvider(p); err != nil {
+		a.cacheNegative(ctx, p, keyReq, err)
 	}
-
-	respChan, err := tryProvider(p)
 	// If chosen provider fails, try fallback providers.
-	if err != nil && len(a.FallbackProviders) > 0 {
+	if err != nil && !errors.Is(err, ErrRetryBudgetExhausted) && ctx.Err() == nil && len(fallbacks) > 0 {
 		errMsg := fmt.Sprintf("Primary provider %q failed: %v", name, err)
 		if cfg.Logger != nil {
 			cfg.Logger.Println(errMsg)
 		}
-		for _, fbName := range a.FallbackProviders {
+		for _, fbName := range fallbacks {
 			if fbName == name {
 				continue
 			}
-			var fb Provider
-			if fb, ok = a.userProviders[fbName]; !ok {
-				if fb, ok = a.systemProviders[fbName]; !ok {
-					continue
-				}
+			fb, ok := a.provider(fbName)
+			if !ok {
+				continue
 			}
 			fbCfg := fb.GetConfig()
-			if fbCfg.DefaultModel == "" && req.Model == "" {
+			if fbCfg.DefaultModel == "" && requestFor(ctx, fb, req).Model == "" {
 				continue
 			}
 			if fbCfg.DefaultMaxTokens == 0 && req.MaxTokens == 0 {
 				req.MaxTokens = 200
 			}
 			if respChan, err = tryProvider(fb); err == nil {
+				served = fb
 				goto CACHE_STORE
 			}
+			a.cacheNegative(ctx, fb, keyReq, err)
 			errMsg = fmt.Sprintf("Fallback provider %q failed: %v", fb.Name(), err)
 			if fbCfg.Logger != nil {
 				fbCfg.Logger.Println(errMsg)
 			}
+			if errors.Is(err, ErrRetryBudgetExhausted) || ctx.Err() != nil {
+				break
+			}
 		}
-		return nil, fmt.Errorf("all providers failed; last error: %v", err)
+	}
+	if err != nil {
+		if agg := run.aggregate(); agg != nil {
+			return nil, agg
+		}
+		return nil, err
 	}
 
 CACHE_STORE:
-	// If the request is non-streaming, capture and cache the response.
+	// If the request is non-streaming, capture and cache the response under
+	// the lookup key, whichever provider actually served it.
 	if !req.StreamValue() {
-		// Read single response from respChan (non-streaming returns one response).
+		// Read the single response from respChan (non-streaming returns one
+		// response), keeping the trailing events such as the Done summary.
 		resp, ok := <-respChan
-		if ok && resp.Err == nil {
-			if key, err := getCacheKey(req); err == nil {
-				a.cacheLock.Lock()
-				a.cache[key] = cacheEntry{
-					content:   resp.Content,
-					expiresAt: time.Now().Add(a.CacheTTL),
-				}
-				a.cacheLock.Unlock()
+		resp.Provider = served.Name()
+		var trailing []CompletionResponse
+		for ev := range respChan {
+			trailing = append(trailing, ev)
+		}
+		entry := cacheEntry{provider: resp.Provider, content: resp.Content, user: UserFromContext(ctx)}
+		for _, ev := range trailing {
+			if ev.Done {
+				entry.finish = ev.FinishReason
 			}
-			// Return a channel with the captured response.
-			out := make(chan CompletionResponse, 1)
-			out <- resp
-			close(out)
-			return out, nil
-		}
-		// If error, return as is.
-		out := make(chan CompletionResponse, 1)
+		}
+		switch {
+		case !ok || resp.Done:
+			// Nothing was produced; don't cache the absence of a response.
+		case len(resp.ToolCalls) > 0:
+			// Tool calls drive side effects; always ask the model again.
+		case resp.Err == nil:
+			entry.expiresAt = a.clock().Now().Add(a.CacheTTL)
+		default:
+			a.cacheNegative(ctx, served, keyReq, resp.Err)
+		}
+		if !entry.expiresAt.IsZero() && key != "" {
+			var err error
+			if entry.content, err = a.seal(entry.content); err == nil {
+				entry.key = key
+				a.cacheSet(entry, promptTokens(req))
+			}
+		}
+		// Return a channel with the captured response.
+		out := make(chan CompletionResponse, 1+len(trailing))
 		out <- resp
+		for _, ev := range trailing {
+			out <- ev
+		}
 		close(out)
 		return out, nil
 	}
@@ -395,6 +775,104 @@ CACHE_STORE:
 	return respChan, nil
 }
 
+// tryProvider runs req against current, retrying up to its RetryCount
+// within the request's budget. Failed attempts are recorded on run.
+func (a *Agent) tryProvider(ctx context.Context, current Provider, req CompletionRequest, run *requestRun) (<-chan CompletionResponse, error) {
+	// Ensure metrics for current provider exists.
+	a.metricsLock.Lock()
+	if _, ok := a.metrics[current.Name()]; !ok {
+		a.metrics[current.Name()] = &ProviderMetrics{}
+	}
+	a.metricsLock.Unlock()
+
+	attempts := 1
+	if current.GetConfig().RetryCount > 0 {
+		attempts = current.GetConfig().RetryCount + 1
+	}
+	var respChan <-chan CompletionResponse
+	var err error
+	delay := defaultRetryDelay
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if werr := run.budget.wait(ctx, delay); werr != nil {
+				return nil, werr
+			}
+		}
+		if !run.take() {
+			return nil, ErrRetryBudgetExhausted
+		}
+		if werr := a.rateWait(ctx, current); werr != nil {
+			return nil, werr
+		}
+		release, lerr := a.limiters.acquire(ctx, current)
+		if lerr != nil {
+			return nil, lerr
+		}
+		start := a.clock().Now()
+		respChan, err = current.Complete(ctx, req)
+		if err == nil {
+			// Upstream HTTP failures surface as the first stream event.
+			respChan, err = firstResponse(ctx, respChan)
+		}
+		if err != nil {
+			release()
+		} else {
+			respChan = releaseOnClose(ctx, respChan, release)
+		}
+		latency := a.clock().Now().Sub(start)
+
+		a.metricsLock.Lock()
+		m := a.metrics[current.Name()]
+		m.TotalLatency += latency
+		if err == nil {
+			m.SuccessCount++
+			a.metricsLock.Unlock()
+			a.pushMetrics(current.Name(), ProviderMetrics{SuccessCount: 1, TotalLatency: latency})
+			if current.GetConfig().Logger != nil {
+				current.GetConfig().Logger.Printf("Provider %q succeeded on attempt %d", current.Name(), i+1)
+			}
+			return a.instrument(ctx, current, req, start, respChan), nil
+		}
+		failure := ProviderMetrics{FailureCount: 1}
+		if isRateLimited(err) {
+			// The quota headers of a 429 are the freshest view of it.
+			failure.RateLimited = 1
+			if meta := ParseResponseMeta(ErrorHeader(err), a.clock().Now()); meta != nil {
+				failure.RateLimit = meta.RateLimit
+				failure.LastRequestID = meta.RequestID
+			}
+		}
+		m.add(failure)
+		a.metricsLock.Unlock()
+		failure.TotalLatency = latency
+		a.pushMetrics(current.Name(), failure)
+		if !shadowed(ctx) {
+			a.recordSLO(current.Name(), sloSample{duration: latency, failed: true, model: ResolveRequest(current.GetConfig(), req).Model, tags: req.Tags})
+		}
+
+		run.record(Attempt{
+			Provider:   current.Name(),
+			Attempt:    i + 1,
+			Err:        err,
+			StatusCode: StatusCode(err),
+			Duration:   latency,
+		})
+		if current.GetConfig().Logger != nil {
+			current.GetConfig().Logger.Printf("Provider %q attempt %d failed: %v", current.Name(), i+1, err)
+		}
+		// Deterministic failures (bad request, size guards) recur on retry.
+		if IsDeterministicError(err) {
+			break
+		}
+		// Honor Retry-After, unless it outlasts what we are willing to wait.
+		var ok bool
+		if delay, ok = retryDelay(current, err, a.clock().Now()); !ok || !run.budget.fits(delay) {
+			break
+		}
+	}
+	return nil, err
+}
+
 // CommonResponse defines a unified response structure for completions.
 type CommonResponse struct {
 	Content string
@@ -408,17 +886,24 @@ func (a *Agent) StreamCommonResponse(ctx context.Context, providerName string, r
 		return nil, err
 	}
 	commonCh := make(chan CommonResponse)
-	go func() {
+	spawn(ctx, func() {
 		defer close(commonCh)
 		for resp := range ch {
-			commonCh <- CommonResponse{Content: resp.Content, Err: resp.Err}
+			select {
+			case commonCh <- CommonResponse{Content: resp.Content, Err: resp.Err}:
+			case <-ctx.Done():
+				for range ch {
+				}
+				return
+			}
 		}
-	}()
+	})
 	return commonCh, nil
 }
 
 // CompleteCommonResponse wraps Agent.Complete for non-streaming responses,
-// reading the single completion and returning it as a CommonResponse.
+// draining the completion (including its trailing Done event) and returning
+// it as a CommonResponse.
 func (a *Agent) CompleteCommonResponse(ctx context.Context, providerName string, req CompletionRequest) (CommonResponse, error) {
 	ch, err := a.Complete(ctx, providerName, req)
 	if err != nil {
@@ -428,5 +913,44 @@ func (a *Agent) CompleteCommonResponse(ctx context.Context, providerName string,
 	if !ok {
 		return CommonResponse{}, errors.New("empty response")
 	}
-	return CommonResponse{Content: resp.Content, Err: resp.Err}, nil
+	// The pipeline stages are unbuffered: leaving the Done event unread would
+	// block their goroutines forever.
+	rest, restErr := Collect(ch)
+	if resp.Err == nil {
+		resp.Err = restErr
+	}
+	return CommonResponse{Content: resp.Content + rest.Content, Err: resp.Err}, nil
+}
+
+// Collect drains a completion stream into a single response: the content of
+// every event concatenated, all tool calls, with the metadata (usage, stats, citations,
+// finish reason) of the terminal event. The first stream error is returned.
+func Collect(ch <-chan CompletionResponse) (CompletionResponse, error) {
+	var out CompletionResponse
+	var text strings.Builder
+	for resp := range ch {
+		if resp.Err != nil && out.Err == nil {
+			out.Err = resp.Err
+		}
+		text.WriteString(resp.Content)
+		if resp.Provider != "" {
+			out.Provider = resp.Provider
+		}
+		if resp.Usage != nil {
+			out.Usage = resp.Usage
+		}
+		out.ToolCalls = append(out.ToolCalls, resp.ToolCalls...)
+		if len(resp.SuggestedQuestions) > 0 {
+			out.SuggestedQuestions = resp.SuggestedQuestions
+		}
+		if resp.Done {
+			out.Done = true
+			out.Cached = resp.Cached
+			out.Stats = resp.Stats
+			out.FinishReason = resp.FinishReason
+			out.Citations = resp.Citations
+		}
+	}
+	out.Content = text.String()
+	return out, out.Err
 }
@@ -0,0 +1,177 @@
+// Package mail answers email threads through agent sessions, e.g. to
+// automate a support inbox. A Mailbox (an IMAP poller or a webhook queue
+// in front, SMTP behind) delivers and sends Emails; Responder keeps one
+// session per thread, attaches the thread's attachments to it as
+// documents, and signs every reply from a template.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Email is one message of a thread.
+type Email struct {
+	ID          string   // Message-ID; Mailbox.Send assigns it to replies
+	InReplyTo   string   // Message-ID of the parent
+	References  []string // Message-IDs of the thread, oldest first
+	From, To    string
+	Subject     string
+	Body        string // plain text
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to an Email.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// thread returns the Message-ID of the first message of e's thread.
+func (e Email) thread() string {
+	switch {
+	case len(e.References) > 0:
+		return e.References[0]
+	case e.InReplyTo != "":
+		return e.InReplyTo
+	}
+	return e.ID
+}
+
+// Mailbox receives and sends mail.
+type Mailbox interface {
+	// Fetch returns the messages that arrived since the last call.
+	Fetch(ctx context.Context) ([]Email, error)
+	Send(ctx context.Context, e Email) error
+}
+
+// Responder answers every Email through Agent, one session per thread.
+type Responder struct {
+	Agent   *llmagent.Agent
+	Mailbox Mailbox
+	Address string // From of the replies
+	// System is the system prompt of new threads.
+	System string
+	// Signature, if set, is executed with the incoming Email and appended
+	// to every reply after a blank line.
+	Signature *template.Template
+	// Extract turns an attachment into a document the thread's turns are
+	// answered with; false skips it. Defaults to TextAttachment.
+	Extract func(Attachment) (llmagent.Document, bool)
+
+	mu      sync.Mutex
+	threads map[string]*llmagent.Session
+}
+
+// TextAttachment keeps text/* attachments as documents and skips the rest.
+func TextAttachment(a Attachment) (llmagent.Document, bool) {
+	if !strings.HasPrefix(a.ContentType, "text/") {
+		return llmagent.Document{}, false
+	}
+	return llmagent.Document{ID: a.Name, Title: a.Name, Content: string(a.Data)}, true
+}
+
+// Poll fetches and answers mail every interval, on the agent's Clock,
+// until ctx is done. A failed fetch or reply is passed to onError, if set,
+// and doesn't stop polling.
+func (r *Responder) Poll(ctx context.Context, interval time.Duration, onError func(error)) {
+	clock := r.Agent.Clock
+	if clock == nil {
+		clock = llmagent.SystemClock
+	}
+	t := clock.NewTicker(interval)
+	defer t.Stop()
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+		}
+		mails, err := r.Mailbox.Fetch(ctx)
+		report(err)
+		for _, e := range mails {
+			report(r.Handle(ctx, e))
+		}
+	}
+}
+
+// Handle answers e in its thread and sends the reply. Messages of one
+// thread must not be handled concurrently.
+func (r *Responder) Handle(ctx context.Context, e Email) error {
+	s := r.session(e.thread())
+	extract := r.Extract
+	if extract == nil {
+		extract = TextAttachment
+	}
+	for _, a := range e.Attachments {
+		if doc, ok := extract(a); ok {
+			s.Template.Documents = append(s.Template.Documents, doc)
+		}
+	}
+	ch, err := s.Send(ctx, llmagent.User(e.Body))
+	if err != nil {
+		return fmt.Errorf("answer %s: %w", e.ID, err)
+	}
+	resp, err := llmagent.Collect(ch)
+	if err != nil {
+		return fmt.Errorf("answer %s: %w", e.ID, err)
+	}
+	body := resp.Content
+	if r.Signature != nil {
+		var sig bytes.Buffer
+		if err := r.Signature.Execute(&sig, e); err != nil {
+			return fmt.Errorf("sign reply to %s: %w", e.ID, err)
+		}
+		body += "\n\n" + sig.String()
+	}
+	subject := e.Subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	refs := e.References
+	if len(refs) == 0 && e.InReplyTo != "" {
+		refs = []string{e.InReplyTo}
+	}
+	return r.Mailbox.Send(ctx, Email{
+		InReplyTo:  e.ID,
+		References: append(append([]string(nil), refs...), e.ID),
+		From:       r.Address,
+		To:         e.From,
+		Subject:    subject,
+		Body:       body,
+	})
+}
+
+// session returns the session of thread, starting it on first use.
+func (r *Responder) session(thread string) *llmagent.Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.threads[thread]; ok {
+		return s
+	}
+	if r.threads == nil {
+		r.threads = map[string]*llmagent.Session{}
+	}
+	var s *llmagent.Session
+	if r.System != "" {
+		s = r.Agent.NewSession(llmagent.System(r.System))
+	} else {
+		s = r.Agent.NewSession()
+	}
+	s.Template.Stream = llmagent.Bool(false)
+	r.threads[thread] = s
+	return s
+}
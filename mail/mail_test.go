@@ -0,0 +1,172 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// fakeProvider answers with the number of user messages in the
+// conversation and the titles of the documents it was given.
+type fakeProvider struct{ cfg llmagent.ProviderConfig }
+
+func (p *fakeProvider) Name() string                        { return "p" }
+func (p *fakeProvider) GetConfig() *llmagent.ProviderConfig { return &p.cfg }
+
+func (p *fakeProvider) Complete(ctx context.Context, req llmagent.CompletionRequest) (<-chan llmagent.CompletionResponse, error) {
+	turn, docs := 0, []string{}
+	for _, m := range req.Messages {
+		switch m.Role {
+		case llmagent.RoleUser:
+			turn++
+		case llmagent.RoleSystem:
+			for _, line := range strings.Split(m.Content, "\n") {
+				// numbered document headers: "[n] title"
+				if _, title, ok := strings.Cut(line, "] "); ok && strings.HasPrefix(line, "[") {
+					docs = append(docs, title)
+				}
+			}
+		}
+	}
+	ch := make(chan llmagent.CompletionResponse, 2)
+	ch <- llmagent.CompletionResponse{Content: fmt.Sprintf("turn %d, docs %v", turn, docs)}
+	ch <- llmagent.CompletionResponse{Done: true, FinishReason: llmagent.FinishStop}
+	close(ch)
+	return ch, nil
+}
+
+// fakeMailbox delivers inbox on the next Fetch and records what is sent.
+type fakeMailbox struct {
+	mu    sync.Mutex
+	inbox []Email
+	sent  []Email
+}
+
+func (m *fakeMailbox) Fetch(ctx context.Context) ([]Email, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	in := m.inbox
+	m.inbox = nil
+	return in, nil
+}
+
+func (m *fakeMailbox) Send(ctx context.Context, e Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, e)
+	return nil
+}
+
+func (m *fakeMailbox) replies() []Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.sent)
+}
+
+func testResponder(t *testing.T) (*Responder, *fakeMailbox, *llmagent.FakeClock) {
+	t.Helper()
+	a := llmagent.NewAgent()
+	clock := llmagent.NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	a.Clock = clock
+	if err := a.RegisterProvidersFromUser(&fakeProvider{cfg: llmagent.ProviderConfig{DefaultModel: "m"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetDefault("p"); err != nil {
+		t.Fatal(err)
+	}
+	box := &fakeMailbox{}
+	return &Responder{Agent: a, Mailbox: box, Address: "support@example.com"}, box, clock
+}
+
+func TestThreads(t *testing.T) {
+	r, box, _ := testResponder(t)
+	r.Signature = template.Must(template.New("sig").Parse("-- \nWe answered {{.From}}"))
+	manual := Attachment{Name: "manual.txt", ContentType: "text/plain", Data: []byte("press the button")}
+	photo := Attachment{Name: "photo.jpg", ContentType: "image/jpeg", Data: []byte{0xff, 0xd8}}
+
+	for _, tc := range []struct {
+		in   Email
+		want Email // the reply, without the signature
+	}{
+		{
+			in:   Email{ID: "a1", From: "ann@example.com", Subject: "Broken", Body: "help", Attachments: []Attachment{manual, photo}},
+			want: Email{InReplyTo: "a1", References: []string{"a1"}, To: "ann@example.com", Subject: "Re: Broken", Body: "turn 1, docs [manual.txt]"},
+		},
+		{
+			in:   Email{ID: "b1", From: "bob@example.com", Subject: "Question", Body: "hi"},
+			want: Email{InReplyTo: "b1", References: []string{"b1"}, To: "bob@example.com", Subject: "Re: Question", Body: "turn 1, docs []"},
+		},
+		{
+			in:   Email{ID: "a3", InReplyTo: "a2", References: []string{"a1", "a2"}, From: "ann@example.com", Subject: "RE: Broken", Body: "still broken"},
+			want: Email{InReplyTo: "a3", References: []string{"a1", "a2", "a3"}, To: "ann@example.com", Subject: "RE: Broken", Body: "turn 2, docs [manual.txt]"},
+		},
+		{
+			// a client that only sets In-Reply-To, to the thread's first message
+			in:   Email{ID: "b3", InReplyTo: "b1", From: "bob@example.com", Subject: "Re: Question", Body: "and?"},
+			want: Email{InReplyTo: "b3", References: []string{"b1", "b3"}, To: "bob@example.com", Subject: "Re: Question", Body: "turn 2, docs []"},
+		},
+	} {
+		if err := r.Handle(context.Background(), tc.in); err != nil {
+			t.Fatalf("%s: %v", tc.in.ID, err)
+		}
+		sent := box.replies()
+		got := sent[len(sent)-1]
+		body, sig, ok := strings.Cut(got.Body, "\n\n")
+		if !ok || sig != "-- \nWe answered "+tc.in.From {
+			t.Errorf("%s: reply not signed: %q", tc.in.ID, got.Body)
+		}
+		got.Body = body
+		tc.want.From = "support@example.com"
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: reply\n%+v\nwant\n%+v", tc.in.ID, got, tc.want)
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	r, box, clock := testResponder(t)
+	r.Extract = func(a Attachment) (llmagent.Document, bool) {
+		return llmagent.Document{ID: a.Name, Title: strings.ToUpper(a.Name), Content: "extracted"}, true
+	}
+	r.Signature = template.Must(template.New("sig").Parse("{{.Nope}}"))
+	errs := make(chan error, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Poll(ctx, time.Minute, func(err error) { errs <- err })
+	for clock.Tickers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	box.mu.Lock()
+	box.inbox = []Email{{ID: "x", Body: "hi", Attachments: []Attachment{{Name: "scan.pdf", ContentType: "application/pdf"}}}}
+	box.mu.Unlock()
+	clock.Advance(time.Minute)
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "sign reply to x") {
+		t.Fatalf("err = %v, want the signature failure", err)
+	}
+
+	r.Signature = nil
+	box.mu.Lock()
+	box.inbox = []Email{{ID: "y", InReplyTo: "x", Body: "again"}}
+	box.mu.Unlock()
+	clock.Advance(time.Minute)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(box.replies()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	default:
+	}
+	if sent := box.replies(); len(sent) != 1 || sent[0].Body != "turn 2, docs [SCAN.PDF]" {
+		t.Fatalf("sent %+v", sent)
+	}
+}
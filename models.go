@@ -0,0 +1,57 @@
+package llmagent
+
+import (
+	"strings"
+	"sync"
+)
+
+// ModelInfo describes a model's context window and pricing. Prices are in
+// USD per 1K tokens.
+type ModelInfo struct {
+	ContextWindow int
+	InputPer1K    float64
+	OutputPer1K   float64
+}
+
+// Cost prices usage against the model's rates.
+func (m ModelInfo) Cost(u Usage) float64 {
+	return float64(u.PromptTokens)/1000*m.InputPer1K + float64(u.CompletionTokens)/1000*m.OutputPer1K
+}
+
+var (
+	modelsMu sync.RWMutex
+	models   = map[string]ModelInfo{
+		"gpt-3.5-turbo":            {ContextWindow: 16385, InputPer1K: 0.0005, OutputPer1K: 0.0015},
+		"gpt-4":                    {ContextWindow: 8192, InputPer1K: 0.03, OutputPer1K: 0.06},
+		"deepseek-chat":            {ContextWindow: 65536, InputPer1K: 0.00027, OutputPer1K: 0.0011},
+		"claude-3-opus-20240229":   {ContextWindow: 200000, InputPer1K: 0.015, OutputPer1K: 0.075},
+		"claude-3-sonnet-20240229": {ContextWindow: 200000, InputPer1K: 0.003, OutputPer1K: 0.015},
+	}
+)
+
+// RegisterModel adds or replaces the catalog entry for model.
+func RegisterModel(model string, info ModelInfo) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models[model] = info
+}
+
+// LookupModel returns the catalog entry for model. Dated snapshots such as
+// "gpt-4-0613" fall back to the longest registered prefix.
+func LookupModel(model string) (ModelInfo, bool) {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	if info, ok := models[model]; ok {
+		return info, true
+	}
+	var best string
+	for name := range models {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelInfo{}, false
+	}
+	return models[best], true
+}
@@ -0,0 +1,614 @@
+// Package openapi turns an OpenAPI 3 document into llmagent tools: one tool
+// per operation, its parameters and JSON request body folded into a single
+// argument schema, and a handler that performs the HTTP call with the
+// document's security schemes.
+//
+// Only JSON documents are read; convert YAML specs first.
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Spec is the part of an OpenAPI 3 document needed to build tools.
+type Spec struct {
+	OpenAPI    string                `json:"openapi"`
+	Servers    []Server              `json:"servers"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Security   []map[string][]string `json:"security"`
+	Components struct {
+		Schemas         map[string]json.RawMessage `json:"schemas"`
+		Parameters      map[string]Parameter       `json:"parameters"`
+		RequestBodies   map[string]RequestBody     `json:"requestBodies"`
+		SecuritySchemes map[string]SecurityScheme  `json:"securitySchemes"`
+	} `json:"components"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem holds the operations of one path, keyed by lower-case method.
+type PathItem struct {
+	Parameters []Parameter
+	Operations map[string]*Operation
+}
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+func (p *PathItem) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if params, ok := raw["parameters"]; ok {
+		if err := json.Unmarshal(params, &p.Parameters); err != nil {
+			return err
+		}
+	}
+	p.Operations = map[string]*Operation{}
+	for _, m := range methods {
+		if body, ok := raw[m]; ok {
+			var op Operation
+			if err := json.Unmarshal(body, &op); err != nil {
+				return fmt.Errorf("%s: %w", m, err)
+			}
+			p.Operations[m] = &op
+		}
+	}
+	return nil
+}
+
+type Operation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description"`
+	Parameters  []Parameter            `json:"parameters"`
+	RequestBody *RequestBody           `json:"requestBody"`
+	Security    *[]map[string][]string `json:"security"` // nil inherits Spec.Security
+	Deprecated  bool                   `json:"deprecated"`
+}
+
+type Parameter struct {
+	Ref         string          `json:"$ref"`
+	Name        string          `json:"name"`
+	In          string          `json:"in"` // path, query, header or cookie
+	Description string          `json:"description"`
+	Required    bool            `json:"required"`
+	Schema      json.RawMessage `json:"schema"`
+}
+
+type RequestBody struct {
+	Ref         string `json:"$ref"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Content     map[string]struct {
+		Schema json.RawMessage `json:"schema"`
+	} `json:"content"`
+}
+
+// SecurityScheme is a components.securitySchemes entry.
+type SecurityScheme struct {
+	Type   string `json:"type"`   // apiKey, http, oauth2 or openIdConnect
+	Scheme string `json:"scheme"` // http: bearer or basic
+	Name   string `json:"name"`   // apiKey: header, query or cookie name
+	In     string `json:"in"`     // apiKey: header, query or cookie
+}
+
+// Credential authenticates one security scheme. Token serves apiKey,
+// bearer, oauth2 and openIdConnect schemes; Username and Password serve
+// basic auth.
+type Credential struct {
+	Token    string
+	Username string
+	Password string
+}
+
+// Options configures Tools.
+type Options struct {
+	// BaseURL overrides the spec's first server URL.
+	BaseURL string
+	// Auth holds credentials by security scheme name.
+	Auth map[string]Credential
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// Include selects operations; nil includes all but deprecated ones.
+	Include func(method, path string, op *Operation) bool
+	// MaxResponseBytes caps the response body returned to the model;
+	// defaults to 64 KiB.
+	MaxResponseBytes int64
+	// Header is added to every request.
+	Header http.Header
+}
+
+// StatusError is returned by tool handlers for error responses; the body is
+// kept so the model can see what went wrong.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *StatusError) HTTPStatusCode() int { return e.StatusCode }
+
+// Parse reads a JSON OpenAPI 3 document.
+func Parse(data []byte) (*Spec, error) {
+	var s Spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(s.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", s.OpenAPI)
+	}
+	return &s, nil
+}
+
+// Load parses data and converts it with opts.
+func Load(data []byte, opts Options) ([]llmagent.ToolFunc, error) {
+	s, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.Tools(opts)
+}
+
+// Tools builds one tool per operation, sorted by name. Arguments are an
+// object with one property per parameter plus "body" for a JSON request
+// body.
+func (s *Spec) Tools(opts Options) ([]llmagent.ToolFunc, error) {
+	base := opts.BaseURL
+	if base == "" && len(s.Servers) > 0 {
+		base = s.Servers[0].URL
+	}
+	if base == "" {
+		return nil, fmt.Errorf("spec has no servers; set Options.BaseURL")
+	}
+	if opts.MaxResponseBytes <= 0 {
+		opts.MaxResponseBytes = 64 << 10
+	}
+	var tools []llmagent.ToolFunc
+	seen := map[string]bool{}
+	for path, item := range s.Paths {
+		for _, m := range methods {
+			op := item.Operations[m]
+			if op == nil {
+				continue
+			}
+			if opts.Include != nil && !opts.Include(m, path, op) || opts.Include == nil && op.Deprecated {
+				continue
+			}
+			t, err := s.tool(base, m, path, item.Parameters, op, opts)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(m), path, err)
+			}
+			if seen[t.Name] {
+				return nil, fmt.Errorf("%s %s: duplicate tool name %q", strings.ToUpper(m), path, t.Name)
+			}
+			seen[t.Name] = true
+			tools = append(tools, t)
+		}
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools, nil
+}
+
+func (s *Spec) tool(base, method, path string, shared []Parameter, op *Operation, opts Options) (llmagent.ToolFunc, error) {
+	params, err := s.parameters(shared, op.Parameters)
+	if err != nil {
+		return llmagent.ToolFunc{}, err
+	}
+	props := map[string]any{}
+	var required []string
+	for _, p := range params {
+		schema, err := s.schema(p.Schema)
+		if err != nil {
+			return llmagent.ToolFunc{}, fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		if schema == nil {
+			schema = map[string]any{"type": "string"}
+		}
+		if p.Description != "" {
+			schema["description"] = p.Description
+		}
+		props[p.Name] = schema
+		if p.Required || p.In == "path" {
+			required = append(required, p.Name)
+		}
+	}
+	body, err := s.body(op.RequestBody)
+	if err != nil {
+		return llmagent.ToolFunc{}, err
+	}
+	if body != nil {
+		if _, clash := props["body"]; clash {
+			return llmagent.ToolFunc{}, fmt.Errorf(`parameter named "body" clashes with the request body`)
+		}
+		schema, err := s.schema(body.Content["application/json"].Schema)
+		if err != nil {
+			return llmagent.ToolFunc{}, fmt.Errorf("request body: %w", err)
+		}
+		if schema == nil {
+			schema = map[string]any{}
+		}
+		if body.Description != "" {
+			schema["description"] = body.Description
+		}
+		props["body"] = schema
+		if body.Required {
+			required = append(required, "body")
+		}
+	}
+	root := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		root["required"] = required
+	}
+	raw, err := json.Marshal(root)
+	if err != nil {
+		return llmagent.ToolFunc{}, err
+	}
+
+	security := s.Security
+	if op.Security != nil {
+		security = *op.Security
+	}
+	auth, err := s.authenticator(security, opts.Auth)
+	if err != nil {
+		return llmagent.ToolFunc{}, err
+	}
+	c := &caller{
+		base:   strings.TrimRight(base, "/"),
+		method: strings.ToUpper(method),
+		path:   path,
+		params: params,
+		body:   body != nil,
+		auth:   auth,
+		client: opts.Client,
+		header: opts.Header,
+		max:    opts.MaxResponseBytes,
+	}
+	return llmagent.ToolFunc{
+		ToolDefinition: llmagent.ToolDefinition{
+			Name:        toolName(method, path, op.OperationID),
+			Description: description(op),
+			Parameters:  raw,
+		},
+		Handler: c.call,
+	}, nil
+}
+
+// parameters merges path-level and operation parameters, resolving
+// references; operation parameters override by name and location.
+func (s *Spec) parameters(shared, own []Parameter) ([]Parameter, error) {
+	var out []Parameter
+	index := map[string]int{}
+	for _, list := range [][]Parameter{shared, own} {
+		for _, p := range list {
+			if p.Ref != "" {
+				name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/")
+				resolved, found := s.Components.Parameters[name]
+				if !ok || !found {
+					return nil, fmt.Errorf("unresolved parameter %s", p.Ref)
+				}
+				p = resolved
+			}
+			if p.In == "cookie" {
+				continue // not worth exposing to the model
+			}
+			key := p.In + ":" + p.Name
+			if i, ok := index[key]; ok {
+				out[i] = p
+				continue
+			}
+			index[key] = len(out)
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// body returns the request body when it accepts JSON.
+func (s *Spec) body(b *RequestBody) (*RequestBody, error) {
+	if b == nil {
+		return nil, nil
+	}
+	if b.Ref != "" {
+		name, ok := strings.CutPrefix(b.Ref, "#/components/requestBodies/")
+		resolved, found := s.Components.RequestBodies[name]
+		if !ok || !found {
+			return nil, fmt.Errorf("unresolved request body %s", b.Ref)
+		}
+		b = &resolved
+	}
+	if _, ok := b.Content["application/json"]; !ok {
+		if b.Required {
+			return nil, fmt.Errorf("request body has no application/json content")
+		}
+		return nil, nil
+	}
+	return b, nil
+}
+
+// schema decodes raw and inlines component references. Recursive schemas
+// are cut off with an open schema at the point they repeat.
+func (s *Spec) schema(raw json.RawMessage) (map[string]any, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var v map[string]any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	out, err := s.inline(v, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	m, _ := out.(map[string]any)
+	return m, nil
+}
+
+// openAPIOnly are schema keywords with no JSON Schema meaning.
+var openAPIOnly = []string{"example", "xml", "externalDocs", "discriminator", "nullable"}
+
+func (s *Spec) inline(v any, visiting map[string]bool) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+			raw, found := s.Components.Schemas[name]
+			if !ok || !found {
+				return nil, fmt.Errorf("unresolved schema %s", ref)
+			}
+			if visiting[name] {
+				return map[string]any{"type": "object"}, nil
+			}
+			var target any
+			if err := json.Unmarshal(raw, &target); err != nil {
+				return nil, fmt.Errorf("schema %s: %w", name, err)
+			}
+			visiting[name] = true
+			defer delete(visiting, name)
+			return s.inline(target, visiting)
+		}
+		if v["nullable"] == true {
+			if t, ok := v["type"].(string); ok {
+				v["type"] = []any{t, "null"}
+			}
+		}
+		for _, k := range openAPIOnly {
+			delete(v, k)
+		}
+		for k, child := range v {
+			resolved, err := s.inline(child, visiting)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = resolved
+		}
+		return v, nil
+	case []any:
+		for i, child := range v {
+			resolved, err := s.inline(child, visiting)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+	}
+	return v, nil
+}
+
+// authenticator picks the first security requirement whose schemes all
+// have credentials. An operation with requirements none of which can be
+// met is an error, unless one of them is empty (auth optional).
+func (s *Spec) authenticator(reqs []map[string][]string, creds map[string]Credential) (func(*http.Request), error) {
+	if len(reqs) == 0 {
+		return func(*http.Request) {}, nil
+	}
+	var missing []string
+	for _, req := range reqs {
+		var apply []func(*http.Request)
+		ok := true
+		for name := range req {
+			scheme, defined := s.Components.SecuritySchemes[name]
+			cred, have := creds[name]
+			if !defined || !have {
+				ok = false
+				missing = append(missing, name)
+				break
+			}
+			f, err := applyScheme(scheme, cred)
+			if err != nil {
+				return nil, fmt.Errorf("security scheme %s: %w", name, err)
+			}
+			apply = append(apply, f)
+		}
+		if ok {
+			return func(r *http.Request) {
+				for _, f := range apply {
+					f(r)
+				}
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("no credentials for security schemes %s", strings.Join(missing, ", "))
+}
+
+func applyScheme(s SecurityScheme, c Credential) (func(*http.Request), error) {
+	switch s.Type {
+	case "apiKey":
+		switch s.In {
+		case "header":
+			return func(r *http.Request) { r.Header.Set(s.Name, c.Token) }, nil
+		case "query":
+			return func(r *http.Request) {
+				q := r.URL.Query()
+				q.Set(s.Name, c.Token)
+				r.URL.RawQuery = q.Encode()
+			}, nil
+		case "cookie":
+			return func(r *http.Request) { r.AddCookie(&http.Cookie{Name: s.Name, Value: c.Token}) }, nil
+		}
+		return nil, fmt.Errorf("unknown apiKey location %q", s.In)
+	case "http":
+		switch strings.ToLower(s.Scheme) {
+		case "bearer":
+			return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+c.Token) }, nil
+		case "basic":
+			return func(r *http.Request) { r.SetBasicAuth(c.Username, c.Password) }, nil
+		}
+		return nil, fmt.Errorf("unsupported http scheme %q", s.Scheme)
+	case "oauth2", "openIdConnect":
+		// the caller obtains the token; flows are out of scope
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+c.Token) }, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", s.Type)
+}
+
+type caller struct {
+	base, method, path string
+	params             []Parameter
+	body               bool
+	auth               func(*http.Request)
+	client             *http.Client
+	header             http.Header
+	max                int64
+}
+
+func (c *caller) call(ctx context.Context, args json.RawMessage) (string, error) {
+	var in map[string]json.RawMessage
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", fmt.Errorf("arguments: %w", err)
+		}
+	}
+	path := c.path
+	query := url.Values{}
+	header := http.Header{}
+	for _, p := range c.params {
+		raw, ok := in[p.Name]
+		if !ok {
+			if p.In == "path" {
+				return "", fmt.Errorf("missing path parameter %q", p.Name)
+			}
+			continue
+		}
+		for _, v := range scalars(raw) {
+			switch p.In {
+			case "path":
+				path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(v))
+			case "query":
+				query.Add(p.Name, v)
+			case "header":
+				header.Add(p.Name, v)
+			}
+		}
+	}
+	var body io.Reader
+	if raw, ok := in["body"]; ok && c.body {
+		body = bytes.NewReader(raw)
+	}
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method, u, body)
+	if err != nil {
+		return "", err
+	}
+	for k, vs := range c.header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	c.auth(req)
+
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.max+1))
+	if err != nil {
+		return "", err
+	}
+	text := string(data)
+	if int64(len(data)) > c.max {
+		text = string(data[:c.max]) + "\n[response truncated]"
+	}
+	if resp.StatusCode >= 400 {
+		return "", &StatusError{StatusCode: resp.StatusCode, Body: text}
+	}
+	return text, nil
+}
+
+// scalars renders a JSON value as parameter strings; arrays become
+// repeated values (form style, explode=true, the OpenAPI default).
+func scalars(raw json.RawMessage) []string {
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		var out []string
+		for _, item := range list {
+			out = append(out, scalar(item))
+		}
+		return out
+	}
+	return []string{scalar(raw)}
+}
+
+func scalar(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(bytes.TrimSpace(raw))
+}
+
+var unsafeName = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// toolName uses the operation ID, or method and path, cut to the 64
+// characters providers accept.
+func toolName(method, path, id string) string {
+	name := id
+	if name == "" {
+		name = method + path
+	}
+	name = strings.Trim(unsafeName.ReplaceAllString(name, "_"), "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+func description(op *Operation) string {
+	switch {
+	case op.Summary != "" && op.Description != "" && op.Summary != op.Description:
+		return op.Summary + "\n\n" + op.Description
+	case op.Description != "":
+		return op.Description
+	}
+	return op.Summary
+}
@@ -0,0 +1,208 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/llmagent"
+)
+
+var allCreds = map[string]Credential{
+	"bearer":       {Token: "bearer-token"},
+	"basic":        {Username: "ann", Password: "secret"},
+	"apiKeyHeader": {Token: "header-key"},
+	"apiKeyQuery":  {Token: "query-key"},
+}
+
+func loadPetstore(t *testing.T, opts Options) map[string]llmagent.ToolFunc {
+	t.Helper()
+	data, err := os.ReadFile("testdata/petstore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools, err := Load(data, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]llmagent.ToolFunc{}
+	for _, tool := range tools {
+		byName[tool.Name] = tool
+	}
+	return byName
+}
+
+func TestToolSchemas(t *testing.T) {
+	tools := loadPetstore(t, Options{Auth: allCreds})
+	want := map[string]string{
+		"listPets": `{"type":"object","properties":{
+			"tag":{"type":"array","items":{"type":"string"},"description":"tags to filter by"},
+			"limit":{"type":"integer"}}}`,
+		"createPet": `{"type":"object","required":["body"],"properties":{
+			"body":{"type":"object","required":["name"],"properties":{
+				"name":{"type":["string","null"]},
+				"parent":{"type":"object"}}}}}`,
+		"get_pets_petId": `{"type":"object","required":["petId"],"properties":{
+			"petId":{"type":"integer"},
+			"X-Trace":{"type":"string"}}}`,
+	}
+	if len(tools) != len(want) {
+		t.Fatalf("got tools %v, want %d (deprecated ones left out)", reflect.ValueOf(tools).MapKeys(), len(want))
+	}
+	for name, schema := range want {
+		tool, ok := tools[name]
+		if !ok {
+			t.Errorf("no tool %s", name)
+			continue
+		}
+		var got, exp any
+		if err := json.Unmarshal(tool.Parameters, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(schema), &exp); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("%s schema = %s", name, tool.Parameters)
+		}
+	}
+	if d := tools["createPet"].Description; d != "Create a pet\n\nAdds a pet to the store." {
+		t.Errorf("createPet description = %q", d)
+	}
+}
+
+func TestToolsNeedCredentials(t *testing.T) {
+	data, err := os.ReadFile("testdata/petstore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load(data, Options{Auth: map[string]Credential{"bearer": {Token: "t"}}})
+	if err == nil || !strings.Contains(err.Error(), "no credentials") {
+		t.Fatalf("err = %v, want missing credentials", err)
+	}
+}
+
+// recorded is what the test server saw.
+type recorded struct {
+	method, path string
+	query        map[string][]string
+	header       http.Header
+	body         string
+}
+
+func petServer(t *testing.T) (*httptest.Server, <-chan recorded) {
+	t.Helper()
+	seen := make(chan recorded, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen <- recorded{r.Method, r.URL.Path, r.URL.Query(), r.Header, string(body)}
+		if strings.HasSuffix(r.URL.Path, "/404") {
+			http.Error(w, `{"error":"no such pet"}`, http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, seen
+}
+
+func TestToolCalls(t *testing.T) {
+	srv, seen := petServer(t)
+	tools := loadPetstore(t, Options{BaseURL: srv.URL + "/", Auth: allCreds, Header: http.Header{"User-Agent": {"pets-test"}}})
+	ctx := context.Background()
+
+	t.Run("query parameters and api key header", func(t *testing.T) {
+		out, err := tools["listPets"].Handler(ctx, json.RawMessage(`{"tag":["cat","dog"],"limit":5}`))
+		if err != nil || out != `{"ok":true}` {
+			t.Fatalf("call = %q, %v", out, err)
+		}
+		r := <-seen
+		if r.method != http.MethodGet || r.path != "/pets" {
+			t.Fatalf("request %s %s", r.method, r.path)
+		}
+		if !reflect.DeepEqual(r.query, map[string][]string{"tag": {"cat", "dog"}, "limit": {"5"}}) {
+			t.Errorf("query = %v", r.query)
+		}
+		if got := r.header.Get("X-API-Key"); got != "header-key" {
+			t.Errorf("X-API-Key = %q", got)
+		}
+		if got := r.header.Get("User-Agent"); got != "pets-test" {
+			t.Errorf("User-Agent = %q", got)
+		}
+	})
+
+	t.Run("json body and bearer token", func(t *testing.T) {
+		if _, err := tools["createPet"].Handler(ctx, json.RawMessage(`{"body":{"name":"Rex"}}`)); err != nil {
+			t.Fatal(err)
+		}
+		r := <-seen
+		if r.method != http.MethodPost || r.body != `{"name":"Rex"}` {
+			t.Errorf("request %s with body %q", r.method, r.body)
+		}
+		if got := r.header.Get("Authorization"); got != "Bearer bearer-token" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q", got)
+		}
+	})
+
+	t.Run("path parameter, header parameter and basic auth", func(t *testing.T) {
+		if _, err := tools["get_pets_petId"].Handler(ctx, json.RawMessage(`{"petId":7,"X-Trace":"abc"}`)); err != nil {
+			t.Fatal(err)
+		}
+		r := <-seen
+		if r.path != "/pets/7" {
+			t.Errorf("path = %q", r.path)
+		}
+		if got := r.header.Get("X-Trace"); got != "abc" {
+			t.Errorf("X-Trace = %q", got)
+		}
+		if got := r.header.Get("Authorization"); got != "Basic YW5uOnNlY3JldA==" {
+			t.Errorf("Authorization = %q", got)
+		}
+	})
+
+	t.Run("missing path parameter", func(t *testing.T) {
+		if _, err := tools["get_pets_petId"].Handler(ctx, json.RawMessage(`{}`)); err == nil {
+			t.Fatal("no error")
+		}
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		_, err := tools["get_pets_petId"].Handler(ctx, json.RawMessage(`{"petId":404}`))
+		<-seen
+		var serr *StatusError
+		if !errors.As(err, &serr) || serr.StatusCode != http.StatusNotFound || !strings.Contains(serr.Body, "no such pet") {
+			t.Fatalf("err = %v, want a 404 StatusError with the body", err)
+		}
+	})
+}
+
+func TestToolCallsApiKeyQueryAndTruncation(t *testing.T) {
+	srv, seen := petServer(t)
+	creds := map[string]Credential{"bearer": {Token: "t"}, "basic": {}, "apiKeyQuery": {Token: "query-key"}}
+	tools := loadPetstore(t, Options{BaseURL: srv.URL, Auth: creds, MaxResponseBytes: 4})
+
+	out, err := tools["listPets"].Handler(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "{\"ok\n[response truncated]" {
+		t.Errorf("response = %q", out)
+	}
+	r := <-seen
+	if got := r.query["api_key"]; !reflect.DeepEqual(got, []string{"query-key"}) {
+		t.Errorf("api_key = %v", got)
+	}
+	if got := r.header.Get("X-API-Key"); got != "" {
+		t.Errorf("X-API-Key = %q without its credential", got)
+	}
+}
@@ -0,0 +1,50 @@
+package llmagent
+
+import "time"
+
+// ProviderOptions holds settings that only make sense for one provider.
+// Providers ignore options meant for someone else, so a config can be
+// shared safely.
+type ProviderOptions interface {
+	// ProviderName is the provider these options are for, e.g. "claude".
+	ProviderName() string
+}
+
+// AnthropicOptions configures the Claude provider.
+type AnthropicOptions struct {
+	Version string   // anthropic-version header; defaults to 2023-06-01
+	Beta    []string // anthropic-beta feature flags
+}
+
+func (AnthropicOptions) ProviderName() string { return "claude" }
+
+// OpenAIOptions configures the OpenAI provider.
+type OpenAIOptions struct {
+	Organization string // OpenAI-Organization header
+	Project      string // OpenAI-Project header
+}
+
+func (OpenAIOptions) ProviderName() string { return "openai" }
+
+// OllamaOptions configures an Ollama provider. There's no built-in Ollama
+// provider; the type is here so one can be plugged in with the same options
+// mechanism.
+type OllamaOptions struct {
+	KeepAlive time.Duration // how long the model stays loaded after a request
+}
+
+func (OllamaOptions) ProviderName() string { return "ollama" }
+
+// WithProviderOptions attaches provider-specific options.
+func WithProviderOptions(opts ProviderOptions) Option {
+	return func(p *ProviderConfig) {
+		p.Options = opts
+	}
+}
+
+// OptionsFor returns the config's options as T, or the zero T when none of
+// that type were attached.
+func OptionsFor[T ProviderOptions](cfg *ProviderConfig) T {
+	opts, _ := cfg.Options.(T)
+	return opts
+}
@@ -0,0 +1,121 @@
+package llmagent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParamRule clamps or strips sampling parameters for matching models, so
+// combinations a model rejects are fixed before they cause an upstream 400.
+type ParamRule struct {
+	// Models lists model names or prefixes ("o1" matches "o1-mini"); an
+	// empty list matches every model.
+	Models []string
+
+	MinTemperature *float64
+	MaxTemperature *float64
+	MaxTopP        *float64
+	MaxTokens      int // 0 = no cap
+
+	StripTemperature bool
+	StripTopP        bool
+	StripStop        bool
+}
+
+func (r ParamRule) matches(model string) bool {
+	if len(r.Models) == 0 {
+		return true
+	}
+	for _, m := range r.Models {
+		if strings.HasPrefix(model, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultParamRules are applied after a provider's own ParamRules.
+// Reasoning models only accept the default sampling parameters and
+// Anthropic caps temperature at 1.
+var DefaultParamRules = []ParamRule{
+	{Models: []string{"o1", "o3", "o4"}, StripTemperature: true, StripTopP: true},
+	{Models: []string{"claude-"}, MaxTemperature: Float64(1)},
+}
+
+// ParamAdjustment describes a parameter changed by a ParamRule.
+type ParamAdjustment struct {
+	Provider string
+	Model    string
+	Param    string
+	From     any
+	To       any // nil when the parameter was stripped
+}
+
+func (p ParamAdjustment) String() string {
+	if p.To == nil {
+		return fmt.Sprintf("%s/%s: stripped %s=%v", p.Provider, p.Model, p.Param, p.From)
+	}
+	return fmt.Sprintf("%s/%s: %s %v -> %v", p.Provider, p.Model, p.Param, p.From, p.To)
+}
+
+// WithParamRules adds parameter rules for the provider, checked before
+// DefaultParamRules.
+func WithParamRules(rules ...ParamRule) Option {
+	return func(p *ProviderConfig) {
+		p.ParamRules = append(p.ParamRules, rules...)
+	}
+}
+
+// ApplyParamRules enforces the config's ParamRules and DefaultParamRules on
+// req, whose defaults must already be resolved. Each change is reported to
+// OnParamAdjust, or logged when that is nil.
+func (cfg *ProviderConfig) ApplyParamRules(provider string, req CompletionRequest) CompletionRequest {
+	warn := func(param string, from, to any) {
+		adj := ParamAdjustment{Provider: provider, Model: req.Model, Param: param, From: from, To: to}
+		switch {
+		case cfg.OnParamAdjust != nil:
+			cfg.OnParamAdjust(adj)
+		case cfg.Logger != nil:
+			cfg.Logger.Println("param policy:", adj)
+		}
+	}
+	for _, rules := range [][]ParamRule{cfg.ParamRules, DefaultParamRules} {
+		for _, r := range rules {
+			if !r.matches(req.Model) {
+				continue
+			}
+			if t := req.Temperature; t != nil {
+				switch {
+				case r.StripTemperature:
+					req.Temperature = nil
+					warn("temperature", *t, nil)
+				case r.MaxTemperature != nil && *t > *r.MaxTemperature:
+					req.Temperature = Float64(*r.MaxTemperature)
+					warn("temperature", *t, *r.MaxTemperature)
+				case r.MinTemperature != nil && *t < *r.MinTemperature:
+					req.Temperature = Float64(*r.MinTemperature)
+					warn("temperature", *t, *r.MinTemperature)
+				}
+			}
+			if p := req.TopP; p != nil {
+				switch {
+				case r.StripTopP:
+					req.TopP = nil
+					warn("top_p", *p, nil)
+				case r.MaxTopP != nil && *p > *r.MaxTopP:
+					req.TopP = Float64(*r.MaxTopP)
+					warn("top_p", *p, *r.MaxTopP)
+				}
+			}
+			if r.StripStop && len(req.Stop) > 0 {
+				warn("stop", req.Stop, nil)
+				req.Stop = nil
+			}
+			if r.MaxTokens > 0 && req.MaxTokens > r.MaxTokens {
+				warn("max_tokens", req.MaxTokens, r.MaxTokens)
+				req.MaxTokens = r.MaxTokens
+			}
+		}
+	}
+	return req
+}
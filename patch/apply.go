@@ -0,0 +1,429 @@
+package patch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Workspace is the directory edits may touch.
+type Workspace struct {
+	Root string
+	// Allow lists the slash-separated paths, relative to Root, that may be
+	// edited: a pattern ending in "/" allows a whole subtree, anything
+	// else is matched with path.Match. Nil allows every file under Root.
+	Allow []string
+}
+
+// PathError reports a change outside the workspace or its allow-list.
+type PathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *PathError) Error() string { return fmt.Sprintf("%s: %s", e.Path, e.Reason) }
+
+// ConflictError reports an edit that doesn't fit the current file.
+type ConflictError struct {
+	Path   string
+	Edit   int // index of the hunk or replacement
+	Reason string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: edit %d: %s", e.Path, e.Edit+1, e.Reason)
+}
+
+// FileResult is the outcome for one file. Before is nil for created files
+// and After is nil for deleted ones.
+type FileResult struct {
+	Path    string
+	Before  []byte
+	After   []byte
+	Created bool
+	Deleted bool
+	mode    fs.FileMode
+}
+
+// Result lists what Apply changed, or would change on a dry run.
+type Result struct {
+	Files  []FileResult
+	DryRun bool
+	ws     *Workspace
+}
+
+// Apply computes the new content of every changed file and, unless dryRun,
+// writes them. Nothing is written if any change is disallowed or
+// conflicts; all such problems are reported together. If a write fails
+// midway the files already written are restored.
+func (w *Workspace) Apply(changes []Change, dryRun bool) (*Result, error) {
+	files := map[string]*FileResult{} // by path, in the state so far
+	var order []string
+	var errs []error
+
+	load := func(p string) (*FileResult, error) {
+		if f, ok := files[p]; ok {
+			return f, nil
+		}
+		abs, err := w.resolve(p)
+		if err != nil {
+			return nil, err
+		}
+		f := &FileResult{Path: p, mode: 0o644}
+		data, err := os.ReadFile(abs)
+		switch {
+		case err == nil:
+			f.Before, f.After = data, data
+			if info, err := os.Stat(abs); err == nil {
+				f.mode = info.Mode().Perm()
+			}
+		case errors.Is(err, fs.ErrNotExist):
+			f.Created = true
+		default:
+			return nil, err
+		}
+		files[p] = f
+		order = append(order, p)
+		return f, nil
+	}
+
+	for _, c := range changes {
+		f, err := load(c.Path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if c.OldPath != "" {
+			old, err := load(c.OldPath)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if old.After == nil {
+				errs = append(errs, &ConflictError{Path: c.OldPath, Reason: "rename source does not exist"})
+				continue
+			}
+			if f.After != nil {
+				errs = append(errs, &ConflictError{Path: c.Path, Reason: "rename target already exists"})
+				continue
+			}
+			f.After, old.After, old.Deleted = old.After, nil, true
+			f.mode = old.mode
+		}
+		switch {
+		case c.Delete:
+			if f.After == nil {
+				errs = append(errs, &ConflictError{Path: c.Path, Reason: "file to delete does not exist"})
+				continue
+			}
+			f.After, f.Deleted = nil, true
+			continue
+		case c.Create && f.After != nil:
+			errs = append(errs, &ConflictError{Path: c.Path, Reason: "file to create already exists"})
+			continue
+		}
+		after, err := applyChange(c, f.After)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		f.After, f.Deleted = after, false
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	res := &Result{DryRun: dryRun, ws: w}
+	for _, p := range order {
+		f := files[p]
+		if f.Created && f.After == nil {
+			continue // created and deleted again
+		}
+		f.Created = f.Before == nil
+		if bytes.Equal(f.Before, f.After) && (f.Before == nil) == (f.After == nil) {
+			continue
+		}
+		res.Files = append(res.Files, *f)
+	}
+	if dryRun {
+		return res, nil
+	}
+	for i := range res.Files {
+		if err := w.write(res.Files[i].Path, res.Files[i].After, res.Files[i].mode); err != nil {
+			partial := &Result{Files: res.Files[:i+1], ws: w}
+			if rerr := partial.Rollback(); rerr != nil {
+				return nil, errors.Join(err, fmt.Errorf("rollback: %w", rerr))
+			}
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Rollback restores every file of an applied result to its previous
+// content, removing created files.
+func (r *Result) Rollback() error {
+	if r.DryRun {
+		return nil
+	}
+	var errs []error
+	for i := len(r.Files) - 1; i >= 0; i-- {
+		f := r.Files[i]
+		if err := r.ws.write(f.Path, f.Before, f.mode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolve maps a relative path into the workspace, rejecting escapes,
+// paths outside the allow-list and symlinked directories leading out.
+func (w *Workspace) resolve(p string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(p, `\`, "/"))
+	if p == "" || path.IsAbs(clean) || filepath.IsAbs(p) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", &PathError{Path: p, Reason: "outside the workspace"}
+	}
+	if !w.allowed(clean) {
+		return "", &PathError{Path: p, Reason: "not in the allow-list"}
+	}
+	root, err := filepath.EvalSymlinks(w.Root)
+	if err != nil {
+		return "", err
+	}
+	abs := filepath.Join(root, filepath.FromSlash(clean))
+	// the deepest existing ancestor must still be inside root
+	dir := filepath.Dir(abs)
+	for {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			rel, err := filepath.Rel(root, real)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return "", &PathError{Path: p, Reason: "outside the workspace"}
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) || dir == root {
+			return "", err
+		}
+		dir = filepath.Dir(dir)
+	}
+	if info, err := os.Lstat(abs); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		return "", &PathError{Path: p, Reason: "is a symlink"}
+	}
+	return abs, nil
+}
+
+func (w *Workspace) allowed(p string) bool {
+	if w.Allow == nil {
+		return true
+	}
+	for _, pat := range w.Allow {
+		if strings.HasSuffix(pat, "/") {
+			if strings.HasPrefix(p, pat) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pat, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// write stores data atomically, or removes the file when data is nil.
+func (w *Workspace) write(p string, data []byte, mode fs.FileMode) error {
+	abs, err := w.resolve(p)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		if err := os.Remove(abs); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(abs), ".patch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), abs)
+}
+
+// applyChange returns content with c's hunks or replacements applied;
+// content is nil for a missing file.
+func applyChange(c Change, content []byte) ([]byte, error) {
+	text := string(content)
+	for i, r := range c.Replacements {
+		switch {
+		case r.Search == "" && content == nil && i == 0:
+			text = r.Replace // a new file
+		case r.Search == "":
+			return nil, &ConflictError{Path: c.Path, Edit: i, Reason: "empty search text for an existing file"}
+		default:
+			next, err := replaceOnce(text, r)
+			if err != nil {
+				return nil, &ConflictError{Path: c.Path, Edit: i, Reason: err.Error()}
+			}
+			text = next
+		}
+	}
+	if len(c.Hunks) > 0 {
+		if content == nil && !c.Create {
+			return nil, &ConflictError{Path: c.Path, Reason: "file does not exist"}
+		}
+		var err error
+		if text, err = applyHunks(c.Path, text, c.Hunks); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(text), nil
+}
+
+// replaceOnce replaces the single occurrence of r.Search, falling back to
+// a match that ignores trailing whitespace on each line.
+func replaceOnce(text string, r Replacement) (string, error) {
+	switch n := strings.Count(text, r.Search); {
+	case n == 1:
+		return strings.Replace(text, r.Search, r.Replace, 1), nil
+	case n > 1:
+		return "", fmt.Errorf("search text occurs %d times", n)
+	}
+	lines := splitLines(text)
+	want := splitLines(r.Search)
+	var at []int
+	for i := 0; i+len(want) <= len(lines); i++ {
+		if linesMatch(lines[i:i+len(want)], want, true) {
+			at = append(at, i)
+		}
+	}
+	switch len(at) {
+	case 0:
+		return "", fmt.Errorf("search text not found")
+	case 1:
+		out := append(append(append([]string(nil), lines[:at[0]]...), splitLines(r.Replace)...), lines[at[0]+len(want):]...)
+		return strings.Join(out, ""), nil
+	}
+	return "", fmt.Errorf("search text occurs %d times", len(at))
+}
+
+// applyHunks applies hunks in order. Each hunk's old lines are looked for
+// at the header position first, then at the nearest position after the
+// previous hunk, exactly and then ignoring trailing whitespace.
+func applyHunks(name, text string, hunks []Hunk) (string, error) {
+	lines := splitLines(text)
+	var out []string
+	pos := 0
+	for i, h := range hunks {
+		var old, repl []string
+		for _, l := range h.Lines {
+			if l == "" || !strings.ContainsRune(" -+", rune(l[0])) {
+				return "", &ConflictError{Path: name, Edit: i, Reason: fmt.Sprintf("hunk line %q lacks a ' ', '-' or '+' prefix", l)}
+			}
+			body := l[1:] + "\n"
+			switch l[0] {
+			case ' ':
+				old, repl = append(old, body), append(repl, body)
+			case '-':
+				old = append(old, body)
+			case '+':
+				repl = append(repl, body)
+			}
+		}
+		var at int
+		if len(old) == 0 {
+			at = max(pos, min(h.OldStart, len(lines))) // OldStart is the line to insert after
+		} else {
+			at = findBlock(lines, old, pos, h.OldStart-1)
+		}
+		if at < 0 {
+			return "", &ConflictError{Path: name, Edit: i, Reason: "context does not match the file"}
+		}
+		out = append(out, lines[pos:at]...)
+		if n := len(out); n > 0 && len(repl) > 0 && !strings.HasSuffix(out[n-1], "\n") {
+			out[n-1] += "\n"
+		}
+		out = append(out, repl...)
+		pos = at + len(old)
+	}
+	out = append(out, lines[pos:]...)
+	joined := strings.Join(out, "")
+	// lines of the patch all end in a newline; keep the file's lack of one
+	if !strings.HasSuffix(text, "\n") && text != "" && strings.HasSuffix(joined, "\n") && pos == len(lines) {
+		joined = strings.TrimSuffix(joined, "\n")
+	}
+	return joined, nil
+}
+
+func findBlock(lines, block []string, from, hint int) int {
+	for _, loose := range []bool{false, true} {
+		if hint >= from && hint+len(block) <= len(lines) && linesMatch(lines[hint:hint+len(block)], block, loose) {
+			return hint
+		}
+		best := -1
+		for i := from; i+len(block) <= len(lines); i++ {
+			if linesMatch(lines[i:i+len(block)], block, loose) {
+				if best < 0 || abs(i-hint) < abs(best-hint) {
+					best = i
+				}
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	return -1
+}
+
+func linesMatch(a, b []string, loose bool) bool {
+	for i := range a {
+		x, y := a[i], b[i]
+		if loose {
+			x, y = strings.TrimRight(x, " \t\r\n"), strings.TrimRight(y, " \t\r\n")
+		} else {
+			// the last line of a file may lack its newline
+			x, y = strings.TrimSuffix(x, "\n"), strings.TrimSuffix(y, "\n")
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLines splits text after each newline, keeping the newlines; the
+// last line may lack one.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
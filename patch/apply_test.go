@@ -0,0 +1,189 @@
+package patch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// workspace returns a workspace over a temporary directory holding files.
+func workspace(t *testing.T, files map[string]string) *Workspace {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Workspace{Root: root}
+}
+
+// content returns the file's content, or "<missing>".
+func content(t *testing.T, w *Workspace, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(w.Root, filepath.FromSlash(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return "<missing>"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestApplyHunks(t *testing.T) {
+	for _, tc := range []struct {
+		name, file string
+		hunk       Hunk
+		want       string
+	}{
+		{"at the header position", "a\nb\nc\n",
+			Hunk{OldStart: 2, Lines: []string{" b", "-c", "+C"}}, "a\nb\nC\n"},
+		{"header off by some lines", "x\nx\nx\na\nb\n",
+			Hunk{OldStart: 1, Lines: []string{" a", "-b", "+B"}}, "x\nx\nx\na\nB\n"},
+		{"nearest of two matches", "k\nv\nk\nv\n",
+			Hunk{OldStart: 3, Lines: []string{" k", "-v", "+V"}}, "k\nv\nk\nV\n"},
+		{"trailing whitespace ignored", "a  \nb\n", // context is rewritten as in the hunk
+			Hunk{OldStart: 1, Lines: []string{" a", "-b", "+B"}}, "a\nB\n"},
+		{"no newline at end of file", "a\nb",
+			Hunk{OldStart: 1, Lines: []string{" a", "-b", "+B"}}, "a\nB"},
+		{"pure insertion", "a\nb\n",
+			Hunk{OldStart: 1, Lines: []string{"+ins"}}, "a\nins\nb\n"},
+	} {
+		got, err := applyHunks("f", tc.file, []Hunk{tc.hunk})
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestApplyHunksRejectsBadLines(t *testing.T) {
+	for _, line := range []string{"", "*b"} {
+		_, err := applyHunks("f", "a\nb\n", []Hunk{{OldStart: 1, Lines: []string{" a", line}}})
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Errorf("hunk line %q: err = %v, want a ConflictError", line, err)
+		}
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	w := workspace(t, map[string]string{"a.txt": "one\n"})
+	res, err := w.Apply([]Change{
+		{Path: "a.txt", Replacements: []Replacement{{Search: "one\n", Replace: "two\n"}}},
+		{Path: "b.txt", Create: true, Replacements: []Replacement{{Replace: "new\n"}}},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Files) != 2 || string(res.Files[0].After) != "two\n" || !res.Files[1].Created {
+		t.Fatalf("dry run result = %+v", res.Files)
+	}
+	if got := content(t, w, "a.txt"); got != "one\n" {
+		t.Fatalf("dry run wrote a.txt: %q", got)
+	}
+	if got := content(t, w, "b.txt"); got != "<missing>" {
+		t.Fatalf("dry run created b.txt: %q", got)
+	}
+}
+
+func TestApplyRenameDeleteAndRollback(t *testing.T) {
+	w := workspace(t, map[string]string{"old.txt": "a\n", "gone.txt": "x\n", "keep.txt": "k\n"})
+	res, err := w.Apply([]Change{
+		{Path: "new.txt", OldPath: "old.txt", Hunks: []Hunk{{OldStart: 1, Lines: []string{"-a", "+b"}}}},
+		{Path: "gone.txt", Delete: true},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"old.txt": "<missing>", "new.txt": "b\n", "gone.txt": "<missing>", "keep.txt": "k\n"} {
+		if got := content(t, w, name); got != want {
+			t.Errorf("after apply %s = %q, want %q", name, got, want)
+		}
+	}
+	if err := res.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"old.txt": "a\n", "new.txt": "<missing>", "gone.txt": "x\n"} {
+		if got := content(t, w, name); got != want {
+			t.Errorf("after rollback %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestApplyConflictsWriteNothing(t *testing.T) {
+	w := workspace(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	_, err := w.Apply([]Change{
+		{Path: "a.txt", Replacements: []Replacement{{Search: "a\n", Replace: "A\n"}}},
+		{Path: "b.txt", Hunks: []Hunk{{OldStart: 1, Lines: []string{"-zzz", "+B"}}}},
+		{Path: "c.txt", Delete: true},
+	}, false)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("err = %v, want a ConflictError", err)
+	}
+	if got := content(t, w, "a.txt"); got != "a\n" {
+		t.Fatalf("a.txt written despite the conflict: %q", got)
+	}
+}
+
+func TestApplyRollsBackFailedWrite(t *testing.T) {
+	w := workspace(t, map[string]string{"a.txt": "a\n"})
+	// "sub" is created as a file before "sub/new.txt" needs it as a
+	// directory, so the third write fails after two succeeded.
+	_, err := w.Apply([]Change{
+		{Path: "a.txt", Replacements: []Replacement{{Search: "a\n", Replace: "A\n"}}},
+		{Path: "sub", Create: true, Replacements: []Replacement{{Replace: "file\n"}}},
+		{Path: "sub/new.txt", Create: true, Replacements: []Replacement{{Replace: "new\n"}}},
+	}, false)
+	if err == nil {
+		t.Fatal("Apply succeeded, want a write error")
+	}
+	for name, want := range map[string]string{"a.txt": "a\n", "sub": "<missing>"} {
+		if got := content(t, w, name); got != want {
+			t.Errorf("after the failed apply %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestApplyStaysInAllowList(t *testing.T) {
+	w := workspace(t, map[string]string{"src/a.go": "a\n", "README": "r\n"})
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(w.Root, "src", "link")); err != nil {
+		t.Fatal(err)
+	}
+	w.Allow = []string{"src/", "*.md"}
+	create := func(p string) Change {
+		return Change{Path: p, Create: true, Replacements: []Replacement{{Replace: "x\n"}}}
+	}
+	for _, c := range []Change{
+		create("README.txt"),
+		create("../escape.txt"),
+		create("/etc/passwd"),
+		create("src/../../escape.txt"),
+		create("src/link/escape.txt"),
+		create("src/link"),
+		{Path: "README", Replacements: []Replacement{{Search: "r\n", Replace: "R\n"}}},
+	} {
+		_, err := w.Apply([]Change{c}, false)
+		var perr *PathError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: err = %v, want a PathError", c.Path, err)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) > 0 {
+		t.Fatalf("wrote outside the workspace: %v", entries)
+	}
+	if _, err := w.Apply([]Change{create("src/b.go"), create("NOTES.md")}, false); err != nil {
+		t.Fatalf("allowed paths: %v", err)
+	}
+}
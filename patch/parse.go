@@ -0,0 +1,339 @@
+// Package patch applies file edits written by a model, either as unified
+// diffs or as search/replace blocks:
+//
+//	path/to/file.go
+//	<<<<<<< SEARCH
+//	old lines
+//	=======
+//	new lines
+//	>>>>>>> REPLACE
+//
+// A Parser reads model output incrementally, so edits can be previewed
+// while a completion streams; a Workspace applies them under an allow-list
+// with dry-run, conflict detection and rollback.
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Change is an edit of one file. A unified diff gives Hunks, a
+// search/replace block gives Replacements.
+type Change struct {
+	Path    string // slash-separated, relative to the workspace
+	OldPath string // set on renames
+	Create  bool   // the diff is against /dev/null
+	Delete  bool   // the diff is to /dev/null
+
+	Hunks        []Hunk
+	Replacements []Replacement
+}
+
+// Hunk is one @@ section of a unified diff. Lines keep their ' ', '-' or
+// '+' prefix; Apply rejects lines without one, including empty lines.
+// Start lines are 1-based hints; 0 means the header had none.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []string
+}
+
+// Replacement replaces Search with Replace; Search must occur exactly once.
+type Replacement struct {
+	Search, Replace string
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+const (
+	markSearch  = "<<<<<<< SEARCH"
+	markDivider = "======="
+	markReplace = ">>>>>>> REPLACE"
+)
+
+type parseState int
+
+const (
+	stateText parseState = iota
+	stateFileHeader
+	stateFile
+	stateHunk
+	stateSearch
+	stateReplace
+)
+
+// Parser turns model output into Changes as soon as each one is complete.
+// Text outside diffs and blocks, such as explanations and code fences, is
+// ignored.
+type Parser struct {
+	partial string // unterminated last line
+	state   parseState
+	last    string // last line of prose, the path of a search/replace block
+	minus   string // pending "--- " line
+	change  *Change
+	hunk    *Hunk
+	counted bool // the hunk header had line counts
+	oldLeft int
+	newLeft int
+	search  strings.Builder
+	replace strings.Builder
+}
+
+// Write feeds text and returns the changes it completed.
+func (p *Parser) Write(text string) ([]Change, error) {
+	text = p.partial + text
+	lines := strings.Split(text, "\n")
+	p.partial = lines[len(lines)-1]
+	var out []Change
+	for _, line := range lines[:len(lines)-1] {
+		done, err := p.line(strings.TrimSuffix(line, "\r"))
+		if err != nil {
+			return out, err
+		}
+		out = append(out, done...)
+	}
+	return out, nil
+}
+
+// Flush ends the input and returns the last change, if any. An unfinished
+// search/replace block is an error.
+func (p *Parser) Flush() ([]Change, error) {
+	var out []Change
+	if p.partial != "" {
+		line := p.partial
+		p.partial = ""
+		done, err := p.line(strings.TrimSuffix(line, "\r"))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, done...)
+	}
+	switch p.state {
+	case stateSearch, stateReplace:
+		return out, fmt.Errorf("unterminated search/replace block for %s", p.change.Path)
+	case stateHunk, stateFile:
+		if p.state == stateHunk && p.counted && (p.oldLeft > 0 || p.newLeft > 0) {
+			return out, fmt.Errorf("%s: hunk ends early", p.change.Path)
+		}
+		out = append(out, p.endFile()...)
+	}
+	p.state = stateText
+	return out, nil
+}
+
+func (p *Parser) line(line string) ([]Change, error) {
+	switch p.state {
+	case stateFileHeader:
+		if rest, ok := strings.CutPrefix(line, "+++ "); ok {
+			p.startFile(diffPath(p.minus), diffPath(rest))
+			return nil, nil
+		}
+		p.state = stateText
+	case stateFile:
+		if m := hunkHeader.FindStringSubmatch(line); m != nil || strings.HasPrefix(line, "@@") {
+			p.startHunk(m)
+			return nil, nil
+		}
+		done := p.endFile()
+		more, err := p.line(line)
+		return append(done, more...), err
+	case stateHunk:
+		if p.hunkLine(line) {
+			return nil, nil
+		}
+		p.endHunk()
+		p.state = stateFile
+		return p.line(line)
+	case stateSearch:
+		if strings.TrimSpace(line) == markDivider {
+			p.state = stateReplace
+			return nil, nil
+		}
+		p.search.WriteString(line + "\n")
+		return nil, nil
+	case stateReplace:
+		if strings.TrimSpace(line) == markReplace {
+			c := *p.change
+			c.Replacements = []Replacement{{Search: p.search.String(), Replace: p.replace.String()}}
+			p.change, p.state = nil, stateText
+			return []Change{c}, nil
+		}
+		p.replace.WriteString(line + "\n")
+		return nil, nil
+	}
+
+	// stateText
+	switch {
+	case strings.HasPrefix(line, "--- "):
+		p.minus, p.state = line[4:], stateFileHeader
+	case strings.TrimSpace(line) == markSearch:
+		path := cleanPathLine(p.last)
+		if path == "" {
+			return nil, fmt.Errorf("search/replace block without a file path")
+		}
+		p.change = &Change{Path: path}
+		p.search.Reset()
+		p.replace.Reset()
+		p.state = stateSearch
+	default:
+		if t := strings.TrimSpace(line); t != "" && !strings.HasPrefix(t, "```") {
+			p.last = t
+		}
+	}
+	return nil, nil
+}
+
+func (p *Parser) startFile(oldPath, newPath string) {
+	c := &Change{Path: newPath}
+	switch {
+	case oldPath == "":
+		c.Create = true
+	case newPath == "":
+		c.Delete, c.Path = true, oldPath
+	case oldPath != newPath:
+		c.OldPath = oldPath
+	}
+	p.change, p.state = c, stateFile
+}
+
+func (p *Parser) startHunk(m []string) {
+	h := &Hunk{}
+	p.counted = m != nil
+	if m != nil {
+		h.OldStart, _ = strconv.Atoi(m[1])
+		h.OldLines = count(m[2])
+		h.NewStart, _ = strconv.Atoi(m[3])
+		h.NewLines = count(m[4])
+	}
+	p.hunk, p.oldLeft, p.newLeft, p.state = h, h.OldLines, h.NewLines, stateHunk
+}
+
+func count(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// hunkLine consumes a line of the current hunk, reporting false when the
+// line belongs to whatever follows it.
+func (p *Parser) hunkLine(line string) bool {
+	if p.counted && p.oldLeft <= 0 && p.newLeft <= 0 {
+		return false
+	}
+	if strings.HasPrefix(line, `\ `) { // "\ No newline at end of file"
+		return true
+	}
+	if line == "" {
+		if !p.counted {
+			return false
+		}
+		line = " " // editors and models drop the space of blank context lines
+	}
+	switch line[0] {
+	case ' ':
+		p.oldLeft--
+		p.newLeft--
+	case '-':
+		p.oldLeft--
+	case '+':
+		p.newLeft--
+	default:
+		return false
+	}
+	p.hunk.Lines = append(p.hunk.Lines, line)
+	return true
+}
+
+func (p *Parser) endHunk() {
+	if p.hunk != nil && len(p.hunk.Lines) > 0 {
+		p.change.Hunks = append(p.change.Hunks, *p.hunk)
+	}
+	p.hunk = nil
+}
+
+func (p *Parser) endFile() []Change {
+	p.endHunk()
+	c := p.change
+	p.change, p.state = nil, stateText
+	if c == nil || len(c.Hunks) == 0 && !c.Delete {
+		return nil
+	}
+	return []Change{*c}
+}
+
+// diffPath strips timestamps and the a/ b/ prefixes; /dev/null is "".
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	if len(s) > 2 && (s[:2] == "a/" || s[:2] == "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+// cleanPathLine extracts a path from the line before a search/replace
+// block, which models decorate with backticks, bold or a "File:" label.
+func cleanPathLine(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "File:")
+	s = strings.TrimPrefix(s, "file:")
+	return strings.Trim(s, " `*#:")
+}
+
+// Parse reads complete model output.
+func Parse(text string) ([]Change, error) {
+	var p Parser
+	out, err := p.Write(text)
+	if err != nil {
+		return out, err
+	}
+	rest, err := p.Flush()
+	return append(out, rest...), err
+}
+
+// ParseStream parses a completion as it streams, calling onChange (if not
+// nil) for each change as soon as it is complete. It returns all changes
+// once the stream ends.
+func ParseStream(ch <-chan llmagent.CompletionResponse, onChange func(Change)) ([]Change, error) {
+	var p Parser
+	var all []Change
+	emit := func(cs []Change) {
+		for _, c := range cs {
+			if onChange != nil {
+				onChange(c)
+			}
+		}
+		all = append(all, cs...)
+	}
+	var streamErr error
+	for resp := range ch {
+		if streamErr != nil {
+			continue // drain
+		}
+		if resp.Err != nil {
+			streamErr = resp.Err
+			continue
+		}
+		cs, err := p.Write(resp.Content)
+		emit(cs)
+		streamErr = err
+	}
+	if streamErr != nil {
+		return all, streamErr
+	}
+	cs, err := p.Flush()
+	emit(cs)
+	return all, err
+}
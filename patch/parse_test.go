@@ -0,0 +1,107 @@
+package patch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/llmagent"
+)
+
+const unifiedDiff = "Here is the fix:\n" +
+	"```diff\n" +
+	"--- a/main.go\t2024-01-01 00:00:00\n" +
+	"+++ b/main.go\n" +
+	"@@ -1,3 +1,3 @@\n" +
+	" package main\n" +
+	"-var x = 1\n" +
+	"+var x = 2\n" +
+	"\n" + // blank context line that lost its space
+	"--- a/old.go\n" +
+	"+++ b/new.go\n" +
+	"@@ -2 +2 @@\n" +
+	"-a\n" +
+	"+b\n" +
+	"--- a/gone.go\n" +
+	"+++ /dev/null\n" +
+	"--- /dev/null\n" +
+	"+++ b/fresh.go\n" +
+	"@@ -0,0 +1,2 @@\n" +
+	"+package fresh\n" +
+	"+\n" +
+	"```\n"
+
+func TestParseUnifiedDiff(t *testing.T) {
+	got, err := Parse(unifiedDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Path: "main.go", Hunks: []Hunk{{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 3,
+			Lines: []string{" package main", "-var x = 1", "+var x = 2", " "}}}},
+		{Path: "new.go", OldPath: "old.go", Hunks: []Hunk{{OldStart: 2, OldLines: 1, NewStart: 2, NewLines: 1,
+			Lines: []string{"-a", "+b"}}}},
+		{Path: "gone.go", Delete: true},
+		{Path: "fresh.go", Create: true, Hunks: []Hunk{{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 2,
+			Lines: []string{"+package fresh", "+"}}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Parse =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseSearchReplace(t *testing.T) {
+	text := "Update the greeting:\n\n" +
+		"File: **`greet/greet.go`**\n" +
+		"<<<<<<< SEARCH\n" +
+		"\treturn \"hi\"\n" +
+		"=======\n" +
+		"\treturn \"hello\"\n" +
+		">>>>>>> REPLACE\n"
+	got, err := Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{{Path: "greet/greet.go", Replacements: []Replacement{{Search: "\treturn \"hi\"\n", Replace: "\treturn \"hello\"\n"}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Parse = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, text := range map[string]string{
+		"block without path":       "<<<<<<< SEARCH\na\n=======\nb\n>>>>>>> REPLACE\n",
+		"unterminated block":       "f.go\n<<<<<<< SEARCH\na\n=======\nb\n",
+		"hunk shorter than header": "--- a/f.go\n+++ b/f.go\n@@ -1,3 +1,3 @@\n a\n",
+	} {
+		if _, err := Parse(text); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestParseStreamSplitsAnywhere(t *testing.T) {
+	want, err := Parse(unifiedDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// feed the diff in 7-byte chunks, splitting lines and markers
+	ch := make(chan llmagent.CompletionResponse, len(unifiedDiff))
+	for s := unifiedDiff; s != ""; {
+		n := min(7, len(s))
+		ch <- llmagent.CompletionResponse{Content: s[:n]}
+		s = s[n:]
+	}
+	close(ch)
+	var seen []string
+	got, err := ParseStream(ch, func(c Change) { seen = append(seen, c.Path) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseStream =\n%+v\nwant\n%+v", got, want)
+	}
+	if strings.Join(seen, ",") != "main.go,new.go,gone.go,fresh.go" {
+		t.Fatalf("onChange saw %v", seen)
+	}
+}
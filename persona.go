@@ -0,0 +1,186 @@
+package llmagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Persona is a named system prompt with default request parameters.
+type Persona struct {
+	Name         string   `json:"name"`
+	SystemPrompt string   `json:"system_prompt"`
+	Provider     string   `json:"provider,omitempty"` // provider or alias; empty uses the agent default
+	Model        string   `json:"model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	MaxTokens    int      `json:"max_tokens,omitempty"`
+	TopP         *float64 `json:"top_p,omitempty"`
+	AllowedTools []string `json:"allowed_tools,omitempty"` // tool names the persona may call
+}
+
+// apply merges the persona into req. Values already set on req win; the
+// persona prompt goes in front of any system message req carries.
+func (p Persona) apply(req CompletionRequest) CompletionRequest {
+	if req.Model == "" {
+		req.Model = p.Model
+	}
+	if req.Temperature == nil {
+		req.Temperature = p.Temperature
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = p.MaxTokens
+	}
+	if req.TopP == nil {
+		req.TopP = p.TopP
+	}
+	if p.SystemPrompt == "" {
+		return req
+	}
+	msgs := make([]Message, 0, len(req.Messages)+1)
+	if len(req.Messages) > 0 && req.Messages[0].Role == RoleSystem {
+		first := req.Messages[0]
+		first.Content = p.SystemPrompt + "\n\n" + first.Content
+		msgs = append(msgs, first)
+		msgs = append(msgs, req.Messages[1:]...)
+	} else {
+		msgs = append(msgs, Message{Role: RoleSystem, Content: p.SystemPrompt})
+		msgs = append(msgs, req.Messages...)
+	}
+	req.Messages = msgs
+	return req
+}
+
+// PersonaRegistry holds personas by name. Personas registered in code and
+// personas loaded from a file live side by side; reloading the file only
+// replaces the file-loaded set.
+type PersonaRegistry struct {
+	mu       sync.RWMutex
+	manual   map[string]Persona
+	fromFile map[string]Persona
+
+	// OnReload, if set, is called after every Watch reload attempt.
+	OnReload func(path string, err error)
+	// Clock times Watch polls; SystemClock when nil.
+	Clock Clock
+}
+
+// NewPersonaRegistry creates an empty registry.
+func NewPersonaRegistry() *PersonaRegistry {
+	return &PersonaRegistry{
+		manual:   make(map[string]Persona),
+		fromFile: make(map[string]Persona),
+	}
+}
+
+// Register adds or replaces a persona.
+func (r *PersonaRegistry) Register(p Persona) error {
+	if p.Name == "" {
+		return errors.New("persona name is required")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.manual[p.Name] = p
+	return nil
+}
+
+// Get looks up a persona; code-registered personas shadow file-loaded ones.
+func (r *PersonaRegistry) Get(name string) (Persona, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if p, ok := r.manual[name]; ok {
+		return p, true
+	}
+	p, ok := r.fromFile[name]
+	return p, ok
+}
+
+// Names lists all persona names in sorted order.
+func (r *PersonaRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, set := range []map[string]Persona{r.manual, r.fromFile} {
+		for name := range set {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadFile reads a JSON array of personas from path and atomically replaces
+// the previously file-loaded set. On error the old set is kept.
+func (r *PersonaRegistry) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var list []Persona
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("parse personas %s: %w", path, err)
+	}
+	set := make(map[string]Persona, len(list))
+	for i, p := range list {
+		if p.Name == "" {
+			return fmt.Errorf("persona %d in %s has no name", i, path)
+		}
+		set[p.Name] = p
+	}
+	r.mu.Lock()
+	r.fromFile = set
+	r.mu.Unlock()
+	return nil
+}
+
+// Watch loads path and then polls it every interval, reloading whenever its
+// modification time changes, until ctx is done.
+func (r *PersonaRegistry) Watch(ctx context.Context, path string, interval time.Duration) error {
+	if err := r.LoadFile(path); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	lastMod := info.ModTime()
+	ticker := clockOr(r.Clock).NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+			err = r.LoadFile(path)
+			if r.OnReload != nil {
+				r.OnReload(path, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// CompleteAs completes req using the named persona's system prompt and
+// defaults, routed to the persona's provider.
+func (a *Agent) CompleteAs(ctx context.Context, persona string, req CompletionRequest) (<-chan CompletionResponse, error) {
+	p, ok := a.Personas.Get(persona)
+	if !ok {
+		return nil, fmt.Errorf("persona %q not registered", persona)
+	}
+	return a.Complete(ctx, p.Provider, p.apply(req))
+}
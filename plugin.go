@@ -0,0 +1,142 @@
+package llmagent
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Plugin is an integration package that snaps into an Agent with one call
+// to Use. Besides Init, a plugin contributes whatever optional interfaces
+// it implements: ProviderPlugin, PolicyPlugin, TransformerPlugin and
+// DataStorePlugin.
+type Plugin interface {
+	Name() string
+	// Init runs after the plugin's contributions are installed, e.g. to
+	// set hooks such as Agent.OnSLOEvent.
+	Init(a *Agent) error
+}
+
+// ProviderPlugin contributes providers, registered as user providers.
+type ProviderPlugin interface {
+	Providers() []Provider
+}
+
+// PolicyPlugin contributes policy rules, added to Agent.Policy (created if
+// nil).
+type PolicyPlugin interface {
+	Rules() []Rule
+}
+
+// TransformerPlugin contributes stream transformers, appended to
+// Agent.Transformers.
+type TransformerPlugin interface {
+	Transformers() []func() StreamTransformer
+}
+
+// DataStorePlugin contributes stores covered by PurgeUserData and
+// retention.
+type DataStorePlugin interface {
+	DataStores() []DataStore
+}
+
+var (
+	pluginsMu sync.RWMutex
+	plugins   = map[string]Plugin{}
+)
+
+// RegisterPlugin makes a plugin available to Agent.UsePlugin by name,
+// typically from the plugin package's init function. Registering a name
+// twice panics, like database/sql drivers.
+func RegisterPlugin(p Plugin) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if _, dup := plugins[p.Name()]; dup {
+		panic(fmt.Sprintf("llmagent: plugin %q registered twice", p.Name()))
+	}
+	plugins[p.Name()] = p
+}
+
+// Plugins lists the registered plugin names, sorted.
+func Plugins() []string {
+	pluginsMu.RLock()
+	defer pluginsMu.RUnlock()
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UsePlugin installs registered plugins by name.
+func (a *Agent) UsePlugin(names ...string) error {
+	for _, name := range names {
+		pluginsMu.RLock()
+		p, ok := plugins[name]
+		pluginsMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("plugin %q not registered", name)
+		}
+		if err := a.Use(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Use installs plugins in order: their providers, rules, transformers and
+// data stores are added, then Init is called. A plugin already installed
+// under the same name is an error; a failing plugin may leave part of its
+// contributions installed. Install plugins before serving requests.
+func (a *Agent) Use(ps ...Plugin) error {
+	for _, p := range ps {
+		if err := a.use(p); err != nil {
+			return fmt.Errorf("plugin %q: %w", p.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (a *Agent) use(p Plugin) error {
+	if _, dup := a.plugins[p.Name()]; dup {
+		return fmt.Errorf("already installed")
+	}
+	if pp, ok := p.(ProviderPlugin); ok {
+		for _, prov := range pp.Providers() {
+			if err := a.RegisterProvidersFromUser(prov); err != nil {
+				return err
+			}
+		}
+	}
+	if pp, ok := p.(PolicyPlugin); ok {
+		if a.Policy == nil {
+			a.Policy = &PolicyEngine{}
+		}
+		for _, r := range pp.Rules() {
+			if err := a.Policy.AddRule(r); err != nil {
+				return err
+			}
+		}
+	}
+	if tp, ok := p.(TransformerPlugin); ok {
+		a.Transformers = append(a.Transformers, tp.Transformers()...)
+	}
+	if dp, ok := p.(DataStorePlugin); ok {
+		a.DataStores = append(a.DataStores, dp.DataStores()...)
+	}
+	if err := p.Init(a); err != nil {
+		return err
+	}
+	if a.plugins == nil {
+		a.plugins = make(map[string]Plugin)
+	}
+	a.plugins[p.Name()] = p
+	return nil
+}
+
+// Plugin returns the installed plugin with the given name.
+func (a *Agent) Plugin(name string) (Plugin, bool) {
+	p, ok := a.plugins[name]
+	return p, ok
+}
@@ -0,0 +1,218 @@
+package llmagent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PolicyAction is what happens when a policy rule matches.
+type PolicyAction string
+
+const (
+	ActionBlock  PolicyAction = "block"  // reject the request / fail the response
+	ActionRedact PolicyAction = "redact" // replace the matched text
+	ActionWarn   PolicyAction = "warn"   // report and continue
+	ActionAudit  PolicyAction = "audit"  // report silently and continue
+)
+
+// PolicyStage says whether a rule applies to prompts, answers or both.
+type PolicyStage string
+
+const (
+	StageInput  PolicyStage = "input"
+	StageOutput PolicyStage = "output"
+	StageBoth   PolicyStage = ""
+)
+
+// Rule is one content safety rule. A rule matches if any of its checks do.
+type Rule struct {
+	Name   string
+	Stage  PolicyStage
+	Action PolicyAction
+
+	Patterns    []string // regular expressions denied in the text
+	Topics      []string // blocked topic keywords, matched case-insensitively on word boundaries
+	MaxToxicity float64  // block above this moderation score (0 disables; needs a Moderator)
+	Jailbreak   bool     // apply the built-in jailbreak heuristics
+
+	compiled []*regexp.Regexp
+}
+
+// Moderator scores text for toxicity in [0, 1], e.g. via a provider's
+// moderation endpoint.
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (float64, error)
+}
+
+// Violation describes a rule match.
+type Violation struct {
+	Rule   string
+	Stage  PolicyStage
+	Action PolicyAction
+	Match  string // matched text, or the score for toxicity rules
+}
+
+// PolicyError is returned (or streamed) when a blocking rule matches.
+type PolicyError struct {
+	Violation Violation
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("llmagent: blocked by policy rule %q (%s)", e.Violation.Rule, e.Violation.Stage)
+}
+
+// RedactionText replaces text matched by redact rules.
+const RedactionText = "[REDACTED]"
+
+var jailbreakPatterns = []string{
+	`(?i)ignore\s+(all\s+)?(the\s+)?(previous|prior|above)\s+instructions`,
+	`(?i)disregard\s+(all\s+)?(your|the)\s+(rules|instructions|guidelines)`,
+	`(?i)\byou\s+are\s+now\s+(DAN|in\s+developer\s+mode)\b`,
+	`(?i)pretend\s+(that\s+)?you\s+(are|have)\s+no\s+(rules|restrictions|filters)`,
+	`(?i)bypass\s+(your\s+)?(safety|content)\s+(filters?|policies)`,
+}
+
+// PolicyEngine evaluates rules before a request is sent and after the
+// answer is produced.
+type PolicyEngine struct {
+	Rules     []Rule
+	Moderator Moderator
+	// OnViolation is called for every match, whatever its action; use it
+	// to log warnings and write audit records.
+	OnViolation func(ctx context.Context, v Violation)
+}
+
+// NewPolicyEngine compiles rules into an engine.
+func NewPolicyEngine(rules ...Rule) (*PolicyEngine, error) {
+	e := &PolicyEngine{}
+	for _, r := range rules {
+		if err := e.AddRule(r); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// AddRule compiles and appends r.
+func (e *PolicyEngine) AddRule(r Rule) error {
+	if r.Action == "" {
+		r.Action = ActionBlock
+	}
+	patterns := append([]string(nil), r.Patterns...)
+	for _, topic := range r.Topics {
+		patterns = append(patterns, `(?i)\b`+regexp.QuoteMeta(topic)+`\b`)
+	}
+	if r.Jailbreak {
+		patterns = append(patterns, jailbreakPatterns...)
+	}
+	r.compiled = r.compiled[:0]
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		r.compiled = append(r.compiled, re)
+	}
+	e.Rules = append(e.Rules, r)
+	return nil
+}
+
+// Evaluate checks text against every rule for stage. It returns the text
+// with redactions applied, all violations, and a *PolicyError if a blocking
+// rule matched.
+func (e *PolicyEngine) Evaluate(ctx context.Context, stage PolicyStage, text string) (string, []Violation, error) {
+	var violations []Violation
+	var blocked error
+	report := func(v Violation) {
+		violations = append(violations, v)
+		if e.OnViolation != nil {
+			e.OnViolation(ctx, v)
+		}
+		if v.Action == ActionBlock && blocked == nil {
+			blocked = &PolicyError{Violation: v}
+		}
+	}
+	for _, r := range e.Rules {
+		if r.Stage != StageBoth && r.Stage != stage {
+			continue
+		}
+		for _, re := range r.compiled {
+			if m := re.FindString(text); m != "" {
+				report(Violation{Rule: r.Name, Stage: stage, Action: r.Action, Match: m})
+				if r.Action == ActionRedact {
+					text = re.ReplaceAllString(text, RedactionText)
+				}
+			}
+		}
+		if r.MaxToxicity > 0 && e.Moderator != nil {
+			score, err := e.Moderator.Moderate(ctx, text)
+			if err != nil {
+				return text, violations, fmt.Errorf("moderation: %w", err)
+			}
+			if score > r.MaxToxicity {
+				action := r.Action
+				if action == ActionRedact {
+					// a score can't be redacted away
+					action = ActionBlock
+				}
+				report(Violation{Rule: r.Name, Stage: stage, Action: action, Match: fmt.Sprintf("toxicity %.2f", score)})
+			}
+		}
+	}
+	return text, violations, blocked
+}
+
+// checkInput applies input rules to every non-assistant message of req.
+func (e *PolicyEngine) checkInput(ctx context.Context, req CompletionRequest) (CompletionRequest, error) {
+	msgs := make([]Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		if msg.Role != RoleAssistant {
+			content, _, err := e.Evaluate(ctx, StageInput, msg.Content)
+			if err != nil {
+				return req, err
+			}
+			msg.Content = content
+		}
+		msgs[i] = msg
+	}
+	req.Messages = msgs
+	return req, nil
+}
+
+// checkOutput redacts each event's content and evaluates the complete answer
+// once the stream ends. Streamed deltas are checked one at a time, so
+// patterns spanning chunks are only caught by the final check; a blocking
+// match there is reported as an error event before Done.
+func (e *PolicyEngine) checkOutput(ctx context.Context, ch <-chan CompletionResponse) <-chan CompletionResponse {
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		var text strings.Builder
+		for resp := range ch {
+			if resp.Done {
+				if _, _, err := e.Evaluate(ctx, StageOutput, text.String()); err != nil && !emit(CompletionResponse{Provider: resp.Provider, Err: err}) {
+					return
+				}
+			} else if resp.Content != "" {
+				text.WriteString(resp.Content)
+				resp.Content = e.redact(resp.Content)
+			}
+			if !emit(resp) {
+				return
+			}
+		}
+	})
+}
+
+// redact applies only the pattern-based redact rules for the output stage.
+func (e *PolicyEngine) redact(text string) string {
+	for _, r := range e.Rules {
+		if r.Action != ActionRedact || (r.Stage != StageBoth && r.Stage != StageOutput) {
+			continue
+		}
+		for _, re := range r.compiled {
+			text = re.ReplaceAllString(text, RedactionText)
+		}
+	}
+	return text
+}
@@ -0,0 +1,166 @@
+package llmagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefetcher pre-generates answers to the questions a user is likely to
+// ask next so they come straight from the response cache. There is no
+// semantic matching: an answer is only served when the client sends the
+// suggested question verbatim, non-streaming, so this pays off for
+// follow-ups picked from a list, e.g. quick-reply buttons. Prefetched
+// completions are billed to ctx's user under the tag "prefetch".
+type Prefetcher struct {
+	N        int    // follow-ups to prefetch; defaults to 3
+	Provider string // suggests the follow-ups; empty uses the agent default
+	Model    string // a cheap model for the suggestions
+	// Delay waits before prefetching, so the user's own next turn isn't
+	// competing with it.
+	Delay time.Duration
+	// Idle, if set, is asked before each prefetched completion; false
+	// skips the rest of the run.
+	Idle func() bool
+	// OnPrefetch reports each prefetched question.
+	OnPrefetch func(question string, err error)
+
+	once sync.Once
+	busy chan struct{} // one run at a time; runs that find it busy are dropped
+}
+
+const followUpPrompt = `Here is a conversation between a user and an assistant:
+
+%s
+List the %d questions the user is most likely to ask next, each short and
+self-contained, phrased as the user would type them.
+Reply with a JSON array of strings only.`
+
+// suggestQuestions asks provider/model for n likely follow-ups to msgs.
+func (a *Agent) suggestQuestions(ctx context.Context, provider, model string, msgs []Message, n int) ([]string, error) {
+	var convo strings.Builder
+	for _, m := range msgs {
+		if m.Role == RoleSystem || m.Role == RoleTool {
+			continue
+		}
+		fmt.Fprintf(&convo, "%s: %s\n\n", m.Role, m.Content)
+	}
+	// like Judge, this bypasses policy and shadowing
+	ch, err := a.complete(ctx, provider, CompletionRequest{
+		Model:       model,
+		Stream:      new(bool),
+		Temperature: Float64(0.3),
+		MaxTokens:   40 * n,
+		Messages:    []Message{User(fmt.Sprintf(followUpPrompt, convo.String(), n))},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := Collect(ch)
+	if err != nil {
+		return nil, err
+	}
+	reply := resp.Content
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("suggestion reply has no JSON array: %q", reply)
+	}
+	var qs []string
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &qs); err != nil {
+		return nil, fmt.Errorf("parse suggestion reply: %w", err)
+	}
+	out := qs[:0]
+	for _, q := range qs {
+		if q = strings.TrimSpace(q); q != "" && len(out) < n {
+			out = append(out, q)
+		}
+	}
+	return out, nil
+}
+
+// PrefetchTag labels prefetched completions in the billing ledger.
+const PrefetchTag = "prefetch"
+
+type prefetchKey struct{}
+
+// prefetching reports whether ctx carries a prefetched request, billed
+// under PrefetchTag.
+func prefetching(ctx context.Context) bool {
+	v, _ := ctx.Value(prefetchKey{}).(bool)
+	return v
+}
+
+// Prefetch suggests follow-ups to req's conversation and its answer, then
+// completes each one non-streaming through provider so the answers land
+// in the cache under the exact request the client will send: req's
+// settings with the answer and the question appended. Like the
+// suggestions, these bypass policy and shadowing; the requests are only
+// sanitized and have their documents rendered, as Complete would, so
+// their cache keys match. It returns the questions it prefetched.
+func (a *Agent) Prefetch(ctx context.Context, p *Prefetcher, provider string, req CompletionRequest, answer string) ([]string, error) {
+	ctx = context.WithValue(ctx, prefetchKey{}, true)
+	n := p.N
+	if n <= 0 {
+		n = 3
+	}
+	convo := append(append([]Message(nil), req.Messages...), Assistant(answer))
+	qs, err := a.suggestQuestions(ctx, p.Provider, p.Model, convo, n)
+	if err != nil {
+		return nil, err
+	}
+	var done []string
+	for _, q := range qs {
+		if ctx.Err() != nil || p.Idle != nil && !p.Idle() {
+			break
+		}
+		follow := req.clone()
+		follow.Stream = Bool(false)
+		follow.Messages = append(append([]Message(nil), convo...), User(q))
+		var err error
+		if a.Sanitize != nil {
+			follow, err = sanitize(follow, *a.Sanitize)
+		}
+		var ch <-chan CompletionResponse
+		if err == nil {
+			ch, err = a.complete(ctx, provider, a.renderDocuments(follow))
+		}
+		if err == nil {
+			_, err = Collect(ch)
+		}
+		if p.OnPrefetch != nil {
+			p.OnPrefetch(q, err)
+		}
+		if err == nil {
+			done = append(done, q)
+		}
+	}
+	return done, nil
+}
+
+// prefetchAfter runs Prefetch in the background after a session turn,
+// unless a run is already going. The context keeps ctx's values (user,
+// tags) but not its cancellation.
+func (a *Agent) prefetchAfter(ctx context.Context, provider string, req CompletionRequest, answer string) {
+	p := a.Prefetcher
+	if p == nil || req.StreamValue() {
+		return
+	}
+	p.once.Do(func() { p.busy = make(chan struct{}, 1) })
+	select {
+	case p.busy <- struct{}{}:
+	default:
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer func() { <-p.busy }()
+		if p.Delay > 0 {
+			t := a.clock().NewTimer(p.Delay)
+			<-t.C()
+		}
+		a.Prefetch(ctx, p, provider, req, answer)
+	}()
+}
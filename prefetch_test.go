@@ -0,0 +1,61 @@
+package llmagent
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPrefetch(t *testing.T) {
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		last := req.Messages[len(req.Messages)-1].Content
+		if strings.Contains(last, "JSON array") {
+			return answer(`["What about B?", "And C?"]`), nil
+		}
+		return answer("re: " + last), nil
+	})
+	a, _ := testAgent(t, p)
+	a.Billing = NewUsageLedger()
+
+	req := CompletionRequest{Messages: []Message{User("Tell me about A")}}
+	ctx := WithUser(context.Background(), "u1")
+	qs, err := a.Prefetch(ctx, &Prefetcher{N: 2}, "p", req, "A is a letter.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(qs, []string{"What about B?", "And C?"}) {
+		t.Fatalf("prefetched %q", qs)
+	}
+	usage := a.Billing.Snapshot()
+	if len(usage) != 1 || usage[0].Tenant != "u1" || usage[0].Tags != PrefetchTag || usage[0].Requests != 3 {
+		t.Fatalf("billed %+v, want 3 requests of u1 under %q", usage, PrefetchTag)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		question string
+		stream   bool
+		cached   bool
+	}{
+		{name: "verbatim follow-up", question: "What about B?", cached: true},
+		{name: "paraphrased follow-up", question: "what about b", cached: false},
+		{name: "streaming follow-up", question: "And C?", stream: true, cached: false},
+	} {
+		follow := CompletionRequest{Stream: Bool(tc.stream), Messages: []Message{
+			User("Tell me about A"), Assistant("A is a letter."), User(tc.question),
+		}}
+		calls := p.calls.Load()
+		ch, err := a.Complete(context.Background(), "p", follow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := Collect(ch)
+		if err != nil || resp.Content != "re: "+tc.question {
+			t.Fatalf("%s: answer = %q, %v", tc.name, resp.Content, err)
+		}
+		if cached := p.calls.Load() == calls; cached != tc.cached {
+			t.Errorf("%s: served from cache = %v, want %v", tc.name, cached, tc.cached)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package llmagent
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testProvider is the fake Provider the tests share: it answers the nth
+// call (from 1) with fn. The embedded KeyHolder lets key rotation tests
+// pool keys on it.
+type testProvider struct {
+	KeyHolder
+	name  string
+	cfg   ProviderConfig
+	calls atomic.Int32
+	fn    func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error)
+}
+
+func newTestProvider(name string, fn func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error)) *testProvider {
+	return &testProvider{name: name, fn: fn}
+}
+
+func (p *testProvider) Name() string               { return p.name }
+func (p *testProvider) GetConfig() *ProviderConfig { return &p.cfg }
+
+func (p *testProvider) Complete(ctx context.Context, req CompletionRequest) (<-chan CompletionResponse, error) {
+	return p.fn(ctx, req, int(p.calls.Add(1)))
+}
+
+// answer streams content followed by a Done event.
+func answer(content string) <-chan CompletionResponse {
+	ch := make(chan CompletionResponse, 2)
+	ch <- CompletionResponse{Content: content, Role: RoleAssistant}
+	ch <- CompletionResponse{Done: true, FinishReason: FinishStop}
+	close(ch)
+	return ch
+}
+
+// testAgent registers ps on an agent running on a FakeClock, with ps[0]
+// as the default provider. Providers without a default model get "m".
+func testAgent(t *testing.T, ps ...*testProvider) (*Agent, *FakeClock) {
+	t.Helper()
+	a := NewAgent()
+	for _, p := range ps {
+		if p.cfg.DefaultModel == "" {
+			p.cfg.DefaultModel = "m"
+		}
+		if err := a.RegisterProvidersFromUser(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.SetDefault(ps[0].name); err != nil {
+		t.Fatal(err)
+	}
+	clock := NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	a.Clock = clock
+	return a, clock
+}
+
+// complete sends one non-streaming request to provider and collects it.
+func complete(a *Agent, provider string) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		ch, err := a.Complete(context.Background(), provider, CompletionRequest{
+			Stream:   new(bool),
+			Messages: []Message{{Role: RoleUser, Content: "hi"}},
+		})
+		if err == nil {
+			_, err = Collect(ch)
+		}
+		done <- err
+	}()
+	return done
+}
@@ -2,11 +2,10 @@
 package providers
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -16,13 +15,14 @@ import (
 )
 
 type ClaudeProvider struct {
-	apiKey     string
+	llmagent.KeyHolder
 	cfg        *llmagent.ProviderConfig
 	httpClient *http.Client
 }
 
 func NewClaude(apiKey string, opts ...llmagent.Option) *ClaudeProvider {
-	p := &ClaudeProvider{apiKey: apiKey}
+	p := &ClaudeProvider{}
+	p.SetAPIKey(apiKey)
 	cfg := &llmagent.ProviderConfig{
 		BaseURL: "https://api.anthropic.com",
 		Timeout: 30 * time.Second,
@@ -35,7 +35,8 @@ func NewClaude(apiKey string, opts ...llmagent.Option) *ClaudeProvider {
 	}
 	cfg.SupportedModels = []string{"claude-3-opus-20240229", "claude-3-sonnet-20240229"} // Updated models
 	p.cfg = cfg
-	p.httpClient = &http.Client{Timeout: p.cfg.Timeout}
+	p.Clock = cfg.Clock
+	p.httpClient = cfg.HTTPClient()
 	return p
 }
 
@@ -47,8 +48,13 @@ func (c *ClaudeProvider) GetConfig() *llmagent.ProviderConfig {
 	return c.cfg
 }
 
+// Warmup opens a pooled connection to the API endpoint.
+func (c *ClaudeProvider) Warmup(ctx context.Context) error {
+	return llmagent.WarmupHTTP(ctx, c.httpClient, c.cfg.BaseURL)
+}
+
 func (c *ClaudeProvider) Complete(ctx context.Context, req llmagent.CompletionRequest) (<-chan llmagent.CompletionResponse, error) {
-	if c.apiKey == "" {
+	if c.APIKey() == "" {
 		return nil, errors.New("API key is required")
 	}
 	if req.Model == "" {
@@ -57,7 +63,7 @@ func (c *ClaudeProvider) Complete(ctx context.Context, req llmagent.CompletionRe
 	if req.Stream == nil && c.cfg.DefaultStream != nil {
 		req.Stream = c.cfg.DefaultStream
 	}
-	if req.Temperature == 0 {
+	if req.Temperature == nil {
 		req.Temperature = c.cfg.DefaultTemperature
 	}
 	if req.MaxTokens == 0 {
@@ -66,104 +72,280 @@ func (c *ClaudeProvider) Complete(ctx context.Context, req llmagent.CompletionRe
 			req.MaxTokens = 200
 		}
 	}
-	if req.TopP == 0 {
+	if req.TopP == nil {
 		req.TopP = c.cfg.DefaultTopP
 	}
+	req = c.cfg.ApplyParamRules(c.Name(), req)
+	if err := c.cfg.CheckRequestSize(req); err != nil {
+		return nil, err
+	}
+	if err := c.cfg.CheckExtra(c.Name(), req); err != nil {
+		return nil, err
+	}
+	if err := req.ToolChoice.Check(c.Name()); err != nil {
+		return nil, err
+	}
+	apiKey, release := c.AcquireKey(ctx)
 	out := make(chan llmagent.CompletionResponse)
 	go func() {
 		defer close(out)
-		payload := map[string]any{
-			"model":       req.Model,
-			"max_tokens":  req.MaxTokens,
-			"temperature": req.Temperature,
-			"stream":      req.StreamValue(),
+		defer func() { release() }()
+		body := anthropicRequest{
+			Model:       req.Model,
+			MaxTokens:   req.MaxTokens,
+			Stream:      req.StreamValue(),
+			Temperature: req.Temperature,
+			TopP:        req.TopP,
+			Messages:    anthropicMessages(req.Messages),
+		}
+		if len(req.Tools) > 0 {
+			body.Tools = anthropicTools(req.Tools)
+		}
+		if hasTools(req) && (req.ToolChoice != nil || req.ParallelToolCalls != nil) {
+			body.ToolChoice = anthropicToolChoice(req.ToolChoice, req.ParallelToolCalls)
 		}
-		var systemMsg string
-		var msgs []map[string]any
 		for _, msg := range req.Messages {
-			if msg.Role == "system" {
-				systemMsg = msg.Content
-			} else {
-				m := map[string]any{
-					"role":    msg.Role,
-					"content": msg.Content,
-				}
-				if msg.Name != "" {
-					m["name"] = msg.Name
-				}
-				msgs = append(msgs, m)
+			if msg.Role == llmagent.RoleSystem {
+				body.System = msg.Content
 			}
 		}
-		if systemMsg != "" {
-			payload["system"] = systemMsg
+		// the Messages API has no seed parameter; req.Seed is ignored
+		payload, err := withExtra(body, req.Extra)
+		if err != nil {
+			send(ctx, out, llmagent.CompletionResponse{Err: err})
+			return
 		}
-		payload["messages"] = msgs
-		client := claude.NewClient(c.apiKey, c.cfg.BaseURL, "/v1/messages", c.cfg.Timeout, c.cfg.DefaultModel, c.cfg.SupportedModels)
+		client := claude.NewClient(apiKey, c.cfg.BaseURL, "/v1/messages", c.cfg.Timeout, c.cfg.DefaultModel, c.cfg.SupportedModels)
+		client.HttpClient = c.httpClient
+		client.GzipThreshold = c.cfg.GzipRequestsAbove
+		client.MaxResponseBytes = c.cfg.MaxResponseBytes
+		opts := llmagent.OptionsFor[llmagent.AnthropicOptions](c.cfg)
+		client.Version, client.Beta = opts.Version, opts.Beta
 		bodyRc, err := client.Complete(ctx, payload)
+		// on a rate limit or quota error, move on to the next pooled key
+		for err != nil {
+			next, nextRelease, ok := c.Failover(ctx, client.APIKey, err)
+			if !ok {
+				break
+			}
+			release()
+			release, client.APIKey = nextRelease, next
+			bodyRc, err = client.Complete(ctx, payload)
+		}
 		if err != nil {
-			out <- llmagent.CompletionResponse{Err: err}
+			send(ctx, out, llmagent.CompletionResponse{Err: err})
 			return
 		}
 		defer bodyRc.Close()
+		if meta := llmagent.ParseResponseMeta(llmagent.ResponseHeader(bodyRc), c.cfg.Now()); meta != nil {
+			if !send(ctx, out, llmagent.CompletionResponse{Meta: meta}) {
+				return
+			}
+		}
 
 		if !req.StreamValue() {
 			var r struct {
 				Content []struct {
-					Type string `json:"type"`
-					Text string `json:"text"`
+					Type  string          `json:"type"`
+					Text  string          `json:"text"`
+					ID    string          `json:"id"`    // tool_use
+					Name  string          `json:"name"`  // tool_use
+					Input json.RawMessage `json:"input"` // tool_use
 				} `json:"content"`
+				Usage struct {
+					InputTokens              int             `json:"input_tokens"`
+					OutputTokens             int             `json:"output_tokens"`
+					CacheCreationInputTokens json.RawMessage `json:"cache_creation_input_tokens"`
+					CacheReadInputTokens     json.RawMessage `json:"cache_read_input_tokens"`
+					CacheCreation            json.RawMessage `json:"cache_creation"`
+					ServiceTier              json.RawMessage `json:"service_tier"`
+				} `json:"usage"`
+				Role       llmagent.Role `json:"role"`
+				StopReason string        `json:"stop_reason"`
+				// known but unused; declared for the drift monitor
+				ID           json.RawMessage `json:"id"`
+				Type         json.RawMessage `json:"type"`
+				Model        json.RawMessage `json:"model"`
+				StopSequence json.RawMessage `json:"stop_sequence"`
+			}
+			b, err := llmagent.ReadBody(bodyRc, c.cfg.MaxResponseBytes)
+			if err != nil {
+				send(ctx, out, llmagent.CompletionResponse{Err: err})
+				return
 			}
-			b, _ := io.ReadAll(bodyRc)
-			if err := json.Unmarshal(b, &r); err != nil {
-				out <- llmagent.CompletionResponse{Err: err}
+			if err := c.cfg.DecodeResponse(c.Name(), "completion", b, &r); err != nil {
+				send(ctx, out, llmagent.CompletionResponse{Err: err})
 			} else if len(r.Content) > 0 {
 				var text string
+				var toolCalls []llmagent.ToolCall
 				for _, content := range r.Content {
-					if content.Type == "text" {
+					switch content.Type {
+					case "text":
 						text += content.Text
+					case "tool_use":
+						toolCalls = append(toolCalls, llmagent.ToolCall{ID: content.ID, Name: content.Name, Arguments: toolArgs(content.Input)})
 					}
 				}
-				out <- llmagent.CompletionResponse{Content: text}
+				send(ctx, out, llmagent.CompletionResponse{Content: text, Role: r.Role, ToolCalls: toolCalls, FinishReason: llmagent.ParseFinishReason(c.Name(), r.StopReason), Usage: &llmagent.Usage{
+					PromptTokens:     r.Usage.InputTokens,
+					CompletionTokens: r.Usage.OutputTokens,
+					TotalTokens:      r.Usage.InputTokens + r.Usage.OutputTokens,
+				}})
 			}
 			return
 		}
 		// Modified streaming event handling for Anthropic
 		var buffer string
-		reader := bufio.NewReader(bodyRc)
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				if err != io.EOF {
-					out <- llmagent.CompletionResponse{Err: err}
-				}
-				break
-			}
-			line = strings.TrimSpace(line)
-			if line == "" {
+		var received int
+		var usage llmagent.Usage
+		var role llmagent.Role
+		// tool_use blocks stream their input as JSON fragments and are
+		// emitted whole when the block stops
+		tools := map[float64]*claudeToolUse{}
+		sr := llmagent.NewSSEReader(bodyRc)
+		defer sr.Release()
+		for sr.Next() {
+			var event map[string]any
+			if err := json.Unmarshal(sr.Event().Data, &event); err != nil {
 				continue
 			}
-			// Handle Server-Sent Events with "data:" prefix.
-			if strings.HasPrefix(line, "data: ") {
-				jsonPart := strings.TrimPrefix(line, "data: ")
-				var event map[string]any
-				if err := json.Unmarshal([]byte(jsonPart), &event); err != nil {
-					continue
+			evtType, _ := event["type"].(string)
+			switch evtType {
+			case "message_start":
+				if msg, ok := event["message"].(map[string]any); ok {
+					usage.PromptTokens, _ = claudeUsage(msg["usage"])
+					if r, ok := msg["role"].(string); ok {
+						role = llmagent.Role(r)
+					}
 				}
-				evtType, _ := event["type"].(string)
-				switch evtType {
-				case "content_block_delta":
-					if delta, ok := event["delta"].(map[string]any); ok {
-						if text, ok := delta["text"].(string); ok {
-							buffer += text
-							out <- llmagent.CompletionResponse{Content: text}
+			case "message_delta":
+				_, usage.CompletionTokens = claudeUsage(event["usage"])
+				if delta, ok := event["delta"].(map[string]any); ok {
+					if stop, ok := delta["stop_reason"].(string); ok {
+						if !send(ctx, out, llmagent.CompletionResponse{FinishReason: llmagent.ParseFinishReason(c.Name(), stop)}) {
+							return
 						}
 					}
-				case "message_stop":
-					// End of message.
-					break
 				}
+			case "content_block_start":
+				block, _ := event["content_block"].(map[string]any)
+				if block["type"] == "tool_use" {
+					index, _ := event["index"].(float64)
+					id, _ := block["id"].(string)
+					name, _ := block["name"].(string)
+					tools[index] = &claudeToolUse{id: id, name: name}
+				}
+			case "content_block_stop":
+				index, _ := event["index"].(float64)
+				if tu, ok := tools[index]; ok {
+					delete(tools, index)
+					call, err := tu.call()
+					if err != nil {
+						send(ctx, out, llmagent.CompletionResponse{Err: err})
+						return
+					}
+					if !send(ctx, out, llmagent.CompletionResponse{ToolCalls: []llmagent.ToolCall{call}}) {
+						return
+					}
+				}
+			case "content_block_delta":
+				if delta, ok := event["delta"].(map[string]any); ok {
+					if partial, ok := delta["partial_json"].(string); ok {
+						index, _ := event["index"].(float64)
+						if tu, ok := tools[index]; ok {
+							tu.input.WriteString(partial)
+							received += len(partial)
+							if err := c.cfg.CheckResponseSize(received); err != nil {
+								send(ctx, out, llmagent.CompletionResponse{Err: err})
+								return
+							}
+						}
+					}
+					if text, ok := delta["text"].(string); ok {
+						buffer += text
+						received += len(text)
+						if err := c.cfg.CheckResponseSize(received); err != nil {
+							send(ctx, out, llmagent.CompletionResponse{Err: err})
+							return
+						}
+						if !send(ctx, out, llmagent.CompletionResponse{Content: text, Role: role}) {
+							return
+						}
+					}
+				}
+			case "message_stop":
+				// End of message.
+				usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+				if !send(ctx, out, llmagent.CompletionResponse{Usage: &usage}) {
+					return
+				}
+			case "error":
+				// e.g. overloaded_error mid-stream: the answer is truncated
+				send(ctx, out, llmagent.CompletionResponse{Err: claudeStreamError(sr.Event().Data), FinishReason: llmagent.FinishError})
+				return
+			case "ping":
+			default:
+				c.cfg.ReportDrift(c.Name(), "event", "type="+evtType)
 			}
 		}
+		if err := sr.Err(); err != nil {
+			send(ctx, out, llmagent.CompletionResponse{Err: err})
+		}
 	}()
 	return out, nil
 }
+
+// claudeStreamError turns an error event of a stream into the *APIError
+// the same failure returns before streaming starts, with the status code
+// Anthropic documents for its type so retries and failover classify it.
+func claudeStreamError(data []byte) error {
+	var ev struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	json.Unmarshal(data, &ev)
+	code := http.StatusInternalServerError
+	switch ev.Error.Type {
+	case "invalid_request_error":
+		code = http.StatusBadRequest
+	case "authentication_error":
+		code = http.StatusUnauthorized
+	case "permission_error":
+		code = http.StatusForbidden
+	case "not_found_error":
+		code = http.StatusNotFound
+	case "request_too_large":
+		code = http.StatusRequestEntityTooLarge
+	case "rate_limit_error":
+		code = http.StatusTooManyRequests
+	case "overloaded_error":
+		code = 529
+	}
+	return &claude.APIError{StatusCode: code, Body: string(data)}
+}
+
+// claudeToolUse accumulates a streamed tool_use block.
+type claudeToolUse struct {
+	id, name string
+	input    strings.Builder
+}
+
+func (t *claudeToolUse) call() (llmagent.ToolCall, error) {
+	args := json.RawMessage(t.input.String())
+	if len(args) > 0 && !json.Valid(args) {
+		return llmagent.ToolCall{}, fmt.Errorf("tool call %q (%s): malformed arguments %q", t.name, t.id, args)
+	}
+	return llmagent.ToolCall{ID: t.id, Name: t.name, Arguments: toolArgs(args)}, nil
+}
+
+// claudeUsage reads input/output token counts from a decoded usage object.
+func claudeUsage(v any) (input, output int) {
+	u, ok := v.(map[string]any)
+	if !ok {
+		return 0, 0
+	}
+	in, _ := u["input_tokens"].(float64)
+	out, _ := u["output_tokens"].(float64)
+	return int(in), int(out)
+}
@@ -0,0 +1,52 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Rate limit resets sent as durations resolve against the provider's
+// Clock, not the wall clock.
+func TestRateLimitResetUsesClock(t *testing.T) {
+	body, err := os.ReadFile("testdata/finish/openai_length.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "99")
+		w.Header().Set("X-Ratelimit-Reset-Requests", "1m30s")
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := NewOpenAI("key", llmagent.WithBaseURL(srv.URL), llmagent.WithClock(llmagent.NewFakeClock(now)))
+	ch, err := p.Complete(context.Background(), llmagent.CompletionRequest{
+		Messages: []llmagent.Message{{Role: llmagent.RoleUser, Content: "hi"}},
+		Stream:   llmagent.Bool(false),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rl *llmagent.RateLimit
+	for resp := range ch {
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+		if resp.Meta != nil {
+			rl = resp.Meta.RateLimit
+		}
+	}
+	if rl == nil {
+		t.Fatal("no rate limit in the response meta")
+	}
+	if want := now.Add(90 * time.Second); !rl.ResetRequests.Equal(want) {
+		t.Fatalf("ResetRequests = %v, want %v", rl.ResetRequests, want)
+	}
+}
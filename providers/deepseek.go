@@ -2,11 +2,9 @@
 package providers
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
-	"io"
 	"net/http"
 	"time"
 
@@ -15,13 +13,14 @@ import (
 )
 
 type DeepSeekProvider struct {
-	apiKey     string
+	llmagent.KeyHolder
 	cfg        *llmagent.ProviderConfig
 	httpClient *http.Client
 }
 
 func NewDeepSeek(apiKey string, opts ...llmagent.Option) *DeepSeekProvider {
-	p := &DeepSeekProvider{apiKey: apiKey}
+	p := &DeepSeekProvider{}
+	p.SetAPIKey(apiKey)
 	cfg := &llmagent.ProviderConfig{
 		BaseURL: "https://api.deepseek.com",
 		Timeout: 30 * time.Second,
@@ -35,7 +34,8 @@ func NewDeepSeek(apiKey string, opts ...llmagent.Option) *DeepSeekProvider {
 	}
 	cfg.SupportedModels = []string{"deepseek-chat", "deepseek-text"}
 	p.cfg = cfg
-	p.httpClient = &http.Client{Timeout: p.cfg.Timeout}
+	p.Clock = cfg.Clock
+	p.httpClient = cfg.HTTPClient()
 	return p
 }
 
@@ -47,8 +47,13 @@ func (c *DeepSeekProvider) GetConfig() *llmagent.ProviderConfig {
 	return c.cfg
 }
 
+// Warmup opens a pooled connection to the API endpoint.
+func (d *DeepSeekProvider) Warmup(ctx context.Context) error {
+	return llmagent.WarmupHTTP(ctx, d.httpClient, d.cfg.BaseURL)
+}
+
 func (d *DeepSeekProvider) Complete(ctx context.Context, req llmagent.CompletionRequest) (<-chan llmagent.CompletionResponse, error) {
-	if d.apiKey == "" {
+	if d.APIKey() == "" {
 		return nil, errors.New("API key is required")
 	}
 	if req.Model == "" {
@@ -57,7 +62,7 @@ func (d *DeepSeekProvider) Complete(ctx context.Context, req llmagent.Completion
 	if req.Stream == nil && d.cfg.DefaultStream != nil {
 		req.Stream = d.cfg.DefaultStream
 	}
-	if req.Temperature == 0 {
+	if req.Temperature == nil {
 		req.Temperature = d.cfg.DefaultTemperature
 	}
 	if req.MaxTokens == 0 {
@@ -66,55 +71,132 @@ func (d *DeepSeekProvider) Complete(ctx context.Context, req llmagent.Completion
 			req.MaxTokens = 200
 		}
 	}
-	if req.TopP == 0 {
+	if req.TopP == nil {
 		req.TopP = d.cfg.DefaultTopP
 	}
-	if req.TopP == 0 {
-		req.TopP = 1.0
+	if req.TopP == nil {
+		req.TopP = llmagent.Float64(1.0)
+	}
+	req = d.cfg.ApplyParamRules(d.Name(), req)
+	if err := d.cfg.CheckRequestSize(req); err != nil {
+		return nil, err
+	}
+	if err := d.cfg.CheckExtra(d.Name(), req); err != nil {
+		return nil, err
 	}
+	if err := req.ToolChoice.Check(d.Name()); err != nil {
+		return nil, err
+	}
+	apiKey, release := d.AcquireKey(ctx)
 	out := make(chan llmagent.CompletionResponse)
 	go func() {
 		defer close(out)
-		payload := map[string]any{
-			"model":       req.Model,
-			"messages":    req.Messages,
-			"stream":      *req.Stream,
-			"temperature": req.Temperature,
-			"max_tokens":  req.MaxTokens,
-			"top_p":       req.TopP,
-			// add stop if provided
-			"stop": req.Stop,
+		defer func() { release() }()
+		body := openaiRequest{
+			Model:       req.Model,
+			Messages:    openaiMessages(req.Messages),
+			Stream:      req.StreamValue(),
+			MaxTokens:   req.MaxTokens,
+			Stop:        req.Stop,
+			Temperature: req.Temperature,
+			TopP:        req.TopP,
+			Seed:        req.Seed,
+		}
+		if len(req.Tools) > 0 {
+			body.Tools = openaiTools(req.Tools)
+		}
+		// DeepSeek has no parallel_tool_calls switch
+		if hasTools(req) && req.ToolChoice != nil {
+			body.ToolChoice = openaiToolChoice(req.ToolChoice)
 		}
-		client := deepseek.NewClient(d.apiKey, d.cfg.BaseURL, "/chat/completions", d.cfg.Timeout, d.cfg.DefaultModel, d.cfg.SupportedModels)
+		payload, err := withExtra(body, req.Extra)
+		if err != nil {
+			send(ctx, out, llmagent.CompletionResponse{Err: err})
+			return
+		}
+		client := deepseek.NewClient(apiKey, d.cfg.BaseURL, "/chat/completions", d.cfg.Timeout, d.cfg.DefaultModel, d.cfg.SupportedModels)
+		client.HttpClient = d.httpClient
+		client.GzipThreshold = d.cfg.GzipRequestsAbove
+		client.MaxResponseBytes = d.cfg.MaxResponseBytes
 		bodyRc, err := client.ChatCompletion(ctx, payload)
+		// on a rate limit or quota error, move on to the next pooled key
+		for err != nil {
+			next, nextRelease, ok := d.Failover(ctx, client.APIKey, err)
+			if !ok {
+				break
+			}
+			release()
+			release, client.APIKey = nextRelease, next
+			bodyRc, err = client.ChatCompletion(ctx, payload)
+		}
 		if err != nil {
-			out <- llmagent.CompletionResponse{Err: err}
+			send(ctx, out, llmagent.CompletionResponse{Err: err})
 			return
 		}
 		defer bodyRc.Close()
-		if !req.StreamValue() {
-			var r struct {
-				Text string `json:"text"`
+		if meta := llmagent.ParseResponseMeta(llmagent.ResponseHeader(bodyRc), d.cfg.Now()); meta != nil {
+			if !send(ctx, out, llmagent.CompletionResponse{Meta: meta}) {
+				return
 			}
-			b, _ := io.ReadAll(bodyRc)
-			if err := json.Unmarshal(b, &r); err != nil {
-				out <- llmagent.CompletionResponse{Err: err}
-			} else {
-				out <- llmagent.CompletionResponse{Content: r.Text}
-			}
-			return
 		}
-		reader := bufio.NewReader(bodyRc)
-		for {
-			chunk, err := reader.ReadBytes('\n')
+		if !req.StreamValue() {
+			var res struct {
+				openaiEnvelope
+				Choices []struct {
+					Message struct {
+						llmagent.Message
+						ToolCalls        []openaiToolCall `json:"tool_calls"`
+						ReasoningContent json.RawMessage  `json:"reasoning_content"`
+					} `json:"message"`
+					Logprobs     *openaiLogprobs `json:"logprobs"`
+					Index        json.RawMessage `json:"index"`
+					FinishReason string          `json:"finish_reason"`
+				} `json:"choices"`
+				Usage *deepseekUsage `json:"usage"`
+			}
+			b, err := llmagent.ReadBody(bodyRc, d.cfg.MaxResponseBytes)
 			if err != nil {
-				if err != io.EOF {
-					out <- llmagent.CompletionResponse{Err: err}
+				send(ctx, out, llmagent.CompletionResponse{Err: err})
+				return
+			}
+			if err := d.cfg.DecodeResponse(d.Name(), "completion", b, &res); err != nil {
+				send(ctx, out, llmagent.CompletionResponse{Err: err})
+				return
+			}
+			if len(res.Choices) > 0 {
+				choice := res.Choices[0]
+				var calls openaiToolCalls
+				for _, tc := range choice.Message.ToolCalls {
+					calls.add(tc)
 				}
-				break
+				toolCalls, err := calls.complete()
+				if err != nil {
+					send(ctx, out, llmagent.CompletionResponse{Err: err})
+					return
+				}
+				resp := llmagent.CompletionResponse{
+					Content:      choice.Message.Content,
+					Role:         choice.Message.Role,
+					Logprobs:     choice.Logprobs.tokens(),
+					ToolCalls:    toolCalls,
+					FinishReason: llmagent.ParseFinishReason(d.Name(), choice.FinishReason),
+				}
+				if res.Usage != nil {
+					resp.Usage = res.Usage.usage()
+				}
+				send(ctx, out, resp)
 			}
-			out <- llmagent.CompletionResponse{Content: string(chunk)}
+			return
 		}
+		streamChatChunks(ctx, d.cfg, d.Name(), bodyRc, out)
 	}()
 	return out, nil
 }
+
+// deepseekUsage adds DeepSeek's context cache counters to the OpenAI usage
+// block.
+type deepseekUsage struct {
+	openaiUsage
+	PromptCacheHitTokens  json.RawMessage `json:"prompt_cache_hit_tokens"`
+	PromptCacheMissTokens json.RawMessage `json:"prompt_cache_miss_tokens"`
+}
@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// The fixtures in testdata/finish are provider responses as captured on
+// the wire, named <provider>_<signal>.json for complete responses and
+// .sse for event streams.
+func TestFinishFixtures(t *testing.T) {
+	want := map[string]llmagent.FinishReason{
+		"openai_stop.sse":                           llmagent.FinishStop,
+		"openai_tool_calls.sse":                     llmagent.FinishToolCalls,
+		"openai_length.json":                        llmagent.FinishLength,
+		"openai_content_filter.json":                llmagent.FinishContentFilter,
+		"deepseek_stop.json":                        llmagent.FinishStop,
+		"deepseek_insufficient_system_resource.sse": llmagent.FinishError,
+		"claude_end_turn.json":                      llmagent.FinishStop,
+		"claude_pause_turn.json":                    llmagent.FinishPaused,
+		"claude_max_tokens.sse":                     llmagent.FinishLength,
+		"claude_tool_use.sse":                       llmagent.FinishToolCalls,
+		"claude_refusal.sse":                        llmagent.FinishContentFilter,
+	}
+	files, err := filepath.Glob("testdata/finish/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(want) {
+		t.Fatalf("%d fixtures, %d expectations", len(files), len(want))
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			reason, ok := want[name]
+			if !ok {
+				t.Fatal("no expectation for fixture")
+			}
+			body, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stream := strings.HasSuffix(name, ".sse")
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if stream {
+					w.Header().Set("Content-Type", "text/event-stream")
+				}
+				w.Write(body)
+			}))
+			defer srv.Close()
+
+			opts := []llmagent.Option{
+				llmagent.WithBaseURL(srv.URL),
+				llmagent.WithDriftMonitor(&llmagent.DriftMonitor{OnDrift: func(ev llmagent.DriftEvent) {
+					t.Errorf("fixture drifted: %s", ev)
+				}}),
+			}
+			var p llmagent.Provider
+			switch provider, _, _ := strings.Cut(name, "_"); provider {
+			case "openai":
+				p = NewOpenAI("key", opts...)
+			case "deepseek":
+				p = NewDeepSeek("key", opts...)
+			case "claude":
+				p = NewClaude("key", opts...)
+			default:
+				t.Fatalf("unknown provider %q", provider)
+			}
+			ch, err := p.Complete(context.Background(), llmagent.CompletionRequest{
+				Messages: []llmagent.Message{{Role: llmagent.RoleUser, Content: "hi"}},
+				Stream:   llmagent.Bool(stream),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []llmagent.FinishReason
+			for resp := range ch {
+				if resp.Err != nil {
+					t.Fatal(resp.Err)
+				}
+				if resp.FinishReason != "" {
+					got = append(got, resp.FinishReason)
+				}
+			}
+			if len(got) != 1 || got[0] != reason {
+				t.Fatalf("finish reasons = %q, want [%q]", got, reason)
+			}
+		})
+	}
+}
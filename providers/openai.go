@@ -2,11 +2,10 @@
 package providers
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"time"
@@ -16,14 +15,15 @@ import (
 )
 
 type OpenAIProvider struct {
-	apiKey     string
+	llmagent.KeyHolder
 	cfg        *llmagent.ProviderConfig
 	httpClient *http.Client
 }
 
 // NewOpenAI constructs a new OpenAIProvider with the given API key and options.
 func NewOpenAI(apiKey string, opts ...llmagent.Option) *OpenAIProvider {
-	p := &OpenAIProvider{apiKey: apiKey}
+	p := &OpenAIProvider{}
+	p.SetAPIKey(apiKey)
 	cfg := &llmagent.ProviderConfig{
 		BaseURL: "https://api.openai.com",
 		Timeout: 30 * time.Second,
@@ -37,7 +37,8 @@ func NewOpenAI(apiKey string, opts ...llmagent.Option) *OpenAIProvider {
 	}
 	cfg.SupportedModels = []string{"gpt-3.5-turbo", "gpt-4"}
 	p.cfg = cfg
-	p.httpClient = &http.Client{Timeout: p.cfg.Timeout}
+	p.Clock = cfg.Clock
+	p.httpClient = cfg.HTTPClient()
 	return p
 }
 
@@ -49,8 +50,13 @@ func (c *OpenAIProvider) GetConfig() *llmagent.ProviderConfig {
 	return c.cfg
 }
 
+// Warmup opens a pooled connection to the API endpoint.
+func (o *OpenAIProvider) Warmup(ctx context.Context) error {
+	return llmagent.WarmupHTTP(ctx, o.httpClient, o.cfg.BaseURL)
+}
+
 func (o *OpenAIProvider) Complete(ctx context.Context, req llmagent.CompletionRequest) (<-chan llmagent.CompletionResponse, error) {
-	if o.apiKey == "" {
+	if o.APIKey() == "" {
 		return nil, errors.New("API key is required")
 	}
 	// Use defaults from config if not provided by request
@@ -60,7 +66,7 @@ func (o *OpenAIProvider) Complete(ctx context.Context, req llmagent.CompletionRe
 	if req.Stream == nil && o.cfg.DefaultStream != nil {
 		req.Stream = o.cfg.DefaultStream
 	}
-	if req.Temperature == 0 {
+	if req.Temperature == nil {
 		req.Temperature = o.cfg.DefaultTemperature
 	}
 	if req.MaxTokens == 0 {
@@ -69,69 +75,314 @@ func (o *OpenAIProvider) Complete(ctx context.Context, req llmagent.CompletionRe
 			req.MaxTokens = 200
 		}
 	}
-	if req.TopP == 0 {
+	if req.TopP == nil {
 		req.TopP = o.cfg.DefaultTopP
 	}
+	req = o.cfg.ApplyParamRules(o.Name(), req)
+	if err := o.cfg.CheckRequestSize(req); err != nil {
+		return nil, err
+	}
+	if err := o.cfg.CheckExtra(o.Name(), req); err != nil {
+		return nil, err
+	}
+	if err := req.ToolChoice.Check(o.Name()); err != nil {
+		return nil, err
+	}
+	apiKey, release := o.AcquireKey(ctx)
 	out := make(chan llmagent.CompletionResponse)
 	go func() {
 		defer close(out)
-		payload := map[string]any{
-			"model":       req.Model,
-			"messages":    req.Messages,
-			"stream":      *req.Stream,
-			"temperature": req.Temperature,
-			"max_tokens":  req.MaxTokens,
-			"top_p":       req.TopP,
-			// add stop if provided
-			"stop": req.Stop,
-		}
-		client := openai.NewClient(o.apiKey, o.cfg.BaseURL, "/v1/chat/completions", o.cfg.Timeout, o.cfg.DefaultModel, o.cfg.SupportedModels)
+		defer func() { release() }()
+		body := openaiRequest{
+			Model:       req.Model,
+			Messages:    openaiMessages(req.Messages),
+			Stream:      req.StreamValue(),
+			MaxTokens:   req.MaxTokens,
+			Stop:        req.Stop,
+			Temperature: req.Temperature,
+			TopP:        req.TopP,
+			Seed:        req.Seed,
+			Logprobs:    req.Logprobs,
+		}
+		if len(req.Tools) > 0 {
+			body.Tools = openaiTools(req.Tools)
+		}
+		if hasTools(req) {
+			if req.ToolChoice != nil {
+				body.ToolChoice = openaiToolChoice(req.ToolChoice)
+			}
+			body.ParallelToolCalls = req.ParallelToolCalls
+		}
+		if req.StreamValue() {
+			// ask for a final chunk carrying token usage
+			body.StreamOptions = &openaiStreamOptions{IncludeUsage: true}
+		}
+		payload, err := withExtra(body, req.Extra)
+		if err != nil {
+			send(ctx, out, llmagent.CompletionResponse{Err: err})
+			return
+		}
+		client := openai.NewClient(apiKey, o.cfg.BaseURL, "/v1/chat/completions", o.cfg.Timeout, o.cfg.DefaultModel, o.cfg.SupportedModels)
+		client.HttpClient = o.httpClient
+		client.GzipThreshold = o.cfg.GzipRequestsAbove
+		client.MaxResponseBytes = o.cfg.MaxResponseBytes
+		opts := llmagent.OptionsFor[llmagent.OpenAIOptions](o.cfg)
+		client.Organization, client.Project = opts.Organization, opts.Project
 		bodyRc, err := client.ChatCompletion(ctx, payload)
+		// on a rate limit or quota error, move on to the next pooled key
+		for err != nil {
+			next, nextRelease, ok := o.Failover(ctx, client.APIKey, err)
+			if !ok {
+				break
+			}
+			release()
+			release, client.APIKey = nextRelease, next
+			bodyRc, err = client.ChatCompletion(ctx, payload)
+		}
 		if err != nil {
-			out <- llmagent.CompletionResponse{Err: err}
+			send(ctx, out, llmagent.CompletionResponse{Err: err})
 			return
 		}
 		defer bodyRc.Close()
+		if meta := llmagent.ParseResponseMeta(llmagent.ResponseHeader(bodyRc), o.cfg.Now()); meta != nil {
+			if !send(ctx, out, llmagent.CompletionResponse{Meta: meta}) {
+				return
+			}
+		}
 		if !req.StreamValue() {
 			var res struct {
+				openaiEnvelope
 				Choices []struct {
-					Message llmagent.Message `json:"message"`
+					Message struct {
+						llmagent.Message
+						ToolCalls   []openaiToolCall `json:"tool_calls"`
+						Refusal     json.RawMessage  `json:"refusal"`
+						Annotations json.RawMessage  `json:"annotations"`
+					} `json:"message"`
+					Logprobs     *openaiLogprobs `json:"logprobs"`
+					Index        json.RawMessage `json:"index"`
+					FinishReason string          `json:"finish_reason"`
 				} `json:"choices"`
+				Usage *openaiUsage `json:"usage"`
 			}
-			b, _ := io.ReadAll(bodyRc)
-			if err := json.Unmarshal(b, &res); err != nil {
-				out <- llmagent.CompletionResponse{Err: err}
+			b, err := llmagent.ReadBody(bodyRc, o.cfg.MaxResponseBytes)
+			if err != nil {
+				send(ctx, out, llmagent.CompletionResponse{Err: err})
+				return
+			}
+			if err := o.cfg.DecodeResponse(o.Name(), "completion", b, &res); err != nil {
+				send(ctx, out, llmagent.CompletionResponse{Err: err})
 				return
 			}
 			if len(res.Choices) > 0 {
-				out <- llmagent.CompletionResponse{Content: res.Choices[0].Message.Content}
+				choice := res.Choices[0]
+				var calls openaiToolCalls
+				for _, tc := range choice.Message.ToolCalls {
+					calls.add(tc)
+				}
+				toolCalls, err := calls.complete()
+				if err != nil {
+					send(ctx, out, llmagent.CompletionResponse{Err: err})
+					return
+				}
+				send(ctx, out, llmagent.CompletionResponse{
+					Content:      choice.Message.Content,
+					Role:         choice.Message.Role,
+					Usage:        res.Usage.usage(),
+					Logprobs:     choice.Logprobs.tokens(),
+					ToolCalls:    toolCalls,
+					FinishReason: llmagent.ParseFinishReason(o.Name(), choice.FinishReason),
+				})
 			}
 			return
 		}
-		reader := bufio.NewReader(bodyRc)
-		for {
-			line, err := reader.ReadBytes('\n')
-			if err != nil {
-				if err != io.EOF {
-					out <- llmagent.CompletionResponse{Err: err}
+		streamChatChunks(ctx, o.cfg, o.Name(), bodyRc, out)
+	}()
+	return out, nil
+}
+
+// streamChatChunks forwards a Chat Completions event stream, shared with
+// DeepSeek's compatible API.
+func streamChatChunks(ctx context.Context, cfg *llmagent.ProviderConfig, name string, body io.Reader, out chan<- llmagent.CompletionResponse) {
+	var received int
+	var role llmagent.Role // sent with the first delta only
+	// tool calls arrive in fragments keyed by index; they're emitted
+	// whole once the choice finishes (or the stream ends)
+	var calls openaiToolCalls
+	flush := func() bool {
+		toolCalls, err := calls.complete()
+		calls = openaiToolCalls{}
+		if err != nil {
+			send(ctx, out, llmagent.CompletionResponse{Err: err})
+			return false
+		}
+		return len(toolCalls) == 0 || send(ctx, out, llmagent.CompletionResponse{ToolCalls: toolCalls})
+	}
+	sr := llmagent.NewSSEReader(body)
+	defer sr.Release()
+	for sr.Next() {
+		data := sr.Event().Data
+		if string(data) == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			openaiEnvelope
+			Choices []struct {
+				Delta struct {
+					Content   string           `json:"content"`
+					ToolCalls []openaiToolCall `json:"tool_calls"`
+					Role      llmagent.Role    `json:"role"`
+					Refusal   json.RawMessage  `json:"refusal"`
+					// DeepSeek's reasoning models
+					ReasoningContent json.RawMessage `json:"reasoning_content"`
+				} `json:"delta"`
+				Logprobs     *openaiLogprobs `json:"logprobs"`
+				FinishReason string          `json:"finish_reason"`
+				Index        json.RawMessage `json:"index"`
+			} `json:"choices"`
+			Usage *deepseekUsage `json:"usage"` // a superset of OpenAI's
+		}
+		if err := cfg.DecodeResponse(name, "chunk", data, &chunk); err != nil {
+			continue
+		}
+		for _, c := range chunk.Choices {
+			received += len(c.Delta.Content)
+			if err := cfg.CheckResponseSize(received); err != nil {
+				send(ctx, out, llmagent.CompletionResponse{Err: err})
+				return
+			}
+			for _, tc := range c.Delta.ToolCalls {
+				received += len(tc.Function.Arguments)
+				calls.add(tc)
+			}
+			if c.Delta.Role != "" {
+				role = c.Delta.Role
+			}
+			if c.Delta.Content != "" || len(c.Logprobs.tokens()) > 0 {
+				if !send(ctx, out, llmagent.CompletionResponse{Content: c.Delta.Content, Role: role, Logprobs: c.Logprobs.tokens()}) {
+					return
 				}
-				break
 			}
-			if bytes.HasPrefix(line, []byte("data: ")) {
-				var chunk struct {
-					Choices []struct {
-						Delta struct {
-							Content string `json:"content"`
-						} `json:"delta"`
-					} `json:"choices"`
+			if c.FinishReason != "" {
+				if !flush() {
+					return
 				}
-				if err := json.Unmarshal(line[6:], &chunk); err == nil {
-					for _, c := range chunk.Choices {
-						out <- llmagent.CompletionResponse{Content: c.Delta.Content}
-					}
+				if !send(ctx, out, llmagent.CompletionResponse{FinishReason: llmagent.ParseFinishReason(name, c.FinishReason)}) {
+					return
 				}
 			}
 		}
-	}()
+		if chunk.Usage != nil {
+			if !send(ctx, out, llmagent.CompletionResponse{Usage: chunk.Usage.usage()}) {
+				return
+			}
+		}
+	}
+	if err := sr.Err(); err != nil {
+		send(ctx, out, llmagent.CompletionResponse{Err: err})
+		return
+	}
+	flush()
+}
+
+// openaiEnvelope holds the response fields the provider doesn't use.
+type openaiEnvelope struct {
+	ID                json.RawMessage `json:"id"`
+	Object            json.RawMessage `json:"object"`
+	Created           json.RawMessage `json:"created"`
+	Model             json.RawMessage `json:"model"`
+	SystemFingerprint json.RawMessage `json:"system_fingerprint"`
+	ServiceTier       json.RawMessage `json:"service_tier"`
+}
+
+type openaiUsage struct {
+	llmagent.Usage
+	PromptTokensDetails     json.RawMessage `json:"prompt_tokens_details"`
+	CompletionTokensDetails json.RawMessage `json:"completion_tokens_details"`
+}
+
+func (u *openaiUsage) usage() *llmagent.Usage {
+	if u == nil {
+		return nil
+	}
+	return &u.Usage
+}
+
+type openaiLogprobs struct {
+	Content []struct {
+		llmagent.TokenLogprob
+		Bytes       json.RawMessage `json:"bytes"`
+		TopLogprobs json.RawMessage `json:"top_logprobs"`
+	} `json:"content"`
+	Refusal json.RawMessage `json:"refusal"`
+}
+
+func (l *openaiLogprobs) tokens() []llmagent.TokenLogprob {
+	if l == nil || len(l.Content) == 0 {
+		return nil
+	}
+	out := make([]llmagent.TokenLogprob, len(l.Content))
+	for i, t := range l.Content {
+		out[i] = t.TokenLogprob
+	}
+	return out
+}
+
+// openaiToolCall is a tool call, or a fragment of one when streamed: the
+// first fragment of each index carries the id and name, later ones append
+// to the arguments.
+type openaiToolCall struct {
+	Index    *int            `json:"index,omitempty"`
+	ID       string          `json:"id"`
+	Type     json.RawMessage `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// openaiToolCalls accumulates streamed tool call fragments.
+type openaiToolCalls struct {
+	order []int
+	calls map[int]*openaiToolCall
+}
+
+func (t *openaiToolCalls) add(frag openaiToolCall) {
+	if t.calls == nil {
+		t.calls = map[int]*openaiToolCall{}
+	}
+	idx := len(t.order) // non-streamed calls have no index
+	if frag.Index != nil {
+		idx = *frag.Index
+	}
+	call, ok := t.calls[idx]
+	if !ok {
+		call = &openaiToolCall{}
+		t.calls[idx] = call
+		t.order = append(t.order, idx)
+	}
+	if frag.ID != "" {
+		call.ID = frag.ID
+	}
+	if frag.Function.Name != "" {
+		call.Function.Name = frag.Function.Name
+	}
+	call.Function.Arguments += frag.Function.Arguments
+}
+
+// complete returns the assembled calls in arrival order.
+func (t *openaiToolCalls) complete() ([]llmagent.ToolCall, error) {
+	var out []llmagent.ToolCall
+	for _, idx := range t.order {
+		call := t.calls[idx]
+		args := call.Function.Arguments
+		if args == "" {
+			args = "{}"
+		}
+		if !json.Valid([]byte(args)) {
+			return nil, fmt.Errorf("tool call %q (%s): malformed arguments %q", call.Function.Name, call.ID, args)
+		}
+		out = append(out, llmagent.ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: json.RawMessage(args)})
+	}
 	return out, nil
 }
@@ -0,0 +1,118 @@
+package providers
+
+import (
+	"encoding/json"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Request bodies are typed structs rather than maps: they encode without
+// reflecting over interface values and build without a map allocation per
+// message.
+
+// openaiRequest is a Chat Completions request, also used by DeepSeek.
+type openaiRequest struct {
+	Model             string               `json:"model"`
+	Messages          []openaiMessage      `json:"messages"`
+	Stream            bool                 `json:"stream"`
+	MaxTokens         int                  `json:"max_tokens"`
+	Stop              []string             `json:"stop,omitempty"`
+	Temperature       *float64             `json:"temperature,omitempty"`
+	TopP              *float64             `json:"top_p,omitempty"`
+	Seed              *int                 `json:"seed,omitempty"`
+	Tools             []openaiTool         `json:"tools,omitempty"`
+	ToolChoice        any                  `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool                `json:"parallel_tool_calls,omitempty"`
+	Logprobs          bool                 `json:"logprobs,omitempty"`
+	StreamOptions     *openaiStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openaiMessage struct {
+	Role       llmagent.Role    `json:"role"`
+	Content    string           `json:"content"`
+	Name       string           `json:"name,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	ToolCalls  []openaiToolCall `json:"tool_calls,omitempty"`
+}
+
+type openaiTool struct {
+	Type     string         `json:"type"`
+	Function openaiFunction `json:"function"`
+}
+
+type openaiFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type openaiStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+var functionType = json.RawMessage(`"function"`)
+
+// anthropicRequest is a Messages API request.
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	Stream      bool               `json:"stream"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        *float64           `json:"top_p,omitempty"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice  *anthropicChoice   `json:"tool_choice,omitempty"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+}
+
+type anthropicMessage struct {
+	Role    llmagent.Role `json:"role"`
+	Content any           `json:"content"` // a string or []anthropicBlock
+	Name    string        `json:"name,omitempty"`
+}
+
+// anthropicBlock is a text, tool_use or tool_result content block.
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+// withExtra merges req.Extra into payload as llmagent.MergeExtra does. The
+// typed payload is returned as is when there is nothing to merge; only
+// requests with pass-through parameters pay for the map round trip.
+func withExtra(payload any, extra map[string]any) (any, error) {
+	if len(extra) == 0 {
+		return payload, nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	merged := make(map[string]any, len(fields)+len(extra))
+	for k, v := range fields {
+		merged[k] = v
+	}
+	llmagent.MergeExtra(merged, extra)
+	return merged, nil
+}
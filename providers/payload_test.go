@@ -0,0 +1,137 @@
+package providers
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oarkflow/llmagent"
+)
+
+func benchRequest() llmagent.CompletionRequest {
+	req := llmagent.CompletionRequest{
+		Model:       "gpt-4o",
+		MaxTokens:   256,
+		Temperature: llmagent.Float64(0.7),
+		TopP:        llmagent.Float64(1),
+		Stream:      llmagent.Bool(true),
+		Tools: []llmagent.ToolDefinition{{
+			Name:        "lookup",
+			Description: "Look up a record",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"id":{"type":"string"}}}`),
+		}},
+	}
+	req.Messages = append(req.Messages, llmagent.Message{Role: llmagent.RoleSystem, Content: "You are terse."})
+	for i := range 16 {
+		role := llmagent.RoleUser
+		if i%2 == 1 {
+			role = llmagent.RoleAssistant
+		}
+		req.Messages = append(req.Messages, llmagent.Message{Role: role, Content: strings.Repeat("lorem ipsum ", 16)})
+	}
+	return req
+}
+
+func typedPayload(req llmagent.CompletionRequest) any {
+	return openaiRequest{
+		Model:       req.Model,
+		Messages:    openaiMessages(req.Messages),
+		Stream:      req.StreamValue(),
+		MaxTokens:   req.MaxTokens,
+		Stop:        req.Stop,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Tools:       openaiTools(req.Tools),
+	}
+}
+
+// mapPayload builds the same body the way providers did before typed
+// payloads, as the baseline for BenchmarkPayloadMap.
+func mapPayload(req llmagent.CompletionRequest) any {
+	msgs := make([]map[string]any, len(req.Messages))
+	for i, msg := range req.Messages {
+		msgs[i] = map[string]any{"role": msg.Role, "content": msg.Content}
+	}
+	tools := make([]map[string]any, len(req.Tools))
+	for i, d := range req.Tools {
+		fn := map[string]any{"name": d.Name, "description": d.Description, "parameters": toolSchema(d.Parameters)}
+		tools[i] = map[string]any{"type": "function", "function": fn}
+	}
+	return map[string]any{
+		"model":       req.Model,
+		"messages":    msgs,
+		"stream":      req.StreamValue(),
+		"max_tokens":  req.MaxTokens,
+		"temperature": *req.Temperature,
+		"top_p":       *req.TopP,
+		"tools":       tools,
+	}
+}
+
+func TestTypedPayloadMatchesMap(t *testing.T) {
+	req := benchRequest()
+	decode := func(v any) (out map[string]any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.Unmarshal(data, &out)
+		return out
+	}
+	if typed, legacy := decode(typedPayload(req)), decode(mapPayload(req)); !reflect.DeepEqual(typed, legacy) {
+		t.Fatalf("typed payload\n%v\ndiffers from map payload\n%v", typed, legacy)
+	}
+}
+
+func TestWithExtra(t *testing.T) {
+	req := benchRequest()
+	p, err := withExtra(typedPayload(req), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(openaiRequest); !ok {
+		t.Fatalf("payload without Extra converted to %T", p)
+	}
+	p, err = withExtra(typedPayload(req), map[string]any{"user": "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(p)
+	var got struct {
+		Model string `json:"model"`
+		User  string `json:"user"`
+	}
+	json.Unmarshal(data, &got)
+	if got.Model != req.Model || got.User != "u1" {
+		t.Fatalf("merged payload = %s", data)
+	}
+}
+
+func benchmarkPayload(b *testing.B, build func(llmagent.CompletionRequest) any) {
+	req := benchRequest()
+	enc := json.NewEncoder(io.Discard)
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := enc.Encode(build(req)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPayloadTyped(b *testing.B) { benchmarkPayload(b, typedPayload) }
+
+func BenchmarkPayloadMap(b *testing.B) { benchmarkPayload(b, mapPayload) }
+
+func BenchmarkPayloadAnthropic(b *testing.B) {
+	benchmarkPayload(b, func(req llmagent.CompletionRequest) any {
+		return anthropicRequest{
+			Model:     req.Model,
+			Messages:  anthropicMessages(req.Messages),
+			MaxTokens: req.MaxTokens,
+			Stream:    req.StreamValue(),
+			Tools:     anthropicTools(req.Tools),
+		}
+	})
+}
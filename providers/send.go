@@ -0,0 +1,19 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// send delivers resp on out unless ctx is done first, so a provider
+// goroutine whose consumer went away returns instead of blocking forever.
+// It reports whether resp was delivered.
+func send(ctx context.Context, out chan<- llmagent.CompletionResponse, resp llmagent.CompletionResponse) bool {
+	select {
+	case out <- resp:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,140 @@
+package providers
+
+import (
+	"encoding/json"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// hasTools reports whether the request declares tools; tool_choice and
+// the parallel flag are rejected upstream without them.
+func hasTools(req llmagent.CompletionRequest) bool {
+	return len(req.Tools) > 0 || req.Extra["tools"] != nil
+}
+
+// toolSchema defaults a tool without parameters to an empty object schema,
+// which both APIs require.
+func toolSchema(params json.RawMessage) json.RawMessage {
+	if len(params) == 0 {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return params
+}
+
+// toolArgs defaults empty call arguments to an empty object.
+func toolArgs(args json.RawMessage) json.RawMessage {
+	if len(args) == 0 {
+		return json.RawMessage("{}")
+	}
+	return args
+}
+
+// openaiTools maps tool definitions to the Chat Completions format, also
+// used by DeepSeek.
+func openaiTools(defs []llmagent.ToolDefinition) []openaiTool {
+	tools := make([]openaiTool, len(defs))
+	for i, d := range defs {
+		tools[i] = openaiTool{Type: "function", Function: openaiFunction{Name: d.Name, Description: d.Description, Parameters: toolSchema(d.Parameters)}}
+	}
+	return tools
+}
+
+// openaiMessages maps messages to the Chat Completions format, where an
+// assistant's tool calls carry their arguments as a string and a tool
+// result names the call it answers.
+func openaiMessages(msgs []llmagent.Message) []openaiMessage {
+	out := make([]openaiMessage, len(msgs))
+	for i, msg := range msgs {
+		m := openaiMessage{Role: msg.Role, Content: msg.Content, ToolCallID: msg.ToolCallID}
+		if msg.ToolCallID == "" {
+			m.Name = msg.Name
+		}
+		if len(msg.ToolCalls) > 0 {
+			m.ToolCalls = make([]openaiToolCall, len(msg.ToolCalls))
+			for j, tc := range msg.ToolCalls {
+				call := openaiToolCall{ID: tc.ID, Type: functionType}
+				call.Function.Name, call.Function.Arguments = tc.Name, string(toolArgs(tc.Arguments))
+				m.ToolCalls[j] = call
+			}
+		}
+		out[i] = m
+	}
+	return out
+}
+
+// anthropicTools maps tool definitions to the Messages API.
+func anthropicTools(defs []llmagent.ToolDefinition) []anthropicTool {
+	tools := make([]anthropicTool, len(defs))
+	for i, d := range defs {
+		tools[i] = anthropicTool{Name: d.Name, Description: d.Description, InputSchema: toolSchema(d.Parameters)}
+	}
+	return tools
+}
+
+// anthropicMessages maps the non-system messages to the Messages API. Tool
+// calls become tool_use blocks of the assistant turn; tool results become
+// tool_result blocks of a user turn, one turn for consecutive results as
+// the API requires for parallel calls.
+func anthropicMessages(msgs []llmagent.Message) []anthropicMessage {
+	var out []anthropicMessage
+	var results []anthropicBlock // blocks of the open tool_result turn
+	for _, msg := range msgs {
+		if msg.Role == llmagent.RoleSystem {
+			continue
+		}
+		if msg.ToolCallID != "" {
+			results = append(results, anthropicBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+			if len(results) == 1 {
+				out = append(out, anthropicMessage{Role: llmagent.RoleUser})
+			}
+			out[len(out)-1].Content = results
+			continue
+		}
+		results = nil
+		m := anthropicMessage{Role: msg.Role, Content: msg.Content}
+		if len(msg.ToolCalls) > 0 {
+			var blocks []anthropicBlock
+			if msg.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Name, Input: toolArgs(tc.Arguments)})
+			}
+			m.Content = blocks
+		} else {
+			m.Name = msg.Name
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// openaiToolChoice maps a tool choice to the Chat Completions format, also
+// used by DeepSeek.
+func openaiToolChoice(tc *llmagent.ToolChoice) any {
+	switch tc.Mode {
+	case llmagent.ToolChoiceAny:
+		return "required"
+	case llmagent.ToolChoiceTool:
+		return openaiTool{Type: "function", Function: openaiFunction{Name: tc.Name}}
+	}
+	return string(tc.Mode)
+}
+
+// anthropicToolChoice maps a tool choice and the parallel flag to the
+// Messages API, where parallelism is a property of tool_choice.
+func anthropicToolChoice(tc *llmagent.ToolChoice, parallel *bool) *anthropicChoice {
+	mode := llmagent.ToolChoiceAuto
+	if tc != nil {
+		mode = tc.Mode
+	}
+	choice := &anthropicChoice{Type: string(mode)}
+	if mode == llmagent.ToolChoiceTool {
+		choice.Name = tc.Name
+	}
+	// "none" takes no parallelism flag
+	if parallel != nil && !*parallel && mode != llmagent.ToolChoiceNone {
+		choice.DisableParallelToolUse = true
+	}
+	return choice
+}
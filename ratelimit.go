@@ -0,0 +1,103 @@
+package llmagent
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces requests to a provider. Take removes n tokens from the
+// bucket named key and returns how long the caller must wait before
+// proceeding; tokens are taken even when a wait is returned, so callers
+// queue up in order. Implementations must be safe for concurrent use.
+type RateLimiter interface {
+	Take(ctx context.Context, key string, n int) (time.Duration, error)
+}
+
+// WithRateLimiter paces every attempt against the provider through l,
+// one token per request, using the provider name as the bucket key. Share
+// a distributed limiter, e.g. a Redis-backed bucket, between instances to
+// respect an org-level limit together.
+func WithRateLimiter(l RateLimiter) Option {
+	return func(p *ProviderConfig) {
+		p.RateLimiter = l
+	}
+}
+
+// TokenBucket is an in-process RateLimiter: each key's bucket holds up to
+// Burst tokens and refills at Rate tokens per second.
+type TokenBucket struct {
+	Rate  float64
+	Burst int   // defaults to 1
+	Clock Clock // SystemClock when nil
+
+	mu      sync.Mutex
+	buckets map[string]*bucketState
+}
+
+type bucketState struct {
+	tokens float64 // negative while callers are queued
+	at     time.Time
+}
+
+// NewTokenBucket returns a TokenBucket refilling at rate tokens per second
+// up to burst.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{Rate: rate, Burst: burst}
+}
+
+func (b *TokenBucket) Take(_ context.Context, key string, n int) (time.Duration, error) {
+	if b.Rate <= 0 {
+		return 0, nil
+	}
+	burst := float64(max(b.Burst, 1))
+	now := clockOr(b.Clock).Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buckets == nil {
+		b.buckets = map[string]*bucketState{}
+	}
+	s, ok := b.buckets[key]
+	if !ok {
+		s = &bucketState{tokens: burst, at: now}
+		b.buckets[key] = s
+	}
+	s.tokens = math.Min(burst, s.tokens+now.Sub(s.at).Seconds()*b.Rate)
+	s.at = now
+	s.tokens -= float64(n)
+	if s.tokens >= 0 {
+		return 0, nil
+	}
+	return time.Duration(math.Ceil(-s.tokens / b.Rate * float64(time.Second))), nil
+}
+
+// rateWait takes a token for p from its RateLimiter and waits as told. A
+// failing limiter, e.g. an unreachable Redis, doesn't block requests.
+func (a *Agent) rateWait(ctx context.Context, p Provider) error {
+	cfg := p.GetConfig()
+	if cfg.RateLimiter == nil {
+		return nil
+	}
+	wait, err := cfg.RateLimiter.Take(ctx, p.Name(), 1)
+	if err != nil {
+		if cfg.Logger != nil {
+			cfg.Logger.Printf("Provider %q rate limiter failed, not pacing: %v", p.Name(), err)
+		}
+		return nil
+	}
+	if wait <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && a.clock().Now().Add(wait).After(deadline) {
+		return context.DeadlineExceeded
+	}
+	t := a.clock().NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
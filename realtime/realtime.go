@@ -0,0 +1,246 @@
+// Package realtime implements OpenAI's Realtime API: a bidirectional
+// WebSocket session streaming audio in and audio, transcripts and function
+// calls out.
+package realtime
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Server event types exposed as typed Event fields.
+const (
+	EventSessionCreated   = "session.created"
+	EventError            = "error"
+	EventSpeechStarted    = "input_audio_buffer.speech_started"
+	EventSpeechStopped    = "input_audio_buffer.speech_stopped"
+	EventAudioDelta       = "response.audio.delta"
+	EventTranscriptDelta  = "response.audio_transcript.delta"
+	EventTextDelta        = "response.text.delta"
+	EventInputTranscript  = "conversation.item.input_audio_transcription.completed"
+	EventFunctionCallDone = "response.function_call_arguments.done"
+	EventResponseDone     = "response.done"
+)
+
+// Config configures a realtime session. Session is sent as the initial
+// session.update, e.g.
+//
+//	map[string]any{"voice": "alloy", "turn_detection": map[string]any{"type": "server_vad"}}
+type Config struct {
+	APIKey  string
+	Model   string // defaults to gpt-4o-realtime-preview
+	BaseURL string // defaults to wss://api.openai.com/v1/realtime
+	Session map[string]any
+	Header  http.Header // extra handshake headers
+}
+
+// Event is a server event. Raw always holds the full JSON; the typed fields
+// are filled for the event types that carry them.
+type Event struct {
+	Type string
+	Raw  json.RawMessage
+
+	Audio    []byte             // EventAudioDelta: decoded PCM
+	Text     string             // text, transcript and input transcript events
+	ToolCall *llmagent.ToolCall // EventFunctionCallDone
+	Err      error              // EventError, or a broken connection
+}
+
+// Session is an open realtime connection. Events delivers server events
+// until the connection closes; read it continuously, since the reader
+// blocks on it.
+type Session struct {
+	Events <-chan Event
+
+	conn   *websocket.Conn
+	sendMu sync.Mutex
+	closed atomic.Bool
+}
+
+// Dial opens a session and sends cfg.Session, if any.
+func Dial(ctx context.Context, cfg Config) (*Session, error) {
+	if cfg.APIKey == "" {
+		return nil, errors.New("API key is required")
+	}
+	if cfg.Model == "" {
+		cfg.Model = "gpt-4o-realtime-preview"
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "wss://api.openai.com/v1/realtime"
+	}
+	wsConfig, err := websocket.NewConfig(cfg.BaseURL+"?model="+url.QueryEscape(cfg.Model), "https://api.openai.com")
+	if err != nil {
+		return nil, err
+	}
+	wsConfig.Header = http.Header{}
+	for k, v := range cfg.Header {
+		wsConfig.Header[k] = v
+	}
+	wsConfig.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	wsConfig.Header.Set("OpenAI-Beta", "realtime=v1")
+	conn, err := wsConfig.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event, 64)
+	s := &Session{Events: events, conn: conn}
+	go s.read(events)
+	if cfg.Session != nil {
+		if err := s.Send(map[string]any{"type": "session.update", "session": cfg.Session}); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Session) read(events chan<- Event) {
+	defer close(events)
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(s.conn, &data); err != nil {
+			// a server hang-up or our own Close is the normal end
+			if !errors.Is(err, io.EOF) && !s.closed.Load() {
+				events <- Event{Type: EventError, Err: err}
+			}
+			return
+		}
+		ev, err := parseEvent(data)
+		if err != nil {
+			ev = Event{Type: EventError, Raw: data, Err: err}
+		}
+		events <- ev
+	}
+}
+
+func parseEvent(data []byte) (Event, error) {
+	var msg struct {
+		Type       string `json:"type"`
+		Delta      string `json:"delta"`
+		Transcript string `json:"transcript"`
+		CallID     string `json:"call_id"`
+		Name       string `json:"name"`
+		Arguments  string `json:"arguments"`
+		Error      *struct {
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return Event{}, err
+	}
+	ev := Event{Type: msg.Type, Raw: data}
+	switch msg.Type {
+	case EventAudioDelta:
+		audio, err := base64.StdEncoding.DecodeString(msg.Delta)
+		if err != nil {
+			return Event{}, err
+		}
+		ev.Audio = audio
+	case EventTranscriptDelta, EventTextDelta:
+		ev.Text = msg.Delta
+	case EventInputTranscript:
+		ev.Text = msg.Transcript
+	case EventFunctionCallDone:
+		args := msg.Arguments
+		if args == "" {
+			args = "{}"
+		}
+		ev.ToolCall = &llmagent.ToolCall{ID: msg.CallID, Name: msg.Name, Arguments: json.RawMessage(args)}
+	case EventError:
+		if msg.Error != nil {
+			ev.Err = &Error{Type: msg.Error.Type, Code: msg.Error.Code, Message: msg.Error.Message}
+		}
+	}
+	return ev, nil
+}
+
+// Error is an error event sent by the server. The session stays open.
+type Error struct {
+	Type    string
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return "realtime " + e.Type + " (" + e.Code + "): " + e.Message
+	}
+	return "realtime " + e.Type + ": " + e.Message
+}
+
+// Send writes a raw client event.
+func (s *Session) Send(event any) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return websocket.JSON.Send(s.conn, event)
+}
+
+// AppendAudio streams input audio in the session's input format (16-bit
+// 24kHz mono PCM by default).
+func (s *Session) AppendAudio(pcm []byte) error {
+	return s.Send(map[string]any{"type": "input_audio_buffer.append", "audio": base64.StdEncoding.EncodeToString(pcm)})
+}
+
+// CommitAudio ends the user's turn. Not needed with server VAD, which
+// commits on detected silence.
+func (s *Session) CommitAudio() error {
+	return s.Send(map[string]any{"type": "input_audio_buffer.commit"})
+}
+
+// ClearAudio discards uncommitted input audio.
+func (s *Session) ClearAudio() error {
+	return s.Send(map[string]any{"type": "input_audio_buffer.clear"})
+}
+
+// SendText adds a user text message to the conversation.
+func (s *Session) SendText(text string) error {
+	return s.Send(map[string]any{
+		"type": "conversation.item.create",
+		"item": map[string]any{
+			"type":    "message",
+			"role":    "user",
+			"content": []map[string]any{{"type": "input_text", "text": text}},
+		},
+	})
+}
+
+// SendToolResult answers a function call; call CreateResponse afterwards
+// to let the model continue.
+func (s *Session) SendToolResult(callID, output string) error {
+	return s.Send(map[string]any{
+		"type": "conversation.item.create",
+		"item": map[string]any{"type": "function_call_output", "call_id": callID, "output": output},
+	})
+}
+
+// CreateResponse asks the model to respond to the conversation so far.
+func (s *Session) CreateResponse() error {
+	return s.Send(map[string]any{"type": "response.create"})
+}
+
+// CancelResponse interrupts the response in progress, e.g. when the user
+// starts speaking over it.
+func (s *Session) CancelResponse() error {
+	return s.Send(map[string]any{"type": "response.cancel"})
+}
+
+// Close ends the session; Events is closed once the reader stops.
+func (s *Session) Close() error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+	return s.conn.Close()
+}
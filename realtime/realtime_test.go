@@ -0,0 +1,185 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestParseEvent(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want Event
+	}{
+		{`{"type":"response.audio.delta","delta":"AAEC"}`, Event{Type: EventAudioDelta, Audio: []byte{0, 1, 2}}},
+		{`{"type":"response.audio_transcript.delta","delta":"Hel"}`, Event{Type: EventTranscriptDelta, Text: "Hel"}},
+		{`{"type":"response.text.delta","delta":"lo"}`, Event{Type: EventTextDelta, Text: "lo"}},
+		{`{"type":"conversation.item.input_audio_transcription.completed","transcript":"hi there"}`,
+			Event{Type: EventInputTranscript, Text: "hi there"}},
+		{`{"type":"error","error":{"type":"invalid_request_error","code":"bad_event","message":"nope"}}`,
+			Event{Type: EventError, Err: &Error{Type: "invalid_request_error", Code: "bad_event", Message: "nope"}}},
+		{`{"type":"rate_limits.updated","rate_limits":[]}`, Event{Type: "rate_limits.updated"}},
+	} {
+		got, err := parseEvent([]byte(tc.data))
+		if err != nil {
+			t.Errorf("%s: %v", tc.data, err)
+			continue
+		}
+		tc.want.Raw = json.RawMessage(tc.data)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseEvent(%s) = %+v, want %+v", tc.data, got, tc.want)
+		}
+	}
+
+	got, err := parseEvent([]byte(`{"type":"response.function_call_arguments.done","call_id":"c1","name":"lookup"}`))
+	if err != nil || got.ToolCall == nil || got.ToolCall.ID != "c1" || got.ToolCall.Name != "lookup" || string(got.ToolCall.Arguments) != "{}" {
+		t.Errorf("function call without arguments = %+v, %v", got.ToolCall, err)
+	}
+	for _, bad := range []string{`{"type":`, `{"type":"response.audio.delta","delta":"!!"}`} {
+		if _, err := parseEvent([]byte(bad)); err == nil {
+			t.Errorf("parseEvent(%s): no error", bad)
+		}
+	}
+}
+
+// fakeServer runs script against each connection after checking the
+// handshake.
+func fakeServer(t *testing.T, script func(ws *websocket.Conn)) string {
+	t.Helper()
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		r := ws.Request()
+		if r.Header.Get("Authorization") != "Bearer sk-test" || r.Header.Get("OpenAI-Beta") != "realtime=v1" || r.URL.Query().Get("model") != "rt-model" {
+			t.Errorf("handshake: %v %v", r.URL, r.Header)
+			return
+		}
+		script(ws)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// receive reads the next client event from ws.
+func receive(t *testing.T, ws *websocket.Conn) map[string]any {
+	t.Helper()
+	var ev map[string]any
+	if err := websocket.JSON.Receive(ws, &ev); err != nil {
+		t.Errorf("receive: %v", err)
+	}
+	return ev
+}
+
+// next returns the next event, failing after a timeout.
+func next(t *testing.T, s *Session) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-s.Events:
+		if !ok {
+			t.Fatal("events closed early")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+func TestFunctionCallRoundTrip(t *testing.T) {
+	url := fakeServer(t, func(ws *websocket.Conn) {
+		if ev := receive(t, ws); ev["type"] != "session.update" || ev["session"].(map[string]any)["voice"] != "alloy" {
+			t.Errorf("first client event = %v, want the session update", ev)
+		}
+		for _, ev := range []string{
+			`{"type":"session.created"}`,
+			`{"type":"response.audio.delta","delta":"AQI="}`,
+			`{"type":"response.function_call_arguments.done","call_id":"call_1","name":"weather","arguments":"{\"city\":\"Oslo\"}"}`,
+		} {
+			websocket.Message.Send(ws, ev)
+		}
+		out := receive(t, ws)
+		item, _ := out["item"].(map[string]any)
+		if out["type"] != "conversation.item.create" || item["type"] != "function_call_output" || item["call_id"] != "call_1" || item["output"] != "sunny" {
+			t.Errorf("tool result event = %v", out)
+		}
+		if ev := receive(t, ws); ev["type"] != "response.create" {
+			t.Errorf("event after the tool result = %v, want response.create", ev)
+		}
+		websocket.Message.Send(ws, `{"type":"response.text.delta","delta":"It is sunny."}`)
+		websocket.Message.Send(ws, `{"type":"response.done"}`)
+	})
+
+	s, err := Dial(context.Background(), Config{APIKey: "sk-test", Model: "rt-model", BaseURL: url, Session: map[string]any{"voice": "alloy"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if ev := next(t, s); ev.Type != EventSessionCreated {
+		t.Fatalf("first event = %+v", ev)
+	}
+	if ev := next(t, s); ev.Type != EventAudioDelta || !reflect.DeepEqual(ev.Audio, []byte{1, 2}) {
+		t.Fatalf("audio event = %+v", ev)
+	}
+	ev := next(t, s)
+	if ev.ToolCall == nil || ev.ToolCall.Name != "weather" || string(ev.ToolCall.Arguments) != `{"city":"Oslo"}` {
+		t.Fatalf("function call event = %+v", ev)
+	}
+	if err := s.SendToolResult(ev.ToolCall.ID, "sunny"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateResponse(); err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(t, s); ev.Text != "It is sunny." {
+		t.Fatalf("text event = %+v", ev)
+	}
+	if ev := next(t, s); ev.Type != EventResponseDone {
+		t.Fatalf("last event = %+v", ev)
+	}
+	// the server hung up: Events closes without an error
+	if ev, ok := <-s.Events; ok {
+		t.Fatalf("event after the hang-up: %+v", ev)
+	}
+}
+
+func TestServerErrorKeepsSessionOpen(t *testing.T) {
+	url := fakeServer(t, func(ws *websocket.Conn) {
+		websocket.Message.Send(ws, `{"type":"error","error":{"type":"invalid_request_error","message":"unknown event"}}`)
+		if ev := receive(t, ws); ev["type"] != "input_audio_buffer.commit" {
+			t.Errorf("client event = %v", ev)
+		}
+		websocket.Message.Send(ws, `not json`)
+		var rest []byte
+		websocket.Message.Receive(ws, &rest) // returns once the client closes
+	})
+	s, err := Dial(context.Background(), Config{APIKey: "sk-test", Model: "rt-model", BaseURL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := next(t, s)
+	var rerr *Error
+	if !errors.As(ev.Err, &rerr) || rerr.Message != "unknown event" {
+		t.Fatalf("error event = %+v", ev)
+	}
+	if err := s.CommitAudio(); err != nil {
+		t.Fatalf("send after a server error: %v", err)
+	}
+	if ev := next(t, s); ev.Type != EventError || ev.Err == nil || string(ev.Raw) != "not json" {
+		t.Fatalf("malformed event = %+v", ev)
+	}
+	s.Close()
+	for range s.Events {
+	}
+}
+
+func TestDialRequiresAPIKey(t *testing.T) {
+	if _, err := Dial(context.Background(), Config{}); err == nil {
+		t.Fatal("no error")
+	}
+}
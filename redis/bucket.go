@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TokenBucket is an llmagent.RateLimiter whose buckets live in Redis, so
+// every instance sharing the Client draws from the same budget. Each
+// bucket holds up to Burst tokens and refills at Rate tokens per second,
+// timed by the Redis server clock.
+type TokenBucket struct {
+	Client *Client
+	Rate   float64
+	Burst  int    // defaults to 1
+	Prefix string // key prefix; defaults to "llmagent:bucket:"
+}
+
+// takeScript refills the bucket, takes the tokens and returns the wait in
+// milliseconds. The balance goes negative while callers are queued.
+const takeScript = `
+redis.replicate_commands()
+local rate, burst, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens, at = tonumber(state[1]) or burst, tonumber(state[2]) or now
+tokens = math.min(burst, tokens + (now - at) * rate / 1000) - n
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'at', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+if tokens >= 0 then return 0 end
+return math.ceil(-tokens / rate * 1000)
+`
+
+func (b *TokenBucket) Take(ctx context.Context, key string, n int) (time.Duration, error) {
+	if b.Rate <= 0 {
+		return 0, nil
+	}
+	prefix := b.Prefix
+	if prefix == "" {
+		prefix = "llmagent:bucket:"
+	}
+	reply, err := b.Client.Eval(ctx, takeScript, []string{prefix + key},
+		strconv.FormatFloat(b.Rate, 'g', -1, 64),
+		strconv.Itoa(max(b.Burst, 1)),
+		strconv.Itoa(n),
+	)
+	if err != nil {
+		return 0, err
+	}
+	ms, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected bucket reply %v", reply)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
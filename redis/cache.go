@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Cache is an llmagent.CacheTier in Redis, shared by every instance using
+// the same server and Prefix. Set Agent.CacheTierMinTokens to 1 to write
+// every response through, so an answer cached by one instance is a hit on
+// all of them. Entries expire with their cache TTL.
+type Cache struct {
+	Client *Client
+	Prefix string // key prefix; defaults to "llmagent:cache:"
+}
+
+func (c *Cache) key(k string) string {
+	if c.Prefix == "" {
+		return "llmagent:cache:" + k
+	}
+	return c.Prefix + k
+}
+
+func (c *Cache) Load(key string) (llmagent.CacheRecord, bool, error) {
+	reply, err := c.Client.Do(context.Background(), "GET", c.key(key))
+	if err != nil || reply == nil {
+		return llmagent.CacheRecord{}, false, err
+	}
+	var rec llmagent.CacheRecord
+	if err := json.Unmarshal([]byte(reply.(string)), &rec); err != nil {
+		return llmagent.CacheRecord{}, false, err
+	}
+	return rec, rec.Key == key, nil
+}
+
+func (c *Cache) Store(rec llmagent.CacheRecord) error {
+	ttl := time.Until(rec.ExpiresAt).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = c.Client.Do(context.Background(), "SET", c.key(rec.Key), string(data), "PX", strconv.FormatInt(ttl, 10))
+	return err
+}
+
+// Purge scans every cached record, so it is slow on large caches.
+func (c *Cache) Purge(fn func(llmagent.CacheRecord) bool) (int, error) {
+	ctx := context.Background()
+	keys, err := c.Client.Scan(ctx, c.key("*"))
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, k := range keys {
+		reply, err := c.Client.Do(ctx, "GET", k)
+		if err != nil {
+			return n, err
+		}
+		s, ok := reply.(string)
+		if !ok {
+			continue // expired since the scan
+		}
+		var rec llmagent.CacheRecord
+		if json.Unmarshal([]byte(s), &rec) != nil || !fn(rec) {
+			continue
+		}
+		if _, err := c.Client.Do(ctx, "DEL", k); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
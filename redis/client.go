@@ -0,0 +1,131 @@
+// Package redis provides Redis-backed building blocks for running several
+// agent instances as one: a token bucket shared across processes, a
+// response cache tier, a metrics store, and a leader lease with a store
+// for health probe results. Commands go through go-redis.
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Client is a small pooled Redis client. The fields configure the
+// connection pool created on first use; NewClient wraps an existing
+// go-redis client instead.
+type Client struct {
+	Addr     string // host:port; defaults to localhost:6379
+	Username string // ACL user; empty authenticates with Password only
+	Password string
+	DB       int
+	TLS      *tls.Config   // connect over TLS when set
+	Timeout  time.Duration // dial and per-command I/O; defaults to 5s
+	MaxIdle  int           // idle connections kept; defaults to 8
+
+	once    sync.Once
+	rdb     goredis.UniversalClient
+	scripts sync.Map // script source -> *goredis.Script
+}
+
+// NewClient returns a Client sending its commands through rdb, e.g. a
+// cluster or sentinel client shared with the rest of the program. rdb
+// should speak RESP2 (Options.Protocol 2) so replies keep the shapes Do
+// documents. Closing the Client closes rdb.
+func NewClient(rdb goredis.UniversalClient) *Client {
+	c := &Client{rdb: rdb}
+	c.once.Do(func() {})
+	return c
+}
+
+// Error is an error reply from the server.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+func (c *Client) client() goredis.UniversalClient {
+	c.once.Do(func() {
+		addr := c.Addr
+		if addr == "" {
+			addr = "localhost:6379"
+		}
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		maxIdle := c.MaxIdle
+		if maxIdle <= 0 {
+			maxIdle = 8
+		}
+		c.rdb = goredis.NewClient(&goredis.Options{
+			Addr:     addr,
+			Username: c.Username,
+			Password: c.Password,
+			DB:       c.DB,
+			// RESP2 keeps replies to strings, integers and arrays.
+			Protocol:              2,
+			TLSConfig:             c.TLS,
+			DialTimeout:           timeout,
+			ReadTimeout:           timeout,
+			WriteTimeout:          timeout,
+			ContextTimeoutEnabled: true,
+			MaxIdleConns:          maxIdle,
+		})
+	})
+	return c.rdb
+}
+
+// Do sends a command and returns its reply: a string, int64, []any, or
+// nil for a nil bulk string. Error replies come back as Error.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	return reply(c.client().Do(ctx, anys(args)...).Result())
+}
+
+// Close closes the connection pool.
+func (c *Client) Close() error {
+	return c.client().Close()
+}
+
+// Eval runs a Lua script by its SHA1, loading it on first use.
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...string) (any, error) {
+	s, ok := c.scripts.Load(script)
+	if !ok {
+		s, _ = c.scripts.LoadOrStore(script, goredis.NewScript(script))
+	}
+	return reply(s.(*goredis.Script).Run(ctx, c.client(), keys, anys(args)...).Result())
+}
+
+// Scan returns every key matching pattern, walking the keyspace with SCAN.
+func (c *Client) Scan(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := c.client().Scan(ctx, 0, pattern, 500).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	_, err := reply(nil, iter.Err())
+	return keys, err
+}
+
+// reply maps go-redis results onto Do's contract: a nil reply is not an
+// error, and error replies become Error.
+func reply(v any, err error) (any, error) {
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+	var rerr goredis.Error
+	if errors.As(err, &rerr) {
+		return v, Error(rerr.Error())
+	}
+	return v, err
+}
+
+func anys(args []string) []any {
+	out := make([]any, len(args))
+	for i, a := range args {
+		out[i] = a
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/oarkflow/llmagent"
+)
+
+func testClient(t *testing.T) *Client {
+	t.Helper()
+	c := &Client{Addr: miniredis.RunT(t).Addr()}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClientReplies(t *testing.T) {
+	c := testClient(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"SET", "k", "v"}, "OK"},
+		{[]string{"GET", "k"}, "v"},
+		{[]string{"GET", "missing"}, nil},
+		{[]string{"INCRBY", "n", "3"}, int64(3)},
+		{[]string{"RPUSH", "l", "a", "b"}, int64(2)},
+		{[]string{"LRANGE", "l", "0", "-1"}, []any{"a", "b"}},
+	}
+	for _, tt := range tests {
+		got, err := c.Do(ctx, tt.args...)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.args, err)
+		}
+		if !equalReply(got, tt.want) {
+			t.Fatalf("%q = %#v, want %#v", tt.args, got, tt.want)
+		}
+	}
+
+	_, err := c.Do(ctx, "INCR", "k")
+	var rerr Error
+	if !errors.As(err, &rerr) {
+		t.Fatalf("error reply = %#v, want Error", err)
+	}
+}
+
+func equalReply(a, b any) bool {
+	as, aok := a.([]any)
+	bs, bok := b.([]any)
+	if aok && bok {
+		return slices.Equal(as, bs)
+	}
+	return a == b
+}
+
+func TestClientEvalAndScan(t *testing.T) {
+	c := testClient(t)
+	ctx := context.Background()
+	const script = `return redis.call('INCRBY', KEYS[1], ARGV[1])`
+	for want := int64(2); want <= 4; want += 2 {
+		// the first call loads the script, the second runs it by SHA1
+		got, err := c.Eval(ctx, script, []string{"p:n"}, "2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("Eval = %#v, want %d", got, want)
+		}
+	}
+	for _, k := range []string{"p:a", "p:b", "q:c"} {
+		if _, err := c.Do(ctx, "SET", k, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys, err := c.Scan(ctx, "p:*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	if want := []string{"p:a", "p:b", "p:n"}; !slices.Equal(keys, want) {
+		t.Fatalf("Scan = %q, want %q", keys, want)
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := testClient(t)
+	cache := &Cache{Client: c}
+	now := time.Now()
+	for _, rec := range []llmagent.CacheRecord{
+		{Key: "a", Content: "A", User: "u1", ExpiresAt: now.Add(time.Hour)},
+		{Key: "b", Content: "B", User: "u2", ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := cache.Store(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec, ok, err := cache.Load("a")
+	if err != nil || !ok || rec.Content != "A" {
+		t.Fatalf("Load(a) = %+v, %v, %v", rec, ok, err)
+	}
+	n, err := cache.Purge(func(r llmagent.CacheRecord) bool { return r.User == "u1" })
+	if err != nil || n != 1 {
+		t.Fatalf("Purge = %d, %v", n, err)
+	}
+	if _, ok, _ := cache.Load("a"); ok {
+		t.Fatal("purged record still loads")
+	}
+	if _, ok, _ := cache.Load("b"); !ok {
+		t.Fatal("kept record is gone")
+	}
+}
+
+func TestLease(t *testing.T) {
+	c := testClient(t)
+	ctx := context.Background()
+	a, b := &Lease{Client: c, ID: "a"}, &Lease{Client: c, ID: "b"}
+	for _, step := range []struct {
+		lease *Lease
+		want  bool
+	}{{a, true}, {b, false}, {a, true}} {
+		got, err := step.lease.Acquire(ctx, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != step.want {
+			t.Fatalf("%s acquired = %v, want %v", step.lease.ID, got, step.want)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	c := testClient(t)
+	b := &TokenBucket{Client: c, Rate: 1, Burst: 2}
+	ctx := context.Background()
+	for i, want := range []bool{false, false, true} {
+		wait, err := b.Take(ctx, "p", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (wait > 0) != want {
+			t.Fatalf("take %d waits %v", i+1, wait)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	srv := miniredis.RunT(t)
+	c := NewClient(goredis.NewClient(&goredis.Options{Addr: srv.Addr(), Protocol: 2}))
+	defer c.Close()
+	if _, err := c.Do(context.Background(), "SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := srv.Get("k"); got != "v" {
+		t.Fatalf("wrapped client wrote %q", got)
+	}
+}
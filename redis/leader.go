@@ -0,0 +1,96 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Lease is an llmagent.Leader held through a Redis key that names the
+// leader and expires unless renewed.
+type Lease struct {
+	Client *Client
+	Key    string // defaults to "llmagent:leader"
+	// ID names this instance; a random one is chosen when empty.
+	ID string
+
+	once sync.Once
+}
+
+// acquireScript renews the lease if this instance holds it, or takes it
+// if nobody does.
+const acquireScript = `
+local holder = redis.call('GET', KEYS[1])
+if holder == ARGV[1] then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  return 1
+end
+if not holder and redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+  return 1
+end
+return 0
+`
+
+func (l *Lease) Acquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	l.once.Do(func() {
+		if l.ID == "" {
+			b := make([]byte, 8)
+			rand.Read(b)
+			l.ID = hex.EncodeToString(b)
+		}
+	})
+	key := l.Key
+	if key == "" {
+		key = "llmagent:leader"
+	}
+	reply, err := l.Client.Eval(ctx, acquireScript, []string{key}, l.ID, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+// Health is an llmagent.HealthStore keeping the leader's latest probe
+// results under one key.
+type Health struct {
+	Client *Client
+	Key    string // defaults to "llmagent:health"
+	// TTL drops results a dead leader left behind; defaults to 5 minutes.
+	TTL time.Duration
+}
+
+func (h *Health) key() string {
+	if h.Key == "" {
+		return "llmagent:health"
+	}
+	return h.Key
+}
+
+func (h *Health) Publish(ctx context.Context, results map[string]llmagent.ProviderHealth) error {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	ttl := h.TTL
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	_, err = h.Client.Do(ctx, "SET", h.key(), string(data), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (h *Health) Load(ctx context.Context) (map[string]llmagent.ProviderHealth, error) {
+	reply, err := h.Client.Do(ctx, "GET", h.key())
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	var results map[string]llmagent.ProviderHealth
+	err = json.Unmarshal([]byte(reply.(string)), &results)
+	return results, err
+}
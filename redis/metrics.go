@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oarkflow/llmagent"
+)
+
+// Metrics is an llmagent.MetricsStore keeping one hash of totals per
+// provider, for Agent.SharedMetrics.
+type Metrics struct {
+	Client *Client
+	Prefix string // key prefix; defaults to "llmagent:metrics:"
+}
+
+func (m *Metrics) prefix() string {
+	if m.Prefix == "" {
+		return "llmagent:metrics:"
+	}
+	return m.Prefix
+}
+
+// addScript sets rate_limit and last_request_id when given, then applies
+// the field/increment pairs.
+const addScript = `
+if ARGV[1] ~= '' then redis.call('HSET', KEYS[1], 'rate_limit', ARGV[1]) end
+if ARGV[2] ~= '' then redis.call('HSET', KEYS[1], 'last_request_id', ARGV[2]) end
+for i = 3, #ARGV, 2 do redis.call('HINCRBY', KEYS[1], ARGV[i], ARGV[i + 1]) end
+return 0
+`
+
+func (m *Metrics) Add(ctx context.Context, provider string, d llmagent.ProviderMetrics) error {
+	var rateLimit string
+	if d.RateLimit != nil {
+		data, err := json.Marshal(d.RateLimit)
+		if err != nil {
+			return err
+		}
+		rateLimit = string(data)
+	}
+	args := []string{rateLimit, d.LastRequestID}
+	for _, f := range []struct {
+		name string
+		n    int64
+	}{
+		{"success", int64(d.SuccessCount)},
+		{"failure", int64(d.FailureCount)},
+		{"latency_ns", int64(d.TotalLatency)},
+		{"rate_limited", int64(d.RateLimited)},
+		{"completions", int64(d.Completions)},
+		{"stream_errors", int64(d.StreamErrors)},
+		{"prompt_tokens", int64(d.PromptTokens)},
+		{"completion_tokens", int64(d.CompletionTokens)},
+		{"duration_ns", int64(d.TotalDuration)},
+		{"ttft_ns", int64(d.TotalTimeToFirstToken)},
+	} {
+		if f.n != 0 {
+			args = append(args, f.name, strconv.FormatInt(f.n, 10))
+		}
+	}
+	_, err := m.Client.Eval(ctx, addScript, []string{m.prefix() + provider}, args...)
+	return err
+}
+
+func (m *Metrics) Load(ctx context.Context) (map[string]llmagent.ProviderMetrics, error) {
+	keys, err := m.Client.Scan(ctx, m.prefix()+"*")
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]llmagent.ProviderMetrics, len(keys))
+	for _, k := range keys {
+		reply, err := m.Client.Do(ctx, "HGETALL", k)
+		if err != nil {
+			return nil, err
+		}
+		fields, _ := reply.([]any)
+		var pm llmagent.ProviderMetrics
+		for i := 0; i+1 < len(fields); i += 2 {
+			name, _ := fields[i].(string)
+			value, _ := fields[i+1].(string)
+			n, _ := strconv.ParseInt(value, 10, 64)
+			switch name {
+			case "success":
+				pm.SuccessCount = int(n)
+			case "failure":
+				pm.FailureCount = int(n)
+			case "latency_ns":
+				pm.TotalLatency = time.Duration(n)
+			case "rate_limited":
+				pm.RateLimited = int(n)
+			case "completions":
+				pm.Completions = int(n)
+			case "stream_errors":
+				pm.StreamErrors = int(n)
+			case "prompt_tokens":
+				pm.PromptTokens = int(n)
+			case "completion_tokens":
+				pm.CompletionTokens = int(n)
+			case "duration_ns":
+				pm.TotalDuration = time.Duration(n)
+			case "ttft_ns":
+				pm.TotalTimeToFirstToken = time.Duration(n)
+			case "last_request_id":
+				pm.LastRequestID = value
+			case "rate_limit":
+				var rl llmagent.RateLimit
+				if json.Unmarshal([]byte(value), &rl) == nil {
+					pm.RateLimit = &rl
+				}
+			}
+		}
+		out[strings.TrimPrefix(k, m.prefix())] = pm
+	}
+	return out, nil
+}
@@ -0,0 +1,68 @@
+package llmagent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type regionKey struct{}
+
+// RequireRegion restricts requests made with the returned context to
+// providers whose ProviderConfig.Region is one of regions (compared case
+// insensitively). Providers without a region never qualify.
+func RequireRegion(ctx context.Context, regions ...string) context.Context {
+	return context.WithValue(ctx, regionKey{}, regions)
+}
+
+// RegionsFromContext returns the regions set by RequireRegion.
+func RegionsFromContext(ctx context.Context) []string {
+	regions, _ := ctx.Value(regionKey{}).([]string)
+	return regions
+}
+
+// ResidencyError is returned when no registered provider satisfies the
+// request's region constraint.
+type ResidencyError struct {
+	Regions []string
+}
+
+func (e *ResidencyError) Error() string {
+	return fmt.Sprintf("no provider available in region %s", strings.Join(e.Regions, ", "))
+}
+
+// HTTPStatusCode classifies the error as deterministic.
+func (e *ResidencyError) HTTPStatusCode() int { return http.StatusForbidden }
+
+// inRegion reports whether p may serve requests made with ctx.
+func inRegion(ctx context.Context, p Provider) bool {
+	regions := RegionsFromContext(ctx)
+	if len(regions) == 0 {
+		return true
+	}
+	region := p.GetConfig().Region
+	return region != "" && slices.ContainsFunc(regions, func(r string) bool {
+		return strings.EqualFold(r, region)
+	})
+}
+
+// residency drops providers outside the context's regions from the route,
+// promoting the first eligible fallback when the primary is excluded.
+func (a *Agent) residency(ctx context.Context, primary string, fallbacks []string) (string, []string, error) {
+	regions := RegionsFromContext(ctx)
+	if len(regions) == 0 {
+		return primary, fallbacks, nil
+	}
+	var allowed []string
+	for _, name := range append([]string{primary}, fallbacks...) {
+		if p, ok := a.provider(name); ok && inRegion(ctx, p) && !slices.Contains(allowed, name) {
+			allowed = append(allowed, name)
+		}
+	}
+	if len(allowed) == 0 {
+		return "", nil, &ResidencyError{Regions: regions}
+	}
+	return allowed[0], allowed[1:], nil
+}
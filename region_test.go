@@ -0,0 +1,65 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestResidencyRouting(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		regions []string
+		failing string // provider that fails
+		want    string // provider that answers; empty for a ResidencyError
+		called  []string
+	}{
+		{name: "no constraint", want: "us", called: []string{"us"}},
+		{name: "primary outside the region", regions: []string{"eu-west"}, want: "eu", called: []string{"eu"}},
+		{name: "any of several regions", regions: []string{"us-east", "eu-west"}, want: "us", called: []string{"us"}},
+		{name: "region matched case insensitively", regions: []string{"EU-WEST"}, want: "eu", called: []string{"eu"}},
+		{name: "fallbacks stay in the region", regions: []string{"us-east", "eu-west"}, failing: "us", want: "eu", called: []string{"us", "eu"}},
+		{name: "no provider in the region", regions: []string{"ap-south"}, called: nil},
+		{name: "a failing region-bound primary", regions: []string{"us-east"}, failing: "us", called: []string{"us"}},
+	} {
+		var called []string
+		region := func(name, r string) *testProvider {
+			p := newTestProvider(name, func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+				called = append(called, name)
+				if name == tc.failing {
+					return nil, statusError(503)
+				}
+				return answer(name), nil
+			})
+			p.cfg.Region = r
+			return p
+		}
+		a, _ := testAgent(t, region("us", "us-east"), region("eu", "EU-West"), region("none", ""))
+		a.RegisterFallbackProviders([]string{"none", "eu", "us"})
+
+		ctx := context.Background()
+		if tc.regions != nil {
+			ctx = RequireRegion(ctx, tc.regions...)
+		}
+		ch, err := a.Complete(ctx, "us", CompletionRequest{Messages: []Message{User("hi")}})
+		var got string
+		if err == nil {
+			var resp CompletionResponse
+			resp, err = Collect(ch)
+			got = resp.Content
+		}
+		var rerr *ResidencyError
+		switch {
+		case tc.want != "" && (err != nil || got != tc.want):
+			t.Errorf("%s: answer = %q, %v; want %s", tc.name, got, err, tc.want)
+		case tc.want == "" && tc.failing == "" && !errors.As(err, &rerr):
+			t.Errorf("%s: err = %v, want a ResidencyError", tc.name, err)
+		case tc.want == "" && err == nil:
+			t.Errorf("%s: answered %q, want an error", tc.name, got)
+		}
+		if !slices.Equal(called, tc.called) {
+			t.Errorf("%s: called %q, want %q", tc.name, called, tc.called)
+		}
+	}
+}
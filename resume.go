@@ -0,0 +1,268 @@
+package llmagent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checkpoint is the saved progress of a resumable completion.
+type Checkpoint struct {
+	ID       string            `json:"id"`
+	Provider string            `json:"provider"`
+	Request  CompletionRequest `json:"request"`
+	Output   string            `json:"output"`  // text produced so far
+	Resumes  int               `json:"resumes"` // times the completion was continued
+	Updated  time.Time         `json:"updated"`
+}
+
+// CheckpointStore keeps checkpoints across process restarts.
+type CheckpointStore interface {
+	Load(id string) (Checkpoint, bool, error)
+	Save(cp Checkpoint) error
+	Delete(id string) error
+}
+
+// Resumable configures CompleteResumable.
+type Resumable struct {
+	Store CheckpointStore
+	// Every is how often progress is saved while streaming; defaults to
+	// 5 seconds. Progress is also saved when the stream fails.
+	Every time.Duration
+	// MaxResumes caps how often one completion is continued; defaults
+	// to 3.
+	MaxResumes int
+	// ContinuePrompt asks the model to carry on; defaults to
+	// DefaultContinuePrompt.
+	ContinuePrompt string
+	// OnStoreError, if set, receives every error saving or deleting the
+	// checkpoint while the answer streams. Without it the first such
+	// error ends the stream as an error event.
+	OnStoreError func(id string, err error)
+}
+
+// DefaultContinuePrompt follows the partial answer when resuming.
+const DefaultContinuePrompt = "Your previous answer was cut off. Continue it exactly where it stopped, without repeating anything or adding a preamble."
+
+// ErrTooManyResumes is returned when a checkpoint has been resumed
+// MaxResumes times.
+var ErrTooManyResumes = errors.New("llmagent: completion resumed too many times")
+
+// CompleteResumable runs a long completion under id, checkpointing its
+// output to r.Store as it streams. If a checkpoint for id already exists,
+// e.g. because the previous worker crashed, the stored request is resumed
+// instead of req: the model is shown the partial answer and asked to
+// continue, and the stream replays the saved text before the new text, so
+// callers see one uninterrupted answer. The checkpoint is deleted once the
+// answer completes. The underlying request always streams.
+func (a *Agent) CompleteResumable(ctx context.Context, id, provider string, req CompletionRequest, r Resumable) (<-chan CompletionResponse, error) {
+	if r.Store == nil {
+		return nil, errors.New("llmagent: resumable completion needs a CheckpointStore")
+	}
+	cp, found, err := r.Store.Load(id)
+	if err != nil {
+		return nil, fmt.Errorf("load checkpoint %s: %w", id, err)
+	}
+	if !found {
+		cp = Checkpoint{ID: id, Provider: provider, Request: req.clone()}
+	}
+	send := cp.Request.clone()
+	send.Stream = Bool(true)
+	if cp.Output != "" {
+		max := r.MaxResumes
+		if max <= 0 {
+			max = 3
+		}
+		if cp.Resumes >= max {
+			return nil, ErrTooManyResumes
+		}
+		cp.Resumes++
+		prompt := r.ContinuePrompt
+		if prompt == "" {
+			prompt = DefaultContinuePrompt
+		}
+		send.Messages = append(send.Messages, Assistant(cp.Output), User(prompt))
+	}
+	cp.Updated = a.clock().Now()
+	if err := r.Store.Save(cp); err != nil {
+		return nil, fmt.Errorf("save checkpoint %s: %w", id, err)
+	}
+	ch, err := a.Complete(ctx, cp.Provider, send)
+	if err != nil {
+		return nil, err
+	}
+
+	every := r.Every
+	if every <= 0 {
+		every = 5 * time.Second
+	}
+	// the replayed prior output shifts the events, so they are renumbered
+	return indexed(ctx, stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		prior := cp.Output
+		if prior != "" && !emit(CompletionResponse{Content: prior, Role: RoleAssistant}) {
+			return
+		}
+		var text strings.Builder
+		text.WriteString(prior)
+		stitch := &overlapTrimmer{prior: prior}
+		var storeErr error
+		stored := func(err error) {
+			if r.OnStoreError != nil {
+				r.OnStoreError(id, err)
+			} else if storeErr == nil {
+				storeErr = err
+			}
+		}
+		saved := a.clock().Now()
+		save := func() {
+			cp.Output, cp.Updated = text.String(), a.clock().Now()
+			if err := r.Store.Save(cp); err != nil {
+				stored(fmt.Errorf("save checkpoint %s: %w", id, err))
+			}
+			saved = cp.Updated
+		}
+		var failed, finished, gone bool
+		for resp := range ch {
+			if resp.Err != nil {
+				failed = true
+			}
+			if resp.Done {
+				resp.Content = stitch.flush() + resp.Content
+			} else {
+				resp.Content = stitch.next(resp.Content)
+			}
+			text.WriteString(resp.Content)
+			switch {
+			case finished:
+				// the provider's Done event is followed by the agent's
+			case resp.Done && !failed && ctx.Err() == nil:
+				// a Done event racing the caller's cancellation may
+				// close an answer that was cut off
+				finished = true
+				if err := r.Store.Delete(id); err != nil {
+					stored(fmt.Errorf("delete checkpoint %s: %w", id, err))
+				}
+			case resp.Done, a.clock().Now().Sub(saved) >= every:
+				save()
+			}
+			if !emit(resp) {
+				gone = true
+				break
+			}
+		}
+		// a stream ending without a Done event still owes the held-back
+		// text to the checkpoint and, if it is listening, the caller
+		if rest := stitch.flush(); rest != "" {
+			text.WriteString(rest)
+			gone = gone || !emit(CompletionResponse{Content: rest, Role: RoleAssistant})
+		}
+		if !finished {
+			save() // failed or cut off; keep what we have for the next try
+		}
+		if storeErr != nil && !gone {
+			emit(CompletionResponse{Err: storeErr})
+		}
+	})), nil
+}
+
+// overlapTrimmer drops text a resumed model repeats from the end of the
+// saved output. It holds back the first overlapWindow bytes to compare.
+type overlapTrimmer struct {
+	prior string
+	buf   strings.Builder
+	done  bool
+}
+
+const overlapWindow = 200
+
+func (t *overlapTrimmer) next(s string) string {
+	if t.done || t.prior == "" {
+		return s
+	}
+	t.buf.WriteString(s)
+	if t.buf.Len() < overlapWindow {
+		return ""
+	}
+	return t.flush()
+}
+
+func (t *overlapTrimmer) flush() string {
+	if t.done || t.prior == "" {
+		return ""
+	}
+	t.done = true
+	s := t.buf.String()
+	// the longest prefix of s that ends the prior output, if long enough
+	// to be a real repeat rather than a coincidence
+	for n := min(len(s), len(t.prior)); n >= 20; n-- {
+		if strings.HasSuffix(t.prior, s[:n]) {
+			return s[n:]
+		}
+	}
+	return s
+}
+
+// DirCheckpoints is a CheckpointStore keeping one JSON file per
+// checkpoint in a directory.
+type DirCheckpoints struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewDirCheckpoints opens (creating if needed) a checkpoint directory.
+func NewDirCheckpoints(dir string) (*DirCheckpoints, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DirCheckpoints{dir: dir}, nil
+}
+
+func (d *DirCheckpoints) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (d *DirCheckpoints) Load(id string) (Checkpoint, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	data, err := os.ReadFile(d.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Checkpoint{}, false, nil
+	}
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return Checkpoint{}, false, err
+	}
+	return cp, cp.ID == id, nil
+}
+
+func (d *DirCheckpoints) Save(cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return writeAtomic(d.path(cp.ID), data)
+}
+
+func (d *DirCheckpoints) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.Remove(d.path(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
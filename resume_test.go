@@ -0,0 +1,132 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// memCheckpoints is a CheckpointStore in memory. Saves after the first
+// fail with saveErr, and deletes with deleteErr.
+type memCheckpoints struct {
+	mu        sync.Mutex
+	cps       map[string]Checkpoint
+	saves     int
+	saveErr   error
+	deleteErr error
+	saved     chan Checkpoint // receives every successful save, if set
+}
+
+func (m *memCheckpoints) Load(id string) (Checkpoint, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp, ok := m.cps[id]
+	return cp, ok, nil
+}
+
+func (m *memCheckpoints) Save(cp Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.saves++; m.saves > 1 && m.saveErr != nil {
+		return m.saveErr
+	}
+	if m.cps == nil {
+		m.cps = make(map[string]Checkpoint)
+	}
+	m.cps[cp.ID] = cp
+	if m.saved != nil {
+		m.saved <- cp
+	}
+	return nil
+}
+
+func (m *memCheckpoints) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+	delete(m.cps, id)
+	return nil
+}
+
+func TestResumableKeepsHeldBackTextWhenCutOff(t *testing.T) {
+	const prior = "The first half of a long answer, saved before the crash."
+	const more = " And here is the rest of it."
+	const pad = 20
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		ch := make(chan CompletionResponse)
+		go func() {
+			defer close(ch)
+			// the empty events push the short continuation, which the
+			// overlap check holds back, through every stage
+			for i, ev := range append([]string{more}, make([]string, pad)...) {
+				select {
+				case ch <- CompletionResponse{Content: ev}:
+				case <-ctx.Done():
+					t.Errorf("cancelled after %d events", i)
+					return
+				}
+			}
+			<-ctx.Done()
+		}()
+		return ch, nil
+	})
+	a, _ := testAgent(t, p)
+	store := &memCheckpoints{cps: map[string]Checkpoint{"job": {ID: "job", Provider: "p", Output: prior}}, saved: make(chan Checkpoint, 4)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := a.CompleteResumable(ctx, "job", "p", CompletionRequest{}, Resumable{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-store.saved // the resume itself
+	if ev := <-ch; ev.Content != prior {
+		t.Fatalf("replayed %q", ev.Content)
+	}
+	for range pad {
+		if ev := <-ch; ev.Content != "" {
+			t.Fatalf("continuation %q emitted before the overlap window filled", ev.Content)
+		}
+	}
+	cancel()
+	if cp := <-store.saved; cp.Output != prior+more {
+		t.Fatalf("checkpoint output = %q, want %q", cp.Output, prior+more)
+	}
+	for range ch {
+	}
+}
+
+func TestResumableReportsStoreErrors(t *testing.T) {
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return answer("done"), nil
+	})
+	a, _ := testAgent(t, p)
+	storeErr := errors.New("disk full")
+
+	store := &memCheckpoints{deleteErr: storeErr}
+	ch, err := a.CompleteResumable(context.Background(), "job", "p", CompletionRequest{}, Resumable{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := Collect(ch); !errors.Is(err, storeErr) || resp.Content != "done" {
+		t.Fatalf("Collect = %q, %v; want the answer and the store error", resp.Content, err)
+	}
+
+	var reported []error
+	store = &memCheckpoints{deleteErr: storeErr}
+	ch, err = a.CompleteResumable(context.Background(), "job", "p", CompletionRequest{}, Resumable{
+		Store:        store,
+		OnStoreError: func(id string, err error) { reported = append(reported, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Collect(ch); err != nil {
+		t.Fatalf("Collect with OnStoreError: %v", err)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], storeErr) {
+		t.Fatalf("reported %v", reported)
+	}
+}
@@ -0,0 +1,130 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type userKey struct{}
+
+// WithUser tags requests made with the returned context as belonging to a
+// user or tenant, so their stored data can be purged with PurgeUserData.
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserFromContext returns the user set by WithUser.
+func UserFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(userKey{}).(string)
+	return id
+}
+
+// DataStore is a store holding user data, such as a conversation store,
+// audit sink or feedback log. Register stores in Agent.DataStores so
+// purges and retention cover them.
+type DataStore interface {
+	Name() string
+	// PurgeUser deletes everything linked to userID and returns the
+	// number of records removed.
+	PurgeUser(ctx context.Context, userID string) (int, error)
+	// PurgeBefore deletes records stored before cutoff.
+	PurgeBefore(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// PurgeReport lists what was deleted, by store name.
+type PurgeReport struct {
+	UserID  string           `json:"user_id,omitempty"`
+	Deleted map[string]int   `json:"deleted"`
+	Errors  map[string]error `json:"-"`
+	At      time.Time        `json:"at"`
+}
+
+// CacheStoreName is the name of the built-in response cache in reports and
+// in Agent.Retention.
+const CacheStoreName = "cache"
+
+// PurgeUserData deletes cache entries and records in every DataStore linked
+// to userID. Stores that fail are listed in the report's Errors and joined
+// into the returned error; the others are still purged.
+func (a *Agent) PurgeUserData(ctx context.Context, userID string) (PurgeReport, error) {
+	if userID == "" {
+		return PurgeReport{}, errors.New("user id is required")
+	}
+	report := PurgeReport{UserID: userID, Deleted: make(map[string]int), At: a.clock().Now()}
+	report.Deleted[CacheStoreName] = a.cache.purge(func(e *cacheEntry) bool { return e.user == userID })
+	a.purgeCacheTier(&report, func(r CacheRecord) bool { return r.User == userID })
+	return report, a.eachStore(&report, func(s DataStore) (int, error) { return s.PurgeUser(ctx, userID) })
+}
+
+// ApplyRetention deletes data older than the TTL configured for each store
+// in Agent.Retention. Stores without a TTL are left alone.
+func (a *Agent) ApplyRetention(ctx context.Context) (PurgeReport, error) {
+	now := a.clock().Now()
+	report := PurgeReport{Deleted: make(map[string]int), At: now}
+	if ttl := a.Retention[CacheStoreName]; ttl > 0 {
+		cutoff := now.Add(-ttl)
+		report.Deleted[CacheStoreName] = a.cache.purge(func(e *cacheEntry) bool { return e.storedAt.Before(cutoff) })
+		a.purgeCacheTier(&report, func(r CacheRecord) bool { return r.StoredAt.Before(cutoff) })
+	}
+	return report, a.eachStore(&report, func(s DataStore) (int, error) {
+		ttl := a.Retention[s.Name()]
+		if ttl <= 0 {
+			return 0, nil
+		}
+		return s.PurgeBefore(ctx, now.Add(-ttl))
+	})
+}
+
+// RunRetention calls ApplyRetention every interval of the agent's Clock
+// until ctx is done, passing each report to onReport if it is non-nil.
+func (a *Agent) RunRetention(ctx context.Context, interval time.Duration, onReport func(PurgeReport, error)) {
+	ticker := a.clock().NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+			report, err := a.ApplyRetention(ctx)
+			if onReport != nil {
+				onReport(report, err)
+			}
+		}
+	}()
+}
+
+func (a *Agent) eachStore(report *PurgeReport, fn func(DataStore) (int, error)) error {
+	var errs []error
+	if err := report.Errors[CacheStoreName]; err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", CacheStoreName, err))
+	}
+	for _, s := range a.DataStores {
+		n, err := fn(s)
+		report.Deleted[s.Name()] += n
+		if err != nil {
+			if report.Errors == nil {
+				report.Errors = make(map[string]error)
+			}
+			report.Errors[s.Name()] = err
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// purgeCacheTier applies fn to Agent.CacheTier, counting deletions under
+// the cache's name.
+func (a *Agent) purgeCacheTier(report *PurgeReport, fn func(CacheRecord) bool) {
+	n, err := a.purgeTier(fn)
+	report.Deleted[CacheStoreName] += n
+	if err != nil {
+		if report.Errors == nil {
+			report.Errors = make(map[string]error)
+		}
+		report.Errors[CacheStoreName] = err
+	}
+}
@@ -0,0 +1,180 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRetryBudgetExhausted is joined into the error returned when a request
+// runs out of its retry budget before any provider succeeded.
+var ErrRetryBudgetExhausted = errors.New("llmagent: retry budget exhausted")
+
+// RetryBudget bounds the total work spent on one request across the primary
+// provider and every fallback. Zero fields mean no limit.
+type RetryBudget struct {
+	MaxAttempts int           // total upstream attempts
+	MaxElapsed  time.Duration // wall time from the first attempt
+}
+
+// DefaultMaxRetryDelay is the longest Retry-After a provider is retried
+// after when ProviderConfig.MaxRetryDelay is unset.
+const DefaultMaxRetryDelay = 30 * time.Second
+
+// defaultRetryDelay spaces attempts whose failure carries no Retry-After.
+const defaultRetryDelay = 100 * time.Millisecond
+
+type retryBudgetKey struct{}
+
+// WithRetryBudget overrides the agent's RetryBudget for requests made with
+// the returned context.
+func WithRetryBudget(ctx context.Context, b RetryBudget) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, b)
+}
+
+// budgetTracker counts attempts and elapsed time against a RetryBudget.
+type budgetTracker struct {
+	RetryBudget
+	clock    Clock
+	start    time.Time
+	attempts int
+}
+
+func newBudgetTracker(ctx context.Context, def RetryBudget, clock Clock) *budgetTracker {
+	b := def
+	if v, ok := ctx.Value(retryBudgetKey{}).(RetryBudget); ok {
+		b = v
+	}
+	clock = clockOr(clock)
+	return &budgetTracker{RetryBudget: b, clock: clock, start: clock.Now()}
+}
+
+// take reserves one attempt, reporting false when the budget is spent.
+func (b *budgetTracker) take() bool {
+	if b.MaxAttempts > 0 && b.attempts >= b.MaxAttempts {
+		return false
+	}
+	if b.MaxElapsed > 0 && b.clock.Now().Sub(b.start) >= b.MaxElapsed {
+		return false
+	}
+	b.attempts++
+	return true
+}
+
+// fits reports whether waiting d leaves time for another attempt.
+func (b *budgetTracker) fits(d time.Duration) bool {
+	return b.MaxElapsed <= 0 || b.clock.Now().Sub(b.start)+d < b.MaxElapsed
+}
+
+// retryDelay returns how long to wait before retrying p after err: what a
+// 429 or 503 asked for, or defaultRetryDelay. ok is false when the provider
+// asked for longer than its MaxRetryDelay, so the request should move on.
+func retryDelay(p Provider, err error, now time.Time) (d time.Duration, ok bool) {
+	if !isRateLimited(err) {
+		return defaultRetryDelay, true
+	}
+	d, found := RetryAfter(ErrorHeader(err), now)
+	if !found {
+		return defaultRetryDelay, true
+	}
+	limit := p.GetConfig().MaxRetryDelay
+	if limit <= 0 {
+		limit = DefaultMaxRetryDelay
+	}
+	return d, d <= limit
+}
+
+// wait sleeps for d between attempts, cut short by ctx or the elapsed budget.
+func (b *budgetTracker) wait(ctx context.Context, d time.Duration) error {
+	if b.MaxElapsed > 0 {
+		if remaining := b.MaxElapsed - b.clock.Now().Sub(b.start); remaining < d {
+			d = max(remaining, 0)
+		}
+	}
+	t := b.clock.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C():
+		return nil
+	}
+}
+
+// requestRun is the shared state of one Agent.Complete call: its retry
+// budget and the record of failed attempts. It is safe for concurrent use
+// by hedged attempts.
+type requestRun struct {
+	mu     sync.Mutex
+	budget *budgetTracker
+	agg    *AggregateError
+}
+
+// take reserves an attempt from the budget.
+func (r *requestRun) take() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.budget.take() {
+		r.agg.BudgetExhausted = true
+		return false
+	}
+	return true
+}
+
+func (r *requestRun) record(at Attempt) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agg.Attempts = append(r.agg.Attempts, at)
+}
+
+// aggregate returns the AggregateError, or nil if nothing was attempted.
+func (r *requestRun) aggregate() *AggregateError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.agg.Attempts) == 0 && !r.agg.BudgetExhausted {
+		return nil
+	}
+	return r.agg
+}
+
+// metaOnly reports whether resp is a provider's header event carrying
+// nothing but Meta.
+func metaOnly(resp CompletionResponse) bool {
+	return resp.Meta != nil && resp.Content == "" && resp.Err == nil && resp.Usage == nil && !resp.Done
+}
+
+// firstResponse waits for the first event on ch past the leading
+// header metadata. If it is an error the attempt is considered failed and
+// the error is returned; otherwise a channel replaying the events read so
+// far followed by the rest of ch is returned.
+func firstResponse(ctx context.Context, ch <-chan CompletionResponse) (<-chan CompletionResponse, error) {
+	var metas []CompletionResponse
+	first, ok := <-ch
+	for ok && metaOnly(first) {
+		metas = append(metas, first)
+		first, ok = <-ch
+	}
+	if ok && first.Err != nil && first.Content == "" {
+		spawn(ctx, func() {
+			for range ch {
+			}
+		})
+		return nil, first.Err
+	}
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		for _, m := range metas {
+			if !emit(m) {
+				return
+			}
+		}
+		if !ok || !emit(first) {
+			return
+		}
+		for resp := range ch {
+			if !emit(resp) {
+				return
+			}
+		}
+	}), nil
+}
@@ -0,0 +1,56 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryBudget(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		agent, request *RetryBudget
+		retries        int    // RetryCount of both providers
+		retryAfter     string // of every failure
+		primary, fb    int32  // calls
+		exhausted      bool
+	}{
+		{"unlimited", nil, nil, 1, "0", 2, 2, false},
+		{"attempts shared with the fallback", &RetryBudget{MaxAttempts: 3}, nil, 1, "0", 2, 1, true},
+		{"spent on the primary", &RetryBudget{MaxAttempts: 2}, nil, 2, "0", 2, 0, true},
+		{"no time for the requested wait", &RetryBudget{MaxElapsed: 3 * time.Second}, nil, 1, "5", 1, 1, false},
+		{"per-request override", &RetryBudget{MaxAttempts: 1}, &RetryBudget{}, 1, "0", 2, 2, false},
+	} {
+		fail := func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+			return nil, rateLimited{retryAfter: tc.retryAfter}
+		}
+		p, fb := newTestProvider("p", fail), newTestProvider("fb", fail)
+		p.cfg.RetryCount, fb.cfg.RetryCount = tc.retries, tc.retries
+		a, _ := testAgent(t, p, fb)
+		a.RegisterFallbackProviders([]string{"fb"})
+		if tc.agent != nil {
+			a.RetryBudget = *tc.agent
+		}
+		ctx := context.Background()
+		if tc.request != nil {
+			ctx = WithRetryBudget(ctx, *tc.request)
+		}
+
+		_, err := a.Complete(ctx, "p", CompletionRequest{Messages: []Message{User("hi")}})
+		var agg *AggregateError
+		if !errors.As(err, &agg) {
+			t.Errorf("%s: err = %v, want an AggregateError", tc.name, err)
+			continue
+		}
+		if got, want := len(agg.Attempts), int(tc.primary+tc.fb); got != want {
+			t.Errorf("%s: %d attempts recorded, want %d", tc.name, got, want)
+		}
+		if p.calls.Load() != tc.primary || fb.calls.Load() != tc.fb {
+			t.Errorf("%s: calls = %d primary, %d fallback; want %d, %d", tc.name, p.calls.Load(), fb.calls.Load(), tc.primary, tc.fb)
+		}
+		if errors.Is(err, ErrRetryBudgetExhausted) != tc.exhausted {
+			t.Errorf("%s: exhausted = %v, want %v", tc.name, !tc.exhausted, tc.exhausted)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package llmagent
+
+import "fmt"
+
+// Role identifies the author of a message.
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+	RoleTool      Role = "tool"
+)
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RoleSystem, RoleUser, RoleAssistant, RoleTool:
+		return true
+	}
+	return false
+}
+
+// System returns a system message.
+func System(content string) Message {
+	return Message{Role: RoleSystem, Content: content}
+}
+
+// User returns a user message.
+func User(content string) Message {
+	return Message{Role: RoleUser, Content: content}
+}
+
+// Assistant returns an assistant message.
+func Assistant(content string) Message {
+	return Message{Role: RoleAssistant, Content: content}
+}
+
+// Tool returns a message carrying the result of the named tool.
+func Tool(name, content string) Message {
+	return Message{Role: RoleTool, Name: name, Content: content}
+}
+
+// ToolCallsMessage returns the assistant turn that made calls, to be sent
+// back ahead of their results.
+func ToolCallsMessage(content string, calls []ToolCall) Message {
+	return Message{Role: RoleAssistant, Content: content, ToolCalls: calls}
+}
+
+// ToolReply returns the result of call as a tool message.
+func ToolReply(call ToolCall, content string) Message {
+	return Message{Role: RoleTool, Name: call.Name, ToolCallID: call.ID, Content: content}
+}
+
+// validateMessages rejects unknown roles before a request reaches a
+// provider, where a typo would otherwise come back as an upstream 400.
+func validateMessages(msgs []Message) error {
+	for i, msg := range msgs {
+		if !msg.Role.Valid() {
+			return fmt.Errorf("message %d: unknown role %q", i, msg.Role)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Run owns the goroutines of a unit of agent work under one cancellable
+// group, with errgroup semantics: the first goroutine to fail cancels the
+// rest, and Wait returns once all of them have finished.
+//
+// Requests made with Run.Context start their pipeline goroutines (provider
+// streams, hedged attempts, output checks, transformers) in the run, so
+// cancelling it stops them all, and Wait guarantees none is left behind:
+//
+//	run := llmagent.NewRun(ctx)
+//	ch, err := agent.Complete(run.Context(), "", req)
+//	... read as much of ch as needed ...
+//	run.Cancel()
+//	err = run.Wait()
+//
+// Without a Run, those goroutines end when the stream is drained or ctx
+// is cancelled; the Run adds Wait and error collection. Shadow
+// comparisons outlive their request by design and are not part of any
+// run.
+type Run struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+type runKey struct{}
+
+// NewRun returns a Run whose context is derived from ctx.
+func NewRun(ctx context.Context) *Run {
+	r := &Run{}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	r.ctx = context.WithValue(r.ctx, runKey{}, r)
+	return r
+}
+
+// runFromContext returns the Run ctx was derived from, if any.
+func runFromContext(ctx context.Context) *Run {
+	r, _ := ctx.Value(runKey{}).(*Run)
+	return r
+}
+
+// Context returns the run's context; it is done once the run is cancelled
+// or a goroutine has failed.
+func (r *Run) Context() context.Context { return r.ctx }
+
+// Go runs fn in a new goroutine of the run. An error or panic from fn
+// cancels the run and is reported by Wait. Go must not be called after
+// Wait has returned.
+func (r *Run) Go(fn func(ctx context.Context) error) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if err := r.call(fn); err != nil {
+			r.mu.Lock()
+			r.errs = append(r.errs, err)
+			r.mu.Unlock()
+			r.cancel()
+		}
+	}()
+}
+
+func (r *Run) call(fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("llmagent: run goroutine panicked: %v", v)
+		}
+	}()
+	return fn(r.ctx)
+}
+
+// Cancel stops the run. Goroutines see their context done and stop
+// forwarding responses.
+func (r *Run) Cancel() { r.cancel() }
+
+// Wait blocks until every goroutine of the run has finished, then releases
+// the run's context and returns their errors joined.
+func (r *Run) Wait() error {
+	r.wg.Wait()
+	r.cancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return errors.Join(r.errs...)
+}
+
+// spawn runs fn in ctx's Run, or in a plain goroutine when there is none.
+func spawn(ctx context.Context, fn func()) {
+	if r := runFromContext(ctx); r != nil {
+		r.Go(func(context.Context) error {
+			fn()
+			return nil
+		})
+		return
+	}
+	go fn()
+}
+
+// stage starts fn as a pipeline stage reading in, if any, and writing the
+// returned channel. fn sends through emit, which reports false once ctx is
+// done, which includes its Run being cancelled; fn should then return, so
+// a consumer that stops reading and cancels leaks no goroutine. Whatever
+// is left of in is drained so the stage upstream finishes too.
+func stage(ctx context.Context, in <-chan CompletionResponse, fn func(emit func(CompletionResponse) bool)) <-chan CompletionResponse {
+	done := ctx.Done()
+	out := make(chan CompletionResponse)
+	emit := func(resp CompletionResponse) bool {
+		select {
+		case out <- resp:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	spawn(ctx, func() {
+		defer close(out)
+		fn(emit)
+		if in != nil {
+			for range in {
+			}
+		}
+	})
+	return out
+}
@@ -0,0 +1,63 @@
+package llmagent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// endless streams events until ctx is done.
+func endless(ctx context.Context) <-chan CompletionResponse {
+	return stage(ctx, nil, func(emit func(CompletionResponse) bool) {
+		for emit(CompletionResponse{Content: "x"}) {
+		}
+	})
+}
+
+// waitRun fails unless run's goroutines all finish soon.
+func waitRun(t *testing.T, name string, run *Run) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- run.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s: goroutines still running after the run was cancelled", name)
+	}
+}
+
+func TestRunStopsAbandonedStreams(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		wrap func(ctx context.Context, ch <-chan CompletionResponse) <-chan CompletionResponse
+	}{
+		{"Track", func(ctx context.Context, ch <-chan CompletionResponse) <-chan CompletionResponse {
+			return NewTranscript().Track(ctx, CompletionRequest{}, ch)
+		}},
+		{"TraceStream", func(ctx context.Context, ch <-chan CompletionResponse) <-chan CompletionResponse {
+			out, _ := TraceStream(ctx, CompletionRequest{}, ch)
+			return out
+		}},
+	} {
+		run := NewRun(context.Background())
+		out := tc.wrap(run.Context(), endless(run.Context()))
+		<-out // read a little, then stop reading
+		run.Cancel()
+		waitRun(t, tc.name, run)
+	}
+}
+
+func TestRunStopsAbandonedCommonResponses(t *testing.T) {
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return endless(ctx), nil
+	})
+	a, _ := testAgent(t, p)
+	run := NewRun(context.Background())
+	ch, err := a.StreamCommonResponse(run.Context(), "p", CompletionRequest{Messages: []Message{User("hi")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	run.Cancel()
+	waitRun(t, "StreamCommonResponse", run)
+}
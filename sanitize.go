@@ -0,0 +1,136 @@
+package llmagent
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SanitizeOptions configures the input sanitation stage run on every
+// message before it reaches a provider. Zero fields take the defaults.
+type SanitizeOptions struct {
+	MaxSpaces      int     // longest run of spaces/tabs kept; defaults to 16
+	MaxBlankLines  int     // longest run of blank lines kept; defaults to 2
+	MaxBinaryRatio float64 // reject text with a larger share of invalid or control bytes; defaults to 0.05
+	SkipNFC        bool    // keep the original Unicode normalization form
+}
+
+// SanitizeError reports a message that looks like binary data rather than
+// text. It counts as a 400 so it is not retried.
+type SanitizeError struct {
+	Message int // index in CompletionRequest.Messages
+	Reason  string
+}
+
+func (e *SanitizeError) Error() string {
+	return fmt.Sprintf("message %d: %s", e.Message, e.Reason)
+}
+
+func (e *SanitizeError) HTTPStatusCode() int { return http.StatusBadRequest }
+
+func (o SanitizeOptions) withDefaults() SanitizeOptions {
+	if o.MaxSpaces <= 0 {
+		o.MaxSpaces = 16
+	}
+	if o.MaxBlankLines <= 0 {
+		o.MaxBlankLines = 2
+	}
+	if o.MaxBinaryRatio <= 0 {
+		o.MaxBinaryRatio = 0.05
+	}
+	return o
+}
+
+// Sanitize cleans text: it rejects binary garbage, removes byte order marks,
+// NULs and other control characters, normalizes line endings and Unicode
+// (NFC), trims trailing spaces and caps runs of whitespace.
+func Sanitize(text string, opts SanitizeOptions) (string, error) {
+	opts = opts.withDefaults()
+	if text == "" {
+		return text, nil
+	}
+	var bad int
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if (r == utf8.RuneError && size == 1) || (r < 0x20 && r != '\t' && r != '\n' && r != '\r') {
+			bad++
+		}
+		i += size
+	}
+	if ratio := float64(bad) / float64(len(text)); ratio > opts.MaxBinaryRatio {
+		return "", fmt.Errorf("looks like binary data (%.0f%% invalid or control bytes)", ratio*100)
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\r':
+			return '\n'
+		case r == '\t' || r == '\n':
+			return r
+		case r == '\uFEFF' || r == utf8.RuneError:
+			return -1
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, text)
+	if !opts.SkipNFC {
+		text = norm.NFC.String(text)
+	}
+
+	var b strings.Builder
+	b.Grow(len(text))
+	blank := 0
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" {
+			blank++
+			if blank > opts.MaxBlankLines {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		capSpaces(&b, line, opts.MaxSpaces)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// capSpaces writes line, shortening runs of spaces and tabs to max.
+func capSpaces(b *strings.Builder, line string, max int) {
+	run := 0
+	for _, r := range line {
+		if r == ' ' || r == '\t' {
+			run++
+			if run > max {
+				continue
+			}
+		} else {
+			run = 0
+		}
+		b.WriteRune(r)
+	}
+}
+
+// sanitize applies opts to every message of req.
+func sanitize(req CompletionRequest, opts SanitizeOptions) (CompletionRequest, error) {
+	msgs := make([]Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		content, err := Sanitize(msg.Content, opts)
+		if err != nil {
+			return req, &SanitizeError{Message: i, Reason: err.Error()}
+		}
+		msg.Content = content
+		msgs[i] = msg
+	}
+	req.Messages = msgs
+	return req, nil
+}
@@ -1,15 +1,42 @@
 package claude
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/oarkflow/llmagent/sdk/internal/jsonhttp"
 )
 
+// APIError is returned for any non-200 response from the API.
+type APIError struct {
+	StatusCode int
+	Body       string
+	Header     http.Header
+}
+
+func (e *APIError) Error() string {
+	status := http.StatusText(e.StatusCode)
+	if status == "" {
+		status = strconv.Itoa(e.StatusCode) // e.g. 529, overloaded
+	}
+	return "HTTP " + status + ": " + e.Body
+}
+
+// HTTPStatusCode exposes the status code to callers that only know the
+// error interface.
+func (e *APIError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// HTTPHeader exposes the response headers, e.g. Retry-After on a 429.
+func (e *APIError) HTTPHeader() http.Header {
+	return e.Header
+}
+
 type Client struct {
 	APIKey             string
 	BaseURL            string
@@ -18,6 +45,16 @@ type Client struct {
 	DefaultModel       string
 	SupportedModels    []string
 	HttpClient         *http.Client
+	// GzipThreshold compresses request bodies larger than this many bytes
+	// (0 disables). Only enable it for endpoints that accept gzip uploads.
+	GzipThreshold int
+	// MaxResponseBytes caps how much of an error response body is read
+	// (0 = 16 MiB).
+	MaxResponseBytes int
+	// Version is sent as anthropic-version; defaults to 2023-06-01.
+	Version string
+	// Beta lists anthropic-beta feature flags.
+	Beta []string
 }
 
 func NewClient(apiKey, baseURL, completionEndpoint string, timeout time.Duration, defaultModel string, supportedModels []string) *Client {
@@ -32,25 +69,25 @@ func NewClient(apiKey, baseURL, completionEndpoint string, timeout time.Duration
 	}
 }
 
-func (c *Client) Complete(ctx context.Context, payload map[string]any) (io.ReadCloser, error) {
-	data, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
+// Complete sends payload, encoded as JSON, and returns the response body.
+func (c *Client) Complete(ctx context.Context, payload any) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("x-api-key", c.APIKey)
+	version := c.Version
+	if version == "" {
+		version = "2023-06-01"
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+c.CompletionEndpoint, bytes.NewReader(data))
-	if err != nil {
-		return nil, err
+	header.Set("anthropic-version", version)
+	if len(c.Beta) > 0 {
+		header.Set("anthropic-beta", strings.Join(c.Beta, ","))
 	}
-	req.Header.Set("x-api-key", c.APIKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.HttpClient.Do(req)
+	resp, err := jsonhttp.Post(ctx, c.HttpClient, c.BaseURL+c.CompletionEndpoint, header, payload, c.GzipThreshold)
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, errors.New("HTTP " + http.StatusText(resp.StatusCode) + ": " + string(body))
+		body := jsonhttp.ErrorBody(resp, c.MaxResponseBytes)
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: body, Header: resp.Header}
 	}
-	return resp.Body, nil
+	return jsonhttp.HeaderBody(resp), nil
 }
@@ -0,0 +1,229 @@
+// Package jsonhttp sends the JSON requests of the sdk clients: it encodes
+// payloads into pooled buffers, gzips large ones, and transparently
+// gunzips responses.
+package jsonhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Body is an encoded request payload. Its buffer goes back to the pool once
+// the response body is closed and the transport has closed every reader of
+// it, so a replayed or still-writing request never sees a recycled buffer.
+type Body struct {
+	buf     *buffer
+	gzipped bool
+	refs    atomic.Int32
+}
+
+// buffer pairs a buffer with an encoder writing to it, so neither is
+// allocated per request.
+type buffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+var (
+	bufPool = sync.Pool{New: func() any {
+		b := &buffer{}
+		b.enc = json.NewEncoder(&b.Buffer)
+		return b
+	}}
+	gzipPool = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+)
+
+// maxPooledBody keeps the pool from pinning the buffers of rare huge
+// requests.
+const maxPooledBody = 1 << 20
+
+// Encode encodes payload as JSON, gzipped when it exceeds gzipAbove bytes
+// (0 never gzips). The caller holds one reference, dropped by Release.
+func Encode(payload any, gzipAbove int) (*Body, error) {
+	buf := bufPool.Get().(*buffer)
+	buf.Reset()
+	b := &Body{buf: buf}
+	b.refs.Store(1)
+	if err := buf.enc.Encode(payload); err != nil {
+		b.Release()
+		return nil, err
+	}
+	buf.Truncate(buf.Len() - 1) // Encode's trailing newline
+	if gzipAbove <= 0 || buf.Len() <= gzipAbove {
+		return b, nil
+	}
+	gz := bufPool.Get().(*buffer)
+	gz.Reset()
+	zw := gzipPool.Get().(*gzip.Writer)
+	defer gzipPool.Put(zw)
+	zw.Reset(gz)
+	_, err := zw.Write(buf.Bytes())
+	if err == nil {
+		err = zw.Close()
+	}
+	put(buf)
+	b.buf, b.gzipped = gz, true
+	if err != nil {
+		b.Release()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Bytes returns the encoded payload; it is only valid until the body is
+// recycled.
+func (b *Body) Bytes() []byte { return b.buf.Bytes() }
+
+// Gzipped reports whether the payload was compressed.
+func (b *Body) Gzipped() bool { return b.gzipped }
+
+// Release drops a reference, recycling the buffer with the last one.
+func (b *Body) Release() {
+	if b.refs.Add(-1) == 0 {
+		put(b.buf)
+		b.buf = nil
+	}
+}
+
+func put(buf *buffer) {
+	if buf.Cap() <= maxPooledBody {
+		bufPool.Put(buf)
+	}
+}
+
+// reader is one pass of the transport over the body.
+type reader struct {
+	bytes.Reader
+	body   *Body
+	closed atomic.Bool
+}
+
+func (b *Body) reader() io.ReadCloser {
+	b.refs.Add(1)
+	r := &reader{body: b}
+	r.Reset(b.buf.Bytes())
+	return r
+}
+
+func (r *reader) Close() error {
+	if !r.closed.Swap(true) {
+		r.body.Release()
+	}
+	return nil
+}
+
+// Post sends payload to url as JSON with the given headers. The returned
+// response's body is gunzipped if the server compressed it; closing it
+// also recycles the request buffer. net/http may replay the request, e.g.
+// on a stale keep-alive connection, as GetBody is set.
+func Post(ctx context.Context, client *http.Client, url string, header http.Header, payload any, gzipAbove int) (*http.Response, error) {
+	body, err := Encode(payload, gzipAbove)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		body.Release()
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	if body.gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.ContentLength = int64(body.buf.Len())
+	req.Body = body.reader()
+	req.GetBody = func() (io.ReadCloser, error) { return body.reader(), nil }
+	resp, err := client.Do(req)
+	if err != nil {
+		body.Release()
+		return nil, err
+	}
+	rc, err := decode(resp)
+	if err != nil {
+		resp.Body.Close()
+		body.Release()
+		return nil, err
+	}
+	resp.Body = &responseBody{ReadCloser: rc, body: body}
+	return resp, nil
+}
+
+// decode returns the response body, transparently gunzipping it. The gzip
+// reader decompresses incrementally, so streamed events arrive as soon as
+// the server flushes them.
+func decode(resp *http.Response) (io.ReadCloser, error) {
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return resp.Body, nil
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return gzipBody{Reader: zr, body: resp.Body}, nil
+}
+
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (g gzipBody) Close() error {
+	g.Reader.Close()
+	return g.body.Close()
+}
+
+// responseBody releases the request buffer once the response is closed.
+type responseBody struct {
+	io.ReadCloser
+	body   *Body
+	closed atomic.Bool
+}
+
+func (r *responseBody) Close() error {
+	err := r.ReadCloser.Close()
+	if !r.closed.Swap(true) {
+		r.body.Release()
+	}
+	return err
+}
+
+// HeaderBody keeps the response headers reachable from a returned body;
+// see its Header method.
+func HeaderBody(resp *http.Response) io.ReadCloser {
+	return headerBody{ReadCloser: resp.Body, header: resp.Header}
+}
+
+type headerBody struct {
+	io.ReadCloser
+	header http.Header
+}
+
+// Header returns the HTTP response headers.
+func (h headerBody) Header() http.Header { return h.header }
+
+// DefaultMaxErrorBytes caps error bodies read by ErrorBody when the client
+// sets no limit; it matches llmagent.DefaultMaxBodyBytes.
+const DefaultMaxErrorBytes = 16 << 20
+
+// ErrorBody reads and closes the body of a failed response, keeping at
+// most max bytes (DefaultMaxErrorBytes when max <= 0). A longer body is
+// cut off rather than failing, so the status code still reaches the
+// caller.
+func ErrorBody(resp *http.Response, max int) string {
+	defer resp.Body.Close()
+	if max <= 0 {
+		max = DefaultMaxErrorBytes
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, int64(max)))
+	return string(b)
+}
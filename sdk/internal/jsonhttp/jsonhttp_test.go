@@ -0,0 +1,206 @@
+package jsonhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type payload struct {
+	Model    string            `json:"model"`
+	Messages []json.RawMessage `json:"messages"`
+	Stream   bool              `json:"stream"`
+}
+
+func testPayload(n int) payload {
+	p := payload{Model: "gpt-4o", Stream: true}
+	for range n {
+		p.Messages = append(p.Messages, json.RawMessage(`{"role":"user","content":"`+strings.Repeat("hello ", 20)+`"}`))
+	}
+	return p
+}
+
+func TestEncode(t *testing.T) {
+	p := testPayload(3)
+	want, _ := json.Marshal(p)
+
+	b, err := Encode(p, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Gzipped() || !bytes.Equal(b.Bytes(), want) {
+		t.Fatalf("plain body = %s (gzipped %v), want %s", b.Bytes(), b.Gzipped(), want)
+	}
+	b.Release()
+
+	b, err = Encode(p, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Gzipped() {
+		t.Fatal("body above threshold not gzipped")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(zr)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("gunzipped body = %s, want %s", got, want)
+	}
+	b.Release()
+
+	if _, err := Encode(func() {}, 0); err == nil {
+		t.Fatal("Encode of a func succeeded")
+	}
+}
+
+func TestPostReplaysBody(t *testing.T) {
+	want, _ := json.Marshal(testPayload(1))
+	var bodies [][]byte
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		// Read the body, then replay it the way the transport does after
+		// a stale connection or GOAWAY.
+		first, _ := io.ReadAll(req.Body)
+		req.Body.Close()
+		if req.GetBody == nil {
+			t.Fatal("GetBody not set")
+		}
+		again, err := req.GetBody()
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, _ := io.ReadAll(again)
+		again.Close()
+		bodies = append(bodies, first, second)
+		if req.ContentLength != int64(len(first)) {
+			t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(first))
+		}
+		return &http.Response{StatusCode: 200, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+	})}
+	resp, err := Post(context.Background(), client, "http://example.invalid/", nil, testPayload(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	for i, b := range bodies {
+		if !bytes.Equal(b, want) {
+			t.Errorf("read %d = %s, want %s", i, b, want)
+		}
+	}
+}
+
+func TestPostKeepsBufferUntilClosed(t *testing.T) {
+	var body *Body
+	var held io.ReadCloser
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		// Hold on to the body like a transport still writing it.
+		held = req.Body
+		body = held.(*reader).body
+		return &http.Response{StatusCode: 200, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+	})}
+	resp, err := Post(context.Background(), client, "http://example.invalid/", nil, testPayload(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if body.buf == nil {
+		t.Fatal("buffer recycled while the transport still reads it")
+	}
+	held.Close()
+	if body.buf != nil {
+		t.Fatal("buffer not recycled once every reader closed")
+	}
+}
+
+func TestPostGzipRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Error("request not gzipped")
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in, _ := io.ReadAll(zr)
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write(in)
+		zw.Close()
+	}))
+	defer srv.Close()
+	p := testPayload(5)
+	want, _ := json.Marshal(p)
+	resp, err := Post(context.Background(), srv.Client(), srv.URL, http.Header{"X-Test": {"1"}}, p, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(got, want) {
+		t.Fatalf("echo = %s, want %s", got, want)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// BenchmarkEncode and BenchmarkMarshal compare pooled encoding against a
+// fresh json.Marshal and bytes.Reader per request.
+func BenchmarkEncode(b *testing.B) {
+	p := testPayload(8)
+	b.ReportAllocs()
+	for b.Loop() {
+		body, err := Encode(p, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		r := body.reader()
+		io.Copy(io.Discard, r)
+		r.Close()
+		body.Release()
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	p := testPayload(8)
+	b.ReportAllocs()
+	for b.Loop() {
+		data, err := json.Marshal(p)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, bytes.NewReader(data))
+	}
+}
+
+func BenchmarkEncodeGzip(b *testing.B) {
+	p := testPayload(8)
+	b.ReportAllocs()
+	for b.Loop() {
+		body, err := Encode(p, 1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		body.Release()
+	}
+}
+
+func TestErrorBodyIsCapped(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader(body))}
+	if got := ErrorBody(resp, 10); got != body[:10] {
+		t.Fatalf("ErrorBody = %q, want the first 10 bytes", got)
+	}
+	resp = &http.Response{Body: io.NopCloser(strings.NewReader(body))}
+	if got := ErrorBody(resp, 0); got != body {
+		t.Fatalf("ErrorBody with the default cap = %q", got)
+	}
+}
@@ -1,15 +1,36 @@
 package openai
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/oarkflow/llmagent/sdk/internal/jsonhttp"
 )
 
+// APIError is returned for any non-200 response from the API.
+type APIError struct {
+	StatusCode int
+	Body       string
+	Header     http.Header
+}
+
+func (e *APIError) Error() string {
+	return "HTTP " + http.StatusText(e.StatusCode) + ": " + e.Body
+}
+
+// HTTPStatusCode exposes the status code to callers that only know the
+// error interface.
+func (e *APIError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// HTTPHeader exposes the response headers, e.g. Retry-After on a 429.
+func (e *APIError) HTTPHeader() http.Header {
+	return e.Header
+}
+
 type Client struct {
 	APIKey          string
 	BaseURL         string
@@ -18,6 +39,16 @@ type Client struct {
 	DefaultModel    string
 	SupportedModels []string
 	HttpClient      *http.Client
+	// GzipThreshold compresses request bodies larger than this many bytes
+	// (0 disables). Only enable it for endpoints that accept gzip uploads.
+	GzipThreshold int
+	// MaxResponseBytes caps how much of an error response body is read
+	// (0 = 16 MiB).
+	MaxResponseBytes int
+	// Organization and Project select the billing scope (OpenAI-Organization
+	// and OpenAI-Project headers) when set.
+	Organization string
+	Project      string
 }
 
 func NewClient(apiKey, baseURL, chatEndpoint string, timeout time.Duration, defaultModel string, supportedModels []string) *Client {
@@ -32,24 +63,23 @@ func NewClient(apiKey, baseURL, chatEndpoint string, timeout time.Duration, defa
 	}
 }
 
-func (c *Client) ChatCompletion(ctx context.Context, payload map[string]any) (io.ReadCloser, error) {
-	data, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
+// ChatCompletion sends payload, encoded as JSON, and returns the response body.
+func (c *Client) ChatCompletion(ctx context.Context, payload any) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.APIKey)
+	if c.Organization != "" {
+		header.Set("OpenAI-Organization", c.Organization)
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+c.ChatEndpoint, bytes.NewReader(data))
-	if err != nil {
-		return nil, err
+	if c.Project != "" {
+		header.Set("OpenAI-Project", c.Project)
 	}
-	req.Header.Set("Authorization", "Bearer "+c.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.HttpClient.Do(req)
+	resp, err := jsonhttp.Post(ctx, c.HttpClient, c.BaseURL+c.ChatEndpoint, header, payload, c.GzipThreshold)
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, errors.New("HTTP " + http.StatusText(resp.StatusCode) + ": " + string(body))
+		body := jsonhttp.ErrorBody(resp, c.MaxResponseBytes)
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: body, Header: resp.Header}
 	}
-	return resp.Body, nil
+	return jsonhttp.HeaderBody(resp), nil
 }
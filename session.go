@@ -0,0 +1,269 @@
+package llmagent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session is a multi-turn conversation on top of an Agent. The first turn
+// pins the session to the provider and model that served it; later turns
+// reuse that pair until it fails over to another provider or Migrate is
+// called.
+type Session struct {
+	ID string
+
+	// Template carries the per-turn request settings (temperature, max
+	// tokens, stream, ...). Its Messages field is ignored.
+	Template CompletionRequest
+
+	// ToolResults limits every tool message added to the conversation;
+	// ToolResultLimits overrides it per tool name. See AddToolResult.
+	ToolResults      ToolResultLimit
+	ToolResultLimits map[string]ToolResultLimit
+
+	// CostGuard caps the session's spend; NewSession copies
+	// Agent.CostGuard.
+	CostGuard *CostGuard
+
+	agent    *Agent
+	mu       sync.Mutex
+	messages []Message
+	provider string
+	model    string
+	turns    []TurnStats
+	// citations of assistant replies, by message index
+	citations   map[int][]Citation
+	costLimited bool // the CostLimit event was sent
+}
+
+// NewSession starts an empty conversation, optionally seeded with messages
+// such as a system prompt.
+func (a *Agent) NewSession(messages ...Message) *Session {
+	return &Session{
+		ID:        newSessionID(),
+		CostGuard: a.CostGuard,
+		agent:     a,
+		messages:  append([]Message(nil), messages...),
+	}
+}
+
+func newSessionID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Pinned returns the provider and model the session is pinned to; both are
+// empty before the first successful turn.
+func (s *Session) Pinned() (provider, model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.provider, s.model
+}
+
+// Migrate re-pins the session to provider/model for subsequent turns. An
+// empty model uses the provider's default.
+func (s *Session) Migrate(provider, model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.provider, s.model = provider, model
+}
+
+// History returns a copy of the conversation so far.
+func (s *Session) History() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Send appends msg to the conversation and completes the next turn. The
+// assistant reply is recorded once the stream finishes without error. Tool
+// messages are shrunk to the session's tool result limits first. With a
+// CostGuard the turn may run on a cheaper model, or fail with a
+// *CostLimitError.
+func (s *Session) Send(ctx context.Context, msg Message) (<-chan CompletionResponse, error) {
+	return s.send(ctx, msg, nil)
+}
+
+// send is Send with stream, if not nil, overriding Template.Stream for
+// this turn only.
+func (s *Session) send(ctx context.Context, msg Message, stream *bool) (<-chan CompletionResponse, error) {
+	if msg.Role == RoleTool {
+		msg.Content = s.agent.ShrinkToolResult(ctx, msg.Name, msg.Content, s.toolResultLimit(msg.Name))
+	}
+	s.mu.Lock()
+	req := s.Template
+	if stream != nil {
+		req.Stream = stream
+	}
+	if s.model != "" {
+		req.Model = s.model
+	}
+	name, current := s.agent.resolveModel(s.provider, req)
+	model, ev, err := s.guardCost(current)
+	if err != nil {
+		s.mu.Unlock()
+		s.agent.emitCost(ev)
+		return nil, err
+	}
+	if s.model != "" || model != current {
+		req.Model = model
+		ctx = withPinnedModel(ctx, name)
+	}
+	s.messages = append(s.messages, msg)
+	req.Messages = append([]Message(nil), s.messages...)
+	provider := s.provider
+	s.mu.Unlock()
+	s.agent.emitCost(ev)
+
+	ch, err := s.agent.Complete(ctx, provider, req)
+	if err != nil {
+		s.dropLast(msg)
+		return nil, err
+	}
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		var reply strings.Builder
+		var calls []ToolCall
+		var failed bool
+		for resp := range ch {
+			if resp.Err != nil {
+				failed = true
+			}
+			reply.WriteString(resp.Content)
+			calls = append(calls, resp.ToolCalls...)
+			if resp.Done && resp.Stats != nil && !failed {
+				s.recordTurn(reply.String(), calls, resp.Stats, resp.Citations)
+				s.prefetch(ctx, reply.String())
+			}
+			if !emit(resp) {
+				failed = failed || !resp.Done // cut off before the turn was recorded
+				break
+			}
+		}
+		if failed {
+			s.dropLast(msg)
+		}
+	}), nil
+}
+
+// recordTurn stores the assistant reply, with any tool calls it made, and
+// (re-)pins the session to the provider/model that actually served it,
+// which differs from the pinned pair only when the pinned provider failed
+// over.
+func (s *Session) recordTurn(content string, calls []ToolCall, stats *CompletionStats, citations []Citation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(citations) > 0 {
+		if s.citations == nil {
+			s.citations = make(map[int][]Citation)
+		}
+		s.citations[len(s.messages)] = citations
+	}
+	s.messages = append(s.messages, ToolCallsMessage(content, calls))
+	turn := TurnStats{
+		Provider: stats.Provider,
+		Model:    stats.Model,
+		Usage:    stats.Usage,
+		Duration: stats.Duration,
+	}
+	if info, ok := LookupModel(stats.Model); ok {
+		turn.Cost = info.Cost(stats.Usage)
+	}
+	s.turns = append(s.turns, turn)
+	if stats.Provider != "" {
+		s.provider, s.model = stats.Provider, stats.Model
+	}
+}
+
+type pinnedKey struct{}
+
+// withPinnedModel marks the request's model as chosen for provider, so
+// the model is only sent there.
+func withPinnedModel(ctx context.Context, provider string) context.Context {
+	return context.WithValue(ctx, pinnedKey{}, provider)
+}
+
+// requestFor returns req as p should receive it: a model pinned to another
+// provider is cleared, so a fallback serves the turn with its own default.
+func requestFor(ctx context.Context, p Provider, req CompletionRequest) CompletionRequest {
+	if provider, ok := ctx.Value(pinnedKey{}).(string); ok && provider != p.Name() {
+		req.Model = ""
+	}
+	return req
+}
+
+// prefetch hands the conversation before answer, as the next turn will
+// send it, to the agent's Prefetcher.
+func (s *Session) prefetch(ctx context.Context, answer string) {
+	if s.agent.Prefetcher == nil {
+		return
+	}
+	s.mu.Lock()
+	next := s.Template
+	if s.model != "" {
+		next.Model = s.model
+	}
+	next.Messages = append([]Message(nil), s.messages[:len(s.messages)-1]...)
+	provider := s.provider
+	s.mu.Unlock()
+	s.agent.prefetchAfter(ctx, provider, next, answer)
+}
+
+// dropLast removes msg if it is still the final message, so a failed turn
+// can be retried without duplicating the prompt.
+func (s *Session) dropLast(msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.messages); n > 0 && reflect.DeepEqual(s.messages[n-1], msg) {
+		s.messages = s.messages[:n-1]
+	}
+}
+
+// TurnStats describes one completed turn of a session.
+type TurnStats struct {
+	Provider string
+	Model    string
+	Usage    Usage
+	Cost     float64 // USD, 0 when the model has no pricing
+	Duration time.Duration
+}
+
+// SessionStats summarizes token usage and cost for a session.
+type SessionStats struct {
+	Turns []TurnStats
+	Usage Usage   // cumulative over all turns
+	Cost  float64 // cumulative USD
+
+	// ContextTokens is the size of the conversation as of the last turn
+	// (its prompt plus completion), i.e. what the next turn will resend.
+	ContextTokens int
+	ContextWindow int     // of the pinned model, 0 if unknown
+	ContextUsage  float64 // ContextTokens as a percentage of ContextWindow
+}
+
+// Stats reports cumulative and per-turn usage for the session.
+func (s *Session) Stats() SessionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := SessionStats{Turns: append([]TurnStats(nil), s.turns...)}
+	for _, t := range s.turns {
+		st.Usage.PromptTokens += t.Usage.PromptTokens
+		st.Usage.CompletionTokens += t.Usage.CompletionTokens
+		st.Usage.TotalTokens += t.Usage.TotalTokens
+		st.Cost += t.Cost
+	}
+	if n := len(s.turns); n > 0 {
+		last := s.turns[n-1]
+		st.ContextTokens = last.Usage.PromptTokens + last.Usage.CompletionTokens
+	}
+	if info, ok := LookupModel(s.model); ok && info.ContextWindow > 0 {
+		st.ContextWindow = info.ContextWindow
+		st.ContextUsage = 100 * float64(st.ContextTokens) / float64(info.ContextWindow)
+	}
+	return st
+}
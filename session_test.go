@@ -0,0 +1,92 @@
+package llmagent
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSessionRecordsToolCallRoundTrip(t *testing.T) {
+	call := ToolCall{ID: "call_1", Name: "weather", Arguments: json.RawMessage(`{"city":"Oslo"}`)}
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		if n > 1 {
+			return answer("sunny"), nil
+		}
+		ch := make(chan CompletionResponse, 2)
+		ch <- CompletionResponse{Role: RoleAssistant, ToolCalls: []ToolCall{call}}
+		ch <- CompletionResponse{Done: true, FinishReason: FinishToolCalls}
+		close(ch)
+		return ch, nil
+	})
+	a, _ := testAgent(t, p)
+	s := a.NewSession()
+	s.Template.Stream = Bool(false)
+
+	ch, err := s.Send(context.Background(), User("weather in Oslo?"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Collect(ch); err != nil {
+		t.Fatal(err)
+	}
+	got := s.AddToolResult(context.Background(), call, "12C, sunny")
+	if got.ToolCallID != call.ID || got.Name != call.Name {
+		t.Fatalf("tool result = %+v, want a reply to %s", got, call.ID)
+	}
+
+	h := s.History()
+	if len(h) != 3 {
+		t.Fatalf("history has %d messages, want 3: %+v", len(h), h)
+	}
+	if len(h[1].ToolCalls) != 1 || h[1].ToolCalls[0].ID != call.ID {
+		t.Fatalf("assistant turn = %+v, want its tool call kept", h[1])
+	}
+	if h[2].Role != RoleTool || h[2].ToolCallID != call.ID {
+		t.Fatalf("tool turn = %+v, want tool_call_id %s", h[2], call.ID)
+	}
+}
+
+func TestSessionFailsOverFromPinnedModel(t *testing.T) {
+	var seen []string // provider:model of every request
+	record := func(name string, req CompletionRequest) {
+		seen = append(seen, name+":"+req.Model)
+	}
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		record("p", req)
+		if n > 1 {
+			return nil, statusError(503)
+		}
+		return answer("from p"), nil
+	})
+	p.cfg.DefaultModel = "p-1"
+	q := newTestProvider("q", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		record("q", req)
+		return answer("from q"), nil
+	})
+	q.cfg.DefaultModel = "q-1"
+	a, _ := testAgent(t, p, q)
+	a.RegisterFallbackProviders([]string{"q"})
+	s := a.NewSession()
+	s.Template.Stream = Bool(false)
+
+	for turn, want := range []struct{ provider, model string }{
+		{"p", "p-1"},
+		{"q", "q-1"}, // p fails: q is not asked for p's model
+		{"q", "q-1"},
+	} {
+		ch, err := s.Send(context.Background(), User("hi"))
+		if err != nil {
+			t.Fatalf("turn %d: %v", turn+1, err)
+		}
+		if _, err := Collect(ch); err != nil {
+			t.Fatalf("turn %d: %v", turn+1, err)
+		}
+		if provider, model := s.Pinned(); provider != want.provider || model != want.model {
+			t.Fatalf("after turn %d pinned to %s/%s, want %s/%s", turn+1, provider, model, want.provider, want.model)
+		}
+	}
+	if want := []string{"p:", "p:p-1", "q:", "q:q-1"}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("requests = %q, want %q", seen, want)
+	}
+}
@@ -0,0 +1,226 @@
+package llmagent
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Shadow duplicates a sample of live requests to a candidate provider or
+// model. Candidate responses are never returned to callers; they are only
+// compared against the served response and reported.
+type Shadow struct {
+	Provider string  // candidate provider
+	Model    string  // candidate model; empty keeps the request's model
+	Percent  float64 // share of requests to shadow, 0-100
+
+	// Judge, if set, has a model compare each pair of answers; the
+	// primary answer is A and the candidate B.
+	Judge *Rubric
+
+	// OnResult, if set, receives every comparison, e.g. to log both answers.
+	OnResult func(ShadowResult)
+
+	mu      sync.Mutex
+	metrics ShadowMetrics
+}
+
+// ShadowResult compares one served response with its shadow.
+type ShadowResult struct {
+	Request   CompletionRequest
+	Primary   string // content returned to the caller
+	Candidate string
+	// PrimaryStats and CandidateStats are nil if that side failed.
+	PrimaryStats   *CompletionStats
+	CandidateStats *CompletionStats
+	CandidateErr   error
+	Similarity     float64 // word-set Jaccard similarity of the two answers
+	Judgement      *Judgement
+	JudgeErr       error
+}
+
+// ShadowMetrics aggregates shadow comparisons.
+type ShadowMetrics struct {
+	Requests          int
+	CandidateFailures int
+	TotalSimilarity   float64
+	// Latency and token deltas are candidate minus primary.
+	TotalLatencyDelta time.Duration
+	TotalTTFTDelta    time.Duration
+	TotalTokenDelta   int
+	// Judge verdicts, when a Judge rubric is set.
+	PrimaryWins   int
+	CandidateWins int
+	Ties          int
+}
+
+// MeanSimilarity averages Similarity over successful comparisons.
+func (m ShadowMetrics) MeanSimilarity() float64 {
+	if n := m.Requests - m.CandidateFailures; n > 0 {
+		return m.TotalSimilarity / float64(n)
+	}
+	return 0
+}
+
+// Metrics returns a snapshot of the comparison metrics.
+func (s *Shadow) Metrics() ShadowMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.metrics
+}
+
+func (s *Shadow) sampled() bool {
+	return s.Percent > 0 && rand.Float64()*100 < s.Percent
+}
+
+type shadowKey struct{}
+
+// shadowed reports whether ctx carries a shadow candidate request. Its
+// traffic is not billed and stays out of the provider metrics and SLOs.
+func shadowed(ctx context.Context) bool {
+	v, _ := ctx.Value(shadowKey{}).(bool)
+	return v
+}
+
+// shadow forwards ch unchanged and, for sampled requests, runs req against
+// the candidate in the background and compares the two once both finish.
+// The candidate outlives ctx's cancellation so a caller hanging up early
+// doesn't skew the comparison.
+func (a *Agent) shadow(ctx context.Context, req CompletionRequest, ch <-chan CompletionResponse) <-chan CompletionResponse {
+	s := a.Shadow
+	if s == nil || !s.sampled() {
+		return ch
+	}
+	cand, ok := a.provider(s.Provider)
+	if !ok || !inRegion(ctx, cand) {
+		return ch
+	}
+	creq := req
+	if s.Model != "" {
+		creq.Model = s.Model
+	}
+	candidate := make(chan ShadowResult, 1)
+	go func() {
+		var r ShadowResult
+		run := &requestRun{budget: newBudgetTracker(context.Background(), RetryBudget{}, a.Clock), agg: &AggregateError{}}
+		cctx := context.WithValue(context.WithoutCancel(ctx), shadowKey{}, true)
+		cch, err := a.tryProvider(cctx, cand, creq, run)
+		if err == nil {
+			r.Candidate, r.CandidateStats, err = collectStats(cch)
+		}
+		r.CandidateErr = err
+		candidate <- r
+	}()
+
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		var text strings.Builder
+		var stats *CompletionStats
+		var failed bool
+		for resp := range ch {
+			text.WriteString(resp.Content)
+			if resp.Err != nil {
+				failed = true
+			}
+			if resp.Done {
+				stats = resp.Stats
+			}
+			if !emit(resp) {
+				failed = true // cut off by the run
+				break
+			}
+		}
+		// the comparison outlives the request, so it is not part of its run
+		go func() {
+			r := <-candidate
+			r.Request = req
+			r.Primary = text.String()
+			if !failed {
+				r.PrimaryStats = stats
+			}
+			if s.Judge != nil && r.CandidateErr == nil && !failed {
+				rubric := *s.Judge
+				if rubric.Task == "" {
+					rubric.Task = lastUserMessage(req.Messages)
+				}
+				j, err := a.Judge(context.WithoutCancel(ctx), rubric, r.Primary, r.Candidate)
+				if err == nil {
+					r.Judgement = &j
+				}
+				r.JudgeErr = err
+			}
+			s.record(&r)
+		}()
+	})
+}
+
+func (s *Shadow) record(r *ShadowResult) {
+	s.mu.Lock()
+	s.metrics.Requests++
+	if r.CandidateErr != nil {
+		s.metrics.CandidateFailures++
+	} else {
+		r.Similarity = similarity(r.Primary, r.Candidate)
+		s.metrics.TotalSimilarity += r.Similarity
+		if p, c := r.PrimaryStats, r.CandidateStats; p != nil && c != nil {
+			s.metrics.TotalLatencyDelta += c.Duration - p.Duration
+			s.metrics.TotalTTFTDelta += c.TimeToFirstToken - p.TimeToFirstToken
+			s.metrics.TotalTokenDelta += c.CompletionTokens - p.CompletionTokens
+		}
+		if r.Judgement != nil {
+			switch r.Judgement.Preferred {
+			case PreferA:
+				s.metrics.PrimaryWins++
+			case PreferB:
+				s.metrics.CandidateWins++
+			default:
+				s.metrics.Ties++
+			}
+		}
+	}
+	s.mu.Unlock()
+	if s.OnResult != nil {
+		s.OnResult(*r)
+	}
+}
+
+// collectStats drains ch, returning its content, the Done event's stats
+// and the first error.
+func collectStats(ch <-chan CompletionResponse) (string, *CompletionStats, error) {
+	var text strings.Builder
+	var stats *CompletionStats
+	var err error
+	for resp := range ch {
+		text.WriteString(resp.Content)
+		if resp.Err != nil && err == nil {
+			err = resp.Err
+		}
+		if resp.Done {
+			stats = resp.Stats
+		}
+	}
+	return text.String(), stats, err
+}
+
+// similarity is the Jaccard index of the lower-cased word sets of a and b.
+func similarity(a, b string) float64 {
+	words := func(s string) map[string]bool {
+		set := make(map[string]bool)
+		for _, w := range strings.Fields(strings.ToLower(s)) {
+			set[w] = true
+		}
+		return set
+	}
+	wa, wb := words(a), words(b)
+	if len(wa) == 0 && len(wb) == 0 {
+		return 1
+	}
+	var inter int
+	for w := range wa {
+		if wb[w] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(wa)+len(wb)-inter)
+}
@@ -0,0 +1,34 @@
+package llmagent
+
+import (
+	"context"
+	"testing"
+)
+
+func TestShadowTrafficIsNotBilled(t *testing.T) {
+	p := newTestProvider("p", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return answer("primary"), nil
+	})
+	cand := newTestProvider("cand", func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+		return answer("candidate"), nil
+	})
+	a, _ := testAgent(t, p, cand)
+	a.Billing = NewUsageLedger()
+	compared := make(chan ShadowResult, 1)
+	a.Shadow = &Shadow{Provider: "cand", Percent: 100, OnResult: func(r ShadowResult) { compared <- r }}
+
+	if err := <-complete(a, "p"); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-compared; r.Candidate != "candidate" {
+		t.Fatalf("candidate answer = %q", r.Candidate)
+	}
+	for _, u := range a.Billing.Snapshot() {
+		if u.Provider == "cand" {
+			t.Fatalf("shadow request billed: %+v", u)
+		}
+	}
+	if m := a.Metrics()["cand"]; m.Completions != 0 {
+		t.Fatalf("shadow request counted in metrics: %+v", m)
+	}
+}
@@ -0,0 +1,94 @@
+package llmagent
+
+import (
+	"context"
+	"sync"
+)
+
+// MetricsStore aggregates provider metrics from every agent instance of a
+// cluster, e.g. in Redis, for a global view of provider health.
+type MetricsStore interface {
+	// Add folds delta into provider's totals: counters and durations are
+	// summed, RateLimit and LastRequestID replace the stored values when
+	// set.
+	Add(ctx context.Context, provider string, delta ProviderMetrics) error
+	// Load returns the totals of every provider.
+	Load(ctx context.Context) (map[string]ProviderMetrics, error)
+}
+
+// ClusterMetrics returns the metrics aggregated in Agent.SharedMetrics;
+// Metrics is this instance's share.
+func (a *Agent) ClusterMetrics(ctx context.Context) (map[string]ProviderMetrics, error) {
+	if a.SharedMetrics == nil {
+		return a.Metrics(), nil
+	}
+	return a.SharedMetrics.Load(ctx)
+}
+
+// metricsPusher forwards metric deltas to the MetricsStore from one
+// background goroutine, merging whatever piles up while a push is slow.
+type metricsPusher struct {
+	mu      sync.Mutex
+	pending map[string]*ProviderMetrics
+	running bool
+}
+
+// pushMetrics queues delta for the MetricsStore. Pushes are best effort;
+// failed ones are dropped.
+func (a *Agent) pushMetrics(provider string, delta ProviderMetrics) {
+	store := a.SharedMetrics
+	if store == nil {
+		return
+	}
+	p := &a.metricsPush
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		p.pending = map[string]*ProviderMetrics{}
+	}
+	if m, ok := p.pending[provider]; ok {
+		m.add(delta)
+	} else {
+		p.pending[provider] = &delta
+	}
+	if p.running {
+		return
+	}
+	p.running = true
+	go func() {
+		for {
+			p.mu.Lock()
+			batch := p.pending
+			p.pending = nil
+			if len(batch) == 0 {
+				p.running = false
+				p.mu.Unlock()
+				return
+			}
+			p.mu.Unlock()
+			for name, d := range batch {
+				_ = store.Add(context.Background(), name, *d)
+			}
+		}
+	}()
+}
+
+// add folds d into m as MetricsStore.Add describes.
+func (m *ProviderMetrics) add(d ProviderMetrics) {
+	m.SuccessCount += d.SuccessCount
+	m.FailureCount += d.FailureCount
+	m.TotalLatency += d.TotalLatency
+	m.RateLimited += d.RateLimited
+	m.Completions += d.Completions
+	m.StreamErrors += d.StreamErrors
+	m.PromptTokens += d.PromptTokens
+	m.CompletionTokens += d.CompletionTokens
+	m.TotalDuration += d.TotalDuration
+	m.TotalTimeToFirstToken += d.TotalTimeToFirstToken
+	if d.RateLimit != nil {
+		m.RateLimit = d.RateLimit
+	}
+	if d.LastRequestID != "" {
+		m.LastRequestID = d.LastRequestID
+	}
+}
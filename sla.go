@@ -0,0 +1,219 @@
+package llmagent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestSample is one upstream attempt as kept by a RequestLog.
+type RequestSample struct {
+	At               time.Time     `json:"at"`
+	Provider         string        `json:"provider"`
+	Model            string        `json:"model,omitempty"`
+	Duration         time.Duration `json:"duration_ns"`
+	TimeToFirstToken time.Duration `json:"ttft_ns,omitempty"`
+	Failed           bool          `json:"failed,omitempty"`
+	Usage            Usage         `json:"usage"`
+	Tags             []string      `json:"tags,omitempty"`
+}
+
+// RequestLog keeps per-attempt samples for SLA reports. Set Agent.Requests
+// to record; persist it with WriteTo and ReadRequestLog.
+type RequestLog struct {
+	// MaxAge drops older samples; defaults to 8 days so a weekly report
+	// always has a full week.
+	MaxAge time.Duration
+
+	mu      sync.Mutex
+	samples []RequestSample
+}
+
+func (l *RequestLog) add(s RequestSample) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples = append(l.samples, s)
+	maxAge := l.MaxAge
+	if maxAge <= 0 {
+		maxAge = 8 * 24 * time.Hour
+	}
+	cutoff := s.At.Add(-maxAge)
+	i := sort.Search(len(l.samples), func(i int) bool { return !l.samples[i].At.Before(cutoff) })
+	if i > 0 {
+		l.samples = append(l.samples[:0], l.samples[i:]...)
+	}
+}
+
+// Samples returns the samples recorded in [from, to).
+func (l *RequestLog) Samples(from, to time.Time) []RequestSample {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []RequestSample
+	for _, s := range l.samples {
+		if !s.At.Before(from) && s.At.Before(to) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// WriteTo writes the log as JSON lines.
+func (l *RequestLog) WriteTo(w io.Writer) (int64, error) {
+	l.mu.Lock()
+	samples := append([]RequestSample(nil), l.samples...)
+	l.mu.Unlock()
+	cw := &countingWriter{w: w}
+	enc := json.NewEncoder(cw)
+	for _, s := range samples {
+		if err := enc.Encode(s); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ReadRequestLog loads a log written by WriteTo.
+func ReadRequestLog(r io.Reader) (*RequestLog, error) {
+	l := &RequestLog{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		var s RequestSample
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			return nil, err
+		}
+		l.samples = append(l.samples, s)
+	}
+	sort.SliceStable(l.samples, func(i, j int) bool { return l.samples[i].At.Before(l.samples[j].At) })
+	return l, sc.Err()
+}
+
+// ProviderSLA summarizes one provider over a report period.
+type ProviderSLA struct {
+	Provider     string        `json:"provider"`
+	Requests     int           `json:"requests"`
+	Failures     int           `json:"failures"`
+	Availability float64       `json:"availability"` // successful / all attempts, in [0, 1]
+	P50Latency   time.Duration `json:"p50_latency_ns"`
+	P95Latency   time.Duration `json:"p95_latency_ns"`
+	P95TTFT      time.Duration `json:"p95_ttft_ns"`
+	// ErrorBudgetUsed is the share of the SLO's allowed failures spent,
+	// e.g. 0.5 = half; -1 when the provider has no ErrorRate objective.
+	ErrorBudgetUsed float64 `json:"error_budget_used"`
+	Tokens          int     `json:"tokens"`
+	Cost            float64 `json:"cost_usd"`
+	CostPer1K       float64 `json:"cost_per_1k_tokens"` // realized, 0 when nothing was priced
+}
+
+// SLAReport covers every provider seen in a period.
+type SLAReport struct {
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Providers []ProviderSLA `json:"providers"`
+}
+
+// SLAReport summarizes Agent.Requests over [from, to), judging error
+// budgets against Agent.SLOs.
+func (a *Agent) SLAReport(from, to time.Time) (SLAReport, error) {
+	if a.Requests == nil {
+		return SLAReport{}, fmt.Errorf("no request log configured")
+	}
+	return BuildSLAReport(a.Requests.Samples(from, to), from, to, a.SLOs), nil
+}
+
+// WeeklySLAReport covers the seven days before now.
+func (a *Agent) WeeklySLAReport() (SLAReport, error) {
+	now := a.clock().Now()
+	return a.SLAReport(now.Add(-7*24*time.Hour), now)
+}
+
+// BuildSLAReport summarizes samples, e.g. loaded with ReadRequestLog.
+func BuildSLAReport(samples []RequestSample, from, to time.Time, slos map[string]SLO) SLAReport {
+	byProvider := map[string][]RequestSample{}
+	for _, s := range samples {
+		byProvider[s.Provider] = append(byProvider[s.Provider], s)
+	}
+	report := SLAReport{From: from, To: to}
+	for provider, ss := range byProvider {
+		sla := ProviderSLA{Provider: provider, Requests: len(ss), ErrorBudgetUsed: -1}
+		var latencies, ttfts []time.Duration
+		var pricedTokens int
+		for _, s := range ss {
+			if s.Failed {
+				sla.Failures++
+				continue
+			}
+			latencies = append(latencies, s.Duration)
+			if s.TimeToFirstToken > 0 {
+				ttfts = append(ttfts, s.TimeToFirstToken)
+			}
+			sla.Tokens += s.Usage.TotalTokens
+			if info, ok := LookupModel(s.Model); ok {
+				sla.Cost += info.Cost(s.Usage)
+				pricedTokens += s.Usage.TotalTokens
+			}
+		}
+		sla.Availability = float64(sla.Requests-sla.Failures) / float64(sla.Requests)
+		sla.P50Latency = percentile(latencies, 0.50)
+		sla.P95Latency = percentile(latencies, 0.95)
+		sla.P95TTFT = percentile(ttfts, 0.95)
+		if slo, ok := slos[provider]; ok && slo.ErrorRate > 0 {
+			sla.ErrorBudgetUsed = float64(sla.Failures) / (slo.ErrorRate * float64(sla.Requests))
+		}
+		if pricedTokens > 0 {
+			sla.CostPer1K = sla.Cost / float64(pricedTokens) * 1000
+		}
+		report.Providers = append(report.Providers, sla)
+	}
+	sort.Slice(report.Providers, func(i, j int) bool { return report.Providers[i].Provider < report.Providers[j].Provider })
+	return report
+}
+
+// percentile uses the nearest-rank method; 0 for no samples.
+func percentile(ds []time.Duration, p float64) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(p*float64(len(sorted))+0.999999) - 1
+	return sorted[max(min(rank, len(sorted)-1), 0)]
+}
+
+// Markdown renders the report as a table.
+func (r SLAReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Provider SLA report\n\n%s to %s\n\n", r.From.UTC().Format("2006-01-02 15:04"), r.To.UTC().Format("2006-01-02 15:04 MST"))
+	b.WriteString("| Provider | Requests | Availability | p50 latency | p95 latency | p95 TTFT | Error budget used | Cost / 1K tokens |\n")
+	b.WriteString("|---|---:|---:|---:|---:|---:|---:|---:|\n")
+	for _, p := range r.Providers {
+		budget := "n/a"
+		if p.ErrorBudgetUsed >= 0 {
+			budget = fmt.Sprintf("%.0f%%", p.ErrorBudgetUsed*100)
+		}
+		fmt.Fprintf(&b, "| %s | %d | %.3f%% | %s | %s | %s | %s | $%.4f |\n",
+			p.Provider, p.Requests, p.Availability*100,
+			p.P50Latency.Round(time.Millisecond), p.P95Latency.Round(time.Millisecond), p.P95TTFT.Round(time.Millisecond),
+			budget, p.CostPer1K)
+	}
+	return b.String()
+}
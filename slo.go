@@ -0,0 +1,226 @@
+package llmagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SLO sets per-provider service level objectives. Each objective is checked
+// against the mean (or, for errors, the rate) over a rolling window; zero
+// thresholds are not checked.
+type SLO struct {
+	TimeToFirstToken time.Duration // mean TTFT of successful completions
+	Latency          time.Duration // mean total duration of successful completions
+	ErrorRate        float64       // failed attempts / all attempts, in [0, 1]
+
+	Window     time.Duration // rolling window; defaults to 5 minutes
+	MinSamples int           // samples required before judging; defaults to 10
+	// Demote moves the provider behind its healthy fallbacks while any
+	// objective is breached, and back once all of them recover.
+	Demote bool
+}
+
+// SLO metric names used in SLOEvent.
+const (
+	SLOTimeToFirstToken = "ttft"
+	SLOLatency          = "latency"
+	SLOErrorRate        = "error_rate"
+)
+
+// SLOEvent reports an objective being breached or recovering.
+type SLOEvent struct {
+	Provider  string    `json:"provider"`
+	Metric    string    `json:"metric"`
+	Observed  float64   `json:"observed"`  // seconds for durations
+	Threshold float64   `json:"threshold"` // seconds for durations
+	Breached  bool      `json:"breached"`  // false means recovered
+	Demoted   bool      `json:"demoted"`   // the provider's routing state after the event
+	Samples   int       `json:"samples"`
+	At        time.Time `json:"at"`
+}
+
+// SLOWebhook returns an OnSLOEvent handler that POSTs each event as JSON to
+// url. Deliveries run in the background and failures are dropped.
+func SLOWebhook(url string, client *http.Client) func(SLOEvent) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return func(ev SLOEvent) {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return
+		}
+		go func() {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+			if err != nil {
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := client.Do(req)
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+}
+
+type sloSample struct {
+	at       time.Time
+	ttft     time.Duration
+	duration time.Duration
+	failed   bool
+	model    string // for the request log
+	usage    Usage
+	tags     []string
+}
+
+type sloState struct {
+	samples  []sloSample
+	breached map[string]bool
+}
+
+// sloMonitor keeps the rolling samples and breach state of every provider
+// with an SLO.
+type sloMonitor struct {
+	mu    sync.Mutex
+	state map[string]*sloState
+}
+
+// recordSLO adds a sample for provider to Agent.Requests and the SLO
+// monitor, reporting any state changes.
+func (a *Agent) recordSLO(provider string, s sloSample) {
+	if a.Requests != nil {
+		a.Requests.add(RequestSample{
+			At: a.clock().Now(), Provider: provider, Model: s.model,
+			Duration: s.duration, TimeToFirstToken: s.ttft, Failed: s.failed, Usage: s.usage, Tags: s.tags,
+		})
+	}
+	slo, ok := a.SLOs[provider]
+	if !ok {
+		return
+	}
+	if slo.Window <= 0 {
+		slo.Window = 5 * time.Minute
+	}
+	if slo.MinSamples <= 0 {
+		slo.MinSamples = 10
+	}
+	s.at = a.clock().Now()
+
+	m := &a.slo
+	m.mu.Lock()
+	if m.state == nil {
+		m.state = make(map[string]*sloState)
+	}
+	st, ok := m.state[provider]
+	if !ok {
+		st = &sloState{breached: make(map[string]bool)}
+		m.state[provider] = st
+	}
+	st.samples = append(st.samples, s)
+	cutoff := s.at.Add(-slo.Window)
+	i := 0
+	for i < len(st.samples) && st.samples[i].at.Before(cutoff) {
+		i++
+	}
+	st.samples = st.samples[i:]
+
+	var events []SLOEvent
+	if len(st.samples) >= slo.MinSamples {
+		var good, failed int
+		var ttft, dur time.Duration
+		for _, smp := range st.samples {
+			if smp.failed {
+				failed++
+				continue
+			}
+			good++
+			ttft += smp.ttft
+			dur += smp.duration
+		}
+		check := func(metric string, observed, threshold float64, enabled bool) {
+			if !enabled {
+				return
+			}
+			breached := observed > threshold
+			if breached == st.breached[metric] {
+				return
+			}
+			st.breached[metric] = breached
+			events = append(events, SLOEvent{
+				Provider:  provider,
+				Metric:    metric,
+				Observed:  observed,
+				Threshold: threshold,
+				Breached:  breached,
+				Samples:   len(st.samples),
+				At:        s.at,
+			})
+		}
+		if good > 0 {
+			check(SLOTimeToFirstToken, (ttft / time.Duration(good)).Seconds(), slo.TimeToFirstToken.Seconds(), slo.TimeToFirstToken > 0)
+			check(SLOLatency, (dur / time.Duration(good)).Seconds(), slo.Latency.Seconds(), slo.Latency > 0)
+		}
+		check(SLOErrorRate, float64(failed)/float64(len(st.samples)), slo.ErrorRate, slo.ErrorRate > 0)
+	}
+	demoted := slo.Demote && st.anyBreached()
+	m.mu.Unlock()
+
+	if a.OnSLOEvent == nil {
+		return
+	}
+	for _, ev := range events {
+		ev.Demoted = demoted
+		a.OnSLOEvent(ev)
+	}
+}
+
+func (st *sloState) anyBreached() bool {
+	for _, b := range st.breached {
+		if b {
+			return true
+		}
+	}
+	return false
+}
+
+// Demoted reports whether provider is currently demoted for breaching an
+// SLO with Demote set.
+func (a *Agent) Demoted(provider string) bool {
+	if !a.SLOs[provider].Demote {
+		return false
+	}
+	a.slo.mu.Lock()
+	defer a.slo.mu.Unlock()
+	st, ok := a.slo.state[provider]
+	return ok && st.anyBreached()
+}
+
+// route orders the primary and fallbacks so demoted providers come after
+// healthy ones, keeping the configured order otherwise.
+func (a *Agent) route(primary string, fallbacks []string) (string, []string) {
+	if len(a.SLOs) == 0 || !a.Demoted(primary) {
+		return primary, fallbacks
+	}
+	var healthy, demoted []string
+	for _, name := range append([]string{primary}, fallbacks...) {
+		if _, ok := a.provider(name); !ok {
+			continue
+		}
+		if a.Demoted(name) {
+			demoted = append(demoted, name)
+		} else {
+			healthy = append(healthy, name)
+		}
+	}
+	order := append(healthy, demoted...)
+	if len(order) == 0 || order[0] == primary {
+		return primary, fallbacks
+	}
+	return order[0], order[1:]
+}
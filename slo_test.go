@@ -0,0 +1,88 @@
+package llmagent
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSLOBreachAndRecovery(t *testing.T) {
+	a, clock := testAgent(t, newTestProvider("p", nil))
+	a.SLOs = map[string]SLO{"p": {TimeToFirstToken: time.Second, ErrorRate: 0.5, Window: time.Minute, MinSamples: 2, Demote: true}}
+	var events []SLOEvent
+	a.OnSLOEvent = func(ev SLOEvent) { events = append(events, ev) }
+
+	ok := func(ttft time.Duration) sloSample { return sloSample{ttft: ttft, duration: ttft} }
+	failed := sloSample{failed: true}
+	for i, step := range []struct {
+		advance time.Duration
+		sample  sloSample
+		events  []string // metric, "+" breached or "-" recovered
+		demoted bool
+	}{
+		{0, ok(2 * time.Second), nil, false}, // too few samples to judge
+		{0, ok(2 * time.Second), []string{"ttft+"}, true},
+		{0, failed, nil, true},                            // 1 of 3 failed
+		{0, failed, nil, true},                            // 2 of 4: at the threshold, not over it
+		{0, failed, []string{"error_rate+"}, true},        // 3 of 5
+		{2 * time.Minute, ok(time.Second / 2), nil, true}, // the window emptied: too few samples
+		{0, ok(time.Second / 2), []string{"ttft-", "error_rate-"}, false},
+	} {
+		clock.Advance(step.advance)
+		events = nil
+		a.recordSLO("p", step.sample)
+		var got []string
+		for _, ev := range events {
+			sign := "-"
+			if ev.Breached {
+				sign = "+"
+			}
+			got = append(got, ev.Metric+sign)
+			if ev.Demoted != step.demoted || !ev.At.Equal(clock.Now()) {
+				t.Errorf("step %d: event %+v", i, ev)
+			}
+		}
+		if !slices.Equal(got, step.events) {
+			t.Errorf("step %d: events %q, want %q", i, got, step.events)
+		}
+		if d := a.Demoted("p"); d != step.demoted {
+			t.Errorf("step %d: demoted = %v, want %v", i, d, step.demoted)
+		}
+	}
+}
+
+func TestSLODemotionRoutesToFallback(t *testing.T) {
+	answers := func(name string) *testProvider {
+		return newTestProvider(name, func(ctx context.Context, req CompletionRequest, n int) (<-chan CompletionResponse, error) {
+			return answer(name), nil
+		})
+	}
+	p, q := answers("p"), answers("q")
+	a, _ := testAgent(t, p, q)
+	a.RegisterFallbackProviders([]string{"q"})
+	a.CacheTTL = 0
+	a.SLOs = map[string]SLO{"p": {ErrorRate: 0.1, MinSamples: 1, Demote: true}}
+
+	send := func() string {
+		t.Helper()
+		content, err := completeText(a, "p")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+	if got := send(); got != "p" {
+		t.Fatalf("healthy primary: answered by %s", got)
+	}
+	a.recordSLO("p", sloSample{failed: true}) // 1 of 2 failed
+	if got := send(); got != "q" {
+		t.Fatalf("demoted primary: answered by %s, want the fallback", got)
+	}
+	for range 20 {
+		a.recordSLO("p", sloSample{duration: time.Millisecond})
+	}
+	if got := send(); got != "p" {
+		t.Fatalf("recovered primary: answered by %s", got)
+	}
+}
@@ -0,0 +1,175 @@
+package llmagent
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SSEEvent is one Server-Sent Events frame.
+type SSEEvent struct {
+	Event string // the event field; empty for the default "message"
+	ID    string // the last event ID seen, which carries over frames
+	// Data is the frame's data lines joined by "\n". It aliases the
+	// reader's buffers and is only valid until the next call to Next.
+	Data  []byte
+	Retry time.Duration // the retry field, if the frame set one
+}
+
+// SSEReader parses a Server-Sent Events stream as the HTML standard
+// describes: lines end in LF, CRLF or CR; a blank line ends a frame;
+// lines starting with ":" are comments; a field's value loses one leading
+// space; data lines of a frame are joined with newlines. Unlike the
+// standard, a frame cut off by the end of the stream is still delivered,
+// so a server omitting the final blank line loses nothing.
+//
+//	sr := llmagent.NewSSEReader(body)
+//	defer sr.Release()
+//	for sr.Next() {
+//		ev := sr.Event()
+//		...
+//	}
+//	if err := sr.Err(); err != nil { ... }
+type SSEReader struct {
+	sc      *bufio.Scanner
+	buf     *[]byte
+	data    []byte // the frame's data lines, reused across frames
+	lines   int
+	ev      SSEEvent
+	id      string
+	started bool
+	err     error
+}
+
+// MaxSSELineBytes bounds one line of an SSE stream; a longer line fails
+// the reader with bufio.ErrTooLong.
+const MaxSSELineBytes = 4 << 20
+
+var sseBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 32<<10)
+		return &b
+	},
+}
+
+// NewSSEReader returns a reader parsing r. Release hands its buffer back
+// once the stream is done.
+func NewSSEReader(r io.Reader) *SSEReader {
+	buf := sseBufPool.Get().(*[]byte)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(*buf, MaxSSELineBytes)
+	sc.Split(scanSSELines)
+	return &SSEReader{sc: sc, buf: buf}
+}
+
+// Release returns the reader's buffer to the pool. The reader and any
+// event data it returned must not be used afterwards.
+func (r *SSEReader) Release() {
+	if r.buf != nil {
+		sseBufPool.Put(r.buf)
+		r.buf = nil
+	}
+}
+
+// Next advances to the next frame, returning false at the end of the
+// stream or on a read error.
+func (r *SSEReader) Next() bool {
+	r.lines = 0
+	r.data = r.data[:0]
+	r.ev = SSEEvent{ID: r.id}
+	for r.sc.Scan() {
+		line := r.sc.Bytes()
+		if !r.started {
+			r.started = true
+			line = bytes.TrimPrefix(line, []byte("\xef\xbb\xbf")) // BOM
+		}
+		if len(line) == 0 {
+			if r.dispatch() {
+				return true
+			}
+			continue
+		}
+		r.field(line)
+	}
+	r.err = r.sc.Err()
+	return r.err == nil && r.dispatch()
+}
+
+// Event returns the current frame.
+func (r *SSEReader) Event() SSEEvent { return r.ev }
+
+// Err returns the read error that ended the stream, if any.
+func (r *SSEReader) Err() error { return r.err }
+
+func (r *SSEReader) field(line []byte) {
+	if line[0] == ':' {
+		return // comment
+	}
+	name, value := line, []byte(nil)
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		name, value = line[:i], line[i+1:]
+		if len(value) > 0 && value[0] == ' ' {
+			value = value[1:]
+		}
+	}
+	switch string(name) {
+	case "data":
+		// copied, as the scanner reuses its buffer, but into a buffer of
+		// the reader's own, so steady streaming doesn't allocate
+		if r.lines > 0 {
+			r.data = append(r.data, '\n')
+		}
+		r.data = append(r.data, value...)
+		r.lines++
+	case "event":
+		r.ev.Event = string(value)
+	case "id":
+		if bytes.IndexByte(value, 0) < 0 {
+			r.id = string(value)
+			r.ev.ID = r.id
+		}
+	case "retry":
+		if ms, err := strconv.ParseUint(string(value), 10, 63); err == nil {
+			r.ev.Retry = time.Duration(ms) * time.Millisecond
+		}
+	}
+}
+
+// dispatch completes the frame, reporting whether it carried data. A
+// frame without data only resets the event name.
+func (r *SSEReader) dispatch() bool {
+	if r.lines == 0 {
+		r.ev = SSEEvent{ID: r.id}
+		return false
+	}
+	r.ev.Data = r.data
+	return true
+}
+
+// scanSSELines splits on LF, CRLF or a lone CR.
+func scanSSELines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		switch {
+		case data[i] == '\n':
+			return i + 1, data[:i], nil
+		case i+1 < len(data):
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		case atEOF:
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil // a CR at the end may be half of a CRLF
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,173 @@
+package llmagent
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func readSSE(t testing.TB, r io.Reader) ([]SSEEvent, error) {
+	t.Helper()
+	sr := NewSSEReader(r)
+	defer sr.Release()
+	var events []SSEEvent
+	for sr.Next() {
+		ev := sr.Event()
+		ev.Data = bytes.Clone(ev.Data)
+		events = append(events, ev)
+	}
+	return events, sr.Err()
+}
+
+func TestSSEReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []SSEEvent
+	}{
+		{
+			name:   "single",
+			stream: "data: hello\n\n",
+			want:   []SSEEvent{{Data: []byte("hello")}},
+		},
+		{
+			name:   "crlf and lone cr",
+			stream: "data: a\r\n\r\ndata: b\r\rdata: c\n\n",
+			want:   []SSEEvent{{Data: []byte("a")}, {Data: []byte("b")}, {Data: []byte("c")}},
+		},
+		{
+			name:   "multi-line data",
+			stream: "data: one\ndata:two\ndata:  three\n\n",
+			want:   []SSEEvent{{Data: []byte("one\ntwo\n three")}},
+		},
+		{
+			name:   "event, id and retry",
+			stream: "event: delta\nid: 7\nretry: 1500\ndata: {}\n\ndata: next\n\n",
+			want: []SSEEvent{
+				{Event: "delta", ID: "7", Retry: 1500 * time.Millisecond, Data: []byte("{}")},
+				{ID: "7", Data: []byte("next")},
+			},
+		},
+		{
+			name:   "comments and frames without data",
+			stream: ": keep-alive\n\nevent: ping\n\n:x\ndata: x\n\n",
+			want:   []SSEEvent{{Data: []byte("x")}},
+		},
+		{
+			name:   "bom",
+			stream: "\xef\xbb\xbfdata: bom\n\n",
+			want:   []SSEEvent{{Data: []byte("bom")}},
+		},
+		{
+			name:   "unterminated last frame",
+			stream: "data: a\n\ndata: b",
+			want:   []SSEEvent{{Data: []byte("a")}, {Data: []byte("b")}},
+		},
+		{
+			name:   "field without colon",
+			stream: "data\n\n",
+			want:   []SSEEvent{{Data: []byte("")}},
+		},
+		{
+			name:   "id with nul ignored",
+			stream: "id: 1\ndata: a\n\nid: 2\x00\ndata: b\n\n",
+			want:   []SSEEvent{{ID: "1", Data: []byte("a")}, {ID: "1", Data: []byte("b")}},
+		},
+		{
+			name:   "bad retry ignored",
+			stream: "retry: soon\ndata: a\n\n",
+			want:   []SSEEvent{{Data: []byte("a")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// one byte per read splits every frame and line ending
+			for _, r := range []io.Reader{strings.NewReader(tt.stream), iotest.OneByteReader(strings.NewReader(tt.stream))} {
+				got, err := readSSE(t, r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !equalEvents(got, tt.want) {
+					t.Fatalf("events = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSSEReaderLineTooLong(t *testing.T) {
+	stream := "data: ok\n\ndata: " + strings.Repeat("x", MaxSSELineBytes) + "\n\n"
+	got, err := readSSE(t, strings.NewReader(stream))
+	if !errors.Is(err, bufio.ErrTooLong) {
+		t.Fatalf("err = %v, want bufio.ErrTooLong", err)
+	}
+	if len(got) != 1 || string(got[0].Data) != "ok" {
+		t.Fatalf("events before the long line = %q", got)
+	}
+}
+
+func equalEvents(a, b []SSEEvent) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Event != b[i].Event || a[i].ID != b[i].ID || a[i].Retry != b[i].Retry || !bytes.Equal(a[i].Data, b[i].Data) {
+			return false
+		}
+	}
+	return true
+}
+
+// FuzzSSEReader checks that any stream, however malformed, parses the
+// same whichever way the reads split it, that line endings are
+// interchangeable, and that data never carries a line break other than
+// the joining newline.
+func FuzzSSEReader(f *testing.F) {
+	for _, seed := range []string{
+		"data: hello\n\n",
+		"data: a\r\n\r\ndata: b\r\rdata: c\n\n",
+		"event: delta\nid: 7\nretry: 10\ndata: one\ndata: two\n\n",
+		": comment\n\nevent: ping\n\n",
+		"\xef\xbb\xbfdata: bom",
+		"data: a\r",
+		"data:" + strings.Repeat("x", 1<<16) + "\n\n",
+		"id: \x00\ndata\n\n",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		whole, err := readSSE(t, bytes.NewReader(stream))
+		if err != nil {
+			t.Fatalf("reading %q: %v", stream, err)
+		}
+		split, err := readSSE(t, iotest.HalfReader(bytes.NewReader(stream)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalEvents(whole, split) {
+			t.Fatalf("split reads parsed %q as %q, whole reads as %q", stream, split, whole)
+		}
+		for _, ev := range whole {
+			if bytes.IndexByte(ev.Data, '\r') >= 0 {
+				t.Fatalf("data %q of %q holds a CR", ev.Data, stream)
+			}
+		}
+		// CRLF and CR line endings parse like LF.
+		lf := bytes.ReplaceAll(bytes.ReplaceAll(stream, []byte("\r\n"), []byte("\n")), []byte("\r"), []byte("\n"))
+		for _, ending := range []string{"\r\n", "\r"} {
+			converted := bytes.ReplaceAll(lf, []byte("\n"), []byte(ending))
+			got, err := readSSE(t, bytes.NewReader(converted))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalEvents(whole, got) {
+				t.Fatalf("%q endings parsed %q as %q, LF as %q", ending, converted, got, whole)
+			}
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package llmagent
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Usage reports token counts for a completion.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// CompletionStats summarizes a finished completion. It is carried by the
+// terminal stream event (Done == true) of every completion.
+type CompletionStats struct {
+	Usage
+	Provider         string        `json:"provider"`
+	Model            string        `json:"model"`
+	Duration         time.Duration `json:"duration"`
+	TimeToFirstToken time.Duration `json:"time_to_first_token"`
+	Estimated        bool          `json:"estimated,omitempty"` // token counts were estimated locally
+	Cached           bool          `json:"cached,omitempty"`
+	RequestID        string        `json:"request_id,omitempty"` // provider's request ID, for support tickets
+	RateLimit        *RateLimit    `json:"rate_limit,omitempty"`
+	Tags             []string      `json:"tags,omitempty"` // from the request
+}
+
+// Metrics returns a snapshot of the per-provider metrics.
+func (a *Agent) Metrics() map[string]ProviderMetrics {
+	a.metricsLock.Lock()
+	defer a.metricsLock.Unlock()
+	out := make(map[string]ProviderMetrics, len(a.metrics))
+	for name, m := range a.metrics {
+		out[name] = *m
+	}
+	return out
+}
+
+// instrument forwards every response from in, tagging it with the provider
+// name and the assistant role, and finishes with a Done event carrying the
+// finish reason the provider reported and CompletionStats. The stats
+// are also folded into the provider's metrics and the billing of ctx's
+// user, also when the run is cancelled mid-stream, unless ctx carries a
+// shadow request. Prefetched requests are billed under PrefetchTag.
+func (a *Agent) instrument(ctx context.Context, p Provider, req CompletionRequest, start time.Time, in <-chan CompletionResponse) <-chan CompletionResponse {
+	tenant := UserFromContext(ctx)
+	return stage(ctx, in, func(emit func(CompletionResponse) bool) {
+		stats := CompletionStats{
+			Provider: p.Name(),
+			Model:    ResolveRequest(p.GetConfig(), req).Model,
+			Tags:     req.Tags,
+		}
+		var usage *Usage
+		var completion int
+		var failed, toolCalls bool
+		var finish FinishReason
+		for resp := range in {
+			if resp.Meta != nil {
+				stats.RequestID = resp.Meta.RequestID
+				stats.RateLimit = resp.Meta.RateLimit
+				if metaOnly(resp) {
+					continue
+				}
+				resp.Meta = nil
+			}
+			if resp.Content != "" && stats.TimeToFirstToken == 0 {
+				stats.TimeToFirstToken = a.clock().Now().Sub(start)
+			}
+			if resp.Usage != nil {
+				usage = resp.Usage
+			}
+			if resp.Err != nil {
+				failed = true
+			}
+			if len(resp.ToolCalls) > 0 {
+				toolCalls = true
+			}
+			if resp.FinishReason != "" {
+				// carried to the Done event; an event with nothing else
+				// is dropped
+				finish = resp.FinishReason
+				resp.FinishReason = ""
+				if resp.Content == "" && resp.Err == nil && resp.Usage == nil && len(resp.ToolCalls) == 0 && !resp.Done {
+					continue
+				}
+			}
+			if resp.Role == "" && (resp.Content != "" || len(resp.ToolCalls) > 0) {
+				resp.Role = RoleAssistant
+			}
+			completion += EstimateTokens(resp.Content)
+			resp.Provider = p.Name()
+			if !emit(resp) {
+				break
+			}
+		}
+		stats.Duration = a.clock().Now().Sub(start)
+		if usage != nil {
+			stats.Usage = *usage
+		} else {
+			stats.Estimated = true
+			for _, msg := range req.Messages {
+				stats.PromptTokens += EstimateTokens(msg.Content)
+			}
+			stats.CompletionTokens = completion
+		}
+		if stats.TotalTokens == 0 {
+			stats.TotalTokens = stats.PromptTokens + stats.CompletionTokens
+		}
+
+		delta := ProviderMetrics{
+			Completions:           1,
+			PromptTokens:          stats.PromptTokens,
+			CompletionTokens:      stats.CompletionTokens,
+			TotalDuration:         stats.Duration,
+			TotalTimeToFirstToken: stats.TimeToFirstToken,
+			RateLimit:             stats.RateLimit,
+			LastRequestID:         stats.RequestID,
+		}
+		if failed {
+			delta.StreamErrors = 1
+		}
+		if !shadowed(ctx) {
+			a.metricsLock.Lock()
+			if m, ok := a.metrics[p.Name()]; ok {
+				m.add(delta)
+			}
+			a.metricsLock.Unlock()
+			a.pushMetrics(p.Name(), delta)
+			if a.Billing != nil {
+				billed := stats
+				if prefetching(ctx) {
+					billed.Tags = append(slices.Clone(stats.Tags), PrefetchTag)
+				}
+				a.Billing.record(tenant, billed, a.clock())
+			}
+			a.recordSLO(p.Name(), sloSample{ttft: stats.TimeToFirstToken, duration: stats.Duration, failed: failed, model: stats.Model, usage: stats.Usage, tags: req.Tags})
+		}
+
+		done := CompletionResponse{Provider: p.Name(), Done: true, FinishReason: finish, Stats: &stats}
+		switch {
+		case failed:
+			done.FinishReason = FinishError
+		case finish != "":
+		case toolCalls:
+			done.FinishReason = FinishToolCalls
+		default:
+			done.FinishReason = FinishStop
+		}
+		emit(done)
+	})
+}
+
+// cachedResponse replays a cache entry followed by its Done event.
+func cachedResponse(entry cacheEntry, model string) <-chan CompletionResponse {
+	out := make(chan CompletionResponse, 2)
+	out <- entry.response()
+	finish := entry.finish
+	if finish == "" {
+		finish = FinishStop
+	}
+	out <- CompletionResponse{
+		Provider:     entry.provider,
+		Cached:       true,
+		Done:         true,
+		FinishReason: finish,
+		Stats:        &CompletionStats{Provider: entry.provider, Model: model, Cached: true},
+	}
+	close(out)
+	return out
+}
@@ -0,0 +1,93 @@
+package llmagent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// TagTaxonomy restricts the tags requests may carry, so usage can be
+// sliced by a fixed set of product features.
+type TagTaxonomy struct {
+	// Allowed lists valid tags; an entry ending in "*" allows every tag
+	// with that prefix, e.g. "feature:*". Empty allows anything.
+	Allowed []string
+	// Required lists prefixes every request must have a tag for, e.g.
+	// "feature:".
+	Required []string
+	MaxTags  int // 0 = unlimited
+}
+
+// TagError rejects a request's tags. It counts as a 400.
+type TagError struct {
+	Tag    string
+	Reason string
+}
+
+func (e *TagError) Error() string {
+	if e.Tag == "" {
+		return "tags: " + e.Reason
+	}
+	return fmt.Sprintf("tag %q: %s", e.Tag, e.Reason)
+}
+
+func (e *TagError) HTTPStatusCode() int { return http.StatusBadRequest }
+
+// Validate checks tags against the taxonomy.
+func (t *TagTaxonomy) Validate(tags []string) error {
+	if t == nil {
+		return nil
+	}
+	if t.MaxTags > 0 && len(tags) > t.MaxTags {
+		return &TagError{Reason: fmt.Sprintf("%d tags, at most %d allowed", len(tags), t.MaxTags)}
+	}
+	for _, tag := range tags {
+		if len(t.Allowed) > 0 && !slices.ContainsFunc(t.Allowed, func(a string) bool { return tagMatches(a, tag) }) {
+			return &TagError{Tag: tag, Reason: "is not in the taxonomy"}
+		}
+	}
+	for _, prefix := range t.Required {
+		if !slices.ContainsFunc(tags, func(tag string) bool { return strings.HasPrefix(tag, prefix) }) {
+			return &TagError{Reason: fmt.Sprintf("a %q tag is required", prefix)}
+		}
+	}
+	return nil
+}
+
+func tagMatches(pattern, tag string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(tag, prefix)
+	}
+	return pattern == tag
+}
+
+type tagsKey struct{}
+
+// withTags makes the request's tags visible to hooks that only get a
+// context, such as PolicyEngine.OnViolation.
+func withTags(ctx context.Context, tags []string) context.Context {
+	if len(tags) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, tagsKey{}, tags)
+}
+
+// TagsFromContext returns the tags of the request being processed, for
+// audit hooks.
+func TagsFromContext(ctx context.Context) []string {
+	tags, _ := ctx.Value(tagsKey{}).([]string)
+	return tags
+}
+
+// tagLabel is the canonical label for a tag set: sorted and
+// comma-separated.
+func tagLabel(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	sorted := slices.Clone(tags)
+	slices.Sort(sorted)
+	return strings.Join(slices.Compact(sorted), ",")
+}
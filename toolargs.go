@@ -0,0 +1,443 @@
+package llmagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ArgProblem is one mismatch between tool arguments and the schema. Path
+// is a dotted location such as "items.2.name"; empty means the root.
+type ArgProblem struct {
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// ArgError reports model-produced arguments that don't fit the tool's
+// schema. Send ToolResult back as the tool output so the model can fix its
+// call instead of failing the run.
+type ArgError struct {
+	Tool     string
+	Problems []ArgProblem
+}
+
+func (e *ArgError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Message
+		if p.Path != "" {
+			msgs[i] = p.Path + ": " + p.Message
+		}
+	}
+	return fmt.Sprintf("tool %q: invalid arguments: %s", e.Tool, strings.Join(msgs, "; "))
+}
+
+func (e *ArgError) HTTPStatusCode() int { return http.StatusBadRequest }
+
+// ToolResult renders the error as JSON for the model.
+func (e *ArgError) ToolResult() string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(map[string]any{
+		"error":    "invalid arguments; fix them and call the tool again",
+		"problems": e.Problems,
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// PrepareArgs checks args against a JSON Schema and returns them
+// normalized: compatible values are coerced to the declared type ("42" to
+// 42, "true" to true, a JSON-encoded object string to the object, a lone
+// value to a one-element array), missing properties with a default are
+// filled in. Problems come back as *ArgError.
+//
+// The supported keywords are type, properties, required,
+// additionalProperties, items, enum, const, default, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern,
+// minItems and maxItems; others are ignored.
+func PrepareArgs(tool string, schema, args json.RawMessage) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(args)) == 0 {
+		args = json.RawMessage("{}")
+	}
+	v, err := decodeNumber(args)
+	if err != nil {
+		return nil, &ArgError{Tool: tool, Problems: []ArgProblem{{Message: "arguments are not valid JSON: " + err.Error()}}}
+	}
+	if len(bytes.TrimSpace(schema)) == 0 {
+		return args, nil
+	}
+	s, err := decodeNumber(schema)
+	if err != nil {
+		return nil, fmt.Errorf("tool %q: bad schema: %w", tool, err)
+	}
+	c := &argChecker{}
+	v = c.check("", v, s)
+	if len(c.problems) > 0 {
+		return nil, &ArgError{Tool: tool, Problems: c.problems}
+	}
+	return json.Marshal(v)
+}
+
+// Call prepares the arguments with PrepareArgs and runs the handler.
+func (t ToolFunc) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	if t.Handler == nil {
+		return "", fmt.Errorf("tool %q has no handler", t.Name)
+	}
+	args, err := PrepareArgs(t.Name, t.Parameters, args)
+	if err != nil {
+		return "", err
+	}
+	return t.Handler(ctx, args)
+}
+
+func decodeNumber(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+type argChecker struct {
+	problems []ArgProblem
+}
+
+func (c *argChecker) fail(path, format string, args ...any) {
+	c.problems = append(c.problems, ArgProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// check validates v against schema s and returns v, possibly coerced.
+func (c *argChecker) check(path string, v any, s any) any {
+	schema, ok := s.(map[string]any)
+	if !ok {
+		return v // true, or a schema we can't read
+	}
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		coerced, ok := coerce(v, types)
+		if !ok {
+			c.fail(path, "expected %s, got %s", strings.Join(types, " or "), jsonType(v))
+			return v
+		}
+		v = coerced
+	}
+	if enum, ok := schema["enum"].([]any); ok && !containsJSON(enum, v) {
+		c.fail(path, "must be one of %s", compactJSON(enum))
+	}
+	if want, ok := schema["const"]; ok && !equalJSON(want, v) {
+		c.fail(path, "must be %s", compactJSON(want))
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		return c.object(path, v, schema)
+	case []any:
+		return c.array(path, v, schema)
+	case string:
+		c.str(path, v, schema)
+	case json.Number:
+		c.number(path, v, schema)
+	}
+	return v
+}
+
+func (c *argChecker) object(path string, v map[string]any, schema map[string]any) any {
+	props, _ := schema["properties"].(map[string]any)
+	for _, r := range asSlice(schema["required"]) {
+		name, _ := r.(string)
+		if _, ok := v[name]; ok {
+			continue
+		}
+		if def, ok := defaultOf(props[name]); ok {
+			v[name] = def
+			continue
+		}
+		c.fail(join(path, name), "is required")
+	}
+	// defaults for optional properties too, in a stable order
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := v[name]; !ok {
+			if def, ok := defaultOf(props[name]); ok {
+				v[name] = def
+			}
+		}
+	}
+	extra := schema["additionalProperties"]
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if ps, ok := props[k]; ok {
+			v[k] = c.check(join(path, k), v[k], ps)
+			continue
+		}
+		switch extra := extra.(type) {
+		case bool:
+			if !extra {
+				c.fail(join(path, k), "is not a known property")
+			}
+		case map[string]any:
+			v[k] = c.check(join(path, k), v[k], extra)
+		}
+	}
+	return v
+}
+
+func (c *argChecker) array(path string, v []any, schema map[string]any) any {
+	if n, ok := intKeyword(schema, "minItems"); ok && len(v) < n {
+		c.fail(path, "needs at least %d items", n)
+	}
+	if n, ok := intKeyword(schema, "maxItems"); ok && len(v) > n {
+		c.fail(path, "allows at most %d items", n)
+	}
+	if items, ok := schema["items"]; ok {
+		for i := range v {
+			v[i] = c.check(join(path, strconv.Itoa(i)), v[i], items)
+		}
+	}
+	return v
+}
+
+func (c *argChecker) str(path, v string, schema map[string]any) {
+	n := utf8.RuneCountInString(v)
+	if min, ok := intKeyword(schema, "minLength"); ok && n < min {
+		c.fail(path, "must be at least %d characters", min)
+	}
+	if max, ok := intKeyword(schema, "maxLength"); ok && n > max {
+		c.fail(path, "must be at most %d characters", max)
+	}
+	if p, ok := schema["pattern"].(string); ok {
+		if re, err := regexp.Compile(p); err == nil && !re.MatchString(v) {
+			c.fail(path, "must match %s", p)
+		}
+	}
+}
+
+func (c *argChecker) number(path string, v json.Number, schema map[string]any) {
+	f, err := v.Float64()
+	if err != nil {
+		return
+	}
+	if min, ok := floatKeyword(schema, "minimum"); ok && f < min {
+		c.fail(path, "must be >= %v", min)
+	}
+	if max, ok := floatKeyword(schema, "maximum"); ok && f > max {
+		c.fail(path, "must be <= %v", max)
+	}
+	if min, ok := floatKeyword(schema, "exclusiveMinimum"); ok && f <= min {
+		c.fail(path, "must be > %v", min)
+	}
+	if max, ok := floatKeyword(schema, "exclusiveMaximum"); ok && f >= max {
+		c.fail(path, "must be < %v", max)
+	}
+}
+
+// coerce returns v as one of types: an exact match wins, then the first
+// type v converts to losslessly.
+func coerce(v any, types []string) (any, bool) {
+	for _, t := range types {
+		if isType(v, t) {
+			if n, ok := v.(json.Number); ok && t == "integer" {
+				return convert(n.String(), t) // 1e2 -> 100
+			}
+			return v, true
+		}
+	}
+	for _, t := range types {
+		if c, ok := convert(v, t); ok {
+			return c, true
+		}
+	}
+	return v, false
+}
+
+func isType(v any, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case map[string]any:
+		return t == "object"
+	case []any:
+		return t == "array"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		return t == "integer" && isInteger(v)
+	}
+	return false
+}
+
+func isInteger(n json.Number) bool {
+	if _, err := n.Int64(); err == nil {
+		return true
+	}
+	f, err := n.Float64()
+	return err == nil && f == math.Trunc(f) && !math.IsInf(f, 0)
+}
+
+func convert(v any, t string) (any, bool) {
+	switch t {
+	case "integer", "number":
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		n := json.Number(strings.TrimSpace(s))
+		if _, err := n.Float64(); err != nil {
+			return nil, false
+		}
+		if t == "integer" {
+			if !isInteger(n) {
+				return nil, false
+			}
+			if i, err := n.Int64(); err == nil {
+				return json.Number(strconv.FormatInt(i, 10)), true
+			}
+			f, _ := n.Float64()
+			return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), true
+		}
+		return n, true
+	case "boolean":
+		if s, ok := v.(string); ok {
+			if b, err := strconv.ParseBool(strings.ToLower(strings.TrimSpace(s))); err == nil {
+				return b, true
+			}
+		}
+	case "string":
+		switch v := v.(type) {
+		case json.Number:
+			return v.String(), true
+		case bool:
+			return strconv.FormatBool(v), true
+		}
+	case "object", "array":
+		// models sometimes send nested JSON as an encoded string
+		if s, ok := v.(string); ok {
+			if d, err := decodeNumber([]byte(s)); err == nil && isType(d, t) {
+				return d, true
+			}
+		}
+		if t == "array" && v != nil && !isType(v, "object") {
+			return []any{v}, true
+		}
+	}
+	return nil, false
+}
+
+func schemaTypes(t any) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var out []string
+		for _, x := range t {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case json.Number:
+		if isInteger(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func defaultOf(s any) (any, bool) {
+	schema, ok := s.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	def, ok := schema["default"]
+	return def, ok
+}
+
+func intKeyword(schema map[string]any, key string) (int, bool) {
+	f, ok := floatKeyword(schema, key)
+	return int(f), ok
+}
+
+func floatKeyword(schema map[string]any, key string) (float64, bool) {
+	n, ok := schema[key].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+func containsJSON(list []any, v any) bool {
+	for _, x := range list {
+		if equalJSON(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalJSON(a, b any) bool {
+	if na, ok := a.(json.Number); ok {
+		if nb, ok := b.(json.Number); ok {
+			fa, ea := na.Float64()
+			fb, eb := nb.Float64()
+			return ea == nil && eb == nil && fa == fb
+		}
+	}
+	return compactJSON(a) == compactJSON(b)
+}
+
+func compactJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,133 @@
+package llmagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const weatherSchema = `{
+	"type": "object",
+	"properties": {
+		"city":  {"type": "string", "minLength": 2},
+		"days":  {"type": "integer", "minimum": 1, "maximum": 14, "default": 3},
+		"units": {"type": "string", "enum": ["metric", "imperial"], "default": "metric"},
+		"alerts": {"type": "boolean"},
+		"hours": {"type": "array", "items": {"type": "integer"}, "maxItems": 3},
+		"where": {
+			"type": "object",
+			"properties": {"lat": {"type": "number"}, "lon": {"type": "number"}},
+			"required": ["lat", "lon"],
+			"additionalProperties": false
+		},
+		"note": {"type": ["string", "null"]}
+	},
+	"required": ["city"]
+}`
+
+func TestPrepareArgsCoercesAndFillsDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		name, args, want string
+	}{
+		{"defaults filled", `{"city":"Oslo"}`,
+			`{"city":"Oslo","days":3,"units":"metric"}`},
+		{"numeric string to integer", `{"city":"Oslo","days":"5"}`,
+			`{"city":"Oslo","days":5,"units":"metric"}`},
+		{"integral float to integer", `{"city":"Oslo","days":1e1}`,
+			`{"city":"Oslo","days":10,"units":"metric"}`},
+		{"string to boolean", `{"city":"Oslo","alerts":"TRUE"}`,
+			`{"alerts":true,"city":"Oslo","days":3,"units":"metric"}`},
+		{"number to string", `{"city":42}`,
+			`{"city":"42","days":3,"units":"metric"}`},
+		{"lone value to array", `{"city":"Oslo","hours":"7"}`,
+			`{"city":"Oslo","days":3,"hours":[7],"units":"metric"}`},
+		{"encoded object string", `{"city":"Oslo","where":"{\"lat\":\"59.9\",\"lon\":10.7}"}`,
+			`{"city":"Oslo","days":3,"units":"metric","where":{"lat":59.9,"lon":10.7}}`},
+		{"null allowed", `{"city":"Oslo","note":null}`,
+			`{"city":"Oslo","days":3,"note":null,"units":"metric"}`},
+		{"big integers keep their digits", `{"city":"Oslo","hours":[9007199254740993]}`,
+			`{"city":"Oslo","days":3,"hours":[9007199254740993],"units":"metric"}`},
+	} {
+		got, err := PrepareArgs("weather", json.RawMessage(weatherSchema), json.RawMessage(tc.args))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPrepareArgsProblems(t *testing.T) {
+	for _, tc := range []struct {
+		name, args string
+		want       []ArgProblem
+	}{
+		{"missing required", `{}`,
+			[]ArgProblem{{Path: "city", Message: "is required"}}},
+		{"not an integer", `{"city":"Oslo","days":"2.5"}`,
+			[]ArgProblem{{Path: "days", Message: "expected integer, got string"}}},
+		{"out of range", `{"city":"Oslo","days":30}`,
+			[]ArgProblem{{Path: "days", Message: "must be <= 14"}}},
+		{"enum", `{"city":"Oslo","units":"kelvin"}`,
+			[]ArgProblem{{Path: "units", Message: `must be one of ["metric","imperial"]`}}},
+		{"nested paths", `{"city":"O","hours":[1,"x",3,4],"where":{"lat":1,"alt":2}}`,
+			[]ArgProblem{
+				{Path: "city", Message: "must be at least 2 characters"},
+				{Path: "hours", Message: "allows at most 3 items"},
+				{Path: "hours.1", Message: "expected integer, got string"},
+				{Path: "where.lon", Message: "is required"},
+				{Path: "where.alt", Message: "is not a known property"},
+			}},
+		{"not JSON", `{"city":`,
+			[]ArgProblem{{Message: "arguments are not valid JSON: unexpected EOF"}}},
+	} {
+		_, err := PrepareArgs("weather", json.RawMessage(weatherSchema), json.RawMessage(tc.args))
+		var aerr *ArgError
+		if !errors.As(err, &aerr) {
+			t.Errorf("%s: err = %v, want an ArgError", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(aerr.Problems, tc.want) {
+			t.Errorf("%s: problems = %+v, want %+v", tc.name, aerr.Problems, tc.want)
+		}
+	}
+}
+
+func TestArgErrorToolResult(t *testing.T) {
+	err := &ArgError{Tool: "weather", Problems: []ArgProblem{
+		{Path: "days", Message: "must be <= 14"},
+		{Message: "arguments are not valid JSON: <eof>"},
+	}}
+	want := `{"error":"invalid arguments; fix them and call the tool again","problems":[{"path":"days","message":"must be <= 14"},{"message":"arguments are not valid JSON: <eof>"}]}`
+	if got := err.ToolResult(); got != want {
+		t.Fatalf("ToolResult =\n%s\nwant\n%s", got, want)
+	}
+	if got := err.Error(); got != `tool "weather": invalid arguments: days: must be <= 14; arguments are not valid JSON: <eof>` {
+		t.Fatalf("Error = %s", got)
+	}
+}
+
+func TestToolFuncCallPreparesArgs(t *testing.T) {
+	var seen string
+	tool := ToolFunc{
+		ToolDefinition: ToolDefinition{Name: "weather", Parameters: json.RawMessage(weatherSchema)},
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			seen = string(args)
+			return "ok", nil
+		},
+	}
+	if _, err := tool.Call(context.Background(), json.RawMessage(`{"city":"Oslo","days":"2"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if seen != `{"city":"Oslo","days":2,"units":"metric"}` {
+		t.Fatalf("handler got %s", seen)
+	}
+	seen = ""
+	if _, err := tool.Call(context.Background(), nil); err == nil || seen != "" {
+		t.Fatalf("missing city: err = %v, handler ran with %q", err, seen)
+	}
+}
@@ -0,0 +1,266 @@
+package llmagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ToolApproval says whether a tool may run.
+type ToolApproval string
+
+const (
+	ToolAllow   ToolApproval = "allow"   // run without asking
+	ToolApprove ToolApproval = "approve" // ask the ToolGuard's Approver first
+	ToolDeny    ToolApproval = "deny"    // never run
+)
+
+// ToolPolicy governs one tool.
+type ToolPolicy struct {
+	Approval ToolApproval // empty means ToolAllow
+	// RedactArgs lists top-level argument names replaced with
+	// RedactionText in audit records; "*" redacts all arguments.
+	RedactArgs []string
+}
+
+// ApprovalRequest is what an Approver decides on.
+type ApprovalRequest struct {
+	Tool   string          `json:"tool"`
+	CallID string          `json:"call_id,omitempty"`
+	User   string          `json:"user,omitempty"`
+	Args   json.RawMessage `json:"args"` // redacted per policy
+}
+
+// Approver decides on tools with a ToolApprove policy, e.g. by asking a
+// human. An error counts as a denial.
+type Approver interface {
+	Approve(ctx context.Context, req ApprovalRequest) (ok bool, reason string, err error)
+}
+
+// ApproverFunc adapts a function to Approver.
+type ApproverFunc func(ctx context.Context, req ApprovalRequest) (bool, string, error)
+
+func (f ApproverFunc) Approve(ctx context.Context, req ApprovalRequest) (bool, string, error) {
+	return f(ctx, req)
+}
+
+// WebhookApprover POSTs the ApprovalRequest as JSON to URL and expects
+// {"approved": true|false, "reason": "..."} back. Without a deadline on the
+// context the call waits at most Timeout (default 5 minutes).
+type WebhookApprover struct {
+	URL     string
+	Header  http.Header
+	Client  *http.Client
+	Timeout time.Duration
+}
+
+func (w WebhookApprover) Approve(ctx context.Context, req ApprovalRequest) (bool, string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := w.Timeout
+		if timeout <= 0 {
+			timeout = 5 * time.Minute
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return false, "", err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, "", err
+	}
+	for k, vs := range w.Header {
+		hreq.Header[k] = vs
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(hreq)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return false, "", fmt.Errorf("approval webhook: HTTP %d", resp.StatusCode)
+	}
+	var out struct {
+		Approved bool   `json:"approved"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&out); err != nil {
+		return false, "", fmt.Errorf("approval webhook: %w", err)
+	}
+	return out.Approved, out.Reason, nil
+}
+
+// Tool audit decisions.
+const (
+	DecisionAllowed  = "allowed"
+	DecisionApproved = "approved"
+	DecisionDenied   = "denied"
+)
+
+// ToolAuditRecord describes one tool execution or refusal. The result
+// itself is not kept, only its hash and size.
+type ToolAuditRecord struct {
+	At         time.Time       `json:"at"`
+	Tool       string          `json:"tool"`
+	CallID     string          `json:"call_id,omitempty"`
+	User       string          `json:"user,omitempty"`
+	Args       json.RawMessage `json:"args"`
+	Decision   string          `json:"decision"`
+	Reason     string          `json:"reason,omitempty"` // approver's reason, or why the call was denied
+	ResultHash string          `json:"result_hash,omitempty"`
+	ResultSize int             `json:"result_size,omitempty"`
+	Duration   time.Duration   `json:"duration"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// ToolDeniedError is returned for calls refused by policy or the
+// approver.
+type ToolDeniedError struct {
+	Tool   string
+	Reason string
+}
+
+func (e *ToolDeniedError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("tool %q: call denied", e.Tool)
+	}
+	return fmt.Sprintf("tool %q: call denied: %s", e.Tool, e.Reason)
+}
+
+func (e *ToolDeniedError) HTTPStatusCode() int { return http.StatusForbidden }
+
+// ToolGuard applies per-tool policies and audits every call.
+type ToolGuard struct {
+	Policies map[string]ToolPolicy // by tool name
+	Default  ToolPolicy            // for tools without an entry
+	Approver Approver              // required by ToolApprove policies; calls are denied without one
+	OnAudit  func(ToolAuditRecord)
+	Clock    Clock
+}
+
+func (g *ToolGuard) policy(name string) ToolPolicy {
+	if p, ok := g.Policies[name]; ok {
+		return p
+	}
+	return g.Default
+}
+
+// Call runs t through the tool's policy, then t.Call, and audits the
+// outcome. A nil guard just runs the tool.
+func (g *ToolGuard) Call(ctx context.Context, t ToolFunc, callID string, args json.RawMessage) (string, error) {
+	if g == nil {
+		return t.Call(ctx, args)
+	}
+	clock := clockOr(g.Clock)
+	p := g.policy(t.Name)
+	rec := ToolAuditRecord{
+		At:     clock.Now(),
+		Tool:   t.Name,
+		CallID: callID,
+		User:   UserFromContext(ctx),
+		Args:   redactArgs(args, p.RedactArgs),
+	}
+	deny := func(reason string) (string, error) {
+		rec.Decision, rec.Reason = DecisionDenied, reason
+		g.audit(rec)
+		return "", &ToolDeniedError{Tool: t.Name, Reason: reason}
+	}
+
+	rec.Decision = DecisionAllowed
+	switch p.Approval {
+	case ToolDeny:
+		return deny("denied by policy")
+	case ToolApprove:
+		if g.Approver == nil {
+			return deny("approval required but no approver is configured")
+		}
+		ok, reason, err := g.Approver.Approve(ctx, ApprovalRequest{Tool: t.Name, CallID: callID, User: rec.User, Args: rec.Args})
+		if err != nil {
+			return deny("approval failed: " + err.Error())
+		}
+		if !ok {
+			if reason == "" {
+				reason = "rejected by approver"
+			}
+			return deny(reason)
+		}
+		rec.Decision, rec.Reason = DecisionApproved, reason
+	}
+
+	start := clock.Now()
+	result, err := t.Call(ctx, args)
+	rec.Duration = clock.Now().Sub(start)
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		sum := sha256.Sum256([]byte(result))
+		rec.ResultHash, rec.ResultSize = hex.EncodeToString(sum[:]), len(result)
+	}
+	g.audit(rec)
+	return result, err
+}
+
+func (g *ToolGuard) audit(rec ToolAuditRecord) {
+	if g.OnAudit != nil {
+		g.OnAudit(rec)
+	}
+}
+
+// redactArgs masks the named top-level arguments. Arguments that aren't a
+// JSON object are masked whole when anything is to be redacted.
+func redactArgs(args json.RawMessage, names []string) json.RawMessage {
+	if len(names) == 0 {
+		return append(json.RawMessage(nil), args...)
+	}
+	redacted, _ := json.Marshal(RedactionText)
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(args, &obj) != nil {
+		return redacted
+	}
+	for _, n := range names {
+		if n == "*" {
+			for k := range obj {
+				obj[k] = redacted
+			}
+			break
+		}
+		if _, ok := obj[n]; ok {
+			obj[n] = redacted
+		}
+	}
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return redacted
+	}
+	return out
+}
+
+// AuditWriter returns an OnAudit handler appending each record to w as a
+// line of JSON. Writes are serialized; errors are dropped.
+func AuditWriter(w io.Writer) func(ToolAuditRecord) {
+	var mu sync.Mutex
+	return func(rec ToolAuditRecord) {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(append(line, '\n'))
+	}
+}
@@ -0,0 +1,199 @@
+package llmagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ToolRegistry holds the tools RunTools offers the model. It is safe for
+// concurrent use.
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]ToolFunc
+	order []string
+}
+
+// NewToolRegistry returns a registry holding tools.
+func NewToolRegistry(tools ...ToolFunc) (*ToolRegistry, error) {
+	r := &ToolRegistry{}
+	for _, t := range tools {
+		if err := r.Register(t); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds t, rejecting a duplicate name or a missing handler.
+func (r *ToolRegistry) Register(t ToolFunc) error {
+	if t.Name == "" {
+		return errors.New("tool has no name")
+	}
+	if t.Handler == nil {
+		return fmt.Errorf("tool %q has no handler", t.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tools == nil {
+		r.tools = map[string]ToolFunc{}
+	}
+	if _, ok := r.tools[t.Name]; ok {
+		return fmt.Errorf("tool %q already registered", t.Name)
+	}
+	r.tools[t.Name] = t
+	r.order = append(r.order, t.Name)
+	return nil
+}
+
+// RegisterFunc registers a Go function as a tool. Its arguments are
+// decoded into a T after PrepareArgs has checked them against schema.
+func RegisterFunc[T any](r *ToolRegistry, name, description, schema string, fn func(context.Context, T) (string, error)) error {
+	return r.Register(ToolFunc{
+		ToolDefinition: ToolDefinition{Name: name, Description: description, Parameters: json.RawMessage(schema)},
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var in T
+			if err := json.Unmarshal(args, &in); err != nil {
+				return "", err
+			}
+			return fn(ctx, in)
+		},
+	})
+}
+
+// Lookup returns the tool called name.
+func (r *ToolRegistry) Lookup(name string) (ToolFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Definitions returns the definitions of every tool, in registration
+// order.
+func (r *ToolRegistry) Definitions() []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	defs := make([]ToolDefinition, len(r.order))
+	for i, name := range r.order {
+		defs[i] = r.tools[name].ToolDefinition
+	}
+	return defs
+}
+
+// ErrToolLoopLimit is returned by RunTools when the model is still calling
+// tools after Agent.MaxToolIterations rounds.
+var ErrToolLoopLimit = errors.New("llmagent: tool loop did not finish within the iteration limit")
+
+// ToolStep is one tool call RunTools executed.
+type ToolStep struct {
+	Iteration int
+	Call      ToolCall
+	Result    string // as sent back to the model
+	Err       error  // the tool's error, also reported to the model
+	Duration  time.Duration
+}
+
+// ToolRun is the outcome of RunTools.
+type ToolRun struct {
+	// Final is the answer that ended the loop.
+	Final CompletionResponse
+	// Messages is the whole conversation, including the tool turns; send
+	// it with the next user message to continue.
+	Messages   []Message
+	Steps      []ToolStep
+	Iterations int
+	Usage      Usage // summed over every completion of the loop
+}
+
+// RunTools completes req with the registry's tools and runs the calls the
+// model makes, sending each result back, until the model answers without
+// calling a tool or MaxToolIterations rounds have passed. The calls of one
+// round run concurrently in a Run of their own; they go through
+// Agent.ToolGuard and their results are cut to Agent.ToolResultLimit.
+// Failing calls, unknown tools and invalid arguments are reported to the
+// model so it can correct itself; a panicking tool ends the loop. On error
+// the partial run is returned alongside it.
+func (a *Agent) RunTools(ctx context.Context, provider string, req CompletionRequest, reg *ToolRegistry) (*ToolRun, error) {
+	req = req.clone()
+	req.Tools = append(req.Tools, reg.Definitions()...)
+	max := a.MaxToolIterations
+	if max <= 0 {
+		max = 8
+	}
+	run := &ToolRun{}
+	for run.Iterations < max {
+		run.Iterations++
+		run.Messages = req.Messages
+		ch, err := a.Complete(ctx, provider, req)
+		if err != nil {
+			return run, err
+		}
+		resp, err := Collect(ch)
+		if resp.Stats != nil {
+			run.Usage.PromptTokens += resp.Stats.PromptTokens
+			run.Usage.CompletionTokens += resp.Stats.CompletionTokens
+			run.Usage.TotalTokens += resp.Stats.TotalTokens
+		}
+		if err != nil {
+			return run, err
+		}
+		if len(resp.ToolCalls) == 0 {
+			run.Final = resp
+			run.Messages = append(req.Messages, Assistant(resp.Content))
+			return run, nil
+		}
+		steps := make([]ToolStep, len(resp.ToolCalls))
+		round := NewRun(ctx)
+		for i, call := range resp.ToolCalls {
+			round.Go(func(ctx context.Context) error {
+				steps[i] = a.runTool(ctx, reg, call)
+				return nil
+			})
+		}
+		if err := round.Wait(); err != nil {
+			return run, err
+		}
+		req.Messages = append(req.Messages, ToolCallsMessage(resp.Content, resp.ToolCalls))
+		for i, step := range steps {
+			step.Iteration = run.Iterations
+			run.Steps = append(run.Steps, step)
+			req.Messages = append(req.Messages, ToolReply(resp.ToolCalls[i], step.Result))
+		}
+		if ctx.Err() != nil {
+			run.Messages = req.Messages
+			return run, ctx.Err()
+		}
+	}
+	run.Messages = req.Messages
+	return run, ErrToolLoopLimit
+}
+
+// runTool executes one call and renders its outcome for the model.
+func (a *Agent) runTool(ctx context.Context, reg *ToolRegistry, call ToolCall) ToolStep {
+	step := ToolStep{Call: call}
+	t, ok := reg.Lookup(call.Name)
+	if !ok {
+		step.Err = fmt.Errorf("unknown tool %q", call.Name)
+		step.Result = fmt.Sprintf("error: there is no tool named %q", call.Name)
+		return step
+	}
+	start := a.clock().Now()
+	result, err := a.ToolGuard.Call(ctx, t, call.ID, call.Arguments)
+	step.Duration = a.clock().Now().Sub(start)
+	step.Err = err
+	var argErr *ArgError
+	switch {
+	case errors.As(err, &argErr):
+		result = argErr.ToolResult()
+	case err != nil:
+		result = "error: " + err.Error()
+	default:
+		result = a.ShrinkToolResult(ctx, call.Name, result, a.ToolResultLimit)
+	}
+	step.Result = result
+	return step
+}
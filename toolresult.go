@@ -0,0 +1,87 @@
+package llmagent
+
+import (
+	"context"
+	"fmt"
+)
+
+// ToolResultLimit caps how much of a tool's output goes into the
+// conversation. Zero limits mean unlimited.
+type ToolResultLimit struct {
+	MaxBytes  int
+	MaxTokens int // estimated, see EstimateTokens
+
+	// Summarize asks a model to condense oversized output instead of
+	// cutting it off; truncation is still the fallback if that fails.
+	Summarize bool
+	Provider  string // summarizer; empty uses the agent's default
+	Model     string
+}
+
+// maxBytes folds both limits into a byte budget.
+func (l ToolResultLimit) maxBytes() int {
+	n := l.MaxBytes
+	if t := l.MaxTokens * 4; t > 0 && (n <= 0 || t < n) {
+		n = t
+	}
+	return n
+}
+
+const toolSummaryPrompt = `Summarize the output of the tool %q below for another model that called the tool and needs its result. Keep every identifier, number, error message and fact that could matter; drop repetition and boilerplate. Answer in at most %d words with the summary only.`
+
+// ShrinkToolResult fits content within limit, truncating it at a natural
+// boundary or summarizing it, and appends a marker saying so. Content that
+// already fits is returned unchanged.
+func (a *Agent) ShrinkToolResult(ctx context.Context, name, content string, limit ToolResultLimit) string {
+	n := limit.maxBytes()
+	if n <= 0 || len(content) <= n {
+		return content
+	}
+	if limit.Summarize {
+		req := CompletionRequest{
+			Model:  limit.Model,
+			Stream: Bool(false),
+			Messages: []Message{
+				System(fmt.Sprintf(toolSummaryPrompt, name, max(n/8, 20))),
+				User(content),
+			},
+		}
+		if ch, err := a.Complete(ctx, limit.Provider, req); err == nil {
+			if resp, err := Collect(ch); err == nil && resp.Content != "" {
+				summary := truncate(resp.Content, n)
+				return fmt.Sprintf("%s\n[summarized from %d bytes of tool output]", summary, len(content))
+			}
+		}
+	}
+	kept := truncate(content, n)
+	return fmt.Sprintf("%s\n[truncated: %d of %d bytes omitted]", kept, len(content)-len(kept), len(content))
+}
+
+// truncate cuts s to at most n bytes, preferring a paragraph, sentence or
+// word boundary.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:cutPoint(s[:n])]
+}
+
+// toolResultLimit is the limit for tool name: its entry in
+// ToolResultLimits, else ToolResults.
+func (s *Session) toolResultLimit(name string) ToolResultLimit {
+	if l, ok := s.ToolResultLimits[name]; ok {
+		return l
+	}
+	return s.ToolResults
+}
+
+// AddToolResult shrinks the output of call to the session's limits and
+// appends it as the reply to call without starting a turn; the next Send
+// carries it to the model. It returns the message as recorded.
+func (s *Session) AddToolResult(ctx context.Context, call ToolCall, content string) Message {
+	msg := ToolReply(call, s.agent.ShrinkToolResult(ctx, call.Name, content, s.toolResultLimit(call.Name)))
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	s.mu.Unlock()
+	return msg
+}
@@ -0,0 +1,73 @@
+package llmagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ToolDefinition describes a function the model may call. Parameters is a
+// JSON Schema object describing the arguments.
+type ToolDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// ToolHandler executes a tool call; the returned string goes back to the
+// model as the tool result.
+type ToolHandler func(ctx context.Context, args json.RawMessage) (string, error)
+
+// ToolFunc is a tool definition with the Go code that runs it.
+type ToolFunc struct {
+	ToolDefinition
+	Handler ToolHandler `json:"-"`
+}
+
+// ToolCall is a complete function call requested by the model. Providers
+// that stream calls in fragments assemble them first, so a ToolCall event
+// always carries the full arguments.
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// ToolChoiceMode says whether and how the model must call a tool.
+type ToolChoiceMode string
+
+const (
+	ToolChoiceAuto ToolChoiceMode = "auto" // the model decides
+	ToolChoiceAny  ToolChoiceMode = "any"  // some tool must be called ("required" on OpenAI)
+	ToolChoiceNone ToolChoiceMode = "none" // no tool may be called
+	ToolChoiceTool ToolChoiceMode = "tool" // the tool in Name must be called
+)
+
+// ToolChoice constrains tool use for a request.
+type ToolChoice struct {
+	Mode ToolChoiceMode `json:"mode"`
+	Name string         `json:"name,omitempty"` // with ToolChoiceTool
+}
+
+// ForceTool makes the model call the named tool, e.g. to get structured
+// output through a tool's schema.
+func ForceTool(name string) *ToolChoice {
+	return &ToolChoice{Mode: ToolChoiceTool, Name: name}
+}
+
+// Check rejects unknown modes and a ToolChoiceTool without a name.
+func (tc *ToolChoice) Check(provider string) error {
+	if tc == nil {
+		return nil
+	}
+	switch tc.Mode {
+	case ToolChoiceAuto, ToolChoiceAny, ToolChoiceNone:
+		return nil
+	case ToolChoiceTool:
+		if tc.Name != "" {
+			return nil
+		}
+		return &ParamError{Provider: provider, Param: "tool_choice", Reason: "needs a tool name"}
+	}
+	return &ParamError{Provider: provider, Param: "tool_choice", Reason: fmt.Sprintf("has unknown mode %q", tc.Mode)}
+}
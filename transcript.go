@@ -0,0 +1,167 @@
+package llmagent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transcript kinds.
+const (
+	EntryModel    = "model"
+	EntryTool     = "tool"
+	EntryDecision = "decision"
+)
+
+// TranscriptEntry is one step of an agent run.
+type TranscriptEntry struct {
+	Kind     string        `json:"kind"`
+	At       time.Time     `json:"at"`
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// model turns
+	Request  *CompletionRequest `json:"request,omitempty"`
+	Response string             `json:"response,omitempty"`
+	Stats    *CompletionStats   `json:"stats,omitempty"`
+
+	// tool invocations
+	Tool   string          `json:"tool,omitempty"`
+	Args   json.RawMessage `json:"args,omitempty"`
+	Result string          `json:"result,omitempty"`
+
+	Note  string `json:"note,omitempty"` // decisions, e.g. "stopping: final answer"
+	Error string `json:"error,omitempty"`
+}
+
+// Transcript records every model turn, tool invocation and decision of an
+// agent run. It is safe for concurrent use and serializes to JSON.
+type Transcript struct {
+	ID      string            `json:"id"`
+	Started time.Time         `json:"started"`
+	Entries []TranscriptEntry `json:"entries"`
+
+	mu sync.Mutex
+}
+
+// NewTranscript starts an empty transcript.
+func NewTranscript() *Transcript {
+	return &Transcript{ID: newSessionID(), Started: time.Now()}
+}
+
+func (t *Transcript) add(e TranscriptEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	t.Entries = append(t.Entries, e)
+}
+
+// RecordModel adds a model turn.
+func (t *Transcript) RecordModel(req CompletionRequest, response string, stats *CompletionStats, d time.Duration, err error) {
+	req = req.clone()
+	e := TranscriptEntry{Kind: EntryModel, Request: &req, Response: response, Stats: stats, Duration: d}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	t.add(e)
+}
+
+// RecordTool adds a tool invocation.
+func (t *Transcript) RecordTool(name string, args json.RawMessage, result string, d time.Duration, err error) {
+	e := TranscriptEntry{Kind: EntryTool, Tool: name, Args: append(json.RawMessage(nil), args...), Result: result, Duration: d}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	t.add(e)
+}
+
+// RecordDecision adds a note about a control-flow decision.
+func (t *Transcript) RecordDecision(note string) {
+	t.add(TranscriptEntry{Kind: EntryDecision, Note: note})
+}
+
+// Track forwards ch and records the completed turn once it ends. A turn
+// cut off by ctx is recorded with ctx's error.
+func (t *Transcript) Track(ctx context.Context, req CompletionRequest, ch <-chan CompletionResponse) <-chan CompletionResponse {
+	start := time.Now()
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		var text strings.Builder
+		var stats *CompletionStats
+		var err error
+		for resp := range ch {
+			text.WriteString(resp.Content)
+			if resp.Err != nil && err == nil {
+				err = resp.Err
+			}
+			if resp.Done {
+				stats = resp.Stats
+			}
+			if !emit(resp) {
+				if err == nil {
+					err = ctx.Err()
+				}
+				break
+			}
+		}
+		t.RecordModel(req, text.String(), stats, time.Since(start), err)
+	})
+}
+
+// MarshalJSON snapshots the transcript under its lock.
+func (t *Transcript) MarshalJSON() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return json.Marshal(&struct {
+		ID      string            `json:"id"`
+		Started time.Time         `json:"started"`
+		Entries []TranscriptEntry `json:"entries"`
+	}{t.ID, t.Started, t.Entries})
+}
+
+// ReplayResult compares one recorded model turn with its replay.
+type ReplayResult struct {
+	Index      int // entry index in the transcript
+	Original   string
+	Replayed   string
+	Stats      *CompletionStats
+	Err        error
+	Similarity float64 // word-set Jaccard similarity
+}
+
+// Replay re-sends every recorded model turn to provider (and model, if
+// non-empty) and compares the answers. Tool results are not re-executed:
+// each turn's request already carries the tool output the original model
+// saw, so replays isolate the model's behavior.
+func (t *Transcript) Replay(ctx context.Context, a *Agent, provider, model string) ([]ReplayResult, error) {
+	t.mu.Lock()
+	entries := append([]TranscriptEntry(nil), t.Entries...)
+	t.mu.Unlock()
+	var results []ReplayResult
+	for i, e := range entries {
+		if e.Kind != EntryModel || e.Request == nil {
+			continue
+		}
+		req := e.Request.clone()
+		req.Stream = Bool(false)
+		if model != "" {
+			req.Model = model
+		}
+		r := ReplayResult{Index: i, Original: e.Response}
+		ch, err := a.Complete(ctx, provider, req)
+		if err == nil {
+			r.Replayed, r.Stats, err = collectStats(ch)
+		}
+		r.Err = err
+		if err == nil {
+			r.Similarity = similarity(r.Original, r.Replayed)
+		}
+		results = append(results, r)
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+	}
+	return results, nil
+}
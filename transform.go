@@ -0,0 +1,213 @@
+package llmagent
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// StreamTransformer rewrites a completion as it streams. Transform gets
+// each delta and returns the text to emit now; it may hold back a suffix
+// (e.g. a partial word) until the next call. Flush returns whatever is
+// still held back when the stream ends. A transformer handles one stream,
+// so they are registered as constructors.
+type StreamTransformer interface {
+	Transform(delta string) string
+	Flush() string
+}
+
+// Transform runs ch through a fresh transformer from each constructor, in
+// order. Events other than plain content deltas (tool calls, metadata,
+// suggestions, the terminal event) pass through after any held-back text
+// has been flushed, with their own text transformed in full. Logprobs stay
+// on the event they arrived with, so they no longer line up with the
+// transformed text.
+func Transform(ch <-chan CompletionResponse, transformers ...func() StreamTransformer) <-chan CompletionResponse {
+	return transform(context.Background(), ch, transformers...)
+}
+
+func transform(ctx context.Context, ch <-chan CompletionResponse, transformers ...func() StreamTransformer) <-chan CompletionResponse {
+	if len(transformers) == 0 {
+		return ch
+	}
+	chain := make([]StreamTransformer, len(transformers))
+	for i, newT := range transformers {
+		chain[i] = newT()
+	}
+	apply := func(text string) string {
+		for _, t := range chain {
+			text = t.Transform(text)
+		}
+		return text
+	}
+	// flush transforms text and everything still held back in full.
+	flush := func(text string) string {
+		for _, t := range chain {
+			text = t.Transform(text) + t.Flush()
+		}
+		return text
+	}
+	return stage(ctx, ch, func(emit func(CompletionResponse) bool) {
+		var provider string
+		for resp := range ch {
+			if resp.Provider != "" {
+				provider = resp.Provider
+			}
+			switch {
+			case plainDelta(resp):
+				if resp.Content = apply(resp.Content); resp.Content == "" {
+					continue // everything was held back
+				}
+			case resp.Content != "":
+				resp.Content = flush(resp.Content)
+			default:
+				if rest := flush(""); rest != "" && !emit(CompletionResponse{Provider: provider, Content: rest}) {
+					return
+				}
+			}
+			if !emit(resp) {
+				return
+			}
+		}
+		if rest := flush(""); rest != "" {
+			emit(CompletionResponse{Provider: provider, Content: rest})
+		}
+	})
+}
+
+// splitTransformer holds back text after the last separator and passes
+// complete pieces through fn.
+type splitTransformer struct {
+	pending strings.Builder
+	cut     func(s string) int // index just past the last complete piece, or -1
+	fn      func(s string) string
+}
+
+func (t *splitTransformer) Transform(delta string) string {
+	t.pending.WriteString(delta)
+	s := t.pending.String()
+	i := t.cut(s)
+	if i < 0 {
+		return ""
+	}
+	t.pending.Reset()
+	t.pending.WriteString(s[i:])
+	return t.fn(s[:i])
+}
+
+func (t *splitTransformer) Flush() string {
+	s := t.pending.String()
+	t.pending.Reset()
+	if s == "" {
+		return ""
+	}
+	return t.fn(s)
+}
+
+// WordTransformer applies fn to every word, holding back a word split
+// across deltas until it is complete. Whitespace is passed through as is.
+func WordTransformer(fn func(word string) string) func() StreamTransformer {
+	return func() StreamTransformer {
+		return &splitTransformer{
+			cut: func(s string) int {
+				i := strings.LastIndexFunc(s, unicode.IsSpace)
+				if i < 0 {
+					return -1
+				}
+				return i + 1
+			},
+			fn: func(s string) string {
+				var b strings.Builder
+				start := -1
+				for i, r := range s {
+					if unicode.IsSpace(r) {
+						if start >= 0 {
+							b.WriteString(fn(s[start:i]))
+							start = -1
+						}
+						b.WriteRune(r)
+					} else if start < 0 {
+						start = i
+					}
+				}
+				if start >= 0 {
+					b.WriteString(fn(s[start:]))
+				}
+				return b.String()
+			},
+		}
+	}
+}
+
+// LineTransformer applies fn to every line (without its newline), holding
+// back the current line until it ends.
+func LineTransformer(fn func(line string) string) func() StreamTransformer {
+	return func() StreamTransformer {
+		return &splitTransformer{
+			cut: func(s string) int {
+				i := strings.LastIndexByte(s, '\n')
+				if i < 0 {
+					return -1
+				}
+				return i + 1
+			},
+			fn: func(s string) string {
+				lines := strings.Split(s, "\n")
+				for i, line := range lines {
+					lines[i] = fn(line)
+				}
+				return strings.Join(lines, "\n")
+			},
+		}
+	}
+}
+
+// MaskWords replaces the given words, case-insensitively and ignoring
+// surrounding punctuation, with asterisks of the same length.
+func MaskWords(words ...string) func() StreamTransformer {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[strings.ToLower(w)] = true
+	}
+	return WordTransformer(func(word string) string {
+		core := strings.TrimFunc(word, unicode.IsPunct)
+		if core == "" || !set[strings.ToLower(core)] {
+			return word
+		}
+		return strings.Replace(word, core, strings.Repeat("*", len([]rune(core))), 1)
+	})
+}
+
+// NormalizeMarkdown trims trailing spaces and rewrites "*" and "+" bullets
+// to "-" line by line.
+func NormalizeMarkdown() func() StreamTransformer {
+	return LineTransformer(func(line string) string {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ ") {
+			indent := line[:len(line)-len(trimmed)]
+			line = indent + "- " + trimmed[2:]
+		}
+		return line
+	})
+}
+
+type runeTransformer func(r rune) rune
+
+func (f runeTransformer) Transform(delta string) string { return strings.Map(f, delta) }
+func (f runeTransformer) Flush() string                 { return "" }
+
+// StripEmoji removes emoji, including joiners and variation selectors.
+func StripEmoji() func() StreamTransformer {
+	return func() StreamTransformer {
+		return runeTransformer(func(r rune) rune {
+			switch {
+			case r >= 0x1F000 && r <= 0x1FAFF, // pictographs, emoticons, flags
+				r >= 0x2600 && r <= 0x27BF, // misc symbols, dingbats
+				r == 0x200D, r == 0xFE0F:
+				return -1
+			}
+			return r
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package llmagent
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	upper := WordTransformer(strings.ToUpper)
+	for _, tc := range []struct {
+		name string
+		in   []CompletionResponse
+		want []string // content per event, "|" for none
+	}{
+		{
+			name: "word split across deltas",
+			in:   []CompletionResponse{{Content: "he"}, {Content: "llo wo"}, {Content: "rld"}, {Done: true}},
+			want: []string{"HELLO ", "WORLD", "|"},
+		},
+		{
+			name: "flushed before a tool call",
+			in: []CompletionResponse{
+				{Content: "let me"},
+				{ToolCalls: []ToolCall{{ID: "1"}}},
+				{Content: " check"},
+				{Done: true},
+			},
+			want: []string{"LET ", "ME", "|", " ", "CHECK", "|"},
+		},
+		{
+			name: "flushed before metadata",
+			in:   []CompletionResponse{{Content: "one tw"}, {Meta: &ResponseMeta{RequestID: "r"}}, {Done: true}},
+			want: []string{"ONE ", "TW", "|", "|"},
+		},
+		{
+			name: "event text transformed in full",
+			in:   []CompletionResponse{{Content: "a b"}, {Content: "c d", Usage: &Usage{}}, {Done: true}},
+			want: []string{"A ", "BC D", "|"},
+		},
+		{
+			name: "flushed before an error",
+			in:   []CompletionResponse{{Content: "cut of"}, {Err: errors.New("boom")}},
+			want: []string{"CUT ", "OF", "|"},
+		},
+		{
+			name: "flushed when the stream ends",
+			in:   []CompletionResponse{{Content: "no done"}},
+			want: []string{"NO ", "DONE"},
+		},
+	} {
+		in := make(chan CompletionResponse, len(tc.in))
+		for _, resp := range tc.in {
+			in <- resp
+		}
+		close(in)
+		if got := contents(Transform(in, upper)); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: events %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTransformChain(t *testing.T) {
+	in := make(chan CompletionResponse, 4)
+	for _, s := range []string{"* Darn", " it \n+ fine", "\n"} {
+		in <- CompletionResponse{Content: s}
+	}
+	in <- CompletionResponse{Done: true}
+	close(in)
+	resp, err := Collect(Transform(in, MaskWords("darn"), NormalizeMarkdown()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "- **** it\n- fine\n"; resp.Content != want {
+		t.Fatalf("content %q, want %q", resp.Content, want)
+	}
+}
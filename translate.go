@@ -0,0 +1,132 @@
+package llmagent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Translator runs completions through a pivot language: the prompt is
+// translated into the pivot (English by default) for models that are weak
+// in the user's language, and the answer is translated back.
+type Translator struct {
+	Agent *Agent
+	// Provider and Model used for detection and translation calls; empty
+	// values use the agent defaults.
+	Provider string
+	Model    string
+}
+
+// TranslateOptions configures a single translated completion.
+type TranslateOptions struct {
+	Pivot          string // language the model answers in, default "en"
+	SourceLanguage string // skip detection when set
+	KeepPivot      bool   // return the pivot-language answer untranslated
+}
+
+// TranslatedResponse is the result of Translator.Complete.
+type TranslatedResponse struct {
+	CompletionResponse
+	Language     string // detected or given source language
+	PivotContent string // the model's answer in the pivot language
+}
+
+// NewTranslator creates a Translator backed by a.
+func NewTranslator(a *Agent) *Translator {
+	return &Translator{Agent: a}
+}
+
+func (t *Translator) ask(ctx context.Context, system, text string) (string, error) {
+	ch, err := t.Agent.Complete(ctx, t.Provider, CompletionRequest{
+		Model:       t.Model,
+		Stream:      new(bool),
+		Temperature: Float64(0),
+		MaxTokens:   max(EstimateTokens(text)*2, 64),
+		Messages: []Message{
+			{Role: RoleSystem, Content: system},
+			{Role: RoleUser, Content: text},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := Collect(ch)
+	return strings.TrimSpace(resp.Content), err
+}
+
+// DetectLanguage returns the ISO 639-1 code of text's language.
+func (t *Translator) DetectLanguage(ctx context.Context, text string) (string, error) {
+	code, err := t.ask(ctx, "Identify the language of the user's text. Reply with its ISO 639-1 code only, in lowercase, and nothing else.", text)
+	if err != nil {
+		return "", err
+	}
+	code = strings.ToLower(strings.Trim(code, " .\"'`\n"))
+	if len(code) < 2 || len(code) > 3 {
+		return "", fmt.Errorf("unexpected language code %q", code)
+	}
+	return code, nil
+}
+
+// Translate translates text from one language to another.
+func (t *Translator) Translate(ctx context.Context, text, from, to string) (string, error) {
+	if from == to {
+		return text, nil
+	}
+	return t.ask(ctx, fmt.Sprintf("Translate the user's text from %s to %s. Preserve formatting, code and proper nouns. Reply with the translation only.", from, to), text)
+}
+
+// Complete answers req through the pivot language. The language is detected
+// from the last user message unless opts.SourceLanguage is set; if it
+// already is the pivot, req is sent unchanged.
+func (t *Translator) Complete(ctx context.Context, providerName string, req CompletionRequest, opts TranslateOptions) (TranslatedResponse, error) {
+	pivot := opts.Pivot
+	if pivot == "" {
+		pivot = "en"
+	}
+	lang := opts.SourceLanguage
+	if lang == "" {
+		last := lastUserMessage(req.Messages)
+		if last == "" {
+			return TranslatedResponse{}, fmt.Errorf("no user message to detect language from")
+		}
+		var err error
+		if lang, err = t.DetectLanguage(ctx, last); err != nil {
+			return TranslatedResponse{}, err
+		}
+	}
+
+	translated := req
+	if lang != pivot {
+		translated.Messages = make([]Message, len(req.Messages))
+		for i, msg := range req.Messages {
+			if msg.Role == RoleUser {
+				content, err := t.Translate(ctx, msg.Content, lang, pivot)
+				if err != nil {
+					return TranslatedResponse{}, err
+				}
+				msg.Content = content
+			}
+			translated.Messages[i] = msg
+		}
+	}
+	ch, err := t.Agent.Complete(ctx, providerName, translated)
+	if err != nil {
+		return TranslatedResponse{}, err
+	}
+	resp, err := Collect(ch)
+	out := TranslatedResponse{CompletionResponse: resp, Language: lang, PivotContent: resp.Content}
+	if err != nil || lang == pivot || opts.KeepPivot {
+		return out, err
+	}
+	out.Content, err = t.Translate(ctx, resp.Content, pivot, lang)
+	return out, err
+}
+
+func lastUserMessage(msgs []Message) string {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == RoleUser {
+			return msgs[i].Content
+		}
+	}
+	return ""
+}
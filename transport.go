@@ -0,0 +1,77 @@
+package llmagent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPClient builds the *http.Client a provider should use, honoring the
+// egress settings in the config: Transport, Proxy, Dialer, LocalAddr and
+// Network.
+func (c *ProviderConfig) HTTPClient() *http.Client {
+	client := &http.Client{Timeout: c.Timeout}
+	if c.Transport != nil {
+		client.Transport = c.Transport
+		return client
+	}
+	if c.Proxy == "" && c.Dialer == nil && c.LocalAddr == "" && c.Network == "" {
+		return client
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Proxy != "" {
+		if u, err := url.Parse(c.Proxy); err == nil {
+			// http(s) and socks5 proxy URLs are all understood by net/http.
+			tr.Proxy = http.ProxyURL(u)
+		} else if c.Logger != nil {
+			c.Logger.Printf("ignoring invalid proxy %q: %v", c.Proxy, err)
+		}
+	}
+	dialer := c.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	}
+	if c.LocalAddr != "" {
+		d := *dialer
+		d.LocalAddr = &net.TCPAddr{IP: net.ParseIP(c.LocalAddr)}
+		dialer = &d
+	}
+	network := c.Network
+	tr.DialContext = func(ctx context.Context, nw, addr string) (net.Conn, error) {
+		if network != "" {
+			nw = network
+		}
+		return dialer.DialContext(ctx, nw, addr)
+	}
+	client.Transport = tr
+	return client
+}
+
+// validateEgress checks the proxy/network settings for Validate.
+func (c *ProviderConfig) validateEgress() []error {
+	var errs []error
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid proxy URL %q", c.Proxy))
+		} else {
+			switch u.Scheme {
+			case "http", "https", "socks5", "socks5h":
+			default:
+				errs = append(errs, fmt.Errorf("unsupported proxy scheme %q", u.Scheme))
+			}
+		}
+	}
+	if c.LocalAddr != "" && net.ParseIP(c.LocalAddr) == nil {
+		errs = append(errs, fmt.Errorf("invalid local address %q", c.LocalAddr))
+	}
+	switch c.Network {
+	case "", "tcp", "tcp4", "tcp6":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported network %q", c.Network))
+	}
+	return errs
+}
@@ -0,0 +1,49 @@
+package llmagent
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// MaxRetryCount is the highest RetryCount accepted by Validate.
+const MaxRetryCount = 10
+
+// Validate checks the config for nonsensical values and returns every
+// problem found joined into one error. A missing default model is only
+// reported to the config's Logger, if any, since requests may still name
+// a model explicitly.
+func (c *ProviderConfig) Validate() error {
+	var errs []error
+	if c.BaseURL != "" {
+		if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid base URL %q", c.BaseURL))
+		}
+	}
+	if c.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout must not be negative, got %s", c.Timeout))
+	}
+	if t := c.DefaultTemperature; t != nil && (*t < 0 || *t > 2) {
+		errs = append(errs, fmt.Errorf("default temperature must be within [0, 2], got %g", *t))
+	}
+	if p := c.DefaultTopP; p != nil && (*p < 0 || *p > 1) {
+		errs = append(errs, fmt.Errorf("default top_p must be within [0, 1], got %g", *p))
+	}
+	if c.DefaultMaxTokens < 0 {
+		errs = append(errs, fmt.Errorf("default max tokens must not be negative, got %d", c.DefaultMaxTokens))
+	}
+	if c.RetryCount < 0 || c.RetryCount > MaxRetryCount {
+		errs = append(errs, fmt.Errorf("retry count must be within [0, %d], got %d", MaxRetryCount, c.RetryCount))
+	}
+	if c.MaxPromptBytes < 0 || c.MaxPromptTokens < 0 || c.MaxResponseBytes < 0 {
+		errs = append(errs, errors.New("size limits must not be negative"))
+	}
+	errs = append(errs, c.validateEgress()...)
+	if c.MaxConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("max concurrency must not be negative, got %d", c.MaxConcurrency))
+	}
+	if c.DefaultModel == "" && c.Logger != nil {
+		c.Logger.Println("llmagent: provider config has no default model; requests must set Model")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,30 @@
+package llmagent
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestValidateNoDefaultModelLogging(t *testing.T) {
+	var std bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&std)
+
+	if err := (&ProviderConfig{}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if std.Len() > 0 {
+		t.Fatalf("Validate wrote to the standard logger: %q", std.String())
+	}
+
+	var own bytes.Buffer
+	cfg := &ProviderConfig{Logger: log.New(&own, "", 0)}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(own.String(), "no default model") {
+		t.Fatalf("config Logger got %q", own.String())
+	}
+}
@@ -0,0 +1,77 @@
+package llmagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Warmer is implemented by providers that can pre-establish connections
+// (DNS lookup, TCP and TLS handshakes) to their API.
+type Warmer interface {
+	Warmup(ctx context.Context) error
+}
+
+// WarmupHTTP opens a pooled connection to baseURL through client by sending
+// a HEAD request. Any HTTP status counts as success: only reaching the
+// server matters.
+func WarmupHTTP(ctx context.Context, client *http.Client, baseURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	// drain so the connection is returned to the pool
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// Warmup pre-establishes connections to every registered provider that
+// implements Warmer, concurrently. Providers named in ping additionally get
+// a one-token completion so any lazy server-side state is primed too.
+func (a *Agent) Warmup(ctx context.Context, ping ...string) error {
+	pinged := make(map[string]bool, len(ping))
+	for _, name := range ping {
+		pinged[name] = true
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	fail := func(name string, err error) {
+		mu.Lock()
+		errs = append(errs, fmt.Errorf("warmup %s: %w", name, err))
+		mu.Unlock()
+	}
+	for _, name := range a.ListProviders() {
+		p, ok := a.provider(name)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w, ok := p.(Warmer); ok {
+				if err := w.Warmup(ctx); err != nil {
+					fail(name, err)
+					return
+				}
+			}
+			if !pinged[name] {
+				return
+			}
+			if err := probe(ctx, p); err != nil {
+				fail(name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
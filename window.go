@@ -0,0 +1,223 @@
+package llmagent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// WindowOptions configures Agent.ProcessLong.
+type WindowOptions struct {
+	Provider    string
+	Model       string
+	Instruction string // what to do with each part, e.g. "Translate into German."
+
+	WindowTokens  int // input per call; defaults to 2000
+	OverlapTokens int // preceding input shown for context only; defaults to 200, negative disables
+	CarryTokens   int // tail of the previous output shown for continuity; defaults to 200, negative disables
+
+	MaxRetries int           // per window on 429/503; defaults to 5
+	RetryDelay time.Duration // initial backoff, doubled per retry; defaults to 2s
+}
+
+func (o *WindowOptions) defaults() {
+	if o.WindowTokens <= 0 {
+		o.WindowTokens = 2000
+	}
+	if o.OverlapTokens == 0 {
+		o.OverlapTokens = 200
+	}
+	if o.CarryTokens == 0 {
+		o.CarryTokens = 200
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = 5
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = 2 * time.Second
+	}
+}
+
+// ProcessLong applies opts.Instruction to text of any length by splitting
+// it into windows and completing them one after another. Each call sees the
+// end of the previous window's input and output so terminology and style
+// carry over. The stitched output is streamed as it is produced, followed
+// by one Done event whose stats cover every window.
+func (a *Agent) ProcessLong(ctx context.Context, text string, opts WindowOptions) (<-chan CompletionResponse, error) {
+	opts.defaults()
+	if opts.Instruction == "" {
+		return nil, fmt.Errorf("window instruction is required")
+	}
+	windows := splitWindows(text, opts.WindowTokens*4)
+	return indexed(ctx, stage(ctx, nil, func(emit func(CompletionResponse) bool) {
+		start := a.clock().Now()
+		total := CompletionStats{Model: opts.Model}
+		var prevIn, prevOut string
+		for i, w := range windows {
+			if i > 0 && !emit(CompletionResponse{Content: w.sep, Role: RoleAssistant}) {
+				return
+			}
+			req := CompletionRequest{
+				Model:    opts.Model,
+				Stream:   Bool(true),
+				Messages: windowMessages(opts, w.text, tail(prevIn, opts.OverlapTokens*4), tail(prevOut, opts.CarryTokens*4)),
+			}
+			req.MaxTokens = max(EstimateTokens(w.text)*2, 256)
+			reply, stats, err := a.completeWindow(ctx, req, opts, emit)
+			if err != nil {
+				emit(CompletionResponse{Err: fmt.Errorf("window %d/%d: %w", i+1, len(windows), err)})
+				return
+			}
+			if stats != nil {
+				total.Provider = stats.Provider
+				total.Model = stats.Model
+				total.PromptTokens += stats.PromptTokens
+				total.CompletionTokens += stats.CompletionTokens
+				total.TotalTokens += stats.TotalTokens
+				total.Estimated = total.Estimated || stats.Estimated
+				if i == 0 {
+					total.TimeToFirstToken = stats.TimeToFirstToken
+				}
+			}
+			prevIn, prevOut = w.text, reply
+		}
+		total.Duration = a.clock().Now().Sub(start)
+		emit(CompletionResponse{Provider: total.Provider, Done: true, FinishReason: FinishStop, Stats: &total})
+	})), nil
+}
+
+// completeWindow streams one window through emit, retrying rate-limited
+// calls with exponential backoff, or after Retry-After if that is longer. Rate limits are only retried before any
+// output was forwarded, so the stitched text never repeats.
+func (a *Agent) completeWindow(ctx context.Context, req CompletionRequest, opts WindowOptions, emit func(CompletionResponse) bool) (string, *CompletionStats, error) {
+	delay := opts.RetryDelay
+	for attempt := 0; ; attempt++ {
+		var reply strings.Builder
+		var stats *CompletionStats
+		ch, err := a.Complete(ctx, opts.Provider, req)
+		if err == nil {
+			for resp := range ch {
+				switch {
+				case resp.Err != nil:
+					if err == nil {
+						err = resp.Err
+					}
+				case resp.Done:
+					stats = resp.Stats
+				case resp.Content != "":
+					reply.WriteString(resp.Content)
+					if !emit(CompletionResponse{Content: resp.Content, Role: resp.Role, Provider: resp.Provider}) {
+						return reply.String(), stats, ctx.Err() // the run was cancelled
+					}
+				}
+			}
+		}
+		if err == nil {
+			return reply.String(), stats, nil
+		}
+		if reply.Len() > 0 || attempt >= opts.MaxRetries || !isRateLimited(err) {
+			return reply.String(), stats, err
+		}
+		wait := delay
+		if d, ok := RetryAfter(ErrorHeader(err), a.clock().Now()); ok {
+			wait = max(wait, d)
+		}
+		t := a.clock().NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return "", nil, ctx.Err()
+		case <-t.C():
+		}
+		delay *= 2
+	}
+}
+
+func isRateLimited(err error) bool {
+	code := StatusCode(err)
+	return code == 429 || code == 503
+}
+
+func windowMessages(opts WindowOptions, text, prevIn, prevOut string) []Message {
+	system := opts.Instruction + "\n\nThe input is one part of a longer document. Process only the part marked CURRENT and reply with its result alone, continuing seamlessly from the previous output."
+	var user strings.Builder
+	if prevIn != "" {
+		fmt.Fprintf(&user, "PREVIOUS INPUT (context only, already processed):\n%s\n\n", prevIn)
+	}
+	if prevOut != "" {
+		fmt.Fprintf(&user, "PREVIOUS OUTPUT (for continuity):\n%s\n\n", prevOut)
+	}
+	fmt.Fprintf(&user, "CURRENT:\n%s", text)
+	return []Message{
+		{Role: RoleSystem, Content: system},
+		{Role: RoleUser, Content: user.String()},
+	}
+}
+
+type window struct {
+	text string
+	sep  string // whitespace that preceded it in the input
+}
+
+// splitWindows cuts text into pieces of at most size bytes, preferring
+// paragraph, then sentence, then word boundaries.
+func splitWindows(text string, size int) []window {
+	var out []window
+	sep := ""
+	for {
+		text = strings.TrimLeftFunc(text, func(r rune) bool {
+			if unicode.IsSpace(r) {
+				sep += string(r)
+				return true
+			}
+			return false
+		})
+		if text == "" {
+			return out
+		}
+		if len(out) == 0 {
+			sep = ""
+		}
+		if len(text) <= size {
+			return append(out, window{text: strings.TrimRightFunc(text, unicode.IsSpace), sep: sep})
+		}
+		piece := text[:cutPoint(text[:size])]
+		trimmed := strings.TrimRightFunc(piece, unicode.IsSpace)
+		out = append(out, window{text: trimmed, sep: sep})
+		text, sep = text[len(piece):], piece[len(trimmed):]
+	}
+}
+
+func cutPoint(s string) int {
+	for _, boundary := range []string{"\n\n", ". ", "\n", " "} {
+		if i := strings.LastIndex(s, boundary); i > len(s)/2 {
+			return i + len(boundary)
+		}
+	}
+	// no boundary in the second half; avoid splitting a UTF-8 sequence
+	i := len(s)
+	for i > 0 && s[i-1]&0xC0 == 0x80 {
+		i--
+	}
+	if i > 0 && s[i-1] >= 0xC0 {
+		i--
+	}
+	return max(i, 1)
+}
+
+// tail returns roughly the last n bytes of s, starting at a word boundary.
+func tail(s string, n int) string {
+	if n <= 0 || s == "" {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	s = s[len(s)-n:]
+	if i := strings.IndexAny(s, " \n"); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
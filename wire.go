@@ -0,0 +1,236 @@
+package llmagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WireVersion is the version of the JSON wire schema produced for
+// CompletionRequest and CompletionResponse. It is bumped on any
+// incompatible change; decoders reject versions newer than they know.
+//
+// Request:
+//
+//	{"version":1,"messages":[{"role":"user","content":"hi"}],"model":"gpt-4",
+//	 "stream":true,"temperature":0,"max_tokens":200,"top_p":1,"stop":["\n"]}
+//
+// Response / stream event ("type" is one of delta, tool_call, usage,
+// suggestions, error, done):
+//
+//	{"version":1,"type":"delta","index":0,"content":"Hel","role":"assistant","provider":"openai"}
+//	{"version":1,"type":"error","index":1,"error":{"message":"...","status_code":429}}
+//	{"version":1,"type":"done","index":2,"finish_reason":"stop","stats":{"provider":"openai",
+//	 "model":"gpt-4","prompt_tokens":9,"completion_tokens":3,"total_tokens":12,
+//	 "duration_ms":812,"time_to_first_token_ms":240}}
+const WireVersion = 1
+
+// FinishReason explains why a completion stopped.
+type FinishReason string
+
+const (
+	FinishStop          FinishReason = "stop"
+	FinishLength        FinishReason = "length"
+	FinishToolCalls     FinishReason = "tool_calls"
+	FinishContentFilter FinishReason = "content_filter"
+	FinishError         FinishReason = "error"
+	// FinishPaused marks a turn the provider paused mid-way, e.g.
+	// Anthropic's pause_turn during long server tool use; sending the
+	// response back as the assistant turn lets the model continue it.
+	FinishPaused FinishReason = "paused"
+)
+
+// Event types carried in the "type" field of a wire response.
+const (
+	EventDelta       = "delta"
+	EventToolCall    = "tool_call"
+	EventUsage       = "usage"
+	EventSuggestions = "suggestions"
+	EventError       = "error"
+	EventDone        = "done"
+)
+
+// WireError is the wire form of a response error. Decoded responses carry
+// it as their Err so the upstream status code survives the round trip.
+type WireError struct {
+	Message    string `json:"message"`
+	StatusCode int    `json:"status_code,omitempty"`
+}
+
+func (e *WireError) Error() string { return e.Message }
+
+// HTTPStatusCode makes StatusCode work on decoded errors.
+func (e *WireError) HTTPStatusCode() int { return e.StatusCode }
+
+type wireRequest struct {
+	Version int `json:"version"`
+	requestAlias
+}
+
+// requestAlias drops CompletionRequest's methods to avoid recursion.
+type requestAlias CompletionRequest
+
+// MarshalJSON encodes the request with the wire version.
+func (c CompletionRequest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(wireRequest{Version: WireVersion, requestAlias: requestAlias(c)})
+}
+
+// UnmarshalJSON decodes a wire request, rejecting unknown versions and
+// roles. A missing version is treated as version 1.
+func (c *CompletionRequest) UnmarshalJSON(data []byte) error {
+	var w wireRequest
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	if w.Version > WireVersion {
+		return fmt.Errorf("unsupported wire version %d", w.Version)
+	}
+	if err := validateMessages(w.Messages); err != nil {
+		return err
+	}
+	*c = CompletionRequest(w.requestAlias)
+	return nil
+}
+
+type wireStats struct {
+	Usage
+	Provider           string     `json:"provider"`
+	Model              string     `json:"model"`
+	DurationMs         int64      `json:"duration_ms"`
+	TimeToFirstTokenMs int64      `json:"time_to_first_token_ms"`
+	Estimated          bool       `json:"estimated,omitempty"`
+	Cached             bool       `json:"cached,omitempty"`
+	RequestID          string     `json:"request_id,omitempty"`
+	RateLimit          *RateLimit `json:"rate_limit,omitempty"`
+	Tags               []string   `json:"tags,omitempty"`
+}
+
+// MarshalJSON encodes durations as integer milliseconds.
+func (s CompletionStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(wireStats{
+		Usage:              s.Usage,
+		Provider:           s.Provider,
+		Model:              s.Model,
+		DurationMs:         s.Duration.Milliseconds(),
+		TimeToFirstTokenMs: s.TimeToFirstToken.Milliseconds(),
+		Estimated:          s.Estimated,
+		Cached:             s.Cached,
+		RequestID:          s.RequestID,
+		RateLimit:          s.RateLimit,
+		Tags:               s.Tags,
+	})
+}
+
+// UnmarshalJSON decodes the millisecond wire form.
+func (s *CompletionStats) UnmarshalJSON(data []byte) error {
+	var w wireStats
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	*s = CompletionStats{
+		Usage:            w.Usage,
+		Provider:         w.Provider,
+		Model:            w.Model,
+		Duration:         time.Duration(w.DurationMs) * time.Millisecond,
+		TimeToFirstToken: time.Duration(w.TimeToFirstTokenMs) * time.Millisecond,
+		Estimated:        w.Estimated,
+		Cached:           w.Cached,
+		RequestID:        w.RequestID,
+		RateLimit:        w.RateLimit,
+		Tags:             w.Tags,
+	}
+	return nil
+}
+
+type wireResponse struct {
+	Version      int              `json:"version"`
+	Type         string           `json:"type"`
+	Index        int              `json:"index"`
+	Content      string           `json:"content,omitempty"`
+	Role         Role             `json:"role,omitempty"`
+	Error        *WireError       `json:"error,omitempty"`
+	Provider     string           `json:"provider,omitempty"`
+	Cached       bool             `json:"cached,omitempty"`
+	Usage        *Usage           `json:"usage,omitempty"`
+	FinishReason FinishReason     `json:"finish_reason,omitempty"`
+	Stats        *CompletionStats `json:"stats,omitempty"`
+	Citations    []Citation       `json:"citations,omitempty"`
+	Logprobs     []TokenLogprob   `json:"logprobs,omitempty"`
+	ToolCalls    []ToolCall       `json:"tool_calls,omitempty"`
+	Suggested    []string         `json:"suggested_questions,omitempty"`
+	Degraded     bool             `json:"degraded,omitempty"`
+}
+
+// EventType classifies the response as delta, tool_call, usage,
+// suggestions, error or done.
+func (c CompletionResponse) EventType() string {
+	switch {
+	case c.Err != nil:
+		return EventError
+	case c.Done:
+		return EventDone
+	case c.Content == "" && len(c.ToolCalls) > 0:
+		return EventToolCall
+	case c.Content == "" && len(c.SuggestedQuestions) > 0:
+		return EventSuggestions
+	case c.Content == "" && c.Usage != nil:
+		return EventUsage
+	}
+	return EventDelta
+}
+
+// MarshalJSON encodes the response as a versioned wire event.
+func (c CompletionResponse) MarshalJSON() ([]byte, error) {
+	w := wireResponse{
+		Version:      WireVersion,
+		Type:         c.EventType(),
+		Index:        c.Index,
+		Content:      c.Content,
+		Role:         c.Role,
+		Provider:     c.Provider,
+		Cached:       c.Cached,
+		Usage:        c.Usage,
+		FinishReason: c.FinishReason,
+		Stats:        c.Stats,
+		Citations:    c.Citations,
+		Logprobs:     c.Logprobs,
+		ToolCalls:    c.ToolCalls,
+		Suggested:    c.SuggestedQuestions,
+		Degraded:     c.Degraded,
+	}
+	if c.Err != nil {
+		w.Error = &WireError{Message: c.Err.Error(), StatusCode: StatusCode(c.Err)}
+	}
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON decodes a wire event; errors come back as *WireError.
+func (c *CompletionResponse) UnmarshalJSON(data []byte) error {
+	var w wireResponse
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	if w.Version > WireVersion {
+		return fmt.Errorf("unsupported wire version %d", w.Version)
+	}
+	*c = CompletionResponse{
+		Content:            w.Content,
+		Role:               w.Role,
+		Index:              w.Index,
+		Provider:           w.Provider,
+		Cached:             w.Cached,
+		Usage:              w.Usage,
+		FinishReason:       w.FinishReason,
+		Done:               w.Type == EventDone,
+		Stats:              w.Stats,
+		Citations:          w.Citations,
+		Logprobs:           w.Logprobs,
+		ToolCalls:          w.ToolCalls,
+		SuggestedQuestions: w.Suggested,
+		Degraded:           w.Degraded,
+	}
+	if w.Error != nil {
+		c.Err = w.Error
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package llmagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got, indented, with testdata/wire/name.json, rewriting
+// the file under -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, got, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteByte('\n')
+	path := filepath.Join("testdata", "wire", name+".json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("%s changed:\n%s\nwant:\n%s", path, buf.Bytes(), want)
+	}
+}
+
+func wireRequests() map[string]CompletionRequest {
+	return map[string]CompletionRequest{
+		"request_minimal": {
+			Messages: []Message{{Role: RoleUser, Content: "hi"}},
+		},
+		"request_full": {
+			Messages: []Message{
+				{Role: RoleSystem, Content: "Be terse."},
+				{Role: RoleUser, Content: "Weather in Oslo?", Name: "ana"},
+				{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "weather", Arguments: json.RawMessage(`{"city":"Oslo"}`)}}},
+				{Role: RoleTool, Content: "4°C, rain", ToolCallID: "call_1"},
+			},
+			Model:             "gpt-4o",
+			Stream:            Bool(true),
+			Temperature:       Float64(0),
+			MaxTokens:         200,
+			TopP:              Float64(1),
+			Stop:              []string{"\n"},
+			Documents:         []Document{{ID: "d1", Source: "https://example.com/oslo", Title: "Oslo", Content: "Oslo is the capital of Norway.", Metadata: map[string]string{"lang": "en"}}},
+			Seed:              new(int),
+			Logprobs:          true,
+			Tools:             []ToolDefinition{{Name: "weather", Description: "Current weather", Parameters: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`)}},
+			ToolChoice:        ForceTool("weather"),
+			ParallelToolCalls: Bool(false),
+			Tags:              []string{"feature:chat"},
+			SuggestQuestions:  2,
+			Extra:             map[string]any{"user": "u-1"},
+		},
+	}
+}
+
+func wireEvents() map[string]CompletionResponse {
+	return map[string]CompletionResponse{
+		"event_delta": {Content: "Hel", Role: RoleAssistant, Provider: "openai", Logprobs: []TokenLogprob{{Token: "Hel", Logprob: -0.25}}},
+		"event_tool_call": {
+			Index:     1,
+			Role:      RoleAssistant,
+			Provider:  "claude",
+			ToolCalls: []ToolCall{{ID: "toolu_1", Name: "weather", Arguments: json.RawMessage(`{"city":"Oslo"}`)}},
+		},
+		"event_usage":       {Index: 2, Provider: "openai", Usage: &Usage{PromptTokens: 9, CompletionTokens: 3, TotalTokens: 12}},
+		"event_suggestions": {Index: 3, SuggestedQuestions: []string{"And tomorrow?", "In Bergen?"}},
+		"event_error":       {Index: 1, Err: &WireError{Message: "HTTP Too Many Requests: slow down", StatusCode: http.StatusTooManyRequests}},
+		"event_done": {
+			Index:        4,
+			Provider:     "openai",
+			Done:         true,
+			FinishReason: FinishStop,
+			Citations:    []Citation{{Index: 1, DocumentID: "d1", Source: "https://example.com/oslo", Title: "Oslo"}},
+			Stats: &CompletionStats{
+				Usage:            Usage{PromptTokens: 9, CompletionTokens: 3, TotalTokens: 12},
+				Provider:         "openai",
+				Model:            "gpt-4o",
+				Duration:         812 * time.Millisecond,
+				TimeToFirstToken: 240 * time.Millisecond,
+				RequestID:        "req_123",
+				RateLimit: &RateLimit{
+					RemainingRequests: 99, RemainingTokens: 9000, LimitRequests: 100, LimitTokens: 10000,
+					ResetRequests: time.Date(2025, 1, 1, 0, 0, 1, 0, time.UTC),
+				},
+				Tags: []string{"feature:chat"},
+			},
+		},
+		"event_done_cached":   {Index: 1, Provider: "openai", Cached: true, Done: true, FinishReason: FinishLength},
+		"event_done_degraded": {Index: 1, Done: true, Degraded: true, FinishReason: FinishError},
+	}
+}
+
+func TestWireRequestGolden(t *testing.T) {
+	for name, req := range wireRequests() {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, name, data)
+
+			var back CompletionRequest
+			if err := json.Unmarshal(data, &back); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(normalize(t, back), normalize(t, req)) {
+				t.Fatalf("round trip changed the request:\n%+v\nwant\n%+v", back, req)
+			}
+		})
+	}
+}
+
+func TestWireEventGolden(t *testing.T) {
+	for name, ev := range wireEvents() {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, name, data)
+
+			var back CompletionResponse
+			if err := json.Unmarshal(data, &back); err != nil {
+				t.Fatal(err)
+			}
+			again, err := json.Marshal(back)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Fatalf("round trip changed the event:\n%s\nwant\n%s", again, data)
+			}
+			if back.EventType() != ev.EventType() {
+				t.Fatalf("event type %q after round trip, want %q", back.EventType(), ev.EventType())
+			}
+		})
+	}
+}
+
+// TestWireEnumsGolden pins the enum values non-Go clients switch on.
+func TestWireEnumsGolden(t *testing.T) {
+	enums := map[string]any{
+		"version":        WireVersion,
+		"roles":          []Role{RoleSystem, RoleUser, RoleAssistant, RoleTool},
+		"finish_reasons": []FinishReason{FinishStop, FinishLength, FinishToolCalls, FinishContentFilter, FinishError, FinishPaused},
+		"event_types":    []string{EventDelta, EventToolCall, EventUsage, EventSuggestions, EventError, EventDone},
+		"tool_choice":    []ToolChoiceMode{ToolChoiceAuto, ToolChoiceAny, ToolChoiceNone, ToolChoiceTool},
+	}
+	data, err := json.Marshal(enums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "enums", data)
+}
+
+func TestWireDecode(t *testing.T) {
+	var req CompletionRequest
+	if err := json.Unmarshal([]byte(`{"messages":[{"role":"user","content":"hi"}]}`), &req); err != nil {
+		t.Fatalf("request without version: %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"version":2,"messages":[]}`), &req); err == nil {
+		t.Fatal("request with a newer version decoded")
+	}
+	if err := json.Unmarshal([]byte(`{"version":1,"messages":[{"role":"robot","content":"hi"}]}`), &req); err == nil {
+		t.Fatal("request with an unknown role decoded")
+	}
+
+	var ev CompletionResponse
+	if err := json.Unmarshal([]byte(`{"version":2,"type":"delta","index":0}`), &ev); err == nil {
+		t.Fatal("event with a newer version decoded")
+	}
+	if err := json.Unmarshal([]byte(`{"version":1,"type":"error","index":3,"error":{"message":"boom","status_code":503}}`), &ev); err != nil {
+		t.Fatal(err)
+	}
+	var we *WireError
+	if !errors.As(ev.Err, &we) || StatusCode(ev.Err) != http.StatusServiceUnavailable || ev.Index != 3 {
+		t.Fatalf("decoded error event = %+v", ev)
+	}
+}
+
+// normalize compares requests by their JSON fields, so nil and empty
+// collections and json.RawMessage spacing don't matter.
+func normalize(t *testing.T, req CompletionRequest) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}